@@ -3,6 +3,8 @@ Redis中双端链表实现的简单仿写
 */
 package datastruct
 
+import "iter"
+
 const (
 	// 从表头向表尾进行迭代
 	AL_START_HEAD = iota
@@ -11,104 +13,104 @@ const (
 )
 
 // 双端链表节点
-type listNode struct {
+type listNode[T any] struct {
 	// 前置节点
-	prev *listNode
+	prev *listNode[T]
 	// 后置节点
-	next *listNode
+	next *listNode[T]
 	// 节点的值
-	value interface{}
+	value T
 }
 
 // 双端链表迭代器
-type listIter struct {
+type listIter[T any] struct {
 	// 当前迭代到的节点
-	next *listNode
+	next *listNode[T]
 	// 迭代的方向
 	direction int
 }
 
 // 双端链表结构
-type List struct {
+type List[T any] struct {
 	// 表头节点
-	head *listNode
+	head *listNode[T]
 	// 表尾节点
-	tail *listNode
+	tail *listNode[T]
 	// 节点值复制函数
-	dup func(value interface{}) interface{}
+	dup func(value T) T
 	// 节点值释放函数
-	free func()
+	free func(value T)
 	// 节点值对比函数
-	match func(value1 interface{}, value2 interface{}) bool
+	match func(value T, key T) bool
 	// 链表所包含的节点数量
 	len int
 }
 
 // 返回链表所包含的节点数量
-func (list *List) ListLength() int {
+func (list *List[T]) ListLength() int {
 	return list.len
 }
 
 // 返回给定链表的表头节点
-func (list *List) ListFirst() *listNode {
+func (list *List[T]) ListFirst() *listNode[T] {
 	return list.head
 }
 
 // 返回给定链表的表尾节点
-func (list *List) ListLast() *listNode {
+func (list *List[T]) ListLast() *listNode[T] {
 	return list.tail
 }
 
 // 返回给定节点的前置节点
-func (list *listNode) ListPrevNode() *listNode {
+func (list *listNode[T]) ListPrevNode() *listNode[T] {
 	return list.prev
 }
 
 // 返回给定节点的后置位置
-func (list *listNode) ListNextNode() *listNode {
+func (list *listNode[T]) ListNextNode() *listNode[T] {
 	return list.next
 }
 
 // 返回给定节点的值
-func (list *listNode) ListNodeValue() interface{} {
+func (list *listNode[T]) ListNodeValue() T {
 	return list.value
 }
 
 // 设置链表的值复制函数为f
-func (list *List) ListSetDupMethod(f func(value interface{}) interface{}) {
+func (list *List[T]) ListSetDupMethod(f func(value T) T) {
 	list.dup = f
 }
 
 // 设置链表的值释放函数为f
-func (list *List) ListSetFreeMethod(f func()) {
+func (list *List[T]) ListSetFreeMethod(f func(value T)) {
 	list.free = f
 }
 
 // 设置链表的对比函数为f
-func (list *List) ListSetMatchMethod(f func(value1 interface{}, value2 interface{}) bool) {
+func (list *List[T]) ListSetMatchMethod(f func(value T, key T) bool) {
 	list.match = f
 }
 
 // 返回链表的值复制函数
-func (list *List) ListGetDupMethod() func(value interface{}) interface{} {
+func (list *List[T]) ListGetDupMethod() func(value T) T {
 	return list.dup
 }
 
 // 返回链表的值释放函数
-func (list *List) ListGetFree() func() {
+func (list *List[T]) ListGetFree() func(value T) {
 	return list.free
 }
 
 // 返回链表的值对比函数
-func (list *List) ListGetMatchMethod() func(value1 interface{}, value2 interface{}) bool {
+func (list *List[T]) ListGetMatchMethod() func(value T, key T) bool {
 	return list.match
 }
 
 //===========================================================
 
 // 创建一个新的链表
-func ListCreate() (list *List, err error) {
-	list = &List{}
+func ListCreate[T any]() (list *List[T], err error) {
+	list = &List[T]{}
 	list.head, list.tail = nil, nil
 	list.dup, list.free = nil, nil
 	list.len = 0
@@ -117,7 +119,13 @@ func ListCreate() (list *List, err error) {
 }
 
 // 释放整个链表，以及链表中的所有节点
-func ListEmpty(list *List) {
+// 设置了值释放函数时，对每个节点的值调用释放函数
+func ListEmpty[T any](list *List[T]) {
+	if list.free != nil {
+		for node := list.head; node != nil; node = node.next {
+			list.free(node.value)
+		}
+	}
 	list.head, list.tail = nil, nil
 	list.dup, list.free = nil, nil
 	list.len = 0
@@ -125,8 +133,8 @@ func ListEmpty(list *List) {
 }
 
 // 添加节点到表头，头插法
-func (list *List) ListAddNodeHead(value interface{}) {
-	node := &listNode{}
+func (list *List[T]) ListAddNodeHead(value T) {
+	node := &listNode[T]{}
 	node.value = value
 	if list.len == 0 {
 		list.head, list.tail = node, node
@@ -141,8 +149,8 @@ func (list *List) ListAddNodeHead(value interface{}) {
 }
 
 // 添加节点到表尾，尾插法
-func (list *List) ListAddNodeTail(value interface{}) {
-	node := &listNode{}
+func (list *List[T]) ListAddNodeTail(value T) {
+	node := &listNode[T]{}
 	node.value = value
 	if list.len == 0 {
 		list.head, list.tail = node, node
@@ -159,8 +167,8 @@ func (list *List) ListAddNodeTail(value interface{}) {
 // 创建一个新节点，将其添加到 oldNode 节点之前或之后
 // 如果 after 为 0，添加到 oldNode 节点之前
 // 如果 after 为 1，添加到 oldNode 节点之后
-func (list *List) ListInsertNode(oldNode *listNode, value interface{}, after int) {
-	node := &listNode{}
+func (list *List[T]) ListInsertNode(oldNode *listNode[T], value T, after int) {
+	node := &listNode[T]{}
 	node.value = value
 	// 添加到给定节点之后
 	if after == 1 {
@@ -192,7 +200,16 @@ func (list *List) ListInsertNode(oldNode *listNode, value interface{}, after int
 }
 
 // 删除指定节点
-func (list *List) ListDelNode(node *listNode) {
+// 设置了值释放函数时，对节点的值调用释放函数
+func (list *List[T]) ListDelNode(node *listNode[T]) {
+	list.ListUnlinkNode(node)
+	if list.free != nil {
+		list.free(node.value)
+	}
+}
+
+// 将节点从链表中移除，但不释放节点的值
+func (list *List[T]) ListUnlinkNode(node *listNode[T]) {
 	if node.prev != nil {
 		node.prev.next = node.next
 	} else {
@@ -205,14 +222,15 @@ func (list *List) ListDelNode(node *listNode) {
 		list.tail = node.prev
 	}
 
+	node.prev, node.next = nil, nil
 	list.len--
 }
 
 // 为链表创建一个迭代器
 // direction  AL_START_HEAD ：从表头向表尾迭代
 // direction  AL_START_TAIL ：从表尾向表头迭代
-func (list *List) ListGetIterator(direction int) *listIter {
-	iter := &listIter{}
+func (list *List[T]) ListGetIterator(direction int) *listIter[T] {
+	iter := &listIter[T]{}
 	if direction == AL_START_HEAD {
 		iter.next = list.head
 	} else {
@@ -223,26 +241,27 @@ func (list *List) ListGetIterator(direction int) *listIter {
 }
 
 // 释放迭代器
-func ListReleaseIterator(iter *listIter) {
+func ListReleaseIterator[T any](iter *listIter[T]) {
 	// 由于垃圾回收，不需要此方法
 }
 
 // 将迭代器的方向设置为 AL_START_HEAD
 // 并将迭代器的指针重新指向表头节点
-func (list *List) ListRewind(li *listIter) {
+func (list *List[T]) ListRewind(li *listIter[T]) {
 	li.next = list.head
 	li.direction = AL_START_HEAD
 }
 
 // 将迭代器的方向设置为 AL_START_TAIL
 // 并将迭代器的指针重新指向表尾节点
-func (list *List) ListRewindTail(li *listIter) {
+func (list *List[T]) ListRewindTail(li *listIter[T]) {
 	li.next = list.tail
 	li.direction = AL_START_TAIL
 }
 
 // 返回迭代器当前所指向的节点
-func ListNext(iter *listIter) *listNode {
+// 可以删除返回的节点，但不能删除其他节点
+func ListNext[T any](iter *listIter[T]) *listNode[T] {
 	current := iter.next
 	if current != nil {
 		if iter.direction == AL_START_HEAD {
@@ -254,9 +273,37 @@ func ListNext(iter *listIter) *listNode {
 	return current
 }
 
+// 从表头向表尾遍历链表中的值
+// 遍历时可以删除当前值所在的节点
+//
+//	for v := range list.All() { ... }
+func (list *List[T]) All() iter.Seq[T] {
+	return func(yield func(T) bool) {
+		iter := list.ListGetIterator(AL_START_HEAD)
+		for node := ListNext(iter); node != nil; node = ListNext(iter) {
+			if !yield(node.value) {
+				return
+			}
+		}
+	}
+}
+
+// 从表尾向表头遍历链表中的值
+// 遍历时可以删除当前值所在的节点
+func (list *List[T]) Backward() iter.Seq[T] {
+	return func(yield func(T) bool) {
+		iter := list.ListGetIterator(AL_START_TAIL)
+		for node := ListNext(iter); node != nil; node = ListNext(iter) {
+			if !yield(node.value) {
+				return
+			}
+		}
+	}
+}
+
 // 复制整个链表
-func (list *List) ListDup() *List {
-	newList, err := ListCreate()
+func (list *List[T]) ListDup() *List[T] {
+	newList, err := ListCreate[T]()
 	if err != nil {
 		return nil
 	}
@@ -267,14 +314,10 @@ func (list *List) ListDup() *List {
 	iter := list.ListGetIterator(AL_START_HEAD)
 	node := ListNext(iter)
 	for node != nil {
-		var value interface{}
+		var value T
 		// 如果有复制函数，则使用复制函数复制值
 		if newList.dup != nil {
 			value = newList.dup(node.value)
-			if value == nil {
-				newList = nil
-				return nil
-			}
 		} else {
 			value = node.value
 		}
@@ -288,9 +331,10 @@ func (list *List) ListDup() *List {
 
 // 查询链表中的key值节点
 // 对比操作由链表的 match 函数负责进行
-// 如果没有设置 match 函数，则直接比较值
+// 如果没有设置 match 函数，则直接使用 == 比较值，此时 T 必须是可比较的类型，
+// 例如 sds 这样的切片类型必须设置 match 函数
 // 匹配成功返回第一个匹配的节点，否则返回nil
-func (list *List) ListSearchKey(key interface{}) *listNode {
+func (list *List[T]) ListSearchKey(key T) *listNode[T] {
 	iter := list.ListGetIterator(AL_START_HEAD)
 	node := ListNext(iter)
 	for node != nil {
@@ -299,7 +343,7 @@ func (list *List) ListSearchKey(key interface{}) *listNode {
 				return node
 			}
 		} else {
-			if key == node.value {
+			if any(key) == any(node.value) {
 				return node
 			}
 		}
@@ -310,8 +354,8 @@ func (list *List) ListSearchKey(key interface{}) *listNode {
 
 // 返回链表在给定索引上的值
 // 索引可以为负数，超出索引范围返回nil
-func (list *List) ListIndex(index int) *listNode {
-	var n *listNode
+func (list *List[T]) ListIndex(index int) *listNode[T] {
+	var n *listNode[T]
 	// 如果索引为负数，从表尾开始查找
 	if index < 0 {
 		index = (-index) - 1
@@ -331,7 +375,7 @@ func (list *List) ListIndex(index int) *listNode {
 }
 
 // 取出链表的表尾节点，并将它移动到表头，成为新的表头节点
-func (list *List) ListRotate() {
+func (list *List[T]) ListRotate() {
 	tail := list.tail
 	if list.ListLength() <= 1 {
 		return
@@ -348,7 +392,7 @@ func (list *List) ListRotate() {
 }
 
 // 将 o 中的元素全部迁移到当前链表的末尾
-func (l *List) ListJoin(o *List) {
+func (l *List[T]) ListJoin(o *List[T]) {
 	if o.head != nil {
 		o.head.prev = l.tail
 	}
@@ -366,3 +410,63 @@ func (l *List) ListJoin(o *List) {
 
 	o.head, o.tail, o.len = nil, nil, 0
 }
+
+// 从 node 节点处将链表分割为两个链表
+// node 及其之后的节点迁移到新的链表中并返回，新链表使用与当前链表相同的复制、释放和对比函数
+// node 必须是当前链表中的节点
+func (list *List[T]) ListSplit(node *listNode[T]) *List[T] {
+	newList, _ := ListCreate[T]()
+	newList.dup = list.dup
+	newList.free = list.free
+	newList.match = list.match
+
+	// 统计迁移的节点数量
+	n := 0
+	for cur := node; cur != nil; cur = cur.next {
+		n++
+	}
+
+	newList.head, newList.tail = node, list.tail
+	newList.len = n
+	if node.prev != nil {
+		node.prev.next = nil
+		list.tail = node.prev
+	} else {
+		list.head, list.tail = nil, nil
+	}
+	node.prev = nil
+	list.len -= n
+	return newList
+}
+
+// 将 o 中的元素全部迁移到 oldNode 节点之前或之后，迁移后 o 为空链表
+// 如果 after 为 0，添加到 oldNode 节点之前
+// 如果 after 为 1，添加到 oldNode 节点之后
+func (list *List[T]) ListSplice(oldNode *listNode[T], o *List[T], after int) {
+	if o.len == 0 {
+		return
+	}
+
+	var prev, next *listNode[T]
+	if after == 1 {
+		prev, next = oldNode, oldNode.next
+	} else {
+		prev, next = oldNode.prev, oldNode
+	}
+
+	o.head.prev = prev
+	o.tail.next = next
+	if prev != nil {
+		prev.next = o.head
+	} else {
+		list.head = o.head
+	}
+	if next != nil {
+		next.prev = o.tail
+	} else {
+		list.tail = o.tail
+	}
+	list.len += o.len
+
+	o.head, o.tail, o.len = nil, nil, 0
+}
@@ -1,18 +1,19 @@
 package datastruct
 
 import (
+	"slices"
 	"testing"
 )
 
 func TestListCreate(t *testing.T) {
-	list, err := ListCreate()
+	list, err := ListCreate[string]()
 	if err != nil || list.ListLength() != 0 || list.head != nil {
 		t.Error("create list fail")
 	}
 }
 
 func TestListEmpty(t *testing.T) {
-	list, err := ListCreate()
+	list, err := ListCreate[int]()
 	if err != nil || list.ListLength() != 0 || list.head != nil {
 		t.Error("create list fail")
 		return
@@ -25,7 +26,7 @@ func TestListEmpty(t *testing.T) {
 }
 
 func TestList_ListAddNodeHead(t *testing.T) {
-	list, _ := ListCreate()
+	list, _ := ListCreate[string]()
 	list.ListAddNodeHead("123")
 	list.ListAddNodeHead("456")
 	list.ListAddNodeHead("abc")
@@ -39,7 +40,7 @@ func TestList_ListAddNodeHead(t *testing.T) {
 }
 
 func TestList_ListAddNodeTail(t *testing.T) {
-	list, _ := ListCreate()
+	list, _ := ListCreate[string]()
 	list.ListAddNodeTail("123")
 	list.ListAddNodeTail("456")
 	list.ListAddNodeTail("abc")
@@ -53,7 +54,7 @@ func TestList_ListAddNodeTail(t *testing.T) {
 }
 
 func TestList_ListInsertNode(t *testing.T) {
-	list, _ := ListCreate()
+	list, _ := ListCreate[string]()
 	list.ListAddNodeTail("123")
 	list.ListAddNodeTail("456")
 	list.ListAddNodeTail("abc")
@@ -74,7 +75,7 @@ func TestList_ListInsertNode(t *testing.T) {
 }
 
 func TestList_ListDelNode(t *testing.T) {
-	list, _ := ListCreate()
+	list, _ := ListCreate[string]()
 	list.ListAddNodeTail("123")
 	list.ListAddNodeTail("456")
 	list.ListAddNodeTail("abc")
@@ -87,7 +88,7 @@ func TestList_ListDelNode(t *testing.T) {
 }
 
 // 校验list中的元素与切片中的内容是否一致
-func checkList(list *List, expec []string) bool {
+func checkList(list *List[string], expec []string) bool {
 	node := list.head
 	for _, item := range expec {
 		if node.value != item {
@@ -102,7 +103,7 @@ func checkList(list *List, expec []string) bool {
 }
 
 func TestList_ListGetIterator(t *testing.T) {
-	list, _ := ListCreate()
+	list, _ := ListCreate[string]()
 	iterator := list.ListGetIterator(AL_START_HEAD)
 	if iterator == nil {
 		t.Error("ListGetIterator error")
@@ -110,7 +111,7 @@ func TestList_ListGetIterator(t *testing.T) {
 }
 
 func TestList_ListRewind(t *testing.T) {
-	list, _ := ListCreate()
+	list, _ := ListCreate[string]()
 	list.ListAddNodeTail("123")
 	list.ListAddNodeTail("456")
 	iterator := list.ListGetIterator(AL_START_HEAD)
@@ -121,7 +122,7 @@ func TestList_ListRewind(t *testing.T) {
 }
 
 func TestList_ListRewindTail(t *testing.T) {
-	list, _ := ListCreate()
+	list, _ := ListCreate[string]()
 	list.ListAddNodeTail("123")
 	list.ListAddNodeTail("456")
 	iterator := list.ListGetIterator(AL_START_TAIL)
@@ -132,7 +133,7 @@ func TestList_ListRewindTail(t *testing.T) {
 }
 
 func TestListNode_ListNext(t *testing.T) {
-	list, _ := ListCreate()
+	list, _ := ListCreate[string]()
 	strList := []string{"123", "456", "789", "abc"}
 
 	for _, item := range strList {
@@ -159,7 +160,7 @@ func TestListNode_ListNext(t *testing.T) {
 }
 
 func TestList_ListDup(t *testing.T) {
-	list, _ := ListCreate()
+	list, _ := ListCreate[string]()
 	strList := []string{"123", "456", "789", "abc"}
 	for _, item := range strList {
 		list.ListAddNodeTail(item)
@@ -180,7 +181,7 @@ func TestList_ListDup(t *testing.T) {
 }
 
 func TestList_ListSearchKey(t *testing.T) {
-	list, _ := ListCreate()
+	list, _ := ListCreate[string]()
 	strList := []string{"123", "456", "789", "abc"}
 	for _, item := range strList {
 		list.ListAddNodeTail(item)
@@ -199,7 +200,7 @@ func TestList_ListSearchKey(t *testing.T) {
 }
 
 func TestList_ListIndex(t *testing.T) {
-	list, _ := ListCreate()
+	list, _ := ListCreate[string]()
 	strList := []string{"123", "456", "789", "abc"}
 	for _, item := range strList {
 		list.ListAddNodeTail(item)
@@ -222,7 +223,7 @@ func TestList_ListIndex(t *testing.T) {
 }
 
 func TestList_ListRotate(t *testing.T) {
-	list, _ := ListCreate()
+	list, _ := ListCreate[string]()
 	strList := []string{"123", "456", "789", "abc"}
 	for _, item := range strList {
 		list.ListAddNodeTail(item)
@@ -230,16 +231,18 @@ func TestList_ListRotate(t *testing.T) {
 
 	list.ListRotate()
 
-	checkList(list, []string{"abc", "123", "456", "789"})
+	if !checkList(list, []string{"abc", "123", "456", "789"}) {
+		t.Error("ListRotate error")
+	}
 }
 
 func TestList_ListJoin(t *testing.T) {
-	list1, _ := ListCreate()
+	list1, _ := ListCreate[string]()
 	list1.ListAddNodeTail("1")
 	list1.ListAddNodeTail("1")
 	list1.ListAddNodeTail("1")
 
-	list2, _ := ListCreate()
+	list2, _ := ListCreate[string]()
 	list2.ListAddNodeTail("2")
 	list2.ListAddNodeTail("2")
 
@@ -254,3 +257,152 @@ func TestList_ListJoin(t *testing.T) {
 		t.Error("ListJoin error")
 	}
 }
+
+func TestList_All(t *testing.T) {
+	list, _ := ListCreate[string]()
+	strList := []string{"123", "456", "789", "abc"}
+	for _, item := range strList {
+		list.ListAddNodeTail(item)
+	}
+
+	var values []string
+	for v := range list.All() {
+		values = append(values, v)
+	}
+	if !slices.Equal(values, strList) {
+		t.Errorf("All error, got %v", values)
+	}
+
+	values = values[:0]
+	for v := range list.Backward() {
+		values = append(values, v)
+	}
+	if !slices.Equal(values, []string{"abc", "789", "456", "123"}) {
+		t.Errorf("Backward error, got %v", values)
+	}
+
+	// 提前结束遍历
+	values = values[:0]
+	for v := range list.All() {
+		if v == "789" {
+			break
+		}
+		values = append(values, v)
+	}
+	if !slices.Equal(values, []string{"123", "456"}) {
+		t.Errorf("All break error, got %v", values)
+	}
+
+	// 遍历时删除当前节点
+	for v := range list.All() {
+		if v == "456" || v == "abc" {
+			list.ListDelNode(list.ListSearchKey(v))
+		}
+	}
+	if !checkList(list, []string{"123", "789"}) || list.ListLength() != 2 || list.tail.value != "789" {
+		t.Error("All delete error")
+	}
+}
+
+func TestList_Callbacks(t *testing.T) {
+	list, _ := ListCreate[sds]()
+	var freed []string
+	list.ListSetDupMethod(sdsDup)
+	list.ListSetFreeMethod(func(value sds) {
+		freed = append(freed, string(value))
+	})
+	list.ListSetMatchMethod(func(value sds, key sds) bool {
+		return sdsCmp(value, key) == 0
+	})
+	for _, item := range []string{"a", "b", "c"} {
+		list.ListAddNodeTail(sdsNew(item))
+	}
+
+	node := list.ListSearchKey(sdsNew("b"))
+	if node == nil || string(node.value) != "b" {
+		t.Fatal("ListSearchKey with match error")
+	}
+	if list.ListSearchKey(sdsNew("x")) != nil {
+		t.Error("ListSearchKey with match error")
+	}
+
+	dup := list.ListDup()
+	dup.head.value[0] = 'z'
+	if string(list.head.value) != "a" {
+		t.Error("ListDup should use dup method")
+	}
+
+	list.ListDelNode(node)
+	if !slices.Equal(freed, []string{"b"}) {
+		t.Errorf("ListDelNode free error, got %v", freed)
+	}
+	ListEmpty(list)
+	if !slices.Equal(freed, []string{"b", "a", "c"}) {
+		t.Errorf("ListEmpty free error, got %v", freed)
+	}
+}
+
+func TestList_ListSplit(t *testing.T) {
+	tests := []struct {
+		index      int
+		head, tail []string
+	}{
+		{0, nil, []string{"1", "2", "3", "4"}},
+		{2, []string{"1", "2"}, []string{"3", "4"}},
+		{-1, []string{"1", "2", "3"}, []string{"4"}},
+	}
+	for _, tt := range tests {
+		list, _ := ListCreate[string]()
+		for _, item := range []string{"1", "2", "3", "4"} {
+			list.ListAddNodeTail(item)
+		}
+		newList := list.ListSplit(list.ListIndex(tt.index))
+		if !checkList(list, tt.head) || list.ListLength() != len(tt.head) {
+			t.Errorf("ListSplit(%d) head error", tt.index)
+		}
+		if !checkList(newList, tt.tail) || newList.ListLength() != len(tt.tail) {
+			t.Errorf("ListSplit(%d) tail error", tt.index)
+		}
+		if len(tt.head) > 0 && list.tail.value != tt.head[len(tt.head)-1] {
+			t.Errorf("ListSplit(%d) tail pointer error", tt.index)
+		}
+		if newList.head.prev != nil || newList.tail.value != "4" {
+			t.Errorf("ListSplit(%d) new list pointer error", tt.index)
+		}
+	}
+}
+
+func TestList_ListSplice(t *testing.T) {
+	tests := []struct {
+		index, after int
+		want         []string
+	}{
+		{0, 0, []string{"a", "b", "1", "2", "3"}},
+		{0, 1, []string{"1", "a", "b", "2", "3"}},
+		{-1, 1, []string{"1", "2", "3", "a", "b"}},
+		{-1, 0, []string{"1", "2", "a", "b", "3"}},
+	}
+	for _, tt := range tests {
+		list, _ := ListCreate[string]()
+		for _, item := range []string{"1", "2", "3"} {
+			list.ListAddNodeTail(item)
+		}
+		o, _ := ListCreate[string]()
+		o.ListAddNodeTail("a")
+		o.ListAddNodeTail("b")
+
+		list.ListSplice(list.ListIndex(tt.index), o, tt.after)
+		if !checkList(list, tt.want) || list.ListLength() != 5 {
+			t.Errorf("ListSplice(%d, %d) error", tt.index, tt.after)
+		}
+		// 反向遍历检查 prev 指针
+		want := slices.Clone(tt.want)
+		slices.Reverse(want)
+		if got := slices.Collect(list.Backward()); !slices.Equal(got, want) {
+			t.Errorf("ListSplice(%d, %d) backward got %v", tt.index, tt.after, got)
+		}
+		if o.head != nil || o.tail != nil || o.ListLength() != 0 {
+			t.Errorf("ListSplice(%d, %d) source not emptied", tt.index, tt.after)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+/*
+分片的并发安全字典
+由多个 dict 组成，每个分片使用单独的读写锁保护
+*/
+package datastruct
+
+import (
+	"math/bits"
+	"sync"
+	"time"
+)
+
+// 并发字典的默认分片数量
+const CONCURRENT_DICT_DEFAULT_SHARDS = 16
+
+// 计算分片索引时与哈希值相乘的常数，2^64 除以黄金分割比
+const CONCURRENT_DICT_SHARD_MULTIPLIER = 0x9e3779b97f4a7c15
+
+// 并发字典的分片
+type concurrentDictShard[K, V any] struct {
+	mu sync.RWMutex
+	d  *Dict[K, V]
+}
+
+// 分片的并发安全字典
+//
+// 键根据哈希值乘以 CONCURRENT_DICT_SHARD_MULTIPLIER 后的高位分配到各个分片(Fibonacci hashing)，
+// 乘积的高位由哈希值的所有位决定，只有低32位的哈希函数(例如 MurmurHash2)也能均匀分布；
+// 分片内部的字典使用哈希值的低位定位索引，不会因为分片而集中在少数桶中。
+// 查找只持有读锁，并且不会执行单步rehash；
+// 写入和删除持有写锁，依然会像普通字典一样执行单步rehash。
+// 可以通过 StartBackgroundRehash 启动后台协程，在限定的时间内持续推进各分片的 rehash。
+type ConcurrentDict[K, V any] struct {
+	shards []*concurrentDictShard[K, V]
+	// 计算分片索引时哈希值右移的位数
+	shift uint
+	// 哈希函数，与分片字典使用的相同
+	hashFunction func(key K) uint64
+
+	// 后台 rehash 协程的停止信号，由 rehashMu 保护
+	rehashMu sync.Mutex
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// 创建一个并发字典，分片数量会向上取整为2的N次方
+// shards 小于等于0时使用默认的分片数量
+func NewConcurrentDict[K, V any](dtype DictType[K, V], shards int) *ConcurrentDict[K, V] {
+	if shards <= 0 {
+		shards = CONCURRENT_DICT_DEFAULT_SHARDS
+	}
+	// 计算大于等于 shards 的2的N次方
+	n := 1
+	for n < shards {
+		n *= 2
+	}
+	cd := &ConcurrentDict[K, V]{
+		shards:       make([]*concurrentDictShard[K, V], n),
+		shift:        uint(64 - bits.TrailingZeros(uint(n))),
+		hashFunction: dtype.HashFunction,
+	}
+	for i := range cd.shards {
+		cd.shards[i] = &concurrentDictShard[K, V]{d: DictCreate(dtype, nil)}
+	}
+	return cd
+}
+
+// 返回key所在的分片
+func (cd *ConcurrentDict[K, V]) shardFor(key K) *concurrentDictShard[K, V] {
+	// 只有一个分片时右移64位，结果为0
+	return cd.shards[(cd.hashFunction(key)*CONCURRENT_DICT_SHARD_MULTIPLIER)>>cd.shift]
+}
+
+// 将key,value 添加到字典中，key已存在时返回false
+func (cd *ConcurrentDict[K, V]) Add(key K, val V) bool {
+	shard := cd.shardFor(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	return shard.d.Add(key, val)
+}
+
+// 添加或替换key对应的值，key原先不存在时返回true
+func (cd *ConcurrentDict[K, V]) Replace(key K, val V) bool {
+	shard := cd.shardFor(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	return shard.d.Replace(key, val)
+}
+
+// 返回key对应的值，第二个返回值表示key是否存在
+// 只持有读锁，不会执行单步rehash
+func (cd *ConcurrentDict[K, V]) Find(key K) (V, bool) {
+	shard := cd.shardFor(key)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+	he := dictFindNoRehash(shard.d, key)
+	if he == nil {
+		var zero V
+		return zero, false
+	}
+	return he.v.val, true
+}
+
+// 删除key对应的节点，key不存在时返回false
+func (cd *ConcurrentDict[K, V]) Delete(key K) bool {
+	shard := cd.shardFor(key)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	return shard.d.Delete(key)
+}
+
+// 返回字典的已有节点数量
+// 各分片依次加锁统计，并发修改时结果不是某一时刻的精确值
+func (cd *ConcurrentDict[K, V]) Len() int {
+	total := 0
+	for _, shard := range cd.shards {
+		shard.mu.RLock()
+		total += dictSize(shard.d)
+		shard.mu.RUnlock()
+	}
+	return total
+}
+
+// 并发字典快照中的一个键值对
+type ConcurrentDictPair[K, V any] struct {
+	Key K
+	Val V
+}
+
+// 返回字典在某一时刻的一致快照
+// 复制期间同时持有所有分片的读锁，快照中不会出现只完成了一半的并发修改
+func (cd *ConcurrentDict[K, V]) Snapshot() []ConcurrentDictPair[K, V] {
+	// 按固定顺序加锁，避免死锁
+	for _, shard := range cd.shards {
+		shard.mu.RLock()
+	}
+	defer func() {
+		for _, shard := range cd.shards {
+			shard.mu.RUnlock()
+		}
+	}()
+
+	total := 0
+	for _, shard := range cd.shards {
+		total += dictSize(shard.d)
+	}
+	pairs := make([]ConcurrentDictPair[K, V], 0, total)
+	for _, shard := range cd.shards {
+		// 不安全迭代器只读取字典，可以在读锁下使用
+		iter := dictGetIterator(shard.d)
+		for he := dictNext(iter); he != nil; he = dictNext(iter) {
+			pairs = append(pairs, ConcurrentDictPair[K, V]{he.key, he.v.val})
+		}
+		dictReleaseIterator(iter)
+	}
+	return pairs
+}
+
+// 遍历字典的一致快照，fn 返回false时停止遍历
+// 遍历时不持有任何锁，可以在 fn 中修改字典，修改不会反映到本次遍历中
+func (cd *ConcurrentDict[K, V]) Range(fn func(key K, val V) bool) {
+	for _, pair := range cd.Snapshot() {
+		if !fn(pair.Key, pair.Val) {
+			return
+		}
+	}
+}
+
+// 在给定的毫秒内对正在 rehash 的分片进行rehash，返回执行的步数
+func (cd *ConcurrentDict[K, V]) RehashMilliseconds(ms int) int {
+	return cd.RehashMicroseconds(int64(ms) * 1000)
+}
+
+// 在给定的微秒内对正在 rehash 的分片进行rehash，返回执行的步数
+// 时间由所有分片共同使用，用完时剩余的分片留到下次处理
+func (cd *ConcurrentDict[K, V]) RehashMicroseconds(us int64) int {
+	start := timeInMicroseconds()
+	rehashes := 0
+	for _, shard := range cd.shards {
+		remaining := us - (timeInMicroseconds() - start)
+		if remaining < 0 {
+			break
+		}
+		shard.mu.Lock()
+		rehashes += shard.d.dictRehashMicroseconds(remaining)
+		shard.mu.Unlock()
+	}
+	return rehashes
+}
+
+// 对填充率过低的分片缩小哈希表，有分片开始了缩小的 rehash 时返回true
+func (cd *ConcurrentDict[K, V]) ResizeIfNeeded() bool {
+	resized := false
+	for _, shard := range cd.shards {
+		shard.mu.Lock()
+		if dictResizeIfNeeded(shard.d) {
+			resized = true
+		}
+		shard.mu.Unlock()
+	}
+	return resized
+}
+
+// 查看是否有分片正在 rehash
+func (cd *ConcurrentDict[K, V]) IsRehashing() bool {
+	for _, shard := range cd.shards {
+		shard.mu.RLock()
+		rehashing := dictIsRehashing(shard.d)
+		shard.mu.RUnlock()
+		if rehashing {
+			return true
+		}
+	}
+	return false
+}
+
+// 启动后台 rehash 协程，每隔 interval 调用一次 RehashMilliseconds(ms)
+// 通过 dictDisableResize 关闭 rehash 期间跳过，已经启动时不做任何操作
+// 可以与 StopBackgroundRehash 并发调用
+func (cd *ConcurrentDict[K, V]) StartBackgroundRehash(interval time.Duration, ms int) {
+	cd.rehashMu.Lock()
+	defer cd.rehashMu.Unlock()
+	if cd.stop != nil {
+		return
+	}
+	cd.stop = make(chan struct{})
+	cd.wg.Add(1)
+	go func(stop chan struct{}) {
+		defer cd.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if dict_can_resize.Load() == 1 {
+					cd.RehashMilliseconds(ms)
+				}
+			}
+		}
+	}(cd.stop)
+}
+
+// 停止后台 rehash 协程，并等待其退出
+func (cd *ConcurrentDict[K, V]) StopBackgroundRehash() {
+	cd.rehashMu.Lock()
+	defer cd.rehashMu.Unlock()
+	if cd.stop == nil {
+		return
+	}
+	close(cd.stop)
+	cd.wg.Wait()
+	cd.stop = nil
+}
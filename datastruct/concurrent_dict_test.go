@@ -0,0 +1,117 @@
+package datastruct
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConcurrentDict(t *testing.T) {
+	cd := NewConcurrentDict(StringDictType[int](), 5)
+	if len(cd.shards) != 8 {
+		t.Errorf("shards error, %d", len(cd.shards))
+	}
+	cd.StartBackgroundRehash(time.Millisecond, 1)
+	defer cd.StopBackgroundRehash()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 2000; i++ {
+				key := strconv.Itoa(g) + ":" + strconv.Itoa(i)
+				if !cd.Add(key, i) {
+					t.Errorf("Add %s error", key)
+					return
+				}
+				if v, ok := cd.Find(key); !ok || v != i {
+					t.Errorf("Find %s error", key)
+					return
+				}
+				if i%2 == 1 && !cd.Delete(key) {
+					t.Errorf("Delete %s error", key)
+					return
+				}
+			}
+		}(g)
+	}
+	// 写入的同时并发读取快照
+	for i := 0; i < 20; i++ {
+		cd.Range(func(key string, val int) bool { return true })
+	}
+	wg.Wait()
+
+	if cd.Len() != 8000 {
+		t.Errorf("Len error, %d", cd.Len())
+	}
+	if n := len(cd.Snapshot()); n != 8000 {
+		t.Errorf("Snapshot error, %d", n)
+	}
+}
+
+func TestConcurrentDict_FindNoRehash(t *testing.T) {
+	cd := NewConcurrentDict(StringDictType[int](), 1)
+	for i := 0; i < 100; i++ {
+		cd.Add(strconv.Itoa(i), i)
+	}
+	d := cd.shards[0].d
+	for d.dictRehash(100) != 0 {
+	}
+	if d.dictExpand(1024) != DICT_OK || !dictIsRehashing(d) {
+		t.Fatal("dict should be rehashing")
+	}
+	idx := d.rehshidx
+	for i := 0; i < 100; i++ {
+		if _, ok := cd.Find(strconv.Itoa(i)); !ok {
+			t.Fatalf("Find %d error", i)
+		}
+	}
+	if d.rehshidx != idx {
+		t.Error("Find should not rehash")
+	}
+	for cd.RehashMilliseconds(1) > 0 {
+	}
+	if dictIsRehashing(d) || d.ht[0].size != 1024 {
+		t.Error("RehashMilliseconds error")
+	}
+}
+
+// 只有低32位的哈希函数也能把键分散到各个分片
+func TestConcurrentDict_ShardSpread32BitHash(t *testing.T) {
+	dtype := StringDictType[int]()
+	dtype.HashFunction = func(key string) uint64 {
+		return uint64(DictGenHashFunction(dictStringBytes(key)))
+	}
+	cd := NewConcurrentDict(dtype, 16)
+	for i := 0; i < 16000; i++ {
+		cd.Add(strconv.Itoa(i), i)
+	}
+	for i, shard := range cd.shards {
+		// 平均每个分片1000个键
+		if n := dictSize(shard.d); n < 800 || n > 1200 {
+			t.Errorf("shard %d has %d keys", i, n)
+		}
+	}
+	if cd.Len() != 16000 {
+		t.Errorf("Len error, %d", cd.Len())
+	}
+}
+
+func TestConcurrentDict_BackgroundRehashStartStop(t *testing.T) {
+	cd := NewConcurrentDict(StringDictType[int](), 4)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				cd.StartBackgroundRehash(time.Millisecond, 1)
+				cd.StopBackgroundRehash()
+			}
+		}()
+	}
+	wg.Wait()
+	cd.StopBackgroundRehash()
+}
@@ -4,9 +4,15 @@
 package datastruct
 
 import (
-	"errors"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
 	"math/rand"
+	"strings"
+	"sync/atomic"
 	"time"
+	"unsafe"
 )
 
 const (
@@ -17,43 +23,47 @@ const (
 )
 
 // 哈希表节点的值
-type dictValue struct {
-	val interface{}
-	u64 uint64
-	s64 int64
+// 与 C 中的 union 一样，无符号整数、有符号整数和浮点数共用 num 这一个字，
+// 有符号整数按补码保存，浮点数按 IEEE 754 的位保存，通过 dictGet*Val 和 dictSet*Val 读写
+type dictValue[V any] struct {
+	val V
+	num uint64
 }
 
 // 哈希表节点
-type DictEntry struct {
+type DictEntry[K, V any] struct {
 	// 键
-	key interface{}
+	key K
 	// 值
-	v dictValue
+	v dictValue[V]
 	// 指向下一个哈希表节点，hash冲突时生成链表使用
-	next *DictEntry
+	next *DictEntry[K, V]
 }
 
 // 字典类型特定函数
-type dictType struct {
+type DictType[K, V any] struct {
 	// 计算哈希值的函数
-	hashFunction func(key interface{}) int
+	HashFunction func(key K) uint64
 	// 复制键的函数
-	keyDup func(privdata interface{}, key interface{}) interface{}
+	KeyDup func(privdata interface{}, key K) K
 	// 复制值的函数
-	valDup func(privdata interface{}, obj interface{}) interface{}
-	// 对比键的函数
-	keyCompare func(privdata interface{}, key1 interface{}, key2 interface{}) int
+	ValDup func(privdata interface{}, obj V) V
+	// 对比键的函数，相等返回true
+	KeyCompare func(privdata interface{}, key1 K, key2 K) bool
 	// 销毁键的函数
-	keyDestructor func(privdata interface{}, key interface{})
+	KeyDestructor func(privdata interface{}, key K)
 	// 销毁值的函数
-	valDestructor func(privdata interface{}, obj interface{})
+	ValDestructor func(privdata interface{}, obj V)
+	// 节点的值保存在整数字段中而不是 val 中，用作 键->int64 的计数器字典
+	// 此时应当使用 struct{} 作为值的类型，值复制和销毁函数不会被调用
+	IntegerValues bool
 }
 
 // 哈希表
 // 每个字典都使用两个哈希表，从而实现渐进式 rehash（从一个哈希表渐进转到另一个哈希表）
-type dictht struct {
+type dictht[K, V any] struct {
 	// 哈希表数组
-	table []*DictEntry
+	table []*DictEntry[K, V]
 	// 哈希表大小
 	size int
 	// 哈希表大小掩码，用于计算索引值，总是等于 size -1
@@ -61,32 +71,40 @@ type dictht struct {
 	sizemask int
 	// 该哈希表已有节点的数量
 	used int
+	// 哈希表中最长的链表长度，用于公平的随机取样
+	maxchain int
+	// 链表长度的分布，chains[l] 为链表长度为 l 的索引数量，
+	// 插入、删除和 rehash 移动节点时由 dictChainUpdate 增量地维护，maxchain 随之增减
+	chains []int
 }
 
 // 字典
-type dict struct {
+type Dict[K, V any] struct {
 	// 类型特定函数
-	dtype dictType
+	dtype DictType[K, V]
 	// 私有数据
 	privdata interface{}
 	// 哈希表(一共两个，rehash使用)
-	ht [2]dictht
+	ht [2]dictht[K, V]
 	// rehash进行到的索引，用于控制rehash进程
 	// 当 rehash 不在进行时，值为-1
 	rehshidx int
-	// 目前正在运行的安全迭代器数量
+	// 目前正在运行的安全迭代器和 dictScan 的数量，不为0时暂停单步rehash
 	iterators int
 }
 
+// 键和值都不限定类型的字典，供集合、哈希等对象使用
+type dict = Dict[interface{}, interface{}]
+
 // 字典迭代器
 // 如果 safe 属性的值为 1 ，那么在迭代进行的过程中，
 // 程序仍然可以执行 dictAdd 、 dictFind 和其他函数，对字典进行修改。
 //
 // 如果 safe 不为 1 ，那么程序只会调用 dictNext 对字典进行迭代，
 // 而不对字典进行修改。
-type dictIterator struct {
+type dictIterator[K, V any] struct {
 	// 被迭代的字典
-	d *dict
+	d *Dict[K, V]
 	// 正在别迭代的哈希吗编号，可以是第0个或第1个
 	table int
 	// 迭代器当前所指向的哈希表索引位置
@@ -94,118 +112,174 @@ type dictIterator struct {
 	// 标识这个迭代器是否安全 1:安全  0:不安全
 	safe int
 	// 当前迭代到的节点的指针
-	entry *DictEntry
+	entry *DictEntry[K, V]
 	// 当前迭代节点的下一个节点，
 	// 因为在安全迭代器运作时，entry 所指向的节点可能会被修改，
 	// 所以需要一个额外的指针来保存下一节点的位置，从而防止指针丢失
-	nextEntry *DictEntry
+	nextEntry *DictEntry[K, V]
+
+	// 不安全迭代器开始迭代时字典的指纹，释放迭代器时用于检查字典是否被修改
+	fingerprint uint64
+}
+
+// 不安全迭代器在迭代期间字典被修改时，释放迭代器返回的错误
+type DictIteratorMisuseError struct {
+	// 开始迭代时字典的指纹
+	Expected uint64
+	// 释放迭代器时字典的指纹
+	Actual uint64
+}
 
-	fingerprint int64
+func (e *DictIteratorMisuseError) Error() string {
+	return fmt.Sprintf("dict modified during unsafe iteration (fingerprint %#x != %#x)",
+		e.Actual, e.Expected)
 }
 
 // 哈希表的数组的初始大小
 const DICT_HT_INITIAL_SIZE int = 4
 
 // 释放给定字典节点的值
-func (d *dict) dictFreeVal(entry DictEntry) {
-	valDestructor := d.dtype.valDestructor
-	if valDestructor != nil {
+func (d *Dict[K, V]) dictFreeVal(entry *DictEntry[K, V]) {
+	valDestructor := d.dtype.ValDestructor
+	if valDestructor != nil && !d.dtype.IntegerValues {
 		valDestructor(d.privdata, entry.v.val)
 	}
 }
 
 // 设置给定字典节点的值
-func (d *dict) dictSetVal(entry *DictEntry, val interface{}) {
-	if d.dtype.valDup != nil {
-		entry.v.val = d.dtype.valDup(d.privdata, val)
+func (d *Dict[K, V]) dictSetVal(entry *DictEntry[K, V], val V) {
+	if d.dtype.ValDup != nil && !d.dtype.IntegerValues {
+		entry.v.val = d.dtype.ValDup(d.privdata, val)
 	} else {
 		entry.v.val = val
 	}
 }
 
 // 将一个有符号整数设为节点的值
-func dictSetSignedIntegerVal(entry *DictEntry, val interface{}) {
-	entry.v.s64 = val.(int64)
+func dictSetSignedIntegerVal[K, V any](entry *DictEntry[K, V], val int64) {
+	entry.v.num = uint64(val)
 }
 
 // 将一个无符号整数设为节点的值
-func dictSetUnsignedIntegerVal(entry *DictEntry, val interface{}) {
-	entry.v.u64 = val.(uint64)
+func dictSetUnsignedIntegerVal[K, V any](entry *DictEntry[K, V], val uint64) {
+	entry.v.num = val
+}
+
+// 将一个浮点数设为节点的值
+func dictSetDoubleVal[K, V any](entry *DictEntry[K, V], val float64) {
+	entry.v.num = math.Float64bits(val)
+}
+
+// 将节点的有符号整数值增加val，返回增加后的值
+func dictIncrSignedIntegerVal[K, V any](entry *DictEntry[K, V], val int64) int64 {
+	entry.v.num = uint64(int64(entry.v.num) + val)
+	return int64(entry.v.num)
+}
+
+// 将节点的无符号整数值增加val，返回增加后的值
+func dictIncrUnsignedIntegerVal[K, V any](entry *DictEntry[K, V], val uint64) uint64 {
+	entry.v.num += val
+	return entry.v.num
+}
+
+// 将节点的浮点数值增加val，返回增加后的值
+func dictIncrDoubleVal[K, V any](entry *DictEntry[K, V], val float64) float64 {
+	d := math.Float64frombits(entry.v.num) + val
+	entry.v.num = math.Float64bits(d)
+	return d
 }
 
 // 释放给定字典节点的键
-func dictFreeKey(d *dict, entry *DictEntry) {
-	if d.dtype.keyDestructor != nil {
-		d.dtype.keyDestructor(d.privdata, entry.key)
+func dictFreeKey[K, V any](d *Dict[K, V], entry *DictEntry[K, V]) {
+	if d.dtype.KeyDestructor != nil {
+		d.dtype.KeyDestructor(d.privdata, entry.key)
 	}
 }
 
 // 设置给定字典节点的键
-func dictSetKey(d *dict, entry *DictEntry, key interface{}) {
-	if d.dtype.keyDup != nil {
-		entry.key = d.dtype.keyDup(d.privdata, key)
+func dictSetKey[K, V any](d *Dict[K, V], entry *DictEntry[K, V], key K) {
+	if d.dtype.KeyDup != nil {
+		entry.key = d.dtype.KeyDup(d.privdata, key)
 	} else {
 		entry.key = key
 	}
 }
 
 // 比对两个键
-func dictCompareKeys(d *dict, key1 interface{}, key2 interface{}) bool {
-	if d.dtype.keyCompare != nil {
-		compare := d.dtype.keyCompare(d.privdata, key1, key2)
-		return compare == 0
+// 没有设置对比函数时直接比较两个键，此时键的实际类型必须是可比较的
+func dictCompareKeys[K, V any](d *Dict[K, V], key1 K, key2 K) bool {
+	if d.dtype.KeyCompare != nil {
+		return d.dtype.KeyCompare(d.privdata, key1, key2)
 	}
-	return key1 == key2
+	return interface{}(key1) == interface{}(key2)
 }
 
 // 计算给定键的哈希值
-func dictHashKey(d *dict, key interface{}) int {
-	return d.dtype.hashFunction(key)
+func dictHashKey[K, V any](d *Dict[K, V], key K) uint64 {
+	return d.dtype.HashFunction(key)
 }
 
-// 返回获取给定节点的键
-func dictGetKey() {
+// 计算给定键在哈希表 ht 中的索引
+func dictHashIndex[K, V any](d *Dict[K, V], ht *dictht[K, V], key K) int {
+	return int(dictHashKey(d, key) & uint64(ht.sizemask))
+}
 
+// 返回获取给定节点的键
+func dictGetKey[K, V any](he *DictEntry[K, V]) K {
+	return he.key
 }
 
 // 返回获取给定节点的值
-func dictGetVal(he *DictEntry) interface{} {
+func dictGetVal[K, V any](he *DictEntry[K, V]) V {
 	return he.v.val
 }
 
 // 返回获取给定节点的有符号整数值
-func dictGetSignedIntegerVal(he *DictEntry) int64 {
-	return he.v.s64
+func dictGetSignedIntegerVal[K, V any](he *DictEntry[K, V]) int64 {
+	return int64(he.v.num)
 }
 
 // 返回给定节点的无符号整数值
-func dictGetUnsignedIntegerVal(he *DictEntry) uint64 {
-	return he.v.u64
+func dictGetUnsignedIntegerVal[K, V any](he *DictEntry[K, V]) uint64 {
+	return he.v.num
+}
+
+// 返回给定节点的浮点数值
+func dictGetDoubleVal[K, V any](he *DictEntry[K, V]) float64 {
+	return math.Float64frombits(he.v.num)
 }
 
 // 返回给定字典的大小
-func dictSlots(d *dict) int {
+func dictSlots[K, V any](d *Dict[K, V]) int {
 	return d.ht[0].size + d.ht[1].size
 }
 
 // 返回字典的已有节点数量
-func dictSize(d *dict) int {
-	return d.ht[0].size + d.ht[1].size
+func dictSize[K, V any](d *Dict[K, V]) int {
+	return d.ht[0].used + d.ht[1].used
 }
 
 // 查看字典是否正在 rehash
-func dictIsRehashing(d *dict) bool {
+func dictIsRehashing[K, V any](d *Dict[K, V]) bool {
 	return d.rehshidx != -1
 }
 
 //==============================
 
-// 指示字典是否启用rehash的标识
-var dict_can_resize = 1
+// 指示字典是否启用rehash的标识，1:启用  0:关闭
+// 可能被后台的 rehash 调度器读取，使用原子操作访问
+var dict_can_resize atomic.Int32
+
+func init() {
+	dict_can_resize.Store(1)
+}
 
 // 强制 rehash 的比率  即 已使用节点的数量 / 字典大小
 const dict_force_resize_ratio = 5
 
+// 哈希表的最小填充率(百分比)，低于这个值时缩小哈希表
+const HASHTABLE_MIN_FILL = 10
+
 // hash 函数
 func DictIntHashFunction(key uint32) uint32 {
 	key += ^(key << 15)
@@ -219,48 +293,261 @@ func DictIntHashFunction(key uint32) uint32 {
 
 var dict_hash_function_seed uint32 = 5381
 
+// SipHash 使用的128位密钥，由 dict_hash_function_seed 派生
+var dict_siphash_key = dictSipHashKeyFromSeed(dict_hash_function_seed)
+
+// 设置哈希种子，所有带种子的哈希函数（MurmurHash2、SipHash）都会受影响
+// 应在创建字典之前调用，否则已有字典中的键将无法被找到
 func DictSetHashFunctionSeed(seed uint32) {
 	dict_hash_function_seed = seed
+	dict_siphash_key = dictSipHashKeyFromSeed(seed)
 }
 
 func DictGetHashFunctionSeed() uint32 {
 	return dict_hash_function_seed
 }
 
-func DictGenHashFunction(key interface{}, len int) uint32 {
-	// todo
-	return uint32(5)
+// 使用 splitmix64 将32位种子扩展为 SipHash 需要的128位密钥
+func dictSipHashKeyFromSeed(seed uint32) [16]byte {
+	var key [16]byte
+	x := uint64(seed)
+	for i := 0; i < 2; i++ {
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		z ^= z >> 31
+		binary.LittleEndian.PutUint64(key[i*8:], z)
+	}
+	return key
 }
 
-func DictGenCaseHashFunction(buf string) uint32 {
-	var hash uint32 = 0
-	for _, v := range buf {
-		hash = hash*31 + uint32(v)
+// MurmurHash2，由 Austin Appleby 实现，与 Redis 3.0 的 dict.c 一致
+// 注意：按小端序读取数据，与 x86 平台上的 C 实现结果相同
+func DictGenHashFunction(key []byte) uint32 {
+	seed := dict_hash_function_seed
+	const m uint32 = 0x5bd1e995
+	const r = 24
+
+	length := len(key)
+	// 将哈希值初始化为一个"随机"值
+	h := seed ^ uint32(length)
+
+	// 每次混合4个字节
+	data := key
+	for len(data) >= 4 {
+		k := binary.LittleEndian.Uint32(data)
+		k *= m
+		k ^= k >> r
+		k *= m
+
+		h *= m
+		h ^= k
+
+		data = data[4:]
+	}
+
+	// 处理剩余的几个字节
+	switch len(data) {
+	case 3:
+		h ^= uint32(data[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(data[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(data[0])
+		h *= m
+	}
+
+	// 最后再混合几次，确保最后几个字节也充分混合
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return h
+}
+
+// 使用 SipHash-1-2 计算哈希值
+func DictGenSipHashFunction(key []byte) uint64 {
+	return siphash(key, &dict_siphash_key)
+}
+
+// 大小写不敏感的哈希函数，使用 SipHash-1-2
+func DictGenCaseHashFunction(buf []byte) uint64 {
+	return siphashNocase(buf, &dict_siphash_key)
+}
+
+// 在不复制的情况下将字符串转为字节切片，返回值不能被修改
+func dictStringBytes(s string) []byte {
+	return unsafe.Slice(unsafe.StringData(s), len(s))
+}
+
+// 各类键的哈希函数与对比函数
+func dictBytesHash(key []byte) uint64 {
+	return DictGenSipHashFunction(key)
+}
+
+func dictBytesMurmurHash(key []byte) uint64 {
+	return uint64(DictGenHashFunction(key))
+}
+
+func dictBytesCaseHash(key []byte) uint64 {
+	return DictGenCaseHashFunction(key)
+}
+
+func dictBytesKeyCompare(privdata interface{}, key1 []byte, key2 []byte) bool {
+	return bytes.Equal(key1, key2)
+}
+
+func dictBytesKeyCaseCompare(privdata interface{}, key1 []byte, key2 []byte) bool {
+	return bytes.EqualFold(key1, key2)
+}
+
+func dictStringHash(key string) uint64 {
+	return DictGenSipHashFunction(dictStringBytes(key))
+}
+
+func dictStringMurmurHash(key string) uint64 {
+	return uint64(DictGenHashFunction(dictStringBytes(key)))
+}
+
+func dictStringCaseHash(key string) uint64 {
+	return DictGenCaseHashFunction(dictStringBytes(key))
+}
+
+func dictStringKeyCompare(privdata interface{}, key1 string, key2 string) bool {
+	return key1 == key2
+}
+
+func dictStringKeyCaseCompare(privdata interface{}, key1 string, key2 string) bool {
+	return strings.EqualFold(key1, key2)
+}
+
+func dictSdsHash(key sds) uint64 {
+	return DictGenSipHashFunction(key)
+}
+
+func dictSdsMurmurHash(key sds) uint64 {
+	return uint64(DictGenHashFunction(key))
+}
+
+func dictSdsCaseHash(key sds) uint64 {
+	return DictGenCaseHashFunction(key)
+}
+
+func dictSdsKeyCompare(privdata interface{}, key1 sds, key2 sds) bool {
+	return bytes.Equal(key1, key2)
+}
+
+func dictSdsKeyCaseCompare(privdata interface{}, key1 sds, key2 sds) bool {
+	return bytes.EqualFold(key1, key2)
+}
+
+// 以字节切片为键的字典类型
+func BytesDictType[V any]() DictType[[]byte, V] {
+	return DictType[[]byte, V]{
+		HashFunction: dictBytesHash,
+		KeyCompare:   dictBytesKeyCompare,
+	}
+}
+
+// 以字节切片为键、使用 MurmurHash2 的字典类型，与 Redis 3.0 的哈希函数相同
+func BytesMurmurDictType[V any]() DictType[[]byte, V] {
+	return DictType[[]byte, V]{
+		HashFunction: dictBytesMurmurHash,
+		KeyCompare:   dictBytesKeyCompare,
+	}
+}
+
+// 以字节切片为键、大小写不敏感的字典类型
+func BytesCaseDictType[V any]() DictType[[]byte, V] {
+	return DictType[[]byte, V]{
+		HashFunction: dictBytesCaseHash,
+		KeyCompare:   dictBytesKeyCaseCompare,
+	}
+}
+
+// 以字符串为键的字典类型
+func StringDictType[V any]() DictType[string, V] {
+	return DictType[string, V]{
+		HashFunction: dictStringHash,
+		KeyCompare:   dictStringKeyCompare,
+	}
+}
+
+// 以字符串为键、使用 MurmurHash2 的字典类型
+func StringMurmurDictType[V any]() DictType[string, V] {
+	return DictType[string, V]{
+		HashFunction: dictStringMurmurHash,
+		KeyCompare:   dictStringKeyCompare,
+	}
+}
+
+// 以字符串为键、大小写不敏感的字典类型，例如命令表
+func StringCaseDictType[V any]() DictType[string, V] {
+	return DictType[string, V]{
+		HashFunction: dictStringCaseHash,
+		KeyCompare:   dictStringKeyCaseCompare,
+	}
+}
+
+// 以sds为键的字典类型
+func sdsDictType[V any]() DictType[sds, V] {
+	return DictType[sds, V]{
+		HashFunction: dictSdsHash,
+		KeyCompare:   dictSdsKeyCompare,
+	}
+}
+
+// 以sds为键、使用 MurmurHash2 的字典类型
+func sdsMurmurDictType[V any]() DictType[sds, V] {
+	return DictType[sds, V]{
+		HashFunction: dictSdsMurmurHash,
+		KeyCompare:   dictSdsKeyCompare,
+	}
+}
+
+// 以sds为键、大小写不敏感的字典类型
+func sdsCaseDictType[V any]() DictType[sds, V] {
+	return DictType[sds, V]{
+		HashFunction: dictSdsCaseHash,
+		KeyCompare:   dictSdsKeyCaseCompare,
 	}
-	return hash
 }
 
 //================================ API implementation ====================
 
 // 重置哈希表
-func dictReset(ht *dictht) {
+func dictReset[K, V any](ht *dictht[K, V]) {
 	ht.table = nil
 	ht.size = 0
 	ht.sizemask = 0
 	ht.used = 0
+	ht.maxchain = 0
+	ht.chains = nil
 }
 
 // 创建一个字典
-func DictCreate(dtype dictType, privDataPtr interface{}) *dict {
-	d := &dict{}
+func DictCreate[K, V any](dtype DictType[K, V], privDataPtr interface{}) *Dict[K, V] {
+	d := &Dict[K, V]{}
 	d.dictInit(dtype, privDataPtr)
 	return d
 }
 
+// 创建一个使用给定哈希函数和键对比函数的字典
+func NewDict[K, V any](hash func(key K) uint64, equal func(key1 K, key2 K) bool) *Dict[K, V] {
+	return DictCreate(DictType[K, V]{
+		HashFunction: hash,
+		KeyCompare: func(privdata interface{}, key1 K, key2 K) bool {
+			return equal(key1, key2)
+		},
+	}, nil)
+}
+
 // 初始化哈希表
-func (d *dict) dictInit(dtype dictType, privDataPtr interface{}) int {
-	d.ht[0] = dictht{}
-	d.ht[1] = dictht{}
+func (d *Dict[K, V]) dictInit(dtype DictType[K, V], privDataPtr interface{}) int {
+	d.ht[0] = dictht[K, V]{}
+	d.ht[1] = dictht[K, V]{}
 
 	d.dtype = dtype
 	d.privdata = privDataPtr
@@ -269,9 +556,25 @@ func (d *dict) dictInit(dtype dictType, privDataPtr interface{}) int {
 	return DICT_OK
 }
 
+// 判断字典是否需要缩小：哈希表大于初始大小，并且填充率低于 HASHTABLE_MIN_FILL
+func htNeedsResize[K, V any](d *Dict[K, V]) bool {
+	size := dictSlots(d)
+	used := dictSize(d)
+	return size > DICT_HT_INITIAL_SIZE && used*100/size < HASHTABLE_MIN_FILL
+}
+
+// 字典需要缩小时进行缩小，开始了缩小的 rehash 时返回true
+func dictResizeIfNeeded[K, V any](d *Dict[K, V]) bool {
+	if !htNeedsResize(d) {
+		return false
+	}
+	return d.dictResize() == DICT_OK
+}
+
 // 缩小给定字典
-func (d *dict) dictResize() int {
-	if dict_can_resize != 1 || dictIsRehashing(d) {
+// 让哈希表的大小与已有节点数量相匹配，即 已有节点数量/哈希表大小 接近1
+func (d *Dict[K, V]) dictResize() int {
+	if dict_can_resize.Load() != 1 || dictIsRehashing(d) {
 		return DICT_ERR
 	}
 	minimal := d.ht[0].used
@@ -284,7 +587,7 @@ func (d *dict) dictResize() int {
 }
 
 // 创建一个新的哈希表，或者重新哈希到两个字典中未使用的字典，并打开字典rehash标识
-func (d *dict) dictExpand(size int) int {
+func (d *Dict[K, V]) dictExpand(size int) int {
 	realSize := dictNextPower(size)
 
 	// 不能在字典进行rehash 或size小于当前已使用节点时进行
@@ -292,11 +595,16 @@ func (d *dict) dictExpand(size int) int {
 		return DICT_ERR
 	}
 
+	// 大小不变时 rehash 没有意义
+	if realSize == d.ht[0].size {
+		return DICT_ERR
+	}
+
 	// new hashtable
-	n := dictht{}
+	n := dictht[K, V]{}
 	n.size = realSize
 	n.sizemask = realSize - 1
-	n.table = make([]*DictEntry, 0, realSize)
+	n.table = make([]*DictEntry[K, V], realSize)
 	n.used = 0
 
 	// 0号哈希表为空则说明没有填充过数据，这时进行初始化
@@ -313,7 +621,7 @@ func (d *dict) dictExpand(size int) int {
 // 执行渐进式rehash
 // 返回1表示未结束，仍有需要从0号哈希表移动到1号哈希表的数据
 // n 为要进行rehash的数组数量(排除空元素)
-func (d *dict) dictRehash(n int) int {
+func (d *Dict[K, V]) dictRehash(n int) int {
 	// 只可以在开始了 rehash 开关后进行
 	if !dictIsRehashing(d) {
 		return 0
@@ -333,14 +641,17 @@ func (d *dict) dictRehash(n int) int {
 		}
 		// 开始进行rehash
 		de := d.ht[0].table[d.rehshidx]
+		dictChainUpdate(&d.ht[0], dictChainLen(de), 0)
 		for de != nil {
 			// 暂存下一个位置的地址
 			nextde := de.next
-			newIndex := dictHashKey(d, de.key) & d.ht[1].sizemask
+			newIndex := dictHashIndex(d, &d.ht[1], de.key)
 
 			// 使用头插法插入到新的哈希表中的头部
+			chainlen := dictChainLen(d.ht[1].table[newIndex])
 			de.next = d.ht[1].table[newIndex]
 			d.ht[1].table[newIndex] = de
+			dictChainUpdate(&d.ht[1], chainlen, chainlen+1)
 
 			d.ht[0].used--
 			d.ht[1].used++
@@ -354,18 +665,35 @@ func (d *dict) dictRehash(n int) int {
 	return 1
 }
 
-// 返回以毫秒为单位的 UNIX 时间戳
+// 计时的起点，time.Since 使用单调时钟，不受系统时间调整的影响
+var dictClockStart = time.Now()
+
+// 返回以毫秒为单位的单调时间
 func timeInMilliseconds() int64 {
-	return time.Now().Unix() * 1000
+	return time.Since(dictClockStart).Milliseconds()
 }
 
-// 在给定的毫秒内，已100步为不常，对字典进行rehash
-func (d *dict) dictRehashMilliseconds(ms int) int {
-	start := timeInMilliseconds()
+// 返回以微秒为单位的单调时间
+func timeInMicroseconds() int64 {
+	return time.Since(dictClockStart).Microseconds()
+}
+
+// 在给定的毫秒内，以100步为单位，对字典进行rehash
+func (d *Dict[K, V]) dictRehashMilliseconds(ms int) int {
+	return d.dictRehashMicroseconds(int64(ms) * 1000)
+}
+
+// 在给定的微秒内，以100步为单位，对字典进行rehash
+// 返回执行的步数，不在rehash或者有安全迭代器时返回0
+func (d *Dict[K, V]) dictRehashMicroseconds(us int64) int {
+	if !dictIsRehashing(d) || d.iterators > 0 {
+		return 0
+	}
+	start := timeInMicroseconds()
 	rehashes := 0
-	for d.dictRehash(100) != 0 {
+	for {
 		rehashes += 100
-		if timeInMilliseconds()-start > int64(ms) {
+		if d.dictRehash(100) == 0 || timeInMicroseconds()-start > us {
 			break
 		}
 	}
@@ -373,14 +701,14 @@ func (d *dict) dictRehashMilliseconds(ms int) int {
 }
 
 // 单步Rehash(没有安全迭代器的情况下)
-func (d *dict) dictRehashStep() {
+func (d *Dict[K, V]) dictRehashStep() {
 	if d.iterators == 0 {
 		d.dictRehash(1)
 	}
 }
 
 // 将key,value 添加到字典中
-func (d *dict) dictAdd(key interface{}, val interface{}) int {
+func (d *Dict[K, V]) dictAdd(key K, val V) int {
 	entry := d.dictAddRaw(key)
 	if entry == nil {
 		return DICT_ERR
@@ -390,54 +718,60 @@ func (d *dict) dictAdd(key interface{}, val interface{}) int {
 }
 
 // 将key插入到字典中(不包括值)
-func (d *dict) dictAddRaw(key interface{}) *DictEntry {
+func (d *Dict[K, V]) dictAddRaw(key K) *DictEntry[K, V] {
 	// 如果渐进hash在进行中，那么在新增时执行一次单步rehash
 	if dictIsRehashing(d) {
 		d.dictRehashStep()
 	}
-	index := dictKeyIndex(d, key)
+	index, chainlen := dictKeyIndex(d, key)
 	// -1 表示键已经存在
 	if index == -1 {
 		return nil
 	}
-	var ht *dictht
+	var ht *dictht[K, V]
 	if dictIsRehashing(d) {
 		ht = &d.ht[1]
 	} else {
 		ht = &d.ht[0]
 	}
-	entry := &DictEntry{}
+	entry := &DictEntry[K, V]{}
 	// 头插法插入链表节点
 	entry.next = ht.table[index]
 	ht.table[index] = entry
 	ht.used++
+	dictChainUpdate(ht, chainlen, chainlen+1)
 
 	dictSetKey(d, entry, key)
 	return entry
 }
 
 // 添加、替换 key-value到dict中
-func (d *dict) dictReplace(key interface{}, val interface{}) int {
+// 新增返回1，替换返回0
+func (d *Dict[K, V]) dictReplace(key K, val V) int {
 	// 能新增则新增后返回
 	if d.dictAdd(key, val) == DICT_OK {
 		return 1
 	}
 	entry := dictFind(d, key)
+	// 先设置新值再释放旧值，新旧值相同时也不会出错
+	auxentry := *entry
 	d.dictSetVal(entry, val)
+	d.dictFreeVal(&auxentry)
 	return 0
 }
 
 // 添加key到dict,如果已经存在则直接返回
-func (d *dict) dictReplaceRaw(key interface{}) *DictEntry {
+func (d *Dict[K, V]) dictReplaceRaw(key K) *DictEntry[K, V] {
 	dictEntry := dictFind(d, key)
-	if dictEntry != nil {
+	if dictEntry == nil {
 		return d.dictAddRaw(key)
 	}
 	return dictEntry
 }
 
 // 查找并删除包含给定键的节点
-func dictGenericDelete(d *dict, key interface{}) int {
+// nofree 为 true 时不调用键和值的释放函数
+func dictGenericDelete[K, V any](d *Dict[K, V], key K, nofree bool) int {
 	if d.ht[0].size == 0 {
 		return DICT_ERR
 	}
@@ -446,23 +780,30 @@ func dictGenericDelete(d *dict, key interface{}) int {
 		d.dictRehashStep()
 	}
 
-	hash := dictHashKey(d, key)
 	for table := 0; table <= 1; table++ {
-		idx := hash & d.ht[table].sizemask
+		idx := dictHashIndex(d, &d.ht[table], key)
 
 		// 拿到对应索引所在数组中的头结点
 		he := d.ht[table].table[idx]
-		var prevHe *DictEntry
+		var prevHe *DictEntry[K, V]
 		for he != nil {
 			if dictCompareKeys(d, key, he.key) {
+				chainlen := dictChainLen(d.ht[table].table[idx])
 				// 头结点就是要找的key对应节点
 				if prevHe == nil {
 					d.ht[table].table[idx] = he.next
 				} else {
 					prevHe.next = he.next
 				}
+				dictChainUpdate(&d.ht[table], chainlen, chainlen-1)
+				if !nofree {
+					dictFreeKey(d, he)
+					d.dictFreeVal(he)
+				}
 
 				d.ht[table].used--
+				// 与 C 中一样，删除后不立即缩小哈希表，避免在 Scan、Range 的回调中开始 rehash，
+				// 缩小由 rehash 调度器(DictRehashScheduler)定期调用 ResizeIfNeeded 完成
 				return DICT_OK
 			}
 
@@ -479,36 +820,59 @@ func dictGenericDelete(d *dict, key interface{}) int {
 	return DICT_ERR
 }
 
-// 从字典中删除包含给定键的节点, 本来区分是是否调用释放函数，此处不提供不释放的实现
-var dictDelete = dictGenericDelete
-var dictDeleteNoFree = dictGenericDelete
+// 从字典中删除包含给定键的节点，并调用键和值的释放函数
+func dictDelete[K, V any](d *Dict[K, V], key K) int {
+	return dictGenericDelete(d, key, false)
+}
+
+// 从字典中删除包含给定键的节点，但不调用键和值的释放函数
+func dictDeleteNoFree[K, V any](d *Dict[K, V], key K) int {
+	return dictGenericDelete(d, key, true)
+}
 
 // 删除哈希表上的所有节点，重置属性
-func dictClear(d *dict, ht *dictht) int {
+func dictClear[K, V any](d *Dict[K, V], ht *dictht[K, V]) int {
+	for i := 0; i < ht.size && ht.used > 0; i++ {
+		he := ht.table[i]
+		for he != nil {
+			nextHe := he.next
+			dictFreeKey(d, he)
+			d.dictFreeVal(he)
+			ht.used--
+			he = nextHe
+		}
+	}
 	dictReset(ht)
 	return DICT_OK
 }
 
 // 删除并释放整个字典
-func dictRelease(d *dict) {
-	d.ht[0] = dictht{}
-	d.ht[1] = dictht{}
+func dictRelease[K, V any](d *Dict[K, V]) {
+	dictClear(d, &d.ht[0])
+	dictClear(d, &d.ht[1])
 }
 
 // 返回字典表中包含key的节点，查询不到返回nil
-func dictFind(d *dict, key interface{}) *DictEntry {
+func dictFind[K, V any](d *Dict[K, V], key K) *DictEntry[K, V] {
 	// 0号哈希表为空则表示整个dict为空
-	if d.ht[0].sizemask == 0 {
+	if d.ht[0].size == 0 {
 		return nil
 	}
 	// 如果在rehash过程中，则单步执行一步
 	if dictIsRehashing(d) {
 		d.dictRehashStep()
 	}
+	return dictFindNoRehash(d, key)
+}
 
-	hash := dictHashKey(d, key)
+// 返回字典表中包含key的节点，查询不到返回nil
+// 与 dictFind 不同，不会执行单步rehash，查找过程中不会修改字典，可以在读锁下并发调用
+func dictFindNoRehash[K, V any](d *Dict[K, V], key K) *DictEntry[K, V] {
+	if d.ht[0].size == 0 {
+		return nil
+	}
 	for table := 0; table <= 1; table++ {
-		idx := hash & d.ht[table].sizemask
+		idx := dictHashIndex(d, &d.ht[table], key)
 		he := d.ht[table].table[idx]
 		for he != nil {
 			if dictCompareKeys(d, key, he.key) {
@@ -525,22 +889,48 @@ func dictFind(d *dict, key interface{}) *DictEntry {
 }
 
 // 返回包含指定key的value值
-func dictFetchValue(d *dict, key interface{}) interface{} {
+func dictFetchValue[K, V any](d *Dict[K, V], key K) (V, bool) {
 	he := dictFind(d, key)
 	if he == nil {
-		return nil
+		var zero V
+		return zero, false
 	}
-	return dictGetVal(he)
+	return dictGetVal(he), true
 }
 
-func dictFingerprint(d *dict) int64 {
-	//todo
-	return 1
+// 计算字典的指纹，是字典当前状态的一个64位数字
+// 不安全迭代器开始迭代时记录指纹，释放时再次计算并对比，
+// 两者不同说明在迭代过程中执行了被禁止的操作(修改了字典)
+func dictFingerprint[K, V any](d *Dict[K, V]) uint64 {
+	integers := [6]uint64{
+		uint64(uintptr(unsafe.Pointer(unsafe.SliceData(d.ht[0].table)))),
+		uint64(d.ht[0].size),
+		uint64(d.ht[0].used),
+		uint64(uintptr(unsafe.Pointer(unsafe.SliceData(d.ht[1].table)))),
+		uint64(d.ht[1].size),
+		uint64(d.ht[1].used),
+	}
+
+	// 依次将每个整数加到上一个哈希值上再进行哈希，
+	// 这样可以让相同的整数以不同的顺序出现时得到不同的结果
+	var hash uint64
+	for _, v := range integers {
+		hash += v
+		// 使用 Tomas Wang 的64位整数哈希
+		hash = (^hash) + (hash << 21) // hash = (hash << 21) - hash - 1
+		hash = hash ^ (hash >> 24)
+		hash = (hash + (hash << 3)) + (hash << 8) // hash * 265
+		hash = hash ^ (hash >> 14)
+		hash = (hash + (hash << 2)) + (hash << 4) // hash * 21
+		hash = hash ^ (hash >> 28)
+		hash = hash + (hash << 31)
+	}
+	return hash
 }
 
 // 创建并返回字典的不安全迭代器
-func dictGetIterator(d *dict) *dictIterator {
-	iterator := &dictIterator{}
+func dictGetIterator[K, V any](d *Dict[K, V]) *dictIterator[K, V] {
+	iterator := &dictIterator[K, V]{}
 	iterator.d = d
 	iterator.table = 0
 	iterator.index = -1
@@ -551,18 +941,18 @@ func dictGetIterator(d *dict) *dictIterator {
 }
 
 // 创建并返回给定节点的安全迭代器
-func dictGetSafeIterator(d *dict) *dictIterator {
+func dictGetSafeIterator[K, V any](d *Dict[K, V]) *dictIterator[K, V] {
 	iterator := dictGetIterator(d)
 	iterator.safe = 1
 	return iterator
 }
 
 // 返回迭代器指向的当前节点，结束返回nil
-func dictNext(iter *dictIterator) *DictEntry {
+func dictNext[K, V any](iter *dictIterator[K, V]) *DictEntry[K, V] {
 	for {
 		if iter.entry == nil {
 			// 获取哈希表
-			ht := iter.d.ht[iter.table]
+			ht := &iter.d.ht[iter.table]
 			// 如果是第一次迭代
 			if iter.index == -1 && iter.table == 0 {
 				// 安全则更新安全迭代器计数器
@@ -574,12 +964,12 @@ func dictNext(iter *dictIterator) *DictEntry {
 			}
 			iter.index++
 			//
-			if iter.index >= int(ht.size) {
+			if iter.index >= ht.size {
 				// 如果在进行rehash,则迭代1号哈希表
 				if dictIsRehashing(iter.d) && iter.table == 0 {
 					iter.table++
 					iter.index = 0
-					ht = iter.d.ht[1]
+					ht = &iter.d.ht[1]
 				} else {
 					break
 				}
@@ -599,22 +989,26 @@ func dictNext(iter *dictIterator) *DictEntry {
 }
 
 // 释放给定字典迭代器
-func dictReleaseIterator(iter *dictIterator) {
+// 不安全迭代器在迭代期间字典被修改时返回 *DictIteratorMisuseError
+func dictReleaseIterator[K, V any](iter *dictIterator[K, V]) error {
 	// 已经开始进行迭代
 	if !(iter.index == -1 && iter.table == 0) {
 		if iter.safe == 1 {
 			iter.d.iterators--
 		} else {
-			if iter.fingerprint != dictFingerprint(iter.d) {
-				panic(errors.New("fingerprint not equals"))
+			fingerprint := dictFingerprint(iter.d)
+			if iter.fingerprint != fingerprint {
+				return &DictIteratorMisuseError{Expected: iter.fingerprint, Actual: fingerprint}
 			}
 		}
 	}
-	iter = nil
+	return nil
 }
 
 // 随机返回一个节点
-func dictGetRandomKey(d *dict) *DictEntry {
+// 先随机选择一个非空的索引，再从该索引的链表中随机选择一个节点，
+// 所以位于较长链表中的节点被选中的概率较低，需要均匀分布时使用 dictGetFairRandomKey
+func dictGetRandomKey[K, V any](d *Dict[K, V]) *DictEntry[K, V] {
 	if dictSize(d) == 0 {
 		return nil
 	}
@@ -622,11 +1016,12 @@ func dictGetRandomKey(d *dict) *DictEntry {
 		d.dictRehashStep()
 	}
 
-	var he *DictEntry
+	var he *DictEntry[K, V]
 	if dictIsRehashing(d) {
-		h := rand.Intn(int(d.ht[0].size + d.ht[1].size))
 		for he == nil {
-			if h > d.ht[0].size {
+			// 0号哈希表中 rehshidx 之前的索引都已经迁移，一定为空，直接跳过
+			h := d.rehshidx + rand.Intn(d.ht[0].size+d.ht[1].size-d.rehshidx)
+			if h >= d.ht[0].size {
 				he = d.ht[1].table[h-d.ht[0].size]
 			} else {
 				he = d.ht[0].table[h]
@@ -634,7 +1029,7 @@ func dictGetRandomKey(d *dict) *DictEntry {
 		}
 	} else {
 		for he == nil {
-			h := uint(rand.Intn(int(d.ht[0].sizemask + 1)))
+			h := rand.Intn(d.ht[0].sizemask + 1)
 			he = d.ht[0].table[h]
 		}
 	}
@@ -656,107 +1051,252 @@ func dictGetRandomKey(d *dict) *DictEntry {
 	return he
 }
 
-// 随机返回count个节点，可能有重复数据
-func dictGetRandomKeys(d *dict, count int) ([]*DictEntry, int) {
+// 从字典中随机取样最多count个节点，返回取到的节点
+//
+// 从一个随机位置开始连续地收集节点，不保证返回count个节点，也不保证没有重复，
+// 但速度比调用count次 dictGetRandomKey 快得多，适合淘汰等只需要近似随机样本的场景。
+// rehash 进行中时同时从两个哈希表中取样，并跳过0号哈希表中已经迁移的索引。
+func dictGetSomeKeys[K, V any](d *Dict[K, V], count int) []*DictEntry[K, V] {
 	if dictSize(d) < count {
-		count = int(dictSize(d))
-	}
-	stored := 0
-	dest := make([]*DictEntry, 0, count)
-	for stored < count {
-		for j := 0; j < 2; j++ {
-			// 随机获取一个索引
-			i := rand.Intn(d.ht[j].size)
-			size := d.ht[j].size
-
-			for size > 0 {
-				size--
-				he := d.ht[j].table[i]
-				// 将这个索引对应的链表都获取到
+		count = dictSize(d)
+	}
+	dest := make([]*DictEntry[K, V], 0, count)
+	if count == 0 {
+		return dest
+	}
+	maxsteps := count * 10
+
+	// 执行与count成比例的 rehash
+	for j := 0; j < count; j++ {
+		if dictIsRehashing(d) {
+			d.dictRehashStep()
+		} else {
+			break
+		}
+	}
+
+	tables := 1
+	if dictIsRehashing(d) {
+		tables = 2
+	}
+	maxsizemask := d.ht[0].sizemask
+	if tables > 1 && maxsizemask < d.ht[1].sizemask {
+		maxsizemask = d.ht[1].sizemask
+	}
+
+	// 在较大的哈希表中随机选择一个起始位置
+	i := rand.Intn(maxsizemask + 1)
+	// 连续遇到的空索引数量
+	emptylen := 0
+	for ; len(dest) < count && maxsteps > 0; maxsteps-- {
+		for j := 0; j < tables; j++ {
+			// rehash 进行中时，0号哈希表中 rehshidx 之前的索引都已经迁移，一定为空
+			if tables == 2 && j == 0 && i < d.rehshidx {
+				// 如果 i 超出了1号哈希表的范围(从大表缩小到小表时)，
+				// 那么两个表中 rehshidx 之前的索引都没有节点，直接跳到 rehshidx
+				if i >= d.ht[1].size {
+					i = d.rehshidx
+				} else {
+					continue
+				}
+			}
+			// 超出了这个哈希表的范围
+			if i >= d.ht[j].size {
+				continue
+			}
+			he := d.ht[j].table[i]
+			if he == nil {
+				// 连续的空索引过多时(至少5个)，跳到另一个随机位置
+				emptylen++
+				if emptylen >= 5 && emptylen > count {
+					i = rand.Intn(maxsizemask + 1)
+					emptylen = 0
+				}
+			} else {
+				emptylen = 0
+				// 收集这个索引上的所有节点
 				for he != nil {
 					dest = append(dest, he)
-					he = he.next
-					stored++
-					if stored == count {
-						return dest, stored
+					if len(dest) == count {
+						return dest
 					}
+					he = he.next
 				}
-
-				// 如果加上索引i中的数据不够，则在随机获取下一个索引
-				i = (i + 1) & d.ht[j].sizemask
-			}
-			// 到这里表示0号哈希表数据不够，这时候dict必须处于rehash中，这时去1号哈希表找
-			if !dictIsRehashing(d) {
-				panic(errors.New("must be rehashing"))
 			}
 		}
+		i = (i + 1) & maxsizemask
+	}
+	return dest
+}
+
+// 均匀地随机返回一个节点，每个节点被选中的概率相同
+//
+// 使用拒绝采样：在所有索引中均匀地选择一个，再在 [0, 最长的链表长度) 中均匀地选择一个位置，
+// 该位置上有节点时返回，否则重新选择。每次尝试中每个节点被选中的概率都是
+// 1/(索引总数*最长的链表长度)，所以结果是均匀分布的。
+func dictGetFairRandomKey[K, V any](d *Dict[K, V]) *DictEntry[K, V] {
+	if dictSize(d) == 0 {
+		return nil
+	}
+	if dictIsRehashing(d) {
+		d.dictRehashStep()
+	}
+
+	// 0号哈希表中 rehshidx 之前的索引都已经迁移，一定为空，不参与选择
+	skip, slots := 0, d.ht[0].size
+	maxchain := d.ht[0].maxchain
+	if dictIsRehashing(d) {
+		skip = d.rehshidx
+		slots += d.ht[1].size
+		if d.ht[1].maxchain > maxchain {
+			maxchain = d.ht[1].maxchain
+		}
+	}
+	for {
+		h := skip + rand.Intn(slots-skip)
+		var he *DictEntry[K, V]
+		if h >= d.ht[0].size {
+			he = d.ht[1].table[h-d.ht[0].size]
+		} else {
+			he = d.ht[0].table[h]
+		}
+		for pos := rand.Intn(maxchain); he != nil && pos > 0; pos-- {
+			he = he.next
+		}
+		if he != nil {
+			return he
+		}
+	}
+}
+
+// 计算从he开始的链表长度
+func dictChainLen[K, V any](he *DictEntry[K, V]) int {
+	chainlen := 0
+	for ; he != nil; he = he.next {
+		chainlen++
+	}
+	return chainlen
+}
+
+// 记录哈希表中一个索引上的链表长度从 from 变为 to，并更新最长的链表长度
+// 每次调用只移动一个分布计数，不需要遍历哈希表
+func dictChainUpdate[K, V any](ht *dictht[K, V], from int, to int) {
+	if from > 0 {
+		ht.chains[from]--
+	}
+	if to > 0 {
+		for len(ht.chains) <= to {
+			ht.chains = append(ht.chains, 0)
+		}
+		ht.chains[to]++
+	}
+	if to > ht.maxchain {
+		ht.maxchain = to
+	}
+	for ht.maxchain > 0 && ht.chains[ht.maxchain] == 0 {
+		ht.maxchain--
 	}
-	return dest, stored
 }
 
 // 翻转位 from: http://graphics.stanford.edu/~seander/bithacks.html#ReverseParallel
-func rev(v uint32) uint32 {
-	// todo
+func rev(v uint64) uint64 {
+	// 位数，必须是2的幂
+	s := uint(64)
+	mask := ^uint64(0)
+	for s >>= 1; s > 0; s >>= 1 {
+		mask ^= mask << s
+		v = ((v >> s) & mask) | ((v << s) & ^mask)
+	}
 	return v
 }
 
-type dictScanFunction struct {
-	privdata interface{}
-	de       *DictEntry
-}
+// dictScan 对每个被迭代到的节点调用的回调函数
+type dictScanFunction[K, V any] func(privdata interface{}, de *DictEntry[K, V])
 
-// todo 改写的有些问题
-func dictScan(d *dict, v int, fn *dictScanFunction, privdata interface{}) int {
+// 迭代字典中的节点
+//
+// 第一次调用时游标 v 为 0，之后每次使用上次返回的游标继续迭代，返回 0 时迭代结束。
+// 在整个迭代期间一直存在于字典中的节点至少会被返回一次，部分节点可能会被返回多次。
+//
+// 游标的递增从高位开始进行：将游标的二进制位翻转后加一，再翻转回来。
+// 哈希表大小总是2的N次方，节点的索引是哈希值的低位，所以表扩大时，
+// 小表中索引为 i 的节点会被分散到大表中低位同为 i 的那些索引上；
+// 表缩小时则相反。按高位递增的顺序访问，可以保证已经访问过的索引
+// 在表的大小改变后依然被视为已访问，从而不会漏掉任何节点。
+//
+// 在 rehash 进行中时，先迭代较小的表中游标所在的索引，
+// 再迭代较大的表中所有由这个索引扩展出来的索引。
+// 回调期间暂停单步rehash，回调中可以删除当前的节点。
+func dictScan[K, V any](d *Dict[K, V], v uint64, fn dictScanFunction[K, V], privdata interface{}) uint64 {
 	if dictSize(d) == 0 {
 		return 0
 	}
-	var t0, t1 *dictht
-	var de *DictEntry
-	var m0, m1 int
+	d.iterators++
+	defer func() {
+		d.iterators--
+	}()
+	var t0, t1 *dictht[K, V]
+	var de *DictEntry[K, V]
+	var m0, m1 uint64
 	if !dictIsRehashing(d) {
 		t0 = &d.ht[0]
-		m0 = t0.sizemask
+		m0 = uint64(t0.sizemask)
 
+		// 迭代游标所在的索引
 		de = t0.table[v&m0]
 		for de != nil {
-			fn = &dictScanFunction{privdata, de}
-			de = de.next
+			next := de.next
+			fn(privdata, de)
+			de = next
 		}
+
+		// 将掩码以外的高位都置为1，这样翻转后加一时进位只会作用在掩码范围内的位上
+		v |= ^m0
+		v = rev(v)
+		v++
+		v = rev(v)
 	} else {
 		t0, t1 = &d.ht[0], &d.ht[1]
 		// 确保t0的size小于t1
 		if t0.size > t1.size {
 			t0, t1 = t1, t0
 		}
-		m0, m1 = t0.sizemask, t1.sizemask
+		m0, m1 = uint64(t0.sizemask), uint64(t1.sizemask)
 
+		// 迭代小表中游标所在的索引
 		de = t0.table[v&m0]
 		for de != nil {
-			fn = &dictScanFunction{privdata, de}
-			de = de.next
+			next := de.next
+			fn(privdata, de)
+			de = next
 		}
 
-		res := 1
-		for res > 0 {
+		// 迭代大表中所有由小表的这个索引扩展出的索引
+		for {
 			de = t1.table[v&m1]
 			for de != nil {
-				fn = &dictScanFunction{privdata, de}
-				de = de.next
+				next := de.next
+				fn(privdata, de)
+				de = next
+			}
+
+			// 递增大表掩码范围内、小表掩码以外的那些位
+			v |= ^m1
+			v = rev(v)
+			v++
+			v = rev(v)
+
+			// 这些位都回到0时，说明扩展出的索引已经全部迭代
+			if v&(m0^m1) == 0 {
+				break
 			}
-			v = (((v | m0) + 1) & ^m0) | (v & m0)
-			res = v & (m0 ^ m1)
 		}
 	}
-
-	v |= ^m0
-	v = int(rev(uint32(v)))
-	v++
-	v = int(rev(uint32(v)))
 	return v
 }
 
 // 初始化字典或者满足条件时进行扩展
-func dictExpandIfNeeded(d *dict) int {
+func dictExpandIfNeeded[K, V any](d *Dict[K, V]) int {
 	// 如果已经在rehash过程中，直接返回
 	if dictIsRehashing(d) {
 		return DICT_OK
@@ -766,7 +1306,7 @@ func dictExpandIfNeeded(d *dict) int {
 	}
 
 	if d.ht[0].used >= d.ht[0].size &&
-		(dict_can_resize == 1 || d.ht[0].used/d.ht[0].size > dict_force_resize_ratio) {
+		(dict_can_resize.Load() == 1 || d.ht[0].used/d.ht[0].size > dict_force_resize_ratio) {
 		return d.dictExpand(d.ht[0].used * 2)
 	}
 	return DICT_OK
@@ -788,21 +1328,23 @@ func dictNextPower(size int) int {
 // 计算key的索引，如果已经存在，返回-1
 // 计算时需要考虑是否在渐进rehash进程中，来决定是插入到哪个哈希表
 // 进行中插入到1号哈希表，否则插入到0号哈希表
-func dictKeyIndex(d *dict, key interface{}) int32 {
+// 第二个返回值为该索引上现有链表的长度
+func dictKeyIndex[K, V any](d *Dict[K, V], key K) (int, int) {
 	if dictExpandIfNeeded(d) == DICT_ERR {
-		return -1
+		return -1, 0
 	}
-	hash := dictHashKey(d, key)
-	var idx int32
+	var idx, chainlen int
 	for table := 0; table <= 1; table++ {
-		idx = int32(hash & d.ht[table].sizemask)
+		idx = dictHashIndex(d, &d.ht[table], key)
 		// 判断相同的key是否已存在
 		// 定位到索引后，从链表(如果存在)往下找
 		he := d.ht[table].table[idx]
+		chainlen = 0
 		for he != nil {
 			if dictCompareKeys(d, key, he.key) {
-				return -1
+				return -1, 0
 			}
+			chainlen++
 			he = he.next
 		}
 		// 如果0号哈希表中没有这个key，并且没有在进行rehash
@@ -811,23 +1353,297 @@ func dictKeyIndex(d *dict, key interface{}) int32 {
 			break
 		}
 	}
-	return idx
+	return idx, chainlen
 }
 
 // 清空所有哈希表节点
-func dictEmpty(d *dict) {
-	d.ht[0] = dictht{}
-	d.ht[1] = dictht{}
+func dictEmpty[K, V any](d *Dict[K, V]) {
+	dictClear(d, &d.ht[0])
+	dictClear(d, &d.ht[1])
 	d.rehshidx = -1
 	d.iterators = 0
 }
 
+// 链长分布统计的长度，链长大于等于 DICT_STATS_VECTLEN-1 的都计入最后一项
+const DICT_STATS_VECTLEN = 50
+
+// 单个哈希表的统计信息
+type DictHtStats struct {
+	// 哈希表编号，0 为主哈希表，1 为 rehash 的目标哈希表
+	TableID int
+	// 哈希表大小
+	TableSize int
+	// 已有节点数量
+	NumElements int
+	// 非空的索引数量
+	UsedBuckets int
+	// 最长的链表长度
+	MaxChainLen int
+	// 所有链表长度之和
+	TotalChainLen int
+	// 链表的平均长度，根据链表长度计算
+	AvgChainLen float64
+	// 链表的平均长度，根据已有节点数量计算
+	AvgChainLenComputed float64
+	// 链长分布，ChainLenHistogram[i] 为长度是 i 的链表数量
+	ChainLenHistogram [DICT_STATS_VECTLEN]int
+}
+
+// 字典的统计信息
+type DictStats struct {
+	// 0号哈希表的统计信息
+	Main DictHtStats
+	// rehash 进行中时1号哈希表的统计信息，否则为nil
+	Rehash *DictHtStats
+	// rehash进行到的索引，不在 rehash 时为-1
+	RehashIdx int
+}
+
+// 统计哈希表 ht 中的链表分布
+func dictGetStatsHt[K, V any](ht *dictht[K, V], tableid int) DictHtStats {
+	stats := DictHtStats{
+		TableID:     tableid,
+		TableSize:   ht.size,
+		NumElements: ht.used,
+	}
+	if ht.used == 0 {
+		return stats
+	}
+	for i := 0; i < ht.size; i++ {
+		if ht.table[i] == nil {
+			stats.ChainLenHistogram[0]++
+			continue
+		}
+		stats.UsedBuckets++
+		// 计算这个索引上的链表长度
+		chainlen := dictChainLen(ht.table[i])
+		if chainlen < DICT_STATS_VECTLEN {
+			stats.ChainLenHistogram[chainlen]++
+		} else {
+			stats.ChainLenHistogram[DICT_STATS_VECTLEN-1]++
+		}
+		if chainlen > stats.MaxChainLen {
+			stats.MaxChainLen = chainlen
+		}
+		stats.TotalChainLen += chainlen
+	}
+	stats.AvgChainLen = float64(stats.TotalChainLen) / float64(stats.UsedBuckets)
+	stats.AvgChainLenComputed = float64(ht.used) / float64(stats.UsedBuckets)
+	return stats
+}
+
+// 返回字典的统计信息，rehash 进行中时同时统计两个哈希表
+func dictGetStats[K, V any](d *Dict[K, V]) *DictStats {
+	stats := &DictStats{
+		Main:      dictGetStatsHt(&d.ht[0], 0),
+		RehashIdx: d.rehshidx,
+	}
+	if dictIsRehashing(d) {
+		rehash := dictGetStatsHt(&d.ht[1], 1)
+		stats.Rehash = &rehash
+	}
+	return stats
+}
+
+// 按 DEBUG HTSTATS 的格式输出单个哈希表的统计信息
+func (s *DictHtStats) String() string {
+	if s.NumElements == 0 {
+		return "No stats available for empty dictionaries\n"
+	}
+	name := "main hash table"
+	if s.TableID != 0 {
+		name = "rehashing target"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Hash table %d stats (%s):\n"+
+		" table size: %d\n"+
+		" number of elements: %d\n"+
+		" different slots: %d\n"+
+		" max chain length: %d\n"+
+		" avg chain length (counted): %.02f\n"+
+		" avg chain length (computed): %.02f\n"+
+		" Chain length distribution:\n",
+		s.TableID, name, s.TableSize, s.NumElements, s.UsedBuckets,
+		s.MaxChainLen, s.AvgChainLen, s.AvgChainLenComputed)
+	for i, n := range s.ChainLenHistogram {
+		if n == 0 {
+			continue
+		}
+		prefix := ""
+		if i == DICT_STATS_VECTLEN-1 {
+			prefix = ">= "
+		}
+		fmt.Fprintf(&b, "   %s%d: %d (%.02f%%)\n", prefix, i, n, float64(n)/float64(s.TableSize)*100)
+	}
+	return b.String()
+}
+
+// 按 DEBUG HTSTATS 的格式输出字典的统计信息
+func (s *DictStats) String() string {
+	str := s.Main.String()
+	if s.Rehash != nil {
+		str += s.Rehash.String()
+		str += fmt.Sprintf("Rehashing index: %d/%d (%.02f%%)\n", s.RehashIdx, s.Main.TableSize,
+			float64(s.RehashIdx)/float64(s.Main.TableSize)*100)
+	}
+	return str
+}
+
 // 开始自动rehash
 func dictEnableResize() {
-	dict_can_resize = 1
+	dict_can_resize.Store(1)
 }
 
 // 关闭自动rehash
 func dictDisableResize() {
-	dict_can_resize = 0
+	dict_can_resize.Store(0)
+}
+
+//================================ 导出的类型安全接口 ====================
+
+// 将key,value 添加到字典中，key已存在时返回false
+func (d *Dict[K, V]) Add(key K, val V) bool {
+	return d.dictAdd(key, val) == DICT_OK
+}
+
+// 添加或替换key对应的值，key原先不存在时返回true
+func (d *Dict[K, V]) Replace(key K, val V) bool {
+	return d.dictReplace(key, val) == 1
+}
+
+// 返回key对应的值，第二个返回值表示key是否存在
+func (d *Dict[K, V]) Find(key K) (V, bool) {
+	return dictFetchValue(d, key)
+}
+
+// 删除key对应的节点，key不存在时返回false
+func (d *Dict[K, V]) Delete(key K) bool {
+	return dictDelete(d, key) == DICT_OK
+}
+
+// 返回字典的已有节点数量
+func (d *Dict[K, V]) Len() int {
+	return dictSize(d)
+}
+
+// 使用安全迭代器遍历字典，fn 返回false时停止遍历
+// 遍历过程中可以对字典进行修改
+func (d *Dict[K, V]) Range(fn func(key K, val V) bool) {
+	iter := dictGetSafeIterator(d)
+	defer dictReleaseIterator(iter)
+	for he := dictNext(iter); he != nil; he = dictNext(iter) {
+		if !fn(he.key, he.v.val) {
+			return
+		}
+	}
+}
+
+// 查看字典是否正在 rehash
+func (d *Dict[K, V]) IsRehashing() bool {
+	return dictIsRehashing(d)
+}
+
+// 在给定的微秒内对字典进行rehash，返回执行的步数
+func (d *Dict[K, V]) RehashMicroseconds(us int64) int {
+	return d.dictRehashMicroseconds(us)
+}
+
+// 字典填充率过低时缩小哈希表，开始了缩小的 rehash 时返回true
+func (d *Dict[K, V]) ResizeIfNeeded() bool {
+	return dictResizeIfNeeded(d)
+}
+
+// 均匀地随机返回一个键值对，字典为空时第三个返回值为false
+func (d *Dict[K, V]) RandomKey() (K, V, bool) {
+	he := dictGetFairRandomKey(d)
+	if he == nil {
+		var key K
+		var val V
+		return key, val, false
+	}
+	return he.key, he.v.val, true
+}
+
+// 从字典中快速取样最多count个键，样本不保证均匀，也可能包含重复的键
+func (d *Dict[K, V]) SomeKeys(count int) []K {
+	entries := dictGetSomeKeys(d, count)
+	keys := make([]K, len(entries))
+	for i, he := range entries {
+		keys[i] = he.key
+	}
+	return keys
+}
+
+// 返回字典的统计信息
+func (d *Dict[K, V]) Stats() *DictStats {
+	return dictGetStats(d)
+}
+
+// 从游标 cursor 开始迭代字典，对迭代到的每个节点调用 fn，返回下次迭代使用的游标
+// 第一次调用时游标为 0，返回 0 表示迭代结束，语义与 SCAN 命令相同
+func (d *Dict[K, V]) Scan(cursor uint64, fn func(key K, val V)) uint64 {
+	return dictScan(d, cursor, func(privdata interface{}, de *DictEntry[K, V]) {
+		fn(de.key, de.v.val)
+	}, nil)
+}
+
+//================================ 计数器字典 ====================
+
+// 键到 int64 的计数器字典
+// 计数保存在节点的整数字段中，不需要装箱，对已有键的增减不会分配内存
+type CounterDict[K any] struct {
+	d *Dict[K, struct{}]
+}
+
+// 创建一个使用给定字典类型的计数器字典，值复制和销毁函数会被忽略
+func NewCounterDict[K any](dtype DictType[K, struct{}]) *CounterDict[K] {
+	dtype.IntegerValues = true
+	return &CounterDict[K]{d: DictCreate(dtype, nil)}
+}
+
+// 将key的计数增加delta，key不存在时以0为初始值，返回增加后的计数
+func (c *CounterDict[K]) IncrBy(key K, delta int64) int64 {
+	he := c.d.dictReplaceRaw(key)
+	return dictIncrSignedIntegerVal(he, delta)
+}
+
+// 返回key的计数，第二个返回值表示key是否存在
+func (c *CounterDict[K]) Get(key K) (int64, bool) {
+	he := dictFind(c.d, key)
+	if he == nil {
+		return 0, false
+	}
+	return dictGetSignedIntegerVal(he), true
+}
+
+// 设置key的计数，key原先不存在时返回true
+func (c *CounterDict[K]) Set(key K, count int64) bool {
+	he := dictFind(c.d, key)
+	added := he == nil
+	if added {
+		he = c.d.dictAddRaw(key)
+	}
+	dictSetSignedIntegerVal(he, count)
+	return added
+}
+
+// 删除key，key不存在时返回false
+func (c *CounterDict[K]) Delete(key K) bool {
+	return c.d.Delete(key)
+}
+
+// 返回计数器的数量
+func (c *CounterDict[K]) Len() int {
+	return dictSize(c.d)
+}
+
+// 遍历所有键和计数，fn 返回false时停止遍历
+func (c *CounterDict[K]) Range(fn func(key K, count int64) bool) {
+	iter := dictGetSafeIterator(c.d)
+	defer dictReleaseIterator(iter)
+	for he := dictNext(iter); he != nil; he = dictNext(iter) {
+		if !fn(he.key, dictGetSignedIntegerVal(he)) {
+			return
+		}
+	}
 }
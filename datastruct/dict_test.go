@@ -0,0 +1,722 @@
+package datastruct
+
+import (
+	"errors"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// 测试使用的字符串哈希函数
+func testStringHash(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64()
+}
+
+func testStringEqual(key1 string, key2 string) bool {
+	return key1 == key2
+}
+
+func newTestStringDict() *Dict[string, int] {
+	return NewDict[string, int](testStringHash, testStringEqual)
+}
+
+func TestDict_Add(t *testing.T) {
+	d := newTestStringDict()
+	if !d.Add("a", 1) || !d.Add("b", 2) {
+		t.Error("Add error")
+	}
+	if d.Add("a", 3) {
+		t.Error("Add existed key should fail")
+	}
+	if d.Len() != 2 {
+		t.Errorf("Len error, %d", d.Len())
+	}
+	if v, ok := d.Find("a"); !ok || v != 1 {
+		t.Errorf("Find error, %d %v", v, ok)
+	}
+	if _, ok := d.Find("c"); ok {
+		t.Error("Find not existed key error")
+	}
+}
+
+func TestDict_Rehash(t *testing.T) {
+	d := newTestStringDict()
+	for i := 0; i < 1000; i++ {
+		d.Add(strconv.Itoa(i), i)
+		// rehash 过程中的每一步都应该能找到所有已插入的键
+		for j := 0; j <= i; j += 97 {
+			if v, ok := d.Find(strconv.Itoa(j)); !ok || v != j {
+				t.Fatalf("Find %d error during rehash", j)
+			}
+		}
+	}
+	if d.Len() != 1000 {
+		t.Errorf("Len error, %d", d.Len())
+	}
+	for d.dictRehash(100) != 0 {
+	}
+	if dictIsRehashing(d) || d.ht[0].size < 1000 {
+		t.Errorf("rehash not finished, size %d", d.ht[0].size)
+	}
+}
+
+func TestDict_Replace(t *testing.T) {
+	d := newTestStringDict()
+	if !d.Replace("a", 1) {
+		t.Error("Replace new key should return true")
+	}
+	if d.Replace("a", 2) {
+		t.Error("Replace existed key should return false")
+	}
+	if v, _ := d.Find("a"); v != 2 || d.Len() != 1 {
+		t.Errorf("Replace error, %d", v)
+	}
+}
+
+func TestDict_Delete(t *testing.T) {
+	freed := 0
+	d := DictCreate(DictType[string, int]{
+		HashFunction: testStringHash,
+		ValDestructor: func(privdata interface{}, obj int) {
+			freed++
+		},
+	}, nil)
+	for i := 0; i < 100; i++ {
+		d.Add(strconv.Itoa(i), i)
+	}
+	for i := 0; i < 100; i += 2 {
+		if !d.Delete(strconv.Itoa(i)) {
+			t.Fatalf("Delete %d error", i)
+		}
+	}
+	if d.Delete("0") {
+		t.Error("Delete not existed key should fail")
+	}
+	if d.Len() != 50 || freed != 50 {
+		t.Errorf("Delete error, len %d freed %d", d.Len(), freed)
+	}
+	if _, ok := d.Find("1"); !ok {
+		t.Error("Find error after Delete")
+	}
+}
+
+func TestDict_Range(t *testing.T) {
+	d := newTestStringDict()
+	for i := 0; i < 100; i++ {
+		d.Add(strconv.Itoa(i), i)
+	}
+	sum, count := 0, 0
+	d.Range(func(key string, val int) bool {
+		if key != strconv.Itoa(val) {
+			t.Errorf("Range key %s val %d", key, val)
+		}
+		sum += val
+		count++
+		return true
+	})
+	if count != 100 || sum != 4950 {
+		t.Errorf("Range error, count %d sum %d", count, sum)
+	}
+
+	count = 0
+	d.Range(func(key string, val int) bool {
+		count++
+		return count < 10
+	})
+	if count != 10 || d.iterators != 0 {
+		t.Errorf("Range stop error, count %d iterators %d", count, d.iterators)
+	}
+}
+
+func TestDictGenHashFunction(t *testing.T) {
+	oldSeed := DictGetHashFunctionSeed()
+	defer DictSetHashFunctionSeed(oldSeed)
+
+	// 期望值由 Redis 3.0 的 C 实现 dictGenHashFunction 在种子为5381时计算得到
+	DictSetHashFunctionSeed(5381)
+	vectors := []struct {
+		key  string
+		hash uint32
+	}{
+		{"", 0x0342ce6c},
+		{"a", 0x43505283},
+		{"ab", 0xb0d6881b},
+		{"abc", 0xb3377ff6},
+		{"abcd", 0xc1e5ff86},
+		{"abcde", 0x0fc28c84},
+		{"hello world", 0x0dd8a7f9},
+		{"redis", 0xb141ee18},
+		{"\xff\xfe\x80", 0x451e7b87},
+	}
+	for _, v := range vectors {
+		if h := DictGenHashFunction([]byte(v.key)); h != v.hash {
+			t.Errorf("DictGenHashFunction(%q) = %#08x, want %#08x", v.key, h, v.hash)
+		}
+	}
+
+	keys := [][]byte{[]byte(""), []byte("a"), []byte("ab"), []byte("abc"), []byte("abcd"), []byte("abcde")}
+	seen := make(map[uint32]bool)
+	for _, key := range keys {
+		h := DictGenHashFunction(key)
+		if h != DictGenHashFunction(key) {
+			t.Errorf("hash of %q not stable", key)
+		}
+		seen[h] = true
+	}
+	if len(seen) != len(keys) {
+		t.Errorf("unexpected collisions, %d", len(seen))
+	}
+
+	murmur, sip := DictGenHashFunction(keys[3]), DictGenSipHashFunction(keys[3])
+	DictSetHashFunctionSeed(oldSeed + 1)
+	if murmur == DictGenHashFunction(keys[3]) || sip == DictGenSipHashFunction(keys[3]) {
+		t.Error("hash should depend on seed")
+	}
+}
+
+func TestStringCaseDictType(t *testing.T) {
+	d := DictCreate(StringCaseDictType[int](), nil)
+	d.Add("Set", 1)
+	if v, ok := d.Find("SET"); !ok || v != 1 {
+		t.Error("case insensitive Find error")
+	}
+	if d.Add("set", 2) {
+		t.Error("case insensitive Add error")
+	}
+
+	sd := DictCreate(sdsDictType[int](), nil)
+	sd.Add(sdsNew("key"), 1)
+	if _, ok := sd.Find(sdsNew("key")); !ok {
+		t.Error("sds dict Find error")
+	}
+	if _, ok := sd.Find(sdsNew("KEY")); ok {
+		t.Error("sds dict should be case sensitive")
+	}
+}
+
+func TestMurmurDictType(t *testing.T) {
+	bd := DictCreate(BytesMurmurDictType[int](), nil)
+	bd.Add([]byte("key"), 1)
+	if v, ok := bd.Find([]byte("key")); !ok || v != 1 {
+		t.Error("bytes murmur dict Find error")
+	}
+
+	d := DictCreate(StringMurmurDictType[int](), nil)
+	for i := 0; i < 1000; i++ {
+		d.Add(strconv.Itoa(i), i)
+	}
+	for i := 0; i < 1000; i++ {
+		if v, ok := d.Find(strconv.Itoa(i)); !ok || v != i {
+			t.Fatalf("string murmur dict Find %d error", i)
+		}
+	}
+	if got, want := d.dtype.HashFunction("abc"), uint64(DictGenHashFunction([]byte("abc"))); got != want {
+		t.Errorf("string murmur hash %x, want %x", got, want)
+	}
+
+	sd := DictCreate(sdsMurmurDictType[int](), nil)
+	key := sdsNew("key")
+	sd.Add(key, 1)
+	if _, ok := sd.Find(sdsNew("key")); !ok {
+		t.Error("sds murmur dict Find error")
+	}
+	if _, ok := sd.Find(sdsNew("KEY")); ok {
+		t.Error("sds murmur dict should be case sensitive")
+	}
+}
+
+func TestRev(t *testing.T) {
+	if rev(1) != 1<<63 || rev(0) != 0 || rev(0xf0) != 0x0f00000000000000 {
+		t.Error("rev error")
+	}
+}
+
+func TestDict_Scan(t *testing.T) {
+	d := newTestStringDict()
+	for i := 0; i < 500; i++ {
+		d.Add(strconv.Itoa(i), i)
+	}
+	seen := make(map[string]int)
+	cursor := d.Scan(0, func(key string, val int) { seen[key]++ })
+	for cursor != 0 {
+		cursor = d.Scan(cursor, func(key string, val int) { seen[key]++ })
+	}
+	if len(seen) != 500 {
+		t.Errorf("Scan error, %d", len(seen))
+	}
+
+	// 空字典直接返回0
+	if newTestStringDict().Scan(0, func(key string, val int) {}) != 0 {
+		t.Error("Scan empty dict error")
+	}
+}
+
+// 在两次 Scan 调用之间随机插入、删除节点，扩展、收缩哈希表并执行 rehash，
+// 整个迭代期间一直存在的节点都必须至少被返回一次
+func TestDict_ScanDuringRehash(t *testing.T) {
+	for seed := int64(1); seed <= 50; seed++ {
+		r := rand.New(rand.NewSource(seed))
+		d := newTestStringDict()
+		// 迭代期间不会被删除的键
+		stable := make(map[string]bool)
+		for i := 0; i < 50+r.Intn(500); i++ {
+			key := "s" + strconv.Itoa(i)
+			d.Add(key, i)
+			stable[key] = true
+		}
+		// 迭代期间会被插入和删除的键
+		var volatile []string
+		next := 0
+
+		seen := make(map[string]bool)
+		cursor := uint64(0)
+		for {
+			cursor = d.Scan(cursor, func(key string, val int) { seen[key] = true })
+			if cursor == 0 {
+				break
+			}
+			switch r.Intn(5) {
+			case 0:
+				// 批量插入，触发扩展
+				for n := r.Intn(200); n > 0 && len(volatile) < 1000; n-- {
+					key := "v" + strconv.Itoa(next)
+					next++
+					d.Add(key, next)
+					volatile = append(volatile, key)
+				}
+			case 1:
+				// 批量删除后尝试收缩
+				for len(volatile) > 0 && r.Intn(20) != 0 {
+					d.Delete(volatile[len(volatile)-1])
+					volatile = volatile[:len(volatile)-1]
+				}
+				d.dictResize()
+			case 2:
+				d.dictRehash(1 + r.Intn(3))
+			case 3:
+				if !dictIsRehashing(d) && d.ht[0].size < 4096 {
+					d.dictExpand(d.ht[0].size * 4)
+				}
+			}
+		}
+		for key := range stable {
+			if !seen[key] {
+				t.Fatalf("seed %d: key %s not returned by Scan", seed, key)
+			}
+		}
+	}
+}
+
+func TestDictFingerprint(t *testing.T) {
+	d := newTestStringDict()
+	for i := 0; i < 10; i++ {
+		d.Add(strconv.Itoa(i), i)
+	}
+
+	// 只读的不安全迭代
+	iter := dictGetIterator(d)
+	count := 0
+	for he := dictNext(iter); he != nil; he = dictNext(iter) {
+		count++
+	}
+	if err := dictReleaseIterator(iter); err != nil || count != 10 {
+		t.Errorf("unsafe iterator error, count %d err %v", count, err)
+	}
+
+	// 迭代期间修改字典
+	iter = dictGetIterator(d)
+	dictNext(iter)
+	d.Add("new", 1)
+	err := dictReleaseIterator(iter)
+	var misuse *DictIteratorMisuseError
+	if !errors.As(err, &misuse) || misuse.Expected == misuse.Actual {
+		t.Errorf("expect DictIteratorMisuseError, got %v", err)
+	}
+
+	// 安全迭代器允许修改字典
+	iter = dictGetSafeIterator(d)
+	for he := dictNext(iter); he != nil; he = dictNext(iter) {
+		dictDelete(d, he.key)
+	}
+	if err := dictReleaseIterator(iter); err != nil || d.Len() != 0 || d.iterators != 0 {
+		t.Errorf("safe iterator error, len %d err %v", d.Len(), err)
+	}
+}
+
+func TestDictGetStats(t *testing.T) {
+	d := newTestStringDict()
+	if str := d.Stats().String(); str != "No stats available for empty dictionaries\n" {
+		t.Errorf("empty dict stats error, %q", str)
+	}
+
+	for i := 0; i < 100; i++ {
+		d.Add(strconv.Itoa(i), i)
+	}
+	for d.dictRehash(100) != 0 {
+	}
+	stats := d.Stats()
+	if stats.Rehash != nil || stats.RehashIdx != -1 {
+		t.Error("stats should not contain rehash table")
+	}
+	main := stats.Main
+	if main.TableSize != 128 || main.NumElements != 100 || main.TotalChainLen != 100 {
+		t.Errorf("stats error, %+v", main)
+	}
+	buckets := 0
+	for _, n := range main.ChainLenHistogram {
+		buckets += n
+	}
+	if buckets != main.TableSize || main.ChainLenHistogram[0] != main.TableSize-main.UsedBuckets {
+		t.Errorf("histogram error, %v", main.ChainLenHistogram)
+	}
+	if !strings.HasPrefix(stats.String(), "Hash table 0 stats (main hash table):\n table size: 128\n number of elements: 100\n") {
+		t.Errorf("stats string error, %s", stats.String())
+	}
+
+	// rehash 进行中时同时输出两个哈希表
+	d.dictExpand(256)
+	d.dictRehash(1)
+	stats = d.Stats()
+	if stats.Rehash == nil || stats.Rehash.TableSize != 256 ||
+		stats.Main.NumElements+stats.Rehash.NumElements != 100 {
+		t.Errorf("rehash stats error, %+v", stats.Rehash)
+	}
+	if !strings.Contains(stats.String(), "Hash table 1 stats (rehashing target):") ||
+		!strings.Contains(stats.String(), "Rehashing index: ") {
+		t.Errorf("rehash stats string error, %s", stats.String())
+	}
+}
+
+func TestDict_ShrinkAfterDelete(t *testing.T) {
+	d := newTestStringDict()
+	for i := 0; i < 10000; i++ {
+		d.Add(strconv.Itoa(i), i)
+	}
+	for d.dictRehash(100) != 0 {
+	}
+	if d.ht[0].size != 16384 {
+		t.Fatalf("size error, %d", d.ht[0].size)
+	}
+
+	// 删除时不缩小，填充率低于10%时由 ResizeIfNeeded 缩小
+	for i := 0; i < 9990; i++ {
+		d.Delete(strconv.Itoa(i))
+	}
+	if dictIsRehashing(d) || d.ht[0].size != 16384 {
+		t.Fatalf("delete should not resize, size %d", d.ht[0].size)
+	}
+	if !d.ResizeIfNeeded() {
+		t.Fatal("ResizeIfNeeded should shrink")
+	}
+	for d.dictRehash(100) != 0 {
+	}
+	if d.ht[0].size > 64 || d.Len() != 10 || len(d.ht[0].table) != d.ht[0].size {
+		t.Errorf("table not shrunk after delete, size %d", d.ht[0].size)
+	}
+	for i := 9990; i < 10000; i++ {
+		if v, ok := d.Find(strconv.Itoa(i)); !ok || v != i {
+			t.Fatalf("Find %d error after shrink", i)
+		}
+	}
+
+	// 全部删除后由调度器缩小到初始大小
+	for i := 9990; i < 10000; i++ {
+		d.Delete(strconv.Itoa(i))
+	}
+	scheduler := NewDictRehashScheduler(time.Second)
+	scheduler.Register(d)
+	if stats := scheduler.Tick(); stats.Resized != 1 {
+		t.Errorf("scheduler should shrink, %+v", stats)
+	}
+	if d.ht[0].size != DICT_HT_INITIAL_SIZE {
+		t.Errorf("empty dict not shrunk, size %d", d.ht[0].size)
+	}
+}
+
+// Scan 的回调中删除节点不会开始缩小，所有节点都会被访问到
+func TestDict_DeleteDuringScan(t *testing.T) {
+	d := newTestStringDict()
+	for i := 0; i < 10000; i++ {
+		d.Add(strconv.Itoa(i), i)
+	}
+	for d.dictRehash(100) != 0 {
+	}
+
+	visited := make(map[string]bool)
+	cursor := uint64(0)
+	for {
+		cursor = d.Scan(cursor, func(key string, val int) {
+			visited[key] = true
+			d.Delete(key)
+		})
+		if dictIsRehashing(d) {
+			t.Fatal("delete during scan started rehash")
+		}
+		if cursor == 0 {
+			break
+		}
+	}
+	if len(visited) != 10000 || d.Len() != 0 {
+		t.Errorf("visited %d keys, %d left", len(visited), d.Len())
+	}
+}
+
+func TestHtNeedsResize(t *testing.T) {
+	d := newTestStringDict()
+	for i := 0; i < 1000; i++ {
+		d.Add(strconv.Itoa(i), i)
+	}
+	for d.dictRehash(100) != 0 {
+	}
+
+	// 关闭 resize 期间删除不会缩小
+	dictDisableResize()
+	for i := 0; i < 990; i++ {
+		d.Delete(strconv.Itoa(i))
+	}
+	dictEnableResize()
+	if !htNeedsResize(d) || dictIsRehashing(d) || d.ht[0].size != 1024 {
+		t.Fatalf("dict should need resize, size %d", d.ht[0].size)
+	}
+
+	// 由调度器周期性地缩小
+	s := NewDictRehashScheduler(time.Millisecond)
+	s.Register(d)
+	stats := s.Tick()
+	if stats.Resized != 1 {
+		t.Errorf("tick should resize dict, %+v", stats)
+	}
+	for dictIsRehashing(d) {
+		s.Tick()
+	}
+	if htNeedsResize(d) || d.ht[0].size != 16 {
+		t.Errorf("dict not resized, size %d", d.ht[0].size)
+	}
+}
+
+// 卡方检验的临界值，使用 Wilson-Hilferty 近似，显著性水平为 0.0001
+func chiSquareCritical(df int) float64 {
+	const z = 3.719
+	k := float64(df)
+	v := 1 - 2/(9*k) + z*math.Sqrt(2/(9*k))
+	return k * v * v * v
+}
+
+// 对字典调用n次取样函数，检验每个键被选中的次数是否服从均匀分布
+func checkUniform[V any](t *testing.T, d *Dict[string, V], samples int, pick func() *DictEntry[string, V]) {
+	t.Helper()
+	counts := make(map[string]int)
+	for i := 0; i < samples; i++ {
+		counts[pick().key]++
+	}
+	keys := dictSize(d)
+	expected := float64(samples) / float64(keys)
+	chi2 := 0.0
+	d.Range(func(key string, val V) bool {
+		diff := float64(counts[key]) - expected
+		chi2 += diff * diff / expected
+		return true
+	})
+	if critical := chiSquareCritical(keys - 1); chi2 > critical {
+		t.Errorf("distribution not uniform, chi2 %.2f > %.2f", chi2, critical)
+	}
+}
+
+func TestDictGetFairRandomKey(t *testing.T) {
+	if dictGetFairRandomKey(newTestStringDict()) != nil {
+		t.Error("empty dict should return nil")
+	}
+
+	d := newTestStringDict()
+	for i := 0; i < 200; i++ {
+		d.Add(strconv.Itoa(i), i)
+	}
+	checkUniform(t, d, 100000, func() *DictEntry[string, int] { return dictGetFairRandomKey(d) })
+
+	// 哈希函数分布很差、链表长短不一时依然是均匀的
+	skewed := NewDict[string, int](func(key string) uint64 {
+		return testStringHash(key) % 7 * 3
+	}, testStringEqual)
+	for i := 0; i < 200; i++ {
+		skewed.Add(strconv.Itoa(i), i)
+	}
+	checkUniform(t, skewed, 100000, func() *DictEntry[string, int] { return dictGetFairRandomKey(skewed) })
+
+	// rehash 进行中(存在安全迭代器时 rehash 暂停)
+	for d.dictRehash(100) != 0 {
+	}
+	d.dictExpand(1024)
+	d.dictRehash(20)
+	iter := dictGetSafeIterator(d)
+	dictNext(iter)
+	checkUniform(t, d, 100000, func() *DictEntry[string, int] { return dictGetFairRandomKey(d) })
+	if !dictIsRehashing(d) {
+		t.Error("dict should be rehashing")
+	}
+	dictReleaseIterator(iter)
+}
+
+// 计算哈希表中最长的链表长度
+func dictMaxChainLen[K, V any](ht *dictht[K, V]) int {
+	maxchain := 0
+	for i := 0; i < ht.size; i++ {
+		if chainlen := dictChainLen(ht.table[i]); chainlen > maxchain {
+			maxchain = chainlen
+		}
+	}
+	return maxchain
+}
+
+// 插入、删除和 rehash 过程中，maxchain 始终等于实际的最长链表长度
+func TestDictMaxChain(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	d := NewDict[string, int](func(key string) uint64 {
+		return testStringHash(key) % 64
+	}, testStringEqual)
+	for i := 0; i < 20000; i++ {
+		key := strconv.Itoa(r.Intn(2000))
+		if r.Intn(3) == 0 {
+			d.Delete(key)
+		} else {
+			d.Add(key, i)
+		}
+		for table := 0; table <= 1; table++ {
+			if maxchain := dictMaxChainLen(&d.ht[table]); maxchain != d.ht[table].maxchain {
+				t.Fatalf("table %d maxchain %d != %d", table, d.ht[table].maxchain, maxchain)
+			}
+		}
+	}
+
+	// 删除后 maxchain 随之减少
+	for i := 0; i < 2000; i++ {
+		d.Delete(strconv.Itoa(i))
+	}
+	if d.ht[0].maxchain != 0 || d.ht[1].maxchain != 0 {
+		t.Errorf("maxchain %d %d after deleting all keys", d.ht[0].maxchain, d.ht[1].maxchain)
+	}
+}
+
+func TestDictGetSomeKeys(t *testing.T) {
+	d := newTestStringDict()
+	if len(dictGetSomeKeys(d, 10)) != 0 {
+		t.Error("empty dict should return no keys")
+	}
+	for i := 0; i < 1000; i++ {
+		d.Add(strconv.Itoa(i), i)
+	}
+	for d.dictRehash(100) != 0 {
+	}
+
+	keys := d.SomeKeys(20)
+	if len(keys) == 0 || len(keys) > 20 {
+		t.Errorf("SomeKeys error, %d", len(keys))
+	}
+	for _, key := range keys {
+		if _, ok := d.Find(key); !ok {
+			t.Errorf("SomeKeys returned unknown key %s", key)
+		}
+	}
+
+	// rehash 进行中时从两个哈希表中取样
+	d.dictExpand(4096)
+	d.dictRehash(300)
+	fromTable := [2]int{}
+	for n := 0; n < 100; n++ {
+		iter := dictGetSafeIterator(d)
+		dictNext(iter)
+		for _, he := range dictGetSomeKeys(d, 10) {
+			if dictFindNoRehash(d, he.key) != he {
+				t.Fatal("dictGetSomeKeys returned unknown entry")
+			}
+			// 0号哈希表中 rehshidx 之前的索引上的节点都已经迁移到1号哈希表
+			if dictHashIndex(d, &d.ht[0], he.key) < d.rehshidx {
+				fromTable[1]++
+			} else {
+				fromTable[0]++
+			}
+		}
+		dictReleaseIterator(iter)
+	}
+	if fromTable[0] == 0 || fromTable[1] == 0 {
+		t.Errorf("dictGetSomeKeys should sample both tables, %v", fromTable)
+	}
+
+	// count 大于节点数量时最多返回全部节点
+	if n := len(dictGetSomeKeys(d, 5000)); n > 1000 {
+		t.Errorf("dictGetSomeKeys returned too many keys, %d", n)
+	}
+}
+
+func TestDictIncrVal(t *testing.T) {
+	d := newTestStringDict()
+	d.Add("a", 0)
+	he := dictFind(d, "a")
+	if dictIncrSignedIntegerVal(he, 5) != 5 || dictIncrSignedIntegerVal(he, -8) != -3 {
+		t.Error("dictIncrSignedIntegerVal error")
+	}
+	// 整数和浮点数共用一个字，与 C 中的 union 相同
+	if dictGetUnsignedIntegerVal(he) != math.MaxUint64-2 {
+		t.Errorf("unsigned view of -3 error, %d", dictGetUnsignedIntegerVal(he))
+	}
+	dictSetUnsignedIntegerVal(he, 0)
+	if dictIncrUnsignedIntegerVal(he, 3) != 3 || dictGetUnsignedIntegerVal(he) != 3 || dictGetSignedIntegerVal(he) != 3 {
+		t.Error("dictIncrUnsignedIntegerVal error")
+	}
+	dictSetDoubleVal(he, 1.5)
+	if dictIncrDoubleVal(he, 0.25) != 1.75 || dictGetDoubleVal(he) != 1.75 {
+		t.Error("dictIncrDoubleVal error")
+	}
+	if dictGetUnsignedIntegerVal(he) != math.Float64bits(1.75) {
+		t.Error("double bits error")
+	}
+	if v, _ := d.Find("a"); v != 0 {
+		t.Errorf("val changed by integer value, %d", v)
+	}
+
+	// 计数器字典的值只占用一个字
+	if size := unsafe.Sizeof(dictValue[struct{}]{}); size != 8 {
+		t.Errorf("dictValue[struct{}] size %d", size)
+	}
+}
+
+func TestCounterDict(t *testing.T) {
+	c := NewCounterDict(StringDictType[struct{}]())
+	if c.IncrBy("a", 1) != 1 || c.IncrBy("a", 2) != 3 || c.IncrBy("b", -1) != -1 {
+		t.Error("IncrBy error")
+	}
+	if n, ok := c.Get("a"); !ok || n != 3 {
+		t.Errorf("Get error, %d", n)
+	}
+	if _, ok := c.Get("c"); ok {
+		t.Error("Get not existed key error")
+	}
+	if !c.Set("c", 10) || c.Set("c", 20) {
+		t.Error("Set error")
+	}
+	sum := int64(0)
+	c.Range(func(key string, count int64) bool {
+		sum += count
+		return true
+	})
+	if c.Len() != 3 || sum != 22 {
+		t.Errorf("Range error, len %d sum %d", c.Len(), sum)
+	}
+	if !c.Delete("b") || c.Len() != 2 {
+		t.Error("Delete error")
+	}
+
+	// 已有键的增减不分配内存
+	allocs := testing.AllocsPerRun(1000, func() {
+		c.IncrBy("a", 1)
+	})
+	if allocs != 0 {
+		t.Errorf("IncrBy allocates, %v", allocs)
+	}
+}
@@ -0,0 +1,254 @@
+/*
+整数集合(intset)实现，与 Redis 3.0 的 intset.c 对应，字节格式完全相同
+
+整数集合是一块连续的内存，布局如下：
+
+	<encoding><length><contents>
+
+encoding: uint32，每个元素占用的字节数，为 2、4 或 8
+length:   uint32，元素数量
+contents: 从小到大排列的元素，没有重复
+
+所有的整数都以小端序保存。添加的元素超出当前编码的范围时，
+整个集合会升级为更大的编码，升级后不会再降级。
+
+与压缩列表一样，Go 中以 []byte 表示整数集合，修改整数集合的函数会返回新的整数集合，之后只能使用返回值。
+*/
+package datastruct
+
+import (
+	"encoding/binary"
+	"math"
+	"math/rand"
+)
+
+// 整数集合的编码，即每个元素占用的字节数
+const (
+	INTSET_ENC_INT16 = 2
+	INTSET_ENC_INT32 = 4
+	INTSET_ENC_INT64 = 8
+)
+
+// 整数集合头部的大小: encoding + length
+const INTSET_HEADER_SIZE = 4 + 4
+
+// 返回保存 v 所需的编码
+func intsetValueEncoding(v int64) int {
+	if v < math.MinInt32 || v > math.MaxInt32 {
+		return INTSET_ENC_INT64
+	} else if v < math.MinInt16 || v > math.MaxInt16 {
+		return INTSET_ENC_INT32
+	}
+	return INTSET_ENC_INT16
+}
+
+// 整数集合的编码
+func intsetEncoding(is []byte) int {
+	return int(binary.LittleEndian.Uint32(is[0:]))
+}
+
+func intsetSetEncoding(is []byte, encoding int) {
+	binary.LittleEndian.PutUint32(is[0:], uint32(encoding))
+}
+
+// 整数集合的元素数量
+func intsetLength(is []byte) int {
+	return int(binary.LittleEndian.Uint32(is[4:]))
+}
+
+func intsetSetLength(is []byte, length int) {
+	binary.LittleEndian.PutUint32(is[4:], uint32(length))
+}
+
+// 按给定的编码读取 pos 处的元素
+func intsetGetEncoded(is []byte, pos int, encoding int) int64 {
+	p := INTSET_HEADER_SIZE + pos*encoding
+	switch encoding {
+	case INTSET_ENC_INT64:
+		return int64(binary.LittleEndian.Uint64(is[p:]))
+	case INTSET_ENC_INT32:
+		return int64(int32(binary.LittleEndian.Uint32(is[p:])))
+	default:
+		return int64(int16(binary.LittleEndian.Uint16(is[p:])))
+	}
+}
+
+// 按集合当前的编码读取 pos 处的元素
+func intsetGetAt(is []byte, pos int) int64 {
+	return intsetGetEncoded(is, pos, intsetEncoding(is))
+}
+
+// 按集合当前的编码将 value 写入 pos 处
+func intsetSet(is []byte, pos int, value int64) {
+	encoding := intsetEncoding(is)
+	p := INTSET_HEADER_SIZE + pos*encoding
+	switch encoding {
+	case INTSET_ENC_INT64:
+		binary.LittleEndian.PutUint64(is[p:], uint64(value))
+	case INTSET_ENC_INT32:
+		binary.LittleEndian.PutUint32(is[p:], uint32(int32(value)))
+	default:
+		binary.LittleEndian.PutUint16(is[p:], uint16(int16(value)))
+	}
+}
+
+// 创建一个空的整数集合
+func intsetNew() []byte {
+	is := make([]byte, INTSET_HEADER_SIZE)
+	intsetSetEncoding(is, INTSET_ENC_INT16)
+	intsetSetLength(is, 0)
+	return is
+}
+
+// 调整整数集合的大小，使其可以保存 length 个元素
+func intsetResize(is []byte, length int) []byte {
+	n := INTSET_HEADER_SIZE + length*intsetEncoding(is)
+	if n <= cap(is) {
+		return is[:n]
+	}
+	newIs := make([]byte, n, n+n/2)
+	copy(newIs, is)
+	return newIs
+}
+
+// 查找 value，找到时返回其位置和true，
+// 找不到时返回 value 应当插入的位置和false
+func intsetSearch(is []byte, value int64) (int, bool) {
+	length := intsetLength(is)
+	// 集合为空时不可能找到
+	if length == 0 {
+		return 0, false
+	}
+	// 比最大值大或者比最小值小时不可能找到
+	if value > intsetGetAt(is, length-1) {
+		return length, false
+	} else if value < intsetGetAt(is, 0) {
+		return 0, false
+	}
+
+	// 二分查找
+	min, max := 0, length-1
+	for max >= min {
+		mid := int(uint(min+max) >> 1)
+		cur := intsetGetAt(is, mid)
+		if value > cur {
+			min = mid + 1
+		} else if value < cur {
+			max = mid - 1
+		} else {
+			return mid, true
+		}
+	}
+	return min, false
+}
+
+// 将整数集合升级为 value 的编码，并添加 value
+// value 超出了当前编码的范围，所以一定比所有元素大或者比所有元素小
+func intsetUpgradeAndAdd(is []byte, value int64) []byte {
+	curenc := intsetEncoding(is)
+	newenc := intsetValueEncoding(value)
+	length := intsetLength(is)
+	// value 为负数时添加到表头，否则添加到表尾
+	prepend := 0
+	if value < 0 {
+		prepend = 1
+	}
+
+	intsetSetEncoding(is, newenc)
+	is = intsetResize(is, length+1)
+
+	// 从后向前移动元素，避免覆盖还没有移动的元素
+	for i := length - 1; i >= 0; i-- {
+		intsetSet(is, i+prepend, intsetGetEncoded(is, i, curenc))
+	}
+
+	if prepend == 1 {
+		intsetSet(is, 0, value)
+	} else {
+		intsetSet(is, length, value)
+	}
+	intsetSetLength(is, length+1)
+	return is
+}
+
+// 将 from 及其之后的元素移动到 to 处
+func intsetMoveTail(is []byte, from int, to int) {
+	encoding := intsetEncoding(is)
+	length := intsetLength(is)
+	src := INTSET_HEADER_SIZE + from*encoding
+	dst := INTSET_HEADER_SIZE + to*encoding
+	copy(is[dst:], is[src:INTSET_HEADER_SIZE+length*encoding])
+}
+
+// 添加 value，返回新的整数集合，value 已存在时第二个返回值为false
+func intsetAdd(is []byte, value int64) ([]byte, bool) {
+	// value 超出当前编码的范围时需要升级，并且 value 一定不存在
+	if intsetValueEncoding(value) > intsetEncoding(is) {
+		return intsetUpgradeAndAdd(is, value), true
+	}
+
+	pos, found := intsetSearch(is, value)
+	if found {
+		return is, false
+	}
+
+	length := intsetLength(is)
+	is = intsetResize(is, length+1)
+	if pos < length {
+		intsetMoveTail(is, pos, pos+1)
+	}
+	intsetSet(is, pos, value)
+	intsetSetLength(is, length+1)
+	return is, true
+}
+
+// 删除 value，返回新的整数集合，value 不存在时第二个返回值为false
+func intsetRemove(is []byte, value int64) ([]byte, bool) {
+	if intsetValueEncoding(value) > intsetEncoding(is) {
+		return is, false
+	}
+	pos, found := intsetSearch(is, value)
+	if !found {
+		return is, false
+	}
+
+	length := intsetLength(is)
+	if pos < length-1 {
+		intsetMoveTail(is, pos+1, pos)
+	}
+	is = intsetResize(is, length-1)
+	intsetSetLength(is, length-1)
+	return is, true
+}
+
+// 查看 value 是否在整数集合中
+func intsetFind(is []byte, value int64) bool {
+	if intsetValueEncoding(value) > intsetEncoding(is) {
+		return false
+	}
+	_, found := intsetSearch(is, value)
+	return found
+}
+
+// 随机返回一个元素，集合不能为空
+func intsetRandom(is []byte) int64 {
+	return intsetGetAt(is, rand.Intn(intsetLength(is)))
+}
+
+// 返回 pos 处的元素，pos 超出范围时第二个返回值为false
+func intsetGet(is []byte, pos int) (int64, bool) {
+	if pos < 0 || pos >= intsetLength(is) {
+		return 0, false
+	}
+	return intsetGetAt(is, pos), true
+}
+
+// 返回整数集合的元素数量
+func intsetLen(is []byte) int {
+	return intsetLength(is)
+}
+
+// 返回整数集合占用的字节数
+func intsetBlobLen(is []byte) int {
+	return INTSET_HEADER_SIZE + intsetLength(is)*intsetEncoding(is)
+}
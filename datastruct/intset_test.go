@@ -0,0 +1,193 @@
+package datastruct
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// 检查整数集合是否有序、没有重复，并返回其中的所有元素
+func checkIntset(t *testing.T, is []byte) []int64 {
+	t.Helper()
+	if intsetBlobLen(is) != len(is) {
+		t.Fatalf("blob len %d, len %d", intsetBlobLen(is), len(is))
+	}
+	values := make([]int64, 0, intsetLen(is))
+	for pos := 0; pos < intsetLen(is); pos++ {
+		v, ok := intsetGet(is, pos)
+		if !ok {
+			t.Fatalf("get %d failed", pos)
+		}
+		if pos > 0 && v <= values[pos-1] {
+			t.Fatalf("not sorted at %d: %d <= %d", pos, v, values[pos-1])
+		}
+		values = append(values, v)
+	}
+	return values
+}
+
+func TestIntsetValueEncoding(t *testing.T) {
+	tests := []struct {
+		v    int64
+		want int
+	}{
+		{-32768, INTSET_ENC_INT16},
+		{32767, INTSET_ENC_INT16},
+		{-32769, INTSET_ENC_INT32},
+		{32768, INTSET_ENC_INT32},
+		{math.MinInt32, INTSET_ENC_INT32},
+		{math.MaxInt32, INTSET_ENC_INT32},
+		{math.MinInt32 - 1, INTSET_ENC_INT64},
+		{math.MaxInt32 + 1, INTSET_ENC_INT64},
+		{math.MinInt64, INTSET_ENC_INT64},
+		{math.MaxInt64, INTSET_ENC_INT64},
+	}
+	for _, tt := range tests {
+		if got := intsetValueEncoding(tt.v); got != tt.want {
+			t.Errorf("intsetValueEncoding(%d) = %d, want %d", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestIntsetLayout(t *testing.T) {
+	is := intsetNew()
+	for _, v := range []int64{5, 6, 4, 4} {
+		is, _ = intsetAdd(is, v)
+	}
+	want := []byte{2, 0, 0, 0, 3, 0, 0, 0, 4, 0, 5, 0, 6, 0}
+	if !bytes.Equal(is, want) {
+		t.Fatalf("got % x, want % x", is, want)
+	}
+
+	// 升级为 int32，负数添加到表头
+	is, _ = intsetAdd(is, -65536)
+	want = []byte{4, 0, 0, 0, 4, 0, 0, 0, 0, 0, 0xff, 0xff, 4, 0, 0, 0, 5, 0, 0, 0, 6, 0, 0, 0}
+	if !bytes.Equal(is, want) {
+		t.Fatalf("got % x, want % x", is, want)
+	}
+}
+
+func TestIntsetAdd(t *testing.T) {
+	is := intsetNew()
+	var added bool
+	if is, added = intsetAdd(is, 5); !added {
+		t.Error("add 5")
+	}
+	if is, added = intsetAdd(is, 6); !added {
+		t.Error("add 6")
+	}
+	if is, added = intsetAdd(is, 4); !added {
+		t.Error("add 4")
+	}
+	if is, added = intsetAdd(is, 4); added {
+		t.Error("add 4 again")
+	}
+	if got := checkIntset(t, is); !slices.Equal(got, []int64{4, 5, 6}) {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestIntsetUpgrade(t *testing.T) {
+	tests := []struct {
+		from, to int64
+		enc      int
+	}{
+		{32, 65535, INTSET_ENC_INT32},
+		{32, -65535, INTSET_ENC_INT32},
+		{32, 4294967295, INTSET_ENC_INT64},
+		{32, -4294967295, INTSET_ENC_INT64},
+		{65535, 4294967295, INTSET_ENC_INT64},
+		{65535, -4294967295, INTSET_ENC_INT64},
+	}
+	for _, tt := range tests {
+		is, _ := intsetAdd(intsetNew(), tt.from)
+		is, _ = intsetAdd(is, tt.to)
+		if intsetEncoding(is) != tt.enc {
+			t.Errorf("%d,%d: encoding %d, want %d", tt.from, tt.to, intsetEncoding(is), tt.enc)
+		}
+		if !intsetFind(is, tt.from) || !intsetFind(is, tt.to) {
+			t.Errorf("%d,%d: find failed", tt.from, tt.to)
+		}
+		checkIntset(t, is)
+	}
+}
+
+func TestIntsetRemove(t *testing.T) {
+	is := intsetNew()
+	for _, v := range []int64{1, 2, 3, 100000} {
+		is, _ = intsetAdd(is, v)
+	}
+	var removed bool
+	if is, removed = intsetRemove(is, 2); !removed {
+		t.Error("remove 2")
+	}
+	if is, removed = intsetRemove(is, 2); removed {
+		t.Error("remove 2 again")
+	}
+	// 超出当前编码范围的值一定不存在
+	if is, removed = intsetRemove(is, math.MaxInt64); removed {
+		t.Error("remove MaxInt64")
+	}
+	if is, removed = intsetRemove(is, 100000); !removed {
+		t.Error("remove 100000")
+	}
+	if got := checkIntset(t, is); !slices.Equal(got, []int64{1, 3}) {
+		t.Errorf("got %v", got)
+	}
+	// 删除元素后不会降级
+	if intsetEncoding(is) != INTSET_ENC_INT32 {
+		t.Errorf("encoding %d", intsetEncoding(is))
+	}
+}
+
+func TestIntsetStress(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	is := intsetNew()
+	model := make(map[int64]bool)
+	for i := 0; i < 20000; i++ {
+		var v int64
+		switch r.Intn(3) {
+		case 0:
+			v = int64(r.Intn(1000) - 500)
+		case 1:
+			v = int64(r.Int31()) - math.MaxInt32/2
+		default:
+			v = r.Int63() - math.MaxInt64/2
+		}
+		if r.Intn(4) == 0 {
+			var removed bool
+			is, removed = intsetRemove(is, v)
+			if removed != model[v] {
+				t.Fatalf("remove %d = %v", v, removed)
+			}
+			delete(model, v)
+		} else {
+			var added bool
+			is, added = intsetAdd(is, v)
+			if added == model[v] {
+				t.Fatalf("add %d = %v", v, added)
+			}
+			model[v] = true
+		}
+	}
+
+	values := checkIntset(t, is)
+	if len(values) != len(model) {
+		t.Fatalf("len %d, want %d", len(values), len(model))
+	}
+	for _, v := range values {
+		if !model[v] || !intsetFind(is, v) {
+			t.Fatalf("%d should be in intset", v)
+		}
+	}
+	for i := 0; i < 100; i++ {
+		if v := intsetRandom(is); !model[v] {
+			t.Fatalf("random %d not in intset", v)
+		}
+	}
+	if _, ok := intsetGet(is, len(values)); ok {
+		t.Error("get out of range")
+	}
+}
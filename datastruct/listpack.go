@@ -0,0 +1,813 @@
+/*
+紧凑列表(listpack)实现，与 Redis 7 的 listpack.c 对应，字节格式完全相同
+
+紧凑列表是压缩列表的替代，每个节点只记录自身的长度，插入和删除节点不会引起级联更新。
+紧凑列表是一块连续的内存，布局如下：
+
+	<tot-bytes><num-elements><entry><entry>...<entry><end>
+
+tot-bytes:    uint32，整个紧凑列表占用的字节数
+num-elements: uint16，节点数量，等于 UINT16_MAX 时需要遍历整个列表才能得到节点数量
+end:          1字节，固定为 0xFF，表示列表结束
+
+每个节点由以下部分组成：
+
+	<encoding-type><element-data><element-tot-len>
+
+encoding-type: 内容的编码，字符串编码时包含字符串的长度
+  - 0xxxxxxx: 7位无符号整数
+  - 10xxxxxx: 长度不超过63字节的字符串
+  - 110xxxxx|yyyyyyyy: 13位有符号整数
+  - 1110xxxx|yyyyyyyy: 长度不超过4095字节的字符串
+  - 11110000|4字节: 长度更大的字符串，长度为32位小端序
+  - 11110001: int16
+  - 11110010: 24位有符号整数
+  - 11110011: int32
+  - 11110100: int64
+
+element-tot-len: encoding-type 和 element-data 的总长度，占用1到5字节，
+每个字节的低7位保存长度，除第一个字节外最高位为1，从后向前读取时可以知道长度在哪个字节结束
+
+所有的整数都以小端序保存。可以表示为整数的字符串会以整数编码保存。
+
+与压缩列表一样，Go 中以 []byte 表示紧凑列表，以节点的偏移量代替 C 中的指针，-1 表示 C 中的 NULL，
+修改紧凑列表的函数会返回新的紧凑列表，之后只能使用返回值。
+*/
+package datastruct
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strconv"
+)
+
+// 紧凑列表头部的大小: tot-bytes + num-elements
+const LP_HDR_SIZE = 6
+
+// 节点数量未知
+const LP_HDR_NUMELE_UNKNOWN = math.MaxUint16
+
+// 整数编码最多占用的字节数
+const LP_MAX_INT_ENCODING_LEN = 9
+
+// element-tot-len 最多占用的字节数
+const LP_MAX_BACKLEN_SIZE = 5
+
+// 紧凑列表结束标志
+const LP_EOF = 0xFF
+
+// 插入的位置
+const (
+	LP_BEFORE = iota
+	LP_AFTER
+	LP_REPLACE
+)
+
+// 编码的类型
+const (
+	LP_ENCODING_INT = iota
+	LP_ENCODING_STRING
+)
+
+// 节点的编码
+const (
+	LP_ENCODING_7BIT_UINT      = 0
+	LP_ENCODING_7BIT_UINT_MASK = 0x80
+	LP_ENCODING_6BIT_STR       = 0x80
+	LP_ENCODING_6BIT_STR_MASK  = 0xC0
+	LP_ENCODING_13BIT_INT      = 0xC0
+	LP_ENCODING_13BIT_INT_MASK = 0xE0
+	LP_ENCODING_12BIT_STR      = 0xE0
+	LP_ENCODING_12BIT_STR_MASK = 0xF0
+	LP_ENCODING_16BIT_INT      = 0xF1
+	LP_ENCODING_24BIT_INT      = 0xF2
+	LP_ENCODING_32BIT_INT      = 0xF3
+	LP_ENCODING_64BIT_INT      = 0xF4
+	LP_ENCODING_32BIT_STR      = 0xF0
+)
+
+// 整个紧凑列表占用的字节数
+func lpGetTotalBytes(lp []byte) int {
+	return int(binary.LittleEndian.Uint32(lp[0:]))
+}
+
+func lpSetTotalBytes(lp []byte, n int) {
+	binary.LittleEndian.PutUint32(lp[0:], uint32(n))
+}
+
+// 头部记录的节点数量
+func lpGetNumElements(lp []byte) int {
+	return int(binary.LittleEndian.Uint16(lp[4:]))
+}
+
+func lpSetNumElements(lp []byte, n int) {
+	binary.LittleEndian.PutUint16(lp[4:], uint16(n))
+}
+
+// 创建一个空的紧凑列表，capacity 为预先分配的字节数
+func lpNew(capacity int) []byte {
+	n := LP_HDR_SIZE + 1
+	lp := make([]byte, n, max(capacity, n))
+	lpSetTotalBytes(lp, n)
+	lpSetNumElements(lp, 0)
+	lp[LP_HDR_SIZE] = LP_EOF
+	return lp
+}
+
+// 调整紧凑列表的大小为 n 字节，不写入头部和结束标志
+func lpResize(lp []byte, n int) []byte {
+	if n <= cap(lp) {
+		return lp[:n]
+	}
+	newLp := make([]byte, n, n+n/2)
+	copy(newLp, lp)
+	return newLp
+}
+
+// 返回整数 v 的编码，写入 intenc 中，返回编码占用的字节数
+func lpEncodeIntegerGetType(v int64, intenc []byte) int {
+	if v >= 0 && v <= 127 {
+		// 7位无符号整数
+		intenc[0] = byte(v)
+		return 1
+	} else if v >= -4096 && v <= 4095 {
+		// 13位有符号整数
+		if v < 0 {
+			v = (1 << 13) + v
+		}
+		intenc[0] = byte(v>>8) | LP_ENCODING_13BIT_INT
+		intenc[1] = byte(v)
+		return 2
+	} else if v >= math.MinInt16 && v <= math.MaxInt16 {
+		intenc[0] = LP_ENCODING_16BIT_INT
+		binary.LittleEndian.PutUint16(intenc[1:], uint16(v))
+		return 3
+	} else if v >= -(1<<23) && v <= 1<<23-1 {
+		uv := uint32(v)
+		intenc[0] = LP_ENCODING_24BIT_INT
+		intenc[1] = byte(uv)
+		intenc[2] = byte(uv >> 8)
+		intenc[3] = byte(uv >> 16)
+		return 4
+	} else if v >= math.MinInt32 && v <= math.MaxInt32 {
+		intenc[0] = LP_ENCODING_32BIT_INT
+		binary.LittleEndian.PutUint32(intenc[1:], uint32(v))
+		return 5
+	}
+	intenc[0] = LP_ENCODING_64BIT_INT
+	binary.LittleEndian.PutUint64(intenc[1:], uint64(v))
+	return 9
+}
+
+// 返回 ele 的编码类型以及编码后占用的字节数
+// ele 可以表示为整数时返回 LP_ENCODING_INT，编码写入 intenc 中；否则返回 LP_ENCODING_STRING
+func lpEncodeGetType(ele []byte, intenc []byte) (int, int) {
+	if v, ok := string2ll(ele); ok {
+		return LP_ENCODING_INT, lpEncodeIntegerGetType(v, intenc)
+	}
+	size := len(ele)
+	if size < 64 {
+		return LP_ENCODING_STRING, 1 + size
+	} else if size < 4096 {
+		return LP_ENCODING_STRING, 2 + size
+	}
+	return LP_ENCODING_STRING, 5 + size
+}
+
+// 将长度 l 编码为 element-tot-len 写入 buf 中，返回占用的字节数
+// buf 为nil时只计算占用的字节数
+func lpEncodeBacklen(buf []byte, l int) int {
+	if l <= 127 {
+		if buf != nil {
+			buf[0] = byte(l)
+		}
+		return 1
+	} else if l < 16383 {
+		if buf != nil {
+			buf[0] = byte(l >> 7)
+			buf[1] = byte(l&127) | 128
+		}
+		return 2
+	} else if l < 2097151 {
+		if buf != nil {
+			buf[0] = byte(l >> 14)
+			buf[1] = byte((l>>7)&127) | 128
+			buf[2] = byte(l&127) | 128
+		}
+		return 3
+	} else if l < 268435455 {
+		if buf != nil {
+			buf[0] = byte(l >> 21)
+			buf[1] = byte((l>>14)&127) | 128
+			buf[2] = byte((l>>7)&127) | 128
+			buf[3] = byte(l&127) | 128
+		}
+		return 4
+	}
+	if buf != nil {
+		buf[0] = byte(l >> 28)
+		buf[1] = byte((l>>21)&127) | 128
+		buf[2] = byte((l>>14)&127) | 128
+		buf[3] = byte((l>>7)&127) | 128
+		buf[4] = byte(l&127) | 128
+	}
+	return 5
+}
+
+// 从 element-tot-len 的最后一个字节 p 开始向前解码长度
+// 编码不合法时返回 -1
+func lpDecodeBacklen(lp []byte, p int) int {
+	val, shift := 0, 0
+	for {
+		if p < 0 {
+			return -1
+		}
+		val |= int(lp[p]&127) << shift
+		if lp[p]&128 == 0 {
+			break
+		}
+		shift += 7
+		p--
+		if shift > 28 {
+			return -1
+		}
+	}
+	return val
+}
+
+// 将字符串 s 编码后写入 buf 中，buf 必须有足够的空间
+func lpEncodeString(buf []byte, s []byte) {
+	size := len(s)
+	if size < 64 {
+		buf[0] = byte(size) | LP_ENCODING_6BIT_STR
+		copy(buf[1:], s)
+	} else if size < 4096 {
+		buf[0] = byte(size>>8) | LP_ENCODING_12BIT_STR
+		buf[1] = byte(size)
+		copy(buf[2:], s)
+	} else {
+		buf[0] = LP_ENCODING_32BIT_STR
+		binary.LittleEndian.PutUint32(buf[1:], uint32(size))
+		copy(buf[5:], s)
+	}
+}
+
+// 返回 p 处节点 encoding-type 和 element-data 的总长度，不包括 element-tot-len
+// 编码不合法时返回0
+func lpCurrentEncodedSizeUnsafe(lp []byte, p int) int {
+	b := lp[p]
+	switch {
+	case b&LP_ENCODING_7BIT_UINT_MASK == LP_ENCODING_7BIT_UINT:
+		return 1
+	case b&LP_ENCODING_6BIT_STR_MASK == LP_ENCODING_6BIT_STR:
+		return 1 + int(b&0x3F)
+	case b&LP_ENCODING_13BIT_INT_MASK == LP_ENCODING_13BIT_INT:
+		return 2
+	case b == LP_ENCODING_16BIT_INT:
+		return 3
+	case b == LP_ENCODING_24BIT_INT:
+		return 4
+	case b == LP_ENCODING_32BIT_INT:
+		return 5
+	case b == LP_ENCODING_64BIT_INT:
+		return 9
+	case b&LP_ENCODING_12BIT_STR_MASK == LP_ENCODING_12BIT_STR:
+		return 2 + (int(b&0x0F)<<8 | int(lp[p+1]))
+	case b == LP_ENCODING_32BIT_STR:
+		return 5 + int(binary.LittleEndian.Uint32(lp[p+1:]))
+	case b == LP_EOF:
+		return 1
+	}
+	return 0
+}
+
+// 返回读取 p 处节点的长度所需的字节数，编码不合法时返回0
+func lpCurrentEncodedSizeBytes(b byte) int {
+	switch {
+	case b&LP_ENCODING_7BIT_UINT_MASK == LP_ENCODING_7BIT_UINT,
+		b&LP_ENCODING_6BIT_STR_MASK == LP_ENCODING_6BIT_STR,
+		b&LP_ENCODING_13BIT_INT_MASK == LP_ENCODING_13BIT_INT,
+		b == LP_ENCODING_16BIT_INT, b == LP_ENCODING_24BIT_INT,
+		b == LP_ENCODING_32BIT_INT, b == LP_ENCODING_64BIT_INT:
+		return 1
+	case b&LP_ENCODING_12BIT_STR_MASK == LP_ENCODING_12BIT_STR:
+		return 2
+	case b == LP_ENCODING_32BIT_STR:
+		return 5
+	case b == LP_EOF:
+		return 1
+	}
+	return 0
+}
+
+// 跳过 p 处的节点，返回下一个节点(可能是结束标志)的偏移量
+func lpSkip(lp []byte, p int) int {
+	entrylen := lpCurrentEncodedSizeUnsafe(lp, p)
+	entrylen += lpEncodeBacklen(nil, entrylen)
+	return p + entrylen
+}
+
+// 返回 p 的后一个节点，没有后一个节点时返回 -1
+func lpNext(lp []byte, p int) int {
+	p = lpSkip(lp, p)
+	if lp[p] == LP_EOF {
+		return -1
+	}
+	return p
+}
+
+// 返回 p 的前一个节点，没有前一个节点时返回 -1
+// p 为结束标志时返回最后一个节点
+func lpPrev(lp []byte, p int) int {
+	if p == LP_HDR_SIZE {
+		return -1
+	}
+	p--
+	prevlen := lpDecodeBacklen(lp, p)
+	prevlen += lpEncodeBacklen(nil, prevlen)
+	return p - prevlen + 1
+}
+
+// 返回第一个节点，紧凑列表为空时返回 -1
+func lpFirst(lp []byte) int {
+	if lp[LP_HDR_SIZE] == LP_EOF {
+		return -1
+	}
+	return LP_HDR_SIZE
+}
+
+// 返回最后一个节点，紧凑列表为空时返回 -1
+func lpLast(lp []byte) int {
+	return lpPrev(lp, lpGetTotalBytes(lp)-1)
+}
+
+// 返回紧凑列表的节点数量
+func lpLength(lp []byte) int {
+	if n := lpGetNumElements(lp); n != LP_HDR_NUMELE_UNKNOWN {
+		return n
+	}
+	// 节点数量超出了头部的范围，需要遍历统计
+	count := 0
+	for p := lpFirst(lp); p >= 0; p = lpNext(lp, p) {
+		count++
+	}
+	// 数量恢复到可以保存的范围时写回头部
+	if count < LP_HDR_NUMELE_UNKNOWN {
+		lpSetNumElements(lp, count)
+	}
+	return count
+}
+
+// 读取 p 处节点的值
+// 字符串编码时返回的 vstr 不为nil，它与紧凑列表共享内存，修改紧凑列表后不能再使用；
+// 整数编码时 vstr 为nil，值保存在 lval 中。
+func lpGetValue(lp []byte, p int) (vstr []byte, lval int64) {
+	b := lp[p]
+	var uval uint64
+	// 整数的位数，用于将无符号数按补码转换为有符号数
+	var bits uint
+	switch {
+	case b&LP_ENCODING_7BIT_UINT_MASK == LP_ENCODING_7BIT_UINT:
+		return nil, int64(b & 0x7F)
+	case b&LP_ENCODING_6BIT_STR_MASK == LP_ENCODING_6BIT_STR:
+		n := int(b & 0x3F)
+		return lp[p+1 : p+1+n : p+1+n], 0
+	case b&LP_ENCODING_13BIT_INT_MASK == LP_ENCODING_13BIT_INT:
+		uval, bits = uint64(b&0x1F)<<8|uint64(lp[p+1]), 13
+	case b == LP_ENCODING_16BIT_INT:
+		uval, bits = uint64(binary.LittleEndian.Uint16(lp[p+1:])), 16
+	case b == LP_ENCODING_24BIT_INT:
+		uval, bits = uint64(lp[p+1])|uint64(lp[p+2])<<8|uint64(lp[p+3])<<16, 24
+	case b == LP_ENCODING_32BIT_INT:
+		uval, bits = uint64(binary.LittleEndian.Uint32(lp[p+1:])), 32
+	case b == LP_ENCODING_64BIT_INT:
+		return nil, int64(binary.LittleEndian.Uint64(lp[p+1:]))
+	case b&LP_ENCODING_12BIT_STR_MASK == LP_ENCODING_12BIT_STR:
+		n := int(b&0x0F)<<8 | int(lp[p+1])
+		return lp[p+2 : p+2+n : p+2+n], 0
+	case b == LP_ENCODING_32BIT_STR:
+		n := int(binary.LittleEndian.Uint32(lp[p+1:]))
+		return lp[p+5 : p+5+n : p+5+n], 0
+	default:
+		// 不合法的编码，与 Redis 一样返回一个不可能出现的值
+		return nil, int64(12345678900000000 + uint64(b))
+	}
+	// 按补码规则转换为有符号数
+	return nil, int64(uval<<(64-bits)) >> (64 - bits)
+}
+
+// 以字符串形式返回 p 处节点的值，整数编码的值会被转换为字符串
+func lpGet(lp []byte, p int) []byte {
+	vstr, lval := lpGetValue(lp, p)
+	if vstr != nil {
+		return vstr
+	}
+	return strconv.AppendInt(nil, lval, 10)
+}
+
+// 读取 p 处节点的整数值，节点的值不能表示为整数时第二个返回值为false
+func lpGetIntegerValue(lp []byte, p int) (int64, bool) {
+	vstr, lval := lpGetValue(lp, p)
+	if vstr == nil {
+		return lval, true
+	}
+	return string2ll(vstr)
+}
+
+// 在 p 之前、之后插入节点或者替换 p 处的节点，where 为 LP_BEFORE、LP_AFTER 或 LP_REPLACE
+// elestr 和 eleint 都为nil时删除 p 处的节点。eleint 为已经编码的整数。
+// 返回新的紧凑列表以及插入的节点的偏移量；删除时返回下一个节点的偏移量，没有下一个节点时为 -1
+// 紧凑列表的大小超出 UINT32_MAX 时返回nil
+func lpInsert(lp []byte, elestr []byte, eleint []byte, p int, where int) ([]byte, int) {
+	var intenc [LP_MAX_INT_ENCODING_LEN]byte
+	var backlen [LP_MAX_BACKLEN_SIZE]byte
+	del := elestr == nil && eleint == nil
+
+	// 删除相当于替换为长度为0的节点
+	if del {
+		where = LP_REPLACE
+	}
+
+	// 插入到 p 之后相当于插入到下一个节点(可能是结束标志)之前
+	if where == LP_AFTER {
+		p = lpSkip(lp, p)
+		where = LP_BEFORE
+	}
+
+	enctype, enclen := -1, 0
+	if elestr != nil {
+		// 可以表示为整数时使用整数编码
+		enctype, enclen = lpEncodeGetType(elestr, intenc[:])
+		if enctype == LP_ENCODING_INT {
+			eleint = intenc[:enclen]
+		}
+	} else if eleint != nil {
+		enctype, enclen = LP_ENCODING_INT, len(eleint)
+	}
+
+	backlenSize := 0
+	if !del {
+		backlenSize = lpEncodeBacklen(backlen[:], enclen)
+	}
+	oldBytes := lpGetTotalBytes(lp)
+	replacedLen := 0
+	if where == LP_REPLACE {
+		replacedLen = lpCurrentEncodedSizeUnsafe(lp, p)
+		replacedLen += lpEncodeBacklen(nil, replacedLen)
+	}
+
+	newBytes := oldBytes + enclen + backlenSize - replacedLen
+	if newBytes > math.MaxUint32 {
+		return nil, -1
+	}
+
+	// 移动 p 之后的数据，留出新节点需要的空间
+	if newBytes > oldBytes {
+		lp = lpResize(lp, newBytes)
+	}
+	dst := p
+	if where == LP_BEFORE {
+		copy(lp[dst+enclen+backlenSize:], lp[dst:oldBytes])
+	} else {
+		copy(lp[dst+enclen+backlenSize:], lp[dst+replacedLen:oldBytes])
+	}
+	if newBytes < oldBytes {
+		lp = lpResize(lp, newBytes)
+	}
+
+	newp := dst
+	if del && lp[dst] == LP_EOF {
+		newp = -1
+	}
+	if !del {
+		if enctype == LP_ENCODING_INT {
+			copy(lp[dst:], eleint)
+		} else {
+			lpEncodeString(lp[dst:], elestr)
+		}
+		dst += enclen
+		copy(lp[dst:], backlen[:backlenSize])
+	}
+
+	// 更新头部
+	if where != LP_REPLACE || del {
+		if n := lpGetNumElements(lp); n != LP_HDR_NUMELE_UNKNOWN {
+			if !del {
+				lpSetNumElements(lp, n+1)
+			} else {
+				lpSetNumElements(lp, n-1)
+			}
+		}
+	}
+	lpSetTotalBytes(lp, newBytes)
+	return lp, newp
+}
+
+// 在 p 之前或之后插入字符串 s，或者替换 p 处的节点
+func lpInsertString(lp []byte, s []byte, p int, where int) ([]byte, int) {
+	if s == nil {
+		s = []byte{}
+	}
+	return lpInsert(lp, s, nil, p, where)
+}
+
+// 在 p 之前或之后插入整数 v，或者替换 p 处的节点
+func lpInsertInteger(lp []byte, v int64, p int, where int) ([]byte, int) {
+	var intenc [LP_MAX_INT_ENCODING_LEN]byte
+	enclen := lpEncodeIntegerGetType(v, intenc[:])
+	return lpInsert(lp, nil, intenc[:enclen], p, where)
+}
+
+// 将 s 添加到表头
+func lpPrepend(lp []byte, s []byte) []byte {
+	p := lpFirst(lp)
+	if p < 0 {
+		return lpAppend(lp, s)
+	}
+	lp, _ = lpInsertString(lp, s, p, LP_BEFORE)
+	return lp
+}
+
+// 将整数 v 添加到表头
+func lpPrependInteger(lp []byte, v int64) []byte {
+	p := lpFirst(lp)
+	if p < 0 {
+		return lpAppendInteger(lp, v)
+	}
+	lp, _ = lpInsertInteger(lp, v, p, LP_BEFORE)
+	return lp
+}
+
+// 将 s 添加到表尾
+func lpAppend(lp []byte, s []byte) []byte {
+	// 插入到结束标志之前
+	lp, _ = lpInsertString(lp, s, lpGetTotalBytes(lp)-1, LP_BEFORE)
+	return lp
+}
+
+// 将整数 v 添加到表尾
+func lpAppendInteger(lp []byte, v int64) []byte {
+	lp, _ = lpInsertInteger(lp, v, lpGetTotalBytes(lp)-1, LP_BEFORE)
+	return lp
+}
+
+// 将 p 处的节点替换为 s，返回新的紧凑列表以及替换后节点的偏移量
+func lpReplace(lp []byte, p int, s []byte) ([]byte, int) {
+	return lpInsertString(lp, s, p, LP_REPLACE)
+}
+
+// 将 p 处的节点替换为整数 v，返回新的紧凑列表以及替换后节点的偏移量
+func lpReplaceInteger(lp []byte, p int, v int64) ([]byte, int) {
+	return lpInsertInteger(lp, v, p, LP_REPLACE)
+}
+
+// 删除 p 处的节点，返回新的紧凑列表以及下一个节点的偏移量，没有下一个节点时为 -1
+func lpDelete(lp []byte, p int) ([]byte, int) {
+	return lpInsert(lp, nil, nil, p, LP_REPLACE)
+}
+
+// 从 p 开始删除 num 个节点，返回新的紧凑列表以及删除后 p 处节点的偏移量，没有节点时为 -1
+func lpDeleteRangeWithEntry(lp []byte, p int, num int) ([]byte, int) {
+	if num <= 0 || p < 0 {
+		return lp, p
+	}
+	totalBytes := lpGetTotalBytes(lp)
+	first, tail := p, p
+	deleted := 0
+	for deleted < num && lp[tail] != LP_EOF {
+		tail = lpSkip(lp, tail)
+		deleted++
+	}
+
+	// 移动被删除节点之后的数据，包括结束标志
+	copy(lp[first:], lp[tail:totalBytes])
+	newBytes := totalBytes - (tail - first)
+	lp = lp[:newBytes]
+	lpSetTotalBytes(lp, newBytes)
+	if n := lpGetNumElements(lp); n != LP_HDR_NUMELE_UNKNOWN {
+		lpSetNumElements(lp, n-deleted)
+	}
+
+	if lp[first] == LP_EOF {
+		return lp, -1
+	}
+	return lp, first
+}
+
+// 从索引 index 开始删除 num 个节点，index 可以为负数
+func lpDeleteRange(lp []byte, index int, num int) []byte {
+	if num <= 0 {
+		return lp
+	}
+	p := lpSeek(lp, index)
+	if p < 0 {
+		return lp
+	}
+
+	// 节点数量已知并且删除到表尾时，直接移动结束标志
+	numele := lpGetNumElements(lp)
+	if numele != LP_HDR_NUMELE_UNKNOWN {
+		if index < 0 {
+			index = numele + index
+		}
+		if numele-index <= num {
+			lp[p] = LP_EOF
+			lp = lp[:p+1]
+			lpSetTotalBytes(lp, p+1)
+			lpSetNumElements(lp, index)
+			return lp
+		}
+	}
+	lp, _ = lpDeleteRangeWithEntry(lp, p, num)
+	return lp
+}
+
+// 返回给定索引上的节点，索引可以为负数，-1 表示最后一个节点
+// 索引超出范围时返回 -1
+func lpSeek(lp []byte, index int) int {
+	forward := true
+	numele := lpGetNumElements(lp)
+	if numele != LP_HDR_NUMELE_UNKNOWN {
+		if index < 0 {
+			index = numele + index
+		}
+		if index < 0 || index >= numele {
+			return -1
+		}
+		// 节点在后半部分时从后向前查找，此时使用负数索引
+		if index > numele/2 {
+			forward = false
+			index -= numele
+		}
+	} else if index < 0 {
+		// 节点数量未知时，负数索引从后向前查找
+		forward = false
+	}
+
+	if forward {
+		ele := lpFirst(lp)
+		for index > 0 && ele >= 0 {
+			ele = lpNext(lp, ele)
+			index--
+		}
+		return ele
+	}
+	ele := lpLast(lp)
+	for index < -1 && ele >= 0 {
+		ele = lpPrev(lp, ele)
+		index++
+	}
+	return ele
+}
+
+// 比较 p 处节点的值与 s 是否相等
+func lpCompare(lp []byte, p int, s []byte) bool {
+	if lp[p] == LP_EOF {
+		return false
+	}
+	vstr, lval := lpGetValue(lp, p)
+	if vstr != nil {
+		return bytes.Equal(vstr, s)
+	}
+	// 整数编码时，s 同样可以表示为整数才可能相等
+	if sval, ok := string2ll(s); ok {
+		return sval == lval
+	}
+	return false
+}
+
+// 从 p 开始查找值为 s 的节点，每比较一个节点后跳过 skip 个节点
+// 找不到时返回 -1
+func lpFind(lp []byte, p int, s []byte, skip int) int {
+	skipcnt := 0
+	// s 转换为整数的结果，只在需要时转换一次
+	var sval int64
+	sconverted, sIsInt := false, false
+
+	for p >= 0 {
+		if skipcnt == 0 {
+			vstr, lval := lpGetValue(lp, p)
+			if vstr != nil {
+				if bytes.Equal(vstr, s) {
+					return p
+				}
+			} else {
+				if !sconverted {
+					sval, sIsInt = string2ll(s)
+					sconverted = true
+				}
+				if sIsInt && sval == lval {
+					return p
+				}
+			}
+			// 重置跳过的节点数
+			skipcnt = skip
+		} else {
+			skipcnt--
+		}
+		p = lpNext(lp, p)
+	}
+	return -1
+}
+
+// 返回紧凑列表占用的字节数
+func lpBytes(lp []byte) int {
+	return lpGetTotalBytes(lp)
+}
+
+// 验证 p 处的节点没有超出紧凑列表的范围，返回下一个节点的偏移量
+// p 为结束标志时返回 -1；节点不合法时第二个返回值为false
+func lpValidateNext(lp []byte, p int, lpbytes int) (int, bool) {
+	outOfRange := func(p int) bool {
+		return p < LP_HDR_SIZE || p > lpbytes-1
+	}
+
+	if p < 0 || outOfRange(p) {
+		return -1, false
+	}
+	if lp[p] == LP_EOF {
+		return -1, true
+	}
+
+	// 确保可以读取节点的长度
+	lenbytes := lpCurrentEncodedSizeBytes(lp[p])
+	if lenbytes == 0 {
+		return -1, false
+	}
+	if outOfRange(p + lenbytes) {
+		return -1, false
+	}
+
+	// 确保节点没有超出紧凑列表的范围
+	entrylen := lpCurrentEncodedSizeUnsafe(lp, p)
+	encodedBacklen := lpEncodeBacklen(nil, entrylen)
+	entrylen += encodedBacklen
+	if outOfRange(p + entrylen) {
+		return -1, false
+	}
+
+	// 确保节点末尾记录的长度与开头的编码一致
+	p += entrylen
+	prevlen := lpDecodeBacklen(lp, p-1)
+	if prevlen < 0 || prevlen+encodedBacklen != entrylen {
+		return -1, false
+	}
+	return p, true
+}
+
+// 验证并返回第一个节点，紧凑列表为空时返回 -1
+func lpValidateFirst(lp []byte) int {
+	if lp[LP_HDR_SIZE] == LP_EOF {
+		return -1
+	}
+	return LP_HDR_SIZE
+}
+
+// 验证紧凑列表的完整性，可以用于不可信的数据(例如从 RDB 中读取的数据)
+// deep 为false时只验证头部和结束标志，否则逐个验证节点，
+// entryCb 不为nil时会对每个节点调用，返回false表示验证失败
+func lpValidateIntegrity(lp []byte, deep bool, entryCb func(lp []byte, p int, numele int) bool) bool {
+	size := len(lp)
+	// 确保可以读取头部和结束标志
+	if size < LP_HDR_SIZE+1 {
+		return false
+	}
+	// 头部记录的大小必须与实际大小一致
+	lpbytes := lpGetTotalBytes(lp)
+	if lpbytes != size {
+		return false
+	}
+	if lp[size-1] != LP_EOF {
+		return false
+	}
+	if !deep {
+		return true
+	}
+
+	count := 0
+	numele := lpGetNumElements(lp)
+	p := LP_HDR_SIZE
+	for p >= 0 && lp[p] != LP_EOF {
+		prev := p
+		// 先验证节点并移动到下一个节点，避免回调访问损坏的数据
+		var ok bool
+		if p, ok = lpValidateNext(lp, p, lpbytes); !ok {
+			return false
+		}
+		if entryCb != nil && !entryCb(lp, prev, numele) {
+			return false
+		}
+		count++
+	}
+
+	// 最后必须停在结束标志处
+	if p != size-1 {
+		return false
+	}
+	// 头部记录的节点数量必须正确
+	if numele != LP_HDR_NUMELE_UNKNOWN && numele != count {
+		return false
+	}
+	return true
+}
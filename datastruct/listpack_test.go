@@ -0,0 +1,389 @@
+package datastruct
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+// 检查紧凑列表的完整性，并与 want 比较正向和反向遍历的结果
+func checkListpackValues(t *testing.T, lp []byte, want [][]byte) {
+	t.Helper()
+	if !lpValidateIntegrity(lp, true, nil) {
+		t.Fatalf("listpack failed integrity check")
+	}
+	if lpLength(lp) != len(want) {
+		t.Fatalf("length %d, want %d", lpLength(lp), len(want))
+	}
+	i := 0
+	for p := lpFirst(lp); p >= 0; p = lpNext(lp, p) {
+		if !bytes.Equal(lpGet(lp, p), want[i]) {
+			t.Fatalf("entry %d = %q, want %q", i, lpGet(lp, p), want[i])
+		}
+		i++
+	}
+	if i != len(want) {
+		t.Fatalf("forward got %d entries, want %d", i, len(want))
+	}
+	for p := lpLast(lp); p >= 0; p = lpPrev(lp, p) {
+		i--
+		if !bytes.Equal(lpGet(lp, p), want[i]) {
+			t.Fatalf("backward entry %d = %q, want %q", i, lpGet(lp, p), want[i])
+		}
+	}
+	if i != 0 {
+		t.Fatalf("backward stopped at %d", i)
+	}
+}
+
+func TestListpackLayout(t *testing.T) {
+	lp := lpNew(0)
+	if !bytes.Equal(lp, []byte{7, 0, 0, 0, 0, 0, LP_EOF}) {
+		t.Fatalf("empty listpack %v", lp)
+	}
+	lp = lpAppend(lp, []byte("hello"))
+	lp = lpAppend(lp, []byte("1024"))
+	want := []byte{
+		17, 0, 0, 0, 2, 0,
+		// "hello": 6位长度的字符串，element-tot-len 为6
+		0x85, 'h', 'e', 'l', 'l', 'o', 6,
+		// 1024: 13位整数，element-tot-len 为2
+		0xC4, 0x00, 2,
+		LP_EOF,
+	}
+	if !bytes.Equal(lp, want) {
+		t.Fatalf("got %v, want %v", lp, want)
+	}
+}
+
+func TestListpackIntegerEncoding(t *testing.T) {
+	cases := []struct {
+		v    int64
+		size int
+	}{
+		{0, 1}, {127, 1},
+		{128, 2}, {-1, 2}, {-4096, 2}, {4095, 2},
+		{4096, 3}, {-4097, 3}, {math.MaxInt16, 3}, {math.MinInt16, 3},
+		{math.MaxInt16 + 1, 4}, {-(1 << 23), 4}, {1<<23 - 1, 4},
+		{1 << 23, 5}, {math.MinInt32, 5}, {math.MaxInt32, 5},
+		{math.MaxInt32 + 1, 9}, {math.MinInt64, 9}, {math.MaxInt64, 9},
+	}
+	lp := lpNew(0)
+	var want [][]byte
+	for _, c := range cases {
+		// 以字符串插入的整数同样使用整数编码
+		s := []byte(strconv.FormatInt(c.v, 10))
+		lp = lpAppend(lp, s)
+		lp = lpAppendInteger(lp, c.v)
+		want = append(want, s, s)
+
+		p := lpSeek(lp, -1)
+		if size := lpCurrentEncodedSizeUnsafe(lp, p); size != c.size {
+			t.Errorf("%d: encoded size %d, want %d", c.v, size, c.size)
+		}
+		vstr, lval := lpGetValue(lp, p)
+		if vstr != nil || lval != c.v {
+			t.Errorf("%d: got %q %d", c.v, vstr, lval)
+		}
+		if v, ok := lpGetIntegerValue(lp, lpSeek(lp, -2)); !ok || v != c.v {
+			t.Errorf("%d: integer value %d", c.v, v)
+		}
+	}
+	checkListpackValues(t, lp, want)
+}
+
+func TestListpackStringEncoding(t *testing.T) {
+	lp := lpNew(0)
+	var want [][]byte
+	for _, n := range []int{0, 1, 63, 64, 4095, 4096, 20000} {
+		s := bytes.Repeat([]byte("s"), n)
+		lp = lpAppend(lp, s)
+		want = append(want, s)
+	}
+	// 不能严格转换为整数的字符串使用字符串编码
+	for _, s := range []string{"01", " 1", "-0", "+1", "1.5", "99999999999999999999"} {
+		lp = lpAppend(lp, []byte(s))
+		want = append(want, []byte(s))
+		if vstr, _ := lpGetValue(lp, lpLast(lp)); vstr == nil {
+			t.Errorf("%q encoded as integer", s)
+		}
+	}
+	checkListpackValues(t, lp, want)
+}
+
+func TestListpackBacklen(t *testing.T) {
+	buf := make([]byte, LP_MAX_BACKLEN_SIZE)
+	for _, l := range []int{0, 1, 127, 128, 16382, 16383, 2097150, 2097151, 268435454, 268435455, math.MaxUint32} {
+		n := lpEncodeBacklen(buf, l)
+		if n != lpEncodeBacklen(nil, l) {
+			t.Fatalf("%d: size mismatch", l)
+		}
+		// 从最后一个字节向前解码
+		if got := lpDecodeBacklen(buf, n-1); got != l {
+			t.Errorf("%d: decoded %d", l, got)
+		}
+	}
+}
+
+func TestListpackInsertReplaceDelete(t *testing.T) {
+	lp := lpNew(0)
+	lp = lpAppend(lp, []byte("b"))
+	lp = lpPrepend(lp, []byte("a"))
+	lp = lpAppendInteger(lp, 3)
+	lp = lpPrependInteger(lp, -1)
+	checkListpackValues(t, lp, [][]byte{[]byte("-1"), []byte("a"), []byte("b"), []byte("3")})
+
+	// 插入后返回新节点的位置
+	lp, p := lpInsertString(lp, []byte("x"), lpSeek(lp, 1), LP_AFTER)
+	if string(lpGet(lp, p)) != "x" {
+		t.Fatalf("inserted %q", lpGet(lp, p))
+	}
+	lp, p = lpInsertInteger(lp, 1000, lpSeek(lp, 0), LP_BEFORE)
+	if string(lpGet(lp, p)) != "1000" {
+		t.Fatalf("inserted %q", lpGet(lp, p))
+	}
+	checkListpackValues(t, lp, [][]byte{[]byte("1000"), []byte("-1"), []byte("a"), []byte("x"), []byte("b"), []byte("3")})
+
+	// 替换为更长和更短的值
+	long := bytes.Repeat([]byte("L"), 200)
+	lp, p = lpReplace(lp, lpSeek(lp, 2), long)
+	if !bytes.Equal(lpGet(lp, p), long) {
+		t.Fatalf("replaced %q", lpGet(lp, p))
+	}
+	lp, _ = lpReplaceInteger(lp, lpSeek(lp, 2), 7)
+	checkListpackValues(t, lp, [][]byte{[]byte("1000"), []byte("-1"), []byte("7"), []byte("x"), []byte("b"), []byte("3")})
+
+	// 删除后返回下一个节点，删除最后一个节点时返回 -1
+	lp, p = lpDelete(lp, lpSeek(lp, 2))
+	if string(lpGet(lp, p)) != "x" {
+		t.Fatalf("next after delete %q", lpGet(lp, p))
+	}
+	lp, p = lpDelete(lp, lpLast(lp))
+	if p != -1 {
+		t.Fatalf("delete last returned %d", p)
+	}
+	checkListpackValues(t, lp, [][]byte{[]byte("1000"), []byte("-1"), []byte("x"), []byte("b")})
+}
+
+func TestListpackSeek(t *testing.T) {
+	lp := lpNew(0)
+	for i := 0; i < 10; i++ {
+		lp = lpAppendInteger(lp, int64(i))
+	}
+	for i := -10; i < 10; i++ {
+		want := i
+		if want < 0 {
+			want += 10
+		}
+		if v, _ := lpGetIntegerValue(lp, lpSeek(lp, i)); v != int64(want) {
+			t.Errorf("seek %d = %d", i, v)
+		}
+	}
+	if lpSeek(lp, 10) != -1 || lpSeek(lp, -11) != -1 || lpSeek(lpNew(0), 0) != -1 {
+		t.Error("seek out of range")
+	}
+}
+
+func TestListpackDeleteRange(t *testing.T) {
+	for start := -7; start < 7; start++ {
+		for num := 0; num < 8; num++ {
+			lp := lpNew(0)
+			var values [][]byte
+			for i := 0; i < 6; i++ {
+				v := []byte("v" + strconv.Itoa(i))
+				lp = lpAppend(lp, v)
+				values = append(values, v)
+			}
+			lp = lpDeleteRange(lp, start, num)
+
+			from := start
+			if from < 0 {
+				from += len(values)
+			}
+			want := values
+			if from >= 0 && from < len(values) {
+				want = append(append([][]byte{}, values[:from]...), values[min(from+num, len(values)):]...)
+			}
+			checkListpackValues(t, lp, want)
+		}
+	}
+
+	lp := lpNew(0)
+	for i := 0; i < 5; i++ {
+		lp = lpAppendInteger(lp, int64(i))
+	}
+	lp, p := lpDeleteRangeWithEntry(lp, lpSeek(lp, 1), 2)
+	if v, _ := lpGetIntegerValue(lp, p); v != 3 {
+		t.Fatalf("next after delete %d", v)
+	}
+	checkListpackValues(t, lp, [][]byte{[]byte("0"), []byte("3"), []byte("4")})
+}
+
+func TestListpackFindCompare(t *testing.T) {
+	lp := lpNew(0)
+	for _, s := range []string{"k1", "10", "k2", "v2", "k3", "-5"} {
+		lp = lpAppend(lp, []byte(s))
+	}
+	if !lpCompare(lp, lpSeek(lp, 1), []byte("10")) || lpCompare(lp, lpSeek(lp, 1), []byte("010")) ||
+		!lpCompare(lp, lpSeek(lp, 0), []byte("k1")) || lpCompare(lp, lpSeek(lp, 0), []byte("k")) {
+		t.Error("compare")
+	}
+
+	// 键和值交替保存，查找键时跳过值
+	if p := lpFind(lp, lpFirst(lp), []byte("k2"), 1); p != lpSeek(lp, 2) {
+		t.Errorf("find k2 at %d", p)
+	}
+	if p := lpFind(lp, lpFirst(lp), []byte("v2"), 1); p != -1 {
+		t.Errorf("v2 is a value, found at %d", p)
+	}
+	if p := lpFind(lp, lpSeek(lp, 1), []byte("-5"), 1); p != lpSeek(lp, 5) {
+		t.Errorf("find -5 at %d", p)
+	}
+	if p := lpFind(lp, lpFirst(lp), []byte("missing"), 0); p != -1 {
+		t.Errorf("find missing at %d", p)
+	}
+}
+
+func TestListpackUnknownLength(t *testing.T) {
+	lp := lpNew(0)
+	n := LP_HDR_NUMELE_UNKNOWN + 10
+	for i := 0; i < n; i++ {
+		lp = lpAppendInteger(lp, int64(i%100))
+	}
+	if lpGetNumElements(lp) != LP_HDR_NUMELE_UNKNOWN || lpLength(lp) != n {
+		t.Fatalf("header %d, length %d", lpGetNumElements(lp), lpLength(lp))
+	}
+	if v, _ := lpGetIntegerValue(lp, lpSeek(lp, -1)); v != int64((n-1)%100) {
+		t.Fatalf("seek -1 = %d", v)
+	}
+	if !lpValidateIntegrity(lp, true, nil) {
+		t.Fatal("integrity")
+	}
+
+	// 删除到可以保存的数量后，lpLength 会写回头部
+	lp = lpDeleteRange(lp, 0, 20)
+	if lpLength(lp) != n-20 || lpGetNumElements(lp) != n-20 {
+		t.Fatalf("header %d, length %d", lpGetNumElements(lp), lpLength(lp))
+	}
+}
+
+func TestListpackValidateIntegrity(t *testing.T) {
+	lp := lpNew(0)
+	for _, s := range []string{"a", "12345", string(bytes.Repeat([]byte("z"), 300)), "-7"} {
+		lp = lpAppend(lp, []byte(s))
+	}
+	if !lpValidateIntegrity(lp, true, nil) || !lpValidateIntegrity(lp, false, nil) {
+		t.Fatal("valid listpack")
+	}
+
+	// 回调可以拒绝节点
+	count := 0
+	ok := lpValidateIntegrity(lp, true, func(lp []byte, p int, numele int) bool {
+		count++
+		return numele == 4 && count < 3
+	})
+	if ok || count != 3 {
+		t.Errorf("callback: ok %v count %d", ok, count)
+	}
+
+	corrupt := func(f func(lp []byte) []byte) []byte {
+		return f(append([]byte(nil), lp...))
+	}
+	bad := [][]byte{
+		nil,
+		{7, 0, 0, 0, 0, 0},
+		corrupt(func(b []byte) []byte { return b[:len(b)-1] }),
+		corrupt(func(b []byte) []byte { b[len(b)-1] = 0; return b }),
+		corrupt(func(b []byte) []byte { lpSetNumElements(b, 3); return b }),
+		// 第一个节点的 element-tot-len 与编码不一致
+		corrupt(func(b []byte) []byte { b[LP_HDR_SIZE+2] = 5; return b }),
+		// 字符串长度超出范围
+		corrupt(func(b []byte) []byte { b[LP_HDR_SIZE] = 0xBF; return b }),
+		// 不合法的编码
+		corrupt(func(b []byte) []byte { b[LP_HDR_SIZE] = 0xF5; return b }),
+	}
+	for i, b := range bad {
+		if lpValidateIntegrity(b, true, nil) {
+			t.Errorf("corrupt listpack %d passed validation", i)
+		}
+	}
+
+	// 随机损坏的数据不能导致 panic
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 5000; i++ {
+		b := append([]byte(nil), lp...)
+		for j := 0; j < 1+r.Intn(3); j++ {
+			b[LP_HDR_SIZE+r.Intn(len(b)-LP_HDR_SIZE)] = byte(r.Intn(256))
+		}
+		if lpValidateIntegrity(b, true, nil) {
+			// 通过验证的数据可以安全遍历
+			for p := lpFirst(b); p >= 0; p = lpNext(b, p) {
+				lpGet(b, p)
+			}
+		}
+	}
+}
+
+func TestListpackRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	randValue := func() []byte {
+		switch r.Intn(4) {
+		case 0:
+			return []byte(strconv.FormatInt(r.Int63()-r.Int63(), 10))
+		case 1:
+			return []byte(strconv.Itoa(r.Intn(10000) - 5000))
+		default:
+			b := make([]byte, r.Intn(300))
+			for i := range b {
+				b[i] = byte('a' + r.Intn(26))
+			}
+			return b
+		}
+	}
+
+	lp := lpNew(0)
+	var want [][]byte
+	for i := 0; i < 3000; i++ {
+		switch op := r.Intn(10); {
+		case op < 2:
+			v := randValue()
+			lp = lpPrepend(lp, v)
+			want = append([][]byte{v}, want...)
+		case op < 4:
+			v := randValue()
+			lp = lpAppend(lp, v)
+			want = append(want, v)
+		case op < 6 && len(want) > 0:
+			v := randValue()
+			idx := r.Intn(len(want))
+			where := LP_BEFORE
+			if r.Intn(2) == 0 {
+				where = LP_AFTER
+			}
+			lp, _ = lpInsertString(lp, v, lpSeek(lp, idx), where)
+			if where == LP_AFTER {
+				idx++
+			}
+			want = append(want[:idx], append([][]byte{v}, want[idx:]...)...)
+		case op < 7 && len(want) > 0:
+			v := randValue()
+			idx := r.Intn(len(want))
+			lp, _ = lpReplace(lp, lpSeek(lp, idx), v)
+			want[idx] = v
+		case op < 8 && len(want) > 0:
+			idx := r.Intn(len(want))
+			lp, _ = lpDelete(lp, lpSeek(lp, idx))
+			want = append(want[:idx], want[idx+1:]...)
+		case len(want) > 0:
+			idx, n := r.Intn(len(want)), r.Intn(3)+1
+			lp = lpDeleteRange(lp, idx, n)
+			want = append(want[:idx], want[min(idx+n, len(want)):]...)
+		}
+		if i%50 == 0 {
+			checkListpackValues(t, lp, want)
+		}
+	}
+	checkListpackValues(t, lp, want)
+}
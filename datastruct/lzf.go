@@ -0,0 +1,221 @@
+/*
+LZF 压缩算法，与 Redis 使用的 liblzf(lzf_c.c、lzf_d.c) 对应，压缩结果可以被 C 版本解压，反之亦然
+
+压缩后的数据由以下两种块组成：
+
+	000LLLLL <L+1个字节>               字面量，L+1 个字节原样复制
+	LLLooooo oooooooo                  回溯引用，从当前位置向前 o+1 个字节处复制 L+2 个字节
+	111ooooo LLLLLLLL oooooooo         L 为7时，长度在下一个字节中，复制 L+9 个字节
+*/
+package datastruct
+
+import "sync"
+
+const (
+	// 哈希表大小的对数，与 Redis 的 lzfP.h 相同
+	LZF_HLOG  = 16
+	LZF_HSIZE = 1 << LZF_HLOG
+	// 字面量的最大长度
+	LZF_MAX_LIT = 1 << 5
+	// 回溯引用的最大偏移量
+	LZF_MAX_OFF = 1 << 13
+	// 回溯引用的最大长度
+	LZF_MAX_REF = (1 << 8) + (1 << 3)
+)
+
+// 压缩使用的哈希表，保存三字节序列最后一次出现的位置
+// 表中可能残留上次压缩的位置，因为每个匹配都会逐字节验证，残留的位置不影响正确性
+var lzf_htab_pool = sync.Pool{
+	New: func() interface{} {
+		return new([LZF_HSIZE]uint32)
+	},
+}
+
+// 三字节序列的哈希值在哈希表中的索引，与 liblzf 的 VERY_FAST 模式相同
+func lzfIdx(h uint32) uint32 {
+	return ((h >> (3*8 - LZF_HLOG)) - h*5) & (LZF_HSIZE - 1)
+}
+
+// 压缩 in 并写入 out，返回压缩后的长度
+// 输入为空、out 空间不足或者压缩后没有变小到可以放入 out 时返回0
+func lzfCompress(in []byte, out []byte) int {
+	inLen, outLen := len(in), len(out)
+	if inLen == 0 || outLen == 0 {
+		return 0
+	}
+
+	htab := lzf_htab_pool.Get().(*[LZF_HSIZE]uint32)
+	defer lzf_htab_pool.Put(htab)
+
+	ip, op := 0, 0
+	// 当前字面量的长度，op 指向字面量后的位置，字面量的控制字节在 op-lit-1 处
+	lit := 0
+	op++
+
+	var hval uint32
+	if inLen >= 2 {
+		hval = uint32(in[0])<<8 | uint32(in[1])
+	}
+	for ip < inLen-2 {
+		hval = hval<<8 | uint32(in[ip+2])
+		slot := lzfIdx(hval)
+		ref := int(htab[slot])
+		htab[slot] = uint32(ip)
+
+		off := ip - ref - 1
+		if ref > 0 && ref < ip && off < LZF_MAX_OFF &&
+			in[ref+2] == in[ip+2] && in[ref] == in[ip] && in[ref+1] == in[ip+1] {
+			// 找到匹配
+			length := 2
+			maxlen := inLen - ip - length
+			if maxlen > LZF_MAX_REF {
+				maxlen = LZF_MAX_REF
+			}
+
+			// 回溯引用最多占用3字节，还需要为之后的字面量预留1字节
+			// 当前字面量为空时会回退它的控制字节
+			need := op + 3 + 1
+			if lit == 0 {
+				need--
+			}
+			if need >= outLen {
+				return 0
+			}
+
+			// 结束当前的字面量，字面量为空时回退
+			out[op-lit-1] = byte(lit - 1)
+			if lit == 0 {
+				op--
+			}
+
+			for {
+				length++
+				if length >= maxlen || in[ref+length] != in[ip+length] {
+					break
+				}
+			}
+
+			// length 变为匹配的字节数减2
+			length -= 2
+			ip++
+
+			if length < 7 {
+				out[op] = byte(off>>8) + byte(length<<5)
+				op++
+			} else {
+				out[op] = byte(off>>8) + (7 << 5)
+				out[op+1] = byte(length - 7)
+				op += 2
+			}
+			out[op] = byte(off)
+			op++
+
+			// 开始新的字面量
+			lit = 0
+			op++
+
+			ip += length + 1
+			if ip >= inLen-2 {
+				break
+			}
+
+			// 将匹配末尾的两个位置加入哈希表
+			ip -= 2
+			hval = uint32(in[ip])<<8 | uint32(in[ip+1])
+			hval = hval<<8 | uint32(in[ip+2])
+			htab[lzfIdx(hval)] = uint32(ip)
+			ip++
+			hval = hval<<8 | uint32(in[ip+2])
+			htab[lzfIdx(hval)] = uint32(ip)
+			ip++
+		} else {
+			// 没有匹配，复制一个字面量字节
+			if op >= outLen {
+				return 0
+			}
+			lit++
+			out[op] = in[ip]
+			op++
+			ip++
+
+			if lit == LZF_MAX_LIT {
+				out[op-lit-1] = byte(lit - 1)
+				lit = 0
+				op++
+			}
+		}
+	}
+
+	// 最多还有3个字节
+	if op+3 > outLen {
+		return 0
+	}
+	for ip < inLen {
+		lit++
+		out[op] = in[ip]
+		op++
+		ip++
+		if lit == LZF_MAX_LIT {
+			out[op-lit-1] = byte(lit - 1)
+			lit = 0
+			op++
+		}
+	}
+
+	// 结束最后的字面量，字面量为空时回退
+	out[op-lit-1] = byte(lit - 1)
+	if lit == 0 {
+		op--
+	}
+	return op
+}
+
+// 解压 in 并写入 out，返回解压后的长度
+// out 空间不足或者数据不合法时返回0
+func lzfDecompress(in []byte, out []byte) int {
+	inLen, outLen := len(in), len(out)
+	ip, op := 0, 0
+	for ip < inLen {
+		ctrl := int(in[ip])
+		ip++
+
+		if ctrl < 1<<5 {
+			// 字面量
+			ctrl++
+			if op+ctrl > outLen || ip+ctrl > inLen {
+				return 0
+			}
+			copy(out[op:], in[ip:ip+ctrl])
+			op += ctrl
+			ip += ctrl
+		} else {
+			// 回溯引用
+			length := ctrl >> 5
+			ref := op - (ctrl&0x1f)<<8 - 1
+			if ip >= inLen {
+				return 0
+			}
+			if length == 7 {
+				length += int(in[ip])
+				ip++
+				if ip >= inLen {
+					return 0
+				}
+			}
+			ref -= int(in[ip])
+			ip++
+
+			length += 2
+			if op+length > outLen || ref < 0 {
+				return 0
+			}
+			// 引用的区域可能与写入的区域重叠，需要逐字节复制
+			for i := 0; i < length; i++ {
+				out[op] = out[ref]
+				op++
+				ref++
+			}
+		}
+	}
+	return op
+}
@@ -0,0 +1,91 @@
+package datastruct
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func lzfRoundTrip(t *testing.T, in []byte) int {
+	out := make([]byte, len(in)+len(in)/16+64)
+	n := lzfCompress(in, out)
+	if n == 0 {
+		t.Fatalf("compress %d bytes failed", len(in))
+	}
+	got := make([]byte, len(in))
+	if m := lzfDecompress(out[:n], got); m != len(in) {
+		t.Fatalf("decompress length %d, want %d", m, len(in))
+	}
+	if !bytes.Equal(got, in) {
+		t.Fatalf("round trip mismatch")
+	}
+	return n
+}
+
+func TestLzfRoundTrip(t *testing.T) {
+	cases := [][]byte{
+		[]byte("a"),
+		[]byte("ab"),
+		[]byte("abc"),
+		[]byte("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"),
+		bytes.Repeat([]byte("hello world "), 200),
+		bytes.Repeat([]byte{0}, 10000),
+	}
+	for _, c := range cases {
+		lzfRoundTrip(t, c)
+	}
+
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		n := r.Intn(5000) + 1
+		in := make([]byte, n)
+		// 使用较小的字母表，使数据中有可以压缩的重复
+		alphabet := r.Intn(255) + 1
+		for j := range in {
+			in[j] = byte(r.Intn(alphabet))
+		}
+		lzfRoundTrip(t, in)
+	}
+}
+
+func TestLzfCompressRatio(t *testing.T) {
+	in := bytes.Repeat([]byte("quicklist"), 100)
+	if n := lzfRoundTrip(t, in); n >= len(in)/10 {
+		t.Errorf("compressed %d bytes to %d, expected better ratio", len(in), n)
+	}
+}
+
+func TestLzfCompressNoRoom(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	in := make([]byte, 100)
+	r.Read(in)
+	// 随机数据无法压缩，输出空间与输入相同时放不下
+	if n := lzfCompress(in, make([]byte, len(in))); n != 0 {
+		t.Errorf("expected 0 for incompressible data, got %d", n)
+	}
+	if n := lzfCompress(nil, make([]byte, 10)); n != 0 {
+		t.Errorf("expected 0 for empty input, got %d", n)
+	}
+}
+
+func TestLzfDecompress(t *testing.T) {
+	// 字面量 "abc"，再从前3个字节处复制5个字节
+	in := []byte{0x02, 'a', 'b', 'c', 3 << 5, 0x02}
+	out := make([]byte, 8)
+	if n := lzfDecompress(in, out); n != 8 || string(out) != "abcabcab" {
+		t.Errorf("got %d %q", n, out)
+	}
+
+	// 输出空间不足
+	if n := lzfDecompress(in, make([]byte, 7)); n != 0 {
+		t.Errorf("expected 0 for small output, got %d", n)
+	}
+	// 字面量被截断
+	if n := lzfDecompress([]byte{0x05, 'a'}, out); n != 0 {
+		t.Errorf("expected 0 for truncated literal, got %d", n)
+	}
+	// 回溯引用超出已输出的范围
+	if n := lzfDecompress([]byte{0x00, 'a', 1 << 5, 0x05}, out); n != 0 {
+		t.Errorf("expected 0 for bad back reference, got %d", n)
+	}
+}
@@ -0,0 +1,124 @@
+//go:build objdebug
+
+/*
+对象引用计数的调试跟踪，使用 -tags objdebug 构建时启用
+
+createObject 创建的每个对象都会记录创建时的调用栈，decrRefCount 释放对象时记录释放时的调用栈。
+对已经释放的对象调用 incrRefCount、decrRefCount 时，panic 的信息中包含对象创建和释放的位置；
+objectDebugLeaks 返回某个时间点之后创建、仍未释放的对象，测试中通过 checkObjectLeaks 在测试结束时报告泄漏。
+已经释放的对象会一直保留在记录中，避免地址被复用，因此只应该在测试中启用。
+*/
+package datastruct
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// 是否启用了对象跟踪
+const objectDebugEnabled = true
+
+// 记录的调用栈的最大深度
+const objectDebugStackDepth = 16
+
+// 被跟踪的对象的信息
+type objectDebugInfo struct {
+	// 创建的顺序
+	seq uint64
+	// 创建和释放时的调用栈，free 为空表示对象还没有被释放
+	alloc, free string
+}
+
+var objdebug_mu sync.Mutex
+var objdebug_seq uint64
+var objdebug_objects = make(map[*redisObject]*objectDebugInfo)
+
+// 返回调用者的调用栈，skip 为需要跳过的调用层数
+func objectDebugStack(skip int) string {
+	pcs := make([]uintptr, objectDebugStackDepth)
+	n := runtime.Callers(skip+2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	var b strings.Builder
+	for {
+		frame, more := frames.Next()
+		fmt.Fprintf(&b, "\n\t%s\n\t\t%s:%d", frame.Function, frame.File, frame.Line)
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
+
+// 记录新创建的对象
+func objectDebugCreate(o *redisObject) {
+	stack := objectDebugStack(2)
+	objdebug_mu.Lock()
+	defer objdebug_mu.Unlock()
+	objdebug_seq++
+	objdebug_objects[o] = &objectDebugInfo{seq: objdebug_seq, alloc: stack}
+}
+
+// 记录对象被释放
+func objectDebugFree(o *redisObject) {
+	stack := objectDebugStack(2)
+	objdebug_mu.Lock()
+	defer objdebug_mu.Unlock()
+	if info, ok := objdebug_objects[o]; ok {
+		info.free = stack
+	}
+}
+
+// 不再跟踪对象，用于永远不会被释放的共享对象
+func objectDebugUntrack(o *redisObject) {
+	objdebug_mu.Lock()
+	defer objdebug_mu.Unlock()
+	delete(objdebug_objects, o)
+}
+
+// 对引用计数不大于0的对象调用 op 时 panic，信息中包含对象创建和释放的位置
+func objectDebugUseAfterFree(o *redisObject, op string) {
+	objdebug_mu.Lock()
+	info, ok := objdebug_objects[o]
+	objdebug_mu.Unlock()
+	if !ok {
+		panic(fmt.Errorf("%s against untracked object with refcount %d", op, o.refcount))
+	}
+	if info.free == "" {
+		panic(fmt.Errorf("%s against object with refcount %d\nallocated at:%s", op, o.refcount, info.alloc))
+	}
+	panic(fmt.Errorf("%s against freed object\nallocated at:%s\nfreed at:%s", op, info.alloc, info.free))
+}
+
+// 返回当前的创建序号，作为 objectDebugLeaks 的参数
+func objectDebugMark() uint64 {
+	objdebug_mu.Lock()
+	defer objdebug_mu.Unlock()
+	return objdebug_seq
+}
+
+// 返回 objectDebugMark 返回 mark 之后创建、仍未释放的对象的描述，按创建的顺序排列
+func objectDebugLeaks(mark uint64) []string {
+	objdebug_mu.Lock()
+	var leaks []*objectDebugInfo
+	objs := make(map[*objectDebugInfo]*redisObject)
+	for o, info := range objdebug_objects {
+		if info.seq > mark && info.free == "" {
+			leaks = append(leaks, info)
+			objs[info] = o
+		}
+	}
+	objdebug_mu.Unlock()
+
+	sort.Slice(leaks, func(i, j int) bool {
+		return leaks[i].seq < leaks[j].seq
+	})
+	res := make([]string, len(leaks))
+	for i, info := range leaks {
+		o := objs[info]
+		res[i] = fmt.Sprintf("type %d encoding %d refcount %d, allocated at:%s", o.rtype, o.encoding, o.refcount, info.alloc)
+	}
+	return res
+}
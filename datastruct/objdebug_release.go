@@ -0,0 +1,23 @@
+//go:build !objdebug
+
+package datastruct
+
+// 不使用 -tags objdebug 构建时，对象跟踪的函数什么都不做
+
+const objectDebugEnabled = false
+
+func objectDebugCreate(o *redisObject) {}
+
+func objectDebugFree(o *redisObject) {}
+
+func objectDebugUntrack(o *redisObject) {}
+
+func objectDebugUseAfterFree(o *redisObject, op string) {}
+
+func objectDebugMark() uint64 {
+	return 0
+}
+
+func objectDebugLeaks(mark uint64) []string {
+	return nil
+}
@@ -0,0 +1,43 @@
+//go:build objdebug
+
+package datastruct
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestObjectDebugLeaks(t *testing.T) {
+	mark := objectDebugMark()
+	leaked := createStringObject([]byte("leaked"))
+	freed := createStringObject([]byte("freed"))
+	decrRefCount(freed)
+
+	leaks := objectDebugLeaks(mark)
+	if len(leaks) != 1 || !strings.Contains(leaks[0], "TestObjectDebugLeaks") {
+		t.Fatalf("leaks %q", leaks)
+	}
+	decrRefCount(leaked)
+	if leaks := objectDebugLeaks(mark); len(leaks) != 0 {
+		t.Fatalf("leaks after free %q", leaks)
+	}
+
+	// 共享对象不会被报告
+	makeObjectShared(createStringObject([]byte("shared")))
+	if leaks := objectDebugLeaks(mark); len(leaks) != 0 {
+		t.Fatalf("shared object reported as leak %q", leaks)
+	}
+}
+
+func TestObjectDebugDoubleFree(t *testing.T) {
+	o := createStringObject([]byte("x"))
+	decrRefCount(o)
+	r := recoverPanic(func() { decrRefCount(o) })
+	msg := fmt.Sprint(r)
+	if !strings.Contains(msg, "decrRefCount against freed object") ||
+		!strings.Contains(msg, "allocated at:") || !strings.Contains(msg, "freed at:") ||
+		strings.Count(msg, "TestObjectDebugDoubleFree") < 2 {
+		t.Errorf("unexpected panic %q", msg)
+	}
+}
@@ -1,15 +1,130 @@
 package datastruct
 
-import "errors"
+import (
+	"bytes"
+	"errors"
+	"math"
+	"unsafe"
+)
 
 const REDIS_COMPARE_BINARY = 1 << 0
+
+// 与 "C" locale 下的 strcoll 相同，不是与语言相关的排序规则
 const REDIS_COMPARE_COLL = 1 << 1
 
+// 共享对象的引用计数，incrRefCount 和 decrRefCount 不会修改它，对象永远不会被释放
+const OBJ_SHARED_REFCOUNT = math.MaxInt32
+
+// initStaticStringObject 创建的临时对象的引用计数，对它调用 incrRefCount 或 decrRefCount 会 panic
+const OBJ_STATIC_REFCOUNT = OBJ_SHARED_REFCOUNT - 1
+
+// 长度不超过该值的字符串使用 REDIS_ENCODING_EMBSTR 编码
+const REDIS_ENCODING_EMBSTR_SIZE_LIMIT = 39
+
+// 创建一个新对象，编码默认为 REDIS_ENCODING_RAW
+func createObject(rtype byte, ptr unsafe.Pointer) *redisObject {
+	o := &redisObject{
+		rtype:    rtype,
+		encoding: REDIS_ENCODING_RAW,
+		refcount: 1,
+		ptr:      ptr,
+	}
+	objectDebugCreate(o)
+	return o
+}
+
+// 创建一个以 ptr 为值的 REDIS_ENCODING_RAW 编码的字符串对象，对象拥有 ptr
+func createRawStringObject(ptr sds) *redisObject {
+	return createObject(REDIS_STRING, unsafe.Pointer(&ptr))
+}
+
+// 创建一个 REDIS_ENCODING_EMBSTR 编码的字符串对象，值为 ptr 的副本
+// C 中对象和 sds 在同一块内存中分配，这里只保留它只读的语义，修改前需要先转换为 REDIS_ENCODING_RAW 编码
+func createEmbeddedStringObject(ptr []byte) *redisObject {
+	o := createRawStringObject(sdsNewLen(ptr, len(ptr)))
+	o.encoding = REDIS_ENCODING_EMBSTR
+	return o
+}
+
+// 创建一个值为 ptr 副本的字符串对象
+// 长度不超过 REDIS_ENCODING_EMBSTR_SIZE_LIMIT 时使用 REDIS_ENCODING_EMBSTR 编码，否则使用 REDIS_ENCODING_RAW 编码
+func createStringObject(ptr []byte) *redisObject {
+	if len(ptr) <= REDIS_ENCODING_EMBSTR_SIZE_LIMIT {
+		return createEmbeddedStringObject(ptr)
+	}
+	return createRawStringObject(sdsNewLen(ptr, len(ptr)))
+}
+
+// 创建一个值为整数 value 的字符串对象
+// value 在 [0, REDIS_SHARED_INTEGERS) 范围内时返回共享的整数对象，否则使用 REDIS_ENCODING_INT 编码
+func createStringObjectFromLongLong(value int64) *redisObject {
+	if value >= 0 && value < REDIS_SHARED_INTEGERS {
+		incrRefCount(shared.integers[value])
+		return shared.integers[value]
+	}
+	o := createObject(REDIS_STRING, unsafe.Pointer(&value))
+	o.encoding = REDIS_ENCODING_INT
+	return o
+}
+
+// 返回一个以 ptr 为值的字符串对象，用于查找和比较时临时包装 sds
+// 对象不拥有 ptr，不能对它调用 incrRefCount 和 decrRefCount
+func initStaticStringObject(ptr sds) redisObject {
+	return redisObject{
+		rtype:    REDIS_STRING,
+		encoding: REDIS_ENCODING_RAW,
+		refcount: OBJ_STATIC_REFCOUNT,
+		ptr:      unsafe.Pointer(&ptr),
+	}
+}
+
+// 创建一个快速列表编码的空列表对象
+func createQuicklistObject() *redisObject {
+	l := quicklistCreate()
+	o := createObject(REDIS_LIST, unsafe.Pointer(l))
+	o.encoding = REDIS_ENCODING_QUICKLIST
+	return o
+}
+
+// 创建一个哈希表编码的空集合对象
+func createSetObject() *redisObject {
+	d := DictCreate(setDictType(), nil)
+	o := createObject(REDIS_SET, unsafe.Pointer(d))
+	o.encoding = REDIS_ENCODING_HT
+	return o
+}
+
+// 创建一个整数集合编码的空集合对象
+func createIntsetObject() *redisObject {
+	is := intsetNew()
+	o := createObject(REDIS_SET, unsafe.Pointer(&is))
+	o.encoding = REDIS_ENCODING_INTSET
+	return o
+}
+
+// 创建一个跳跃表编码的空有序集合对象
+func createZsetObject() *redisObject {
+	zs := &zset{
+		dict: DictCreate(zsetDictType(), nil),
+		zsl:  zslCreate(),
+	}
+	o := createObject(REDIS_ZSET, unsafe.Pointer(zs))
+	o.encoding = REDIS_ENCODING_SKIPLIST
+	return o
+}
+
+// 创建一个压缩列表编码的空有序集合对象
+func createZsetZiplistObject() *redisObject {
+	zl := ziplistNew()
+	o := createObject(REDIS_ZSET, unsafe.Pointer(&zl))
+	o.encoding = REDIS_ENCODING_ZIPLIST
+	return o
+}
+
 // 释放字符串对象
 func freeStringObject(robj *redisObject) {
-	if robj.encoding == REDIS_ENCODING_RAW {
-		//ptr := robj.ptr
-		//sdsFree((*ptr).(sds))
+	if sdsEncodedObject(robj) {
+		sdsFree(*(*sds)(robj.ptr))
 		robj.ptr = nil
 	}
 }
@@ -17,6 +132,8 @@ func freeStringObject(robj *redisObject) {
 // 释放列表对象
 func freeListObject(robj *redisObject) {
 	switch robj.encoding {
+	case REDIS_ENCODING_QUICKLIST:
+		quicklistRelease((*quicklist)(robj.ptr))
 	case REDIS_ENCODING_LINKEDLIST:
 		robj.ptr = nil
 	case REDIS_ENCODING_ZIPLIST:
@@ -40,7 +157,17 @@ func freeSetObject(robj *redisObject) {
 
 // 释放有序集合对象
 func freeZsetObject(robj *redisObject) {
-	//todo
+	switch robj.encoding {
+	case REDIS_ENCODING_SKIPLIST:
+		zs := (*zset)(robj.ptr)
+		// 字典与跳跃表共享成员对象，成员对象由跳跃表释放
+		dictRelease(zs.dict)
+		zslFree(zs.zsl)
+	case REDIS_ENCODING_ZIPLIST:
+		robj.ptr = nil
+	default:
+		panic(errors.New("Unknown sorted set encoding"))
+	}
 }
 
 // 释放哈希对象
@@ -55,12 +182,46 @@ func freeHashObject(robj *redisObject) {
 	}
 }
 
+// 将对象设置为共享对象，之后 decrRefCount 不会释放它，返回 o 本身
+// 对象只能在创建后、被其它地方引用前设置为共享对象
+func makeObjectShared(o *redisObject) *redisObject {
+	if o.refcount != 1 {
+		panic(errors.New("makeObjectShared against an object with refcount != 1"))
+	}
+	o.refcount = OBJ_SHARED_REFCOUNT
+	// 共享对象永远不会被释放，不再跟踪
+	objectDebugUntrack(o)
+	return o
+}
+
+// 为对象的引用计数加一，共享对象的引用计数不变
+func incrRefCount(robj *redisObject) {
+	switch {
+	case robj.refcount == OBJ_SHARED_REFCOUNT:
+	case robj.refcount == OBJ_STATIC_REFCOUNT:
+		panic(errors.New("incrRefCount against a static object"))
+	case robj.refcount <= 0:
+		objectDebugUseAfterFree(robj, "incrRefCount")
+		panic(errors.New("incrRefCount against refcount <= 0"))
+	default:
+		robj.refcount++
+	}
+}
+
 // 为对象的引用计数减一
-// 当对象的引用计数降为0时，释放对象
+// 当对象的引用计数降为0时，释放对象，共享对象不会被释放
+// 对象释放后引用计数为0，值为nil，之后再对它调用 decrRefCount 会 panic
 func decrRefCount(robj *redisObject) {
 	if robj.refcount <= 0 {
+		objectDebugUseAfterFree(robj, "decrRefCount")
 		panic(errors.New("decrRefCount against refcount <= 0"))
 	}
+	if robj.refcount == OBJ_SHARED_REFCOUNT {
+		return
+	}
+	if robj.refcount == OBJ_STATIC_REFCOUNT {
+		panic(errors.New("decrRefCount against a static object"))
+	}
 	if robj.refcount == 1 {
 		switch robj.rtype {
 		case REDIS_STRING:
@@ -76,23 +237,156 @@ func decrRefCount(robj *redisObject) {
 		default:
 			panic(errors.New("Unknown object type"))
 		}
-		robj = nil
+		robj.refcount = 0
+		robj.ptr = nil
+		objectDebugFree(robj)
 	} else {
 		robj.refcount--
 	}
 }
 
+// 将字符串对象的值转换为 int64，o 为nil时返回0
+// 值不能严格地表示为整数时第二个返回值为false
+func getLongLongFromObject(o *redisObject) (int64, bool) {
+	if o == nil {
+		return 0, true
+	}
+	if o.rtype != REDIS_STRING {
+		panic(errors.New("type must redis string"))
+	}
+	if sdsEncodedObject(o) {
+		return string2ll(*(*sds)(o.ptr))
+	}
+	if o.encoding == REDIS_ENCODING_INT {
+		return *(*int64)(o.ptr), true
+	}
+	panic(errors.New("Unknown string encoding"))
+}
+
+// 尝试用更节省空间的编码保存字符串对象，返回编码后的对象，o 可能已经被释放
+//
+// 可以表示为整数的字符串使用共享的整数对象或者 REDIS_ENCODING_INT 编码；
+// 长度不超过 REDIS_ENCODING_EMBSTR_SIZE_LIMIT 的字符串使用 REDIS_ENCODING_EMBSTR 编码；
+// 其余 REDIS_ENCODING_RAW 编码的字符串在剩余空间超过长度的10%时释放剩余空间。
+// 被共享的对象(refcount > 1)不会被修改
+func tryObjectEncoding(o *redisObject) *redisObject {
+	if o.rtype != REDIS_STRING {
+		panic(errors.New("tryObjectEncoding against a non string object"))
+	}
+	// 只对 sds 编码的字符串进行编码
+	if !sdsEncodedObject(o) {
+		return o
+	}
+	if o.refcount > 1 {
+		return o
+	}
+
+	s := *(*sds)(o.ptr)
+	length := sdsLen(s)
+	// 超过21个字符的字符串不可能表示为 int64
+	if length <= 21 {
+		if value, ok := string2ll(s); ok {
+			if value >= 0 && value < REDIS_SHARED_INTEGERS {
+				decrRefCount(o)
+				incrRefCount(shared.integers[value])
+				return shared.integers[value]
+			}
+			sdsFree(s)
+			o.encoding = REDIS_ENCODING_INT
+			o.ptr = unsafe.Pointer(&value)
+			return o
+		}
+	}
+
+	if length <= REDIS_ENCODING_EMBSTR_SIZE_LIMIT {
+		if o.encoding == REDIS_ENCODING_EMBSTR {
+			return o
+		}
+		emb := createEmbeddedStringObject(s)
+		decrRefCount(o)
+		return emb
+	}
+
+	if o.encoding == REDIS_ENCODING_RAW && sdsAvail(s) > length/10 {
+		s = sdsRemoveFreeSpace(s)
+		o.ptr = unsafe.Pointer(&s)
+	}
+	return o
+}
+
+// 返回字符串对象的 sds 编码版本
+// o 是 sds 编码时增加它的引用计数后返回 o 本身，整数编码时返回一个新的对象，
+// 调用者使用完毕后需要对返回的对象调用 decrRefCount
+func getDecodedObject(o *redisObject) *redisObject {
+	if sdsEncodedObject(o) {
+		incrRefCount(o)
+		return o
+	}
+	if o.rtype == REDIS_STRING && o.encoding == REDIS_ENCODING_INT {
+		str, _ := ll2string(*(*int64)(o.ptr))
+		return createStringObject([]byte(str))
+	}
+	panic(errors.New("Unknown encoding type"))
+}
+
+// 返回字符串对象值的长度，整数编码时为整数转换为字符串后的长度
+func stringObjectLen(o *redisObject) int {
+	if o.rtype != REDIS_STRING {
+		panic(errors.New("type must redis string"))
+	}
+	if sdsEncodedObject(o) {
+		return sdsLen(*(*sds)(o.ptr))
+	}
+	_, length := ll2string(*(*int64)(o.ptr))
+	return length
+}
+
+// 返回字符串对象的值，整数编码时转换为字符串，返回的值不能修改
+func stringObjectBytes(o *redisObject) []byte {
+	if sdsEncodedObject(o) {
+		return *(*sds)(o.ptr)
+	}
+	str, _ := ll2string(*(*int64)(o.ptr))
+	return []byte(str)
+}
+
+// 比较两个字符串对象，a 小于、等于、大于 b 时分别返回负数、0、正数
+//
+// flags 为 REDIS_COMPARE_BINARY 时按字节比较；
+// 为 REDIS_COMPARE_COLL 时与 C 的 strcoll 相同，排序规则为 "C" locale，见 strcollC。
+// Redis 使用进程当前的 locale，Go 没有 locale，这里不实现与语言相关的排序规则
 func compareStringObjectsWithFlags(a *redisObject, b *redisObject, flags int) int {
 	if a.rtype != REDIS_STRING || b.rtype != REDIS_STRING {
 		panic(errors.New("type must redis string"))
 	}
 	if a == b {
-		return 1
+		return 0
+	}
+	astr, bstr := stringObjectBytes(a), stringObjectBytes(b)
+	if flags&REDIS_COMPARE_COLL != 0 {
+		return strcollC(astr, bstr)
+	}
+	return bytes.Compare(astr, bstr)
+}
+
+// "C" locale 下的 strcoll：C 字符串在第一个 '\0' 处结束，之后按无符号字节的顺序比较
+// 与二进制比较的区别只在于忽略 '\0' 及其之后的内容
+func strcollC(a []byte, b []byte) int {
+	if i := bytes.IndexByte(a, 0); i >= 0 {
+		a = a[:i]
+	}
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
 	}
-	// todo
-	return 0
+	return bytes.Compare(a, b)
 }
 
+// 按二进制比较两个字符串对象
 func compareStringObjects(a *redisObject, b *redisObject) int {
 	return compareStringObjectsWithFlags(a, b, REDIS_COMPARE_BINARY)
 }
+
+// 按 strcoll 的规则比较两个字符串对象，排序规则为 "C" locale
+func collateStringObjects(a *redisObject, b *redisObject) int {
+	return compareStringObjectsWithFlags(a, b, REDIS_COMPARE_COLL)
+}
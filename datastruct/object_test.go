@@ -0,0 +1,254 @@
+package datastruct
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCreateStringObject(t *testing.T) {
+	checkObjectLeaks(t)
+	short := createStringObject([]byte("hello"))
+	if short.encoding != REDIS_ENCODING_EMBSTR || string(*(*sds)(short.ptr)) != "hello" {
+		t.Errorf("short string: encoding %d value %q", short.encoding, *(*sds)(short.ptr))
+	}
+	long := createStringObject([]byte(strings.Repeat("a", REDIS_ENCODING_EMBSTR_SIZE_LIMIT+1)))
+	if long.encoding != REDIS_ENCODING_RAW || stringObjectLen(long) != REDIS_ENCODING_EMBSTR_SIZE_LIMIT+1 {
+		t.Errorf("long string: encoding %d len %d", long.encoding, stringObjectLen(long))
+	}
+	decrRefCount(short)
+	decrRefCount(long)
+
+	// 小整数返回共享对象
+	a := createStringObjectFromLongLong(10)
+	b := createStringObjectFromLongLong(10)
+	if a != b || a != shared.integers[10] {
+		t.Errorf("expected shared integer object")
+	}
+	decrRefCount(a)
+	decrRefCount(b)
+
+	for _, v := range []int64{-1, REDIS_SHARED_INTEGERS, 1 << 40} {
+		o := createStringObjectFromLongLong(v)
+		if o.encoding != REDIS_ENCODING_INT || *(*int64)(o.ptr) != v {
+			t.Errorf("%d: encoding %d", v, o.encoding)
+		}
+		decrRefCount(o)
+	}
+}
+
+func TestTryObjectEncoding(t *testing.T) {
+	checkObjectLeaks(t)
+	cases := []struct {
+		value    string
+		encoding byte
+	}{
+		{"123", REDIS_ENCODING_INT},
+		{"-5", REDIS_ENCODING_INT},
+		{"12345678901", REDIS_ENCODING_INT},
+		{"9223372036854775807", REDIS_ENCODING_INT},
+		{"9223372036854775808", REDIS_ENCODING_EMBSTR},
+		{"0123", REDIS_ENCODING_EMBSTR},
+		{" 1", REDIS_ENCODING_EMBSTR},
+		{"hello", REDIS_ENCODING_EMBSTR},
+		{strings.Repeat("x", 100), REDIS_ENCODING_RAW},
+	}
+	for _, c := range cases {
+		o := tryObjectEncoding(createRawStringObject(sdsNew(c.value)))
+		if o.encoding != c.encoding {
+			t.Errorf("%q: encoding %d, want %d", c.value, o.encoding, c.encoding)
+		}
+		if got := string(stringObjectBytes(o)); got != c.value {
+			t.Errorf("%q: value %q", c.value, got)
+		}
+		if stringObjectLen(o) != len(c.value) {
+			t.Errorf("%q: len %d", c.value, stringObjectLen(o))
+		}
+		decrRefCount(o)
+	}
+
+	// 共享范围内的整数使用共享对象
+	o := tryObjectEncoding(createRawStringObject(sdsNew("42")))
+	if o != shared.integers[42] {
+		t.Errorf("expected shared integer 42")
+	}
+	decrRefCount(o)
+
+	// 被共享的对象不会被修改
+	o = createRawStringObject(sdsNew("42"))
+	incrRefCount(o)
+	if tryObjectEncoding(o) != o || o.encoding != REDIS_ENCODING_RAW {
+		t.Errorf("shared object was encoded")
+	}
+	decrRefCount(o)
+	decrRefCount(o)
+
+	// 剩余空间过多的 RAW 字符串会释放剩余空间
+	s := sdsMakeRoomFor(sdsNew(strings.Repeat("y", 50)), 1000)
+	o = tryObjectEncoding(createRawStringObject(s))
+	if got := sdsAllocSize(*(*sds)(o.ptr)); got != zmallocSize(50) {
+		t.Errorf("free space not removed, alloc size %d", got)
+	}
+	decrRefCount(o)
+}
+
+func TestGetDecodedObject(t *testing.T) {
+	checkObjectLeaks(t)
+	o := createStringObjectFromLongLong(-123456)
+	d := getDecodedObject(o)
+	if !sdsEncodedObject(d) || string(*(*sds)(d.ptr)) != "-123456" {
+		t.Errorf("decoded %q", stringObjectBytes(d))
+	}
+	decrRefCount(d)
+	decrRefCount(o)
+
+	o = createStringObject([]byte("abc"))
+	if d := getDecodedObject(o); d != o || o.refcount != 2 {
+		t.Errorf("sds encoded object should be returned with refcount incremented")
+	}
+	decrRefCount(o)
+	decrRefCount(o)
+}
+
+func TestCompareStringObjects(t *testing.T) {
+	checkObjectLeaks(t)
+	obj := func(s string) *redisObject {
+		return tryObjectEncoding(createRawStringObject(sdsNew(s)))
+	}
+	cases := []struct {
+		a, b    string
+		binary  int
+		strcoll int
+	}{
+		{"abc", "abc", 0, 0},
+		{"abc", "abd", -1, -1},
+		{"b", "abc", 1, 1},
+		{"ab", "abc", -1, -1},
+		// 整数编码的对象按字符串比较
+		{"100", "99", -1, -1},
+		{"-1", "1", -1, -1},
+		{"100", "abc", -1, -1},
+		{"12", "12", 0, 0},
+		// strcoll 只比较到第一个 '\0'，与二进制比较的结果不同
+		{"a\x00b", "a\x00c", -1, 0},
+		{"a\x00b", "a", 1, 0},
+		{"\x00z", "\x00a", 1, 0},
+		{"a", "a\x00", -1, 0},
+		{"ab", "a\x00c", 1, 1},
+		// "C" locale 按无符号字节排序，大写字母在小写字母之前，é 在 z 之后
+		{"B", "a", -1, -1},
+		{"\xc3\xa9", "z", 1, 1},
+	}
+	sign := func(n int) int {
+		switch {
+		case n < 0:
+			return -1
+		case n > 0:
+			return 1
+		}
+		return 0
+	}
+	for _, c := range cases {
+		a, b := obj(c.a), obj(c.b)
+		if got := sign(compareStringObjects(a, b)); got != c.binary {
+			t.Errorf("binary %q %q: %d, want %d", c.a, c.b, got, c.binary)
+		}
+		if got := sign(collateStringObjects(a, b)); got != c.strcoll {
+			t.Errorf("strcoll %q %q: %d, want %d", c.a, c.b, got, c.strcoll)
+		}
+		decrRefCount(a)
+		decrRefCount(b)
+	}
+}
+
+func TestEqualStringObjects(t *testing.T) {
+	checkObjectLeaks(t)
+	a := createStringObjectFromLongLong(1 << 40)
+	b := createStringObjectFromLongLong(1 << 40)
+	c := createStringObjectFromLongLong(1<<40 + 1)
+	if a == b || equalStringObjects(a, b) != 1 {
+		t.Errorf("integer objects with same value should be equal")
+	}
+	if equalStringObjects(a, c) != 0 {
+		t.Errorf("integer objects with different value should not be equal")
+	}
+	s := createStringObject([]byte("1099511627776"))
+	if equalStringObjects(a, s) != 1 || equalStringObjects(s, a) != 1 {
+		t.Errorf("integer and string object with same value should be equal")
+	}
+	decrRefCount(a)
+	decrRefCount(b)
+	decrRefCount(c)
+	decrRefCount(s)
+}
+
+// 调用 f，返回它 panic 的值
+func recoverPanic(f func()) (r interface{}) {
+	defer func() {
+		r = recover()
+	}()
+	f()
+	return nil
+}
+
+func TestRefCount(t *testing.T) {
+	checkObjectLeaks(t)
+	o := createStringObject([]byte("hello"))
+	incrRefCount(o)
+	decrRefCount(o)
+	if o.refcount != 1 || string(stringObjectBytes(o)) != "hello" {
+		t.Fatalf("refcount %d", o.refcount)
+	}
+	decrRefCount(o)
+	if o.refcount != 0 || o.ptr != nil {
+		t.Fatalf("freed object: refcount %d", o.refcount)
+	}
+
+	// 重复释放和释放后再引用
+	if recoverPanic(func() { decrRefCount(o) }) == nil {
+		t.Errorf("double free should panic")
+	}
+	if recoverPanic(func() { incrRefCount(o) }) == nil {
+		t.Errorf("incrRefCount after free should panic")
+	}
+
+	// 临时对象不能被引用或释放
+	s := sdsNew("static")
+	static := initStaticStringObject(s)
+	if recoverPanic(func() { incrRefCount(&static) }) == nil {
+		t.Errorf("incrRefCount on static object should panic")
+	}
+	if recoverPanic(func() { decrRefCount(&static) }) == nil {
+		t.Errorf("decrRefCount on static object should panic")
+	}
+	if string(*(*sds)(static.ptr)) != "static" {
+		t.Errorf("static object modified")
+	}
+	sdsFree(s)
+
+	// 每种类型的对象都可以被释放
+	for _, o := range []*redisObject{
+		createStringObjectFromLongLong(-1),
+		createQuicklistObject(),
+		createSetObject(),
+		createIntsetObject(),
+		createZsetObject(),
+		createZsetZiplistObject(),
+	} {
+		decrRefCount(o)
+		if o.refcount != 0 || o.ptr != nil {
+			t.Errorf("type %d encoding %d not freed", o.rtype, o.encoding)
+		}
+	}
+}
+
+// 检查测试期间创建的对象在测试结束时是否都已经释放
+// 只在使用 -tags objdebug 构建时生效
+func checkObjectLeaks(t *testing.T) {
+	t.Helper()
+	mark := objectDebugMark()
+	t.Cleanup(func() {
+		for _, leak := range objectDebugLeaks(mark) {
+			t.Errorf("leaked object %s", leak)
+		}
+	})
+}
@@ -0,0 +1,1214 @@
+/*
+快速列表(quicklist)实现，与 Redis 的 quicklist.c 对应
+
+快速列表是以压缩列表为节点的双端链表，兼顾了链表插入删除的效率和压缩列表的内存利用率。
+
+fill 决定每个节点可以保存多少元素，对应配置项 list-max-ziplist-size：
+为正数时表示每个节点最多保存的元素数量(节点大小仍然受 SIZE_SAFETY_LIMIT 限制)；
+为 -1 到 -5 时表示每个节点的压缩列表最多占用 4KB、8KB、16KB、32KB、64KB。
+
+compress 决定链表两端各有多少个节点不被压缩，对应配置项 list-compress-depth：
+为0时不压缩，否则两端之间的节点会使用 LZF 算法压缩，访问时再临时解压。
+*/
+package datastruct
+
+// 节点的编码
+const (
+	QUICKLIST_NODE_ENCODING_RAW = 1
+	QUICKLIST_NODE_ENCODING_LZF = 2
+)
+
+// 节点的容器类型
+const (
+	QUICKLIST_NODE_CONTAINER_NONE    = 1
+	QUICKLIST_NODE_CONTAINER_ZIPLIST = 2
+)
+
+// 添加和弹出元素的位置
+const (
+	QUICKLIST_HEAD = 0
+	QUICKLIST_TAIL = -1
+)
+
+// fill 为正数时节点的压缩列表最多占用的字节数
+const SIZE_SAFETY_LIMIT = 8192
+
+// 小于该大小的节点不压缩
+const MIN_COMPRESS_BYTES = 48
+
+// 压缩后至少要减少的字节数，否则不压缩
+const MIN_COMPRESS_IMPROVE = 8
+
+// fill 和 compress 的最大值
+const (
+	FILL_MAX     = 1<<15 - 1
+	COMPRESS_MAX = 1<<16 - 1
+)
+
+// 最多可以创建的书签数量
+const QL_MAX_BM = 1<<4 - 1
+
+// fill 为 -1 到 -5 时对应的节点大小上限
+var optimization_level = []int{4096, 8192, 16384, 32768, 65536}
+
+// 压缩后的节点数据
+type quicklistLZF struct {
+	// 压缩后的长度
+	sz         int
+	compressed []byte
+}
+
+// 快速列表节点
+type quicklistNode struct {
+	prev, next *quicklistNode
+	// 未压缩时的压缩列表
+	zl []byte
+	// 压缩后的数据，只在编码为 QUICKLIST_NODE_ENCODING_LZF 时有效
+	lzf *quicklistLZF
+	// 压缩列表的字节数，节点被压缩时同样记录压缩前的大小
+	sz int
+	// 压缩列表的元素数量
+	count int
+	// 编码 RAW 或 LZF
+	encoding int
+	// 容器类型，目前只有压缩列表
+	container int
+	// 节点是否因为使用而被临时解压，使用后需要重新压缩
+	recompress bool
+	// 节点是否尝试过压缩但因为太小没有压缩，测试时使用
+	attemptedCompress bool
+}
+
+// 书签，记录某个节点，删除该节点时书签移动到下一个节点
+// 用于在多次调用之间保存遍历的位置
+type quicklistBookmark struct {
+	node *quicklistNode
+	name string
+}
+
+// 快速列表
+type quicklist struct {
+	head, tail *quicklistNode
+	// 所有压缩列表的元素总数
+	count int
+	// 节点数量
+	len int
+	// 节点的大小限制
+	fill int
+	// 两端不压缩的节点数量，0表示不压缩
+	compress  int
+	bookmarks []quicklistBookmark
+}
+
+// 快速列表迭代器
+type quicklistIter struct {
+	quicklist *quicklist
+	current   *quicklistNode
+	// 当前节点中压缩列表的位置，-1 表示需要根据 offset 重新定位
+	zi int
+	// 元素在当前节点中的偏移量，从表尾开始迭代时为负数
+	offset    int
+	direction int
+}
+
+// 快速列表中的一个元素
+type quicklistEntry struct {
+	quicklist *quicklist
+	node      *quicklistNode
+	// 元素在压缩列表中的位置
+	zi int
+	// 字符串编码时的值，整数编码时为nil
+	value   []byte
+	longval int64
+	sz      int
+	// 元素在节点中的偏移量
+	offset int
+}
+
+func initEntry(entry *quicklistEntry) {
+	entry.quicklist = nil
+	entry.node = nil
+	entry.zi = -1
+	entry.value = nil
+	entry.longval = -123456789
+	entry.sz = 0
+	entry.offset = 123456789
+}
+
+// 创建一个空的快速列表，fill 为 -2，不压缩
+func quicklistCreate() *quicklist {
+	return &quicklist{
+		fill:     -2,
+		compress: 0,
+	}
+}
+
+// 设置两端不压缩的节点数量
+func quicklistSetCompressDepth(ql *quicklist, compress int) {
+	if compress > COMPRESS_MAX {
+		compress = COMPRESS_MAX
+	} else if compress < 0 {
+		compress = 0
+	}
+	ql.compress = compress
+}
+
+// 设置节点的大小限制
+func quicklistSetFill(ql *quicklist, fill int) {
+	if fill > FILL_MAX {
+		fill = FILL_MAX
+	} else if fill < -5 {
+		fill = -5
+	}
+	ql.fill = fill
+}
+
+func quicklistSetOptions(ql *quicklist, fill int, depth int) {
+	quicklistSetFill(ql, fill)
+	quicklistSetCompressDepth(ql, depth)
+}
+
+// 使用给定的选项创建一个空的快速列表
+func quicklistNew(fill int, compress int) *quicklist {
+	ql := quicklistCreate()
+	quicklistSetOptions(ql, fill, compress)
+	return ql
+}
+
+func quicklistCreateNode() *quicklistNode {
+	return &quicklistNode{
+		encoding:  QUICKLIST_NODE_ENCODING_RAW,
+		container: QUICKLIST_NODE_CONTAINER_ZIPLIST,
+	}
+}
+
+// 返回快速列表的元素数量
+func quicklistCount(ql *quicklist) int {
+	return ql.count
+}
+
+// 释放快速列表
+func quicklistRelease(ql *quicklist) {
+	current := ql.head
+	for current != nil {
+		next := current.next
+		current.zl = nil
+		current.lzf = nil
+		current.prev, current.next = nil, nil
+		ql.len--
+		current = next
+	}
+	quicklistBookmarksClear(ql)
+	ql.head, ql.tail = nil, nil
+	ql.count = 0
+}
+
+// 压缩节点，压缩成功时返回true
+// 节点太小或者压缩后没有足够的改善时不压缩
+func __quicklistCompressNode(node *quicklistNode) bool {
+	node.attemptedCompress = true
+	// 无论是否压缩成功，节点都不再需要重新压缩
+	node.recompress = false
+
+	// 太小的节点不压缩
+	if node.sz < MIN_COMPRESS_BYTES {
+		return false
+	}
+
+	compressed := make([]byte, node.sz)
+	sz := lzfCompress(node.zl, compressed)
+	// 压缩失败或者压缩后减少的字节数太少
+	if sz == 0 || sz+MIN_COMPRESS_IMPROVE >= node.sz {
+		return false
+	}
+	node.lzf = &quicklistLZF{
+		sz:         sz,
+		compressed: compressed[:sz:sz],
+	}
+	node.zl = nil
+	node.encoding = QUICKLIST_NODE_ENCODING_LZF
+	return true
+}
+
+// 节点未压缩时压缩节点
+func quicklistCompressNode(node *quicklistNode) {
+	if node != nil && node.encoding == QUICKLIST_NODE_ENCODING_RAW {
+		__quicklistCompressNode(node)
+	}
+}
+
+// 解压节点，解压成功时返回true
+func __quicklistDecompressNode(node *quicklistNode) bool {
+	node.attemptedCompress = false
+
+	decompressed := make([]byte, node.sz)
+	if lzfDecompress(node.lzf.compressed, decompressed) == 0 {
+		// 压缩的数据损坏
+		return false
+	}
+	node.zl = decompressed
+	node.lzf = nil
+	node.encoding = QUICKLIST_NODE_ENCODING_RAW
+	return true
+}
+
+// 节点被压缩时解压节点
+func quicklistDecompressNode(node *quicklistNode) {
+	if node != nil && node.encoding == QUICKLIST_NODE_ENCODING_LZF {
+		__quicklistDecompressNode(node)
+	}
+}
+
+// 为了使用节点而临时解压节点，使用后需要调用 quicklistRecompressOnly 或 quicklistCompress 重新压缩
+func quicklistDecompressNodeForUse(node *quicklistNode) {
+	if node != nil && node.encoding == QUICKLIST_NODE_ENCODING_LZF {
+		__quicklistDecompressNode(node)
+		node.recompress = true
+	}
+}
+
+// 返回节点压缩后的数据
+func quicklistGetLzf(node *quicklistNode) []byte {
+	return node.lzf.compressed
+}
+
+func quicklistNodeUpdateSz(node *quicklistNode) {
+	node.sz = ziplistBlobLen(node.zl)
+}
+
+func quicklistAllowsCompression(ql *quicklist) bool {
+	return ql.compress != 0
+}
+
+// 确保两端 compress 个节点没有被压缩，并压缩 node 以及刚好超出深度的两个节点
+func __quicklistCompress(ql *quicklist, node *quicklistNode) {
+	// 不压缩，或者节点太少，所有节点都在两端的深度内
+	if !quicklistAllowsCompression(ql) || ql.len < ql.compress*2 {
+		return
+	}
+
+	// 从两端向中间遍历，解压深度内的节点
+	forward := ql.head
+	reverse := ql.tail
+	depth := 0
+	inDepth := false
+	for depth < ql.compress {
+		depth++
+		quicklistDecompressNode(forward)
+		quicklistDecompressNode(reverse)
+
+		if forward == node || reverse == node {
+			inDepth = true
+		}
+
+		// 两端相遇，所有节点都在深度内
+		if forward == reverse {
+			return
+		}
+
+		forward = forward.next
+		reverse = reverse.prev
+	}
+	depth++
+
+	if !inDepth {
+		quicklistCompressNode(node)
+	}
+
+	if depth > 2 {
+		// forward 和 reverse 刚好超出深度
+		quicklistCompressNode(forward)
+		quicklistCompressNode(reverse)
+	}
+}
+
+// 节点是被临时解压的时只重新压缩它，否则根据深度压缩
+func quicklistCompress(ql *quicklist, node *quicklistNode) {
+	if node.recompress {
+		quicklistCompressNode(node)
+	} else {
+		__quicklistCompress(ql, node)
+	}
+}
+
+// 节点是被临时解压的时重新压缩它
+func quicklistRecompressOnly(ql *quicklist, node *quicklistNode) {
+	if node.recompress {
+		quicklistCompressNode(node)
+	}
+}
+
+// 将 newNode 插入到 oldNode 之前或之后，oldNode 为nil时快速列表必须为空
+func __quicklistInsertNode(ql *quicklist, oldNode *quicklistNode, newNode *quicklistNode, after bool) {
+	if after {
+		newNode.prev = oldNode
+		if oldNode != nil {
+			newNode.next = oldNode.next
+			if oldNode.next != nil {
+				oldNode.next.prev = newNode
+			}
+			oldNode.next = newNode
+		}
+		if ql.tail == oldNode {
+			ql.tail = newNode
+		}
+	} else {
+		newNode.next = oldNode
+		if oldNode != nil {
+			newNode.prev = oldNode.prev
+			if oldNode.prev != nil {
+				oldNode.prev.next = newNode
+			}
+			oldNode.prev = newNode
+		}
+		if ql.head == oldNode {
+			ql.head = newNode
+		}
+	}
+	// 第一个节点
+	if ql.len == 0 {
+		ql.head = newNode
+		ql.tail = newNode
+	}
+
+	if oldNode != nil {
+		quicklistCompress(ql, oldNode)
+	}
+	ql.len++
+}
+
+func _quicklistInsertNodeBefore(ql *quicklist, oldNode *quicklistNode, newNode *quicklistNode) {
+	__quicklistInsertNode(ql, oldNode, newNode, false)
+}
+
+func _quicklistInsertNodeAfter(ql *quicklist, oldNode *quicklistNode, newNode *quicklistNode) {
+	__quicklistInsertNode(ql, oldNode, newNode, true)
+}
+
+// fill 为负数时，检查大小为 sz 的节点是否满足对应的大小限制
+func _quicklistNodeSizeMeetsOptimizationRequirement(sz int, fill int) bool {
+	if fill >= 0 {
+		return false
+	}
+	offset := (-fill) - 1
+	if offset < len(optimization_level) {
+		return sz <= optimization_level[offset]
+	}
+	return false
+}
+
+func sizeMeetsSafetyLimit(sz int) bool {
+	return sz <= SIZE_SAFETY_LIMIT
+}
+
+// 检查是否可以向节点中再添加一个长度为 sz 的元素
+func _quicklistNodeAllowInsert(node *quicklistNode, fill int, sz int) bool {
+	if node == nil {
+		return false
+	}
+
+	// 估算新元素的 prevlen 和 encoding 占用的字节数
+	ziplistOverhead := 0
+	if sz < 254 {
+		ziplistOverhead = 1
+	} else {
+		ziplistOverhead = 5
+	}
+	if sz < 64 {
+		ziplistOverhead += 1
+	} else if sz < 16384 {
+		ziplistOverhead += 2
+	} else {
+		ziplistOverhead += 5
+	}
+
+	newSz := node.sz + sz + ziplistOverhead
+	if _quicklistNodeSizeMeetsOptimizationRequirement(newSz, fill) {
+		return true
+	} else if !sizeMeetsSafetyLimit(newSz) {
+		return false
+	} else if node.count < fill {
+		return true
+	}
+	return false
+}
+
+// 检查两个节点是否可以合并
+func _quicklistNodeAllowMerge(a *quicklistNode, b *quicklistNode, fill int) bool {
+	if a == nil || b == nil {
+		return false
+	}
+
+	// 合并后只保留一个压缩列表头部和结束标志
+	mergeSz := a.sz + b.sz - ZIPLIST_HEADER_SIZE - 1
+	if _quicklistNodeSizeMeetsOptimizationRequirement(mergeSz, fill) {
+		return true
+	} else if !sizeMeetsSafetyLimit(mergeSz) {
+		return false
+	} else if a.count+b.count <= fill {
+		return true
+	}
+	return false
+}
+
+// 将 value 添加到表头，创建了新的表头节点时返回true
+func quicklistPushHead(ql *quicklist, value []byte) bool {
+	origHead := ql.head
+	if _quicklistNodeAllowInsert(ql.head, ql.fill, len(value)) {
+		ql.head.zl = ziplistPush(ql.head.zl, value, ZIPLIST_HEAD)
+		quicklistNodeUpdateSz(ql.head)
+	} else {
+		node := quicklistCreateNode()
+		node.zl = ziplistPush(ziplistNew(), value, ZIPLIST_HEAD)
+		quicklistNodeUpdateSz(node)
+		_quicklistInsertNodeBefore(ql, ql.head, node)
+	}
+	ql.count++
+	ql.head.count++
+	return origHead != ql.head
+}
+
+// 将 value 添加到表尾，创建了新的表尾节点时返回true
+func quicklistPushTail(ql *quicklist, value []byte) bool {
+	origTail := ql.tail
+	if _quicklistNodeAllowInsert(ql.tail, ql.fill, len(value)) {
+		ql.tail.zl = ziplistPush(ql.tail.zl, value, ZIPLIST_TAIL)
+		quicklistNodeUpdateSz(ql.tail)
+	} else {
+		node := quicklistCreateNode()
+		node.zl = ziplistPush(ziplistNew(), value, ZIPLIST_TAIL)
+		quicklistNodeUpdateSz(node)
+		_quicklistInsertNodeAfter(ql, ql.tail, node)
+	}
+	ql.count++
+	ql.tail.count++
+	return origTail != ql.tail
+}
+
+// 将 value 添加到表头或表尾，where 为 QUICKLIST_HEAD 或 QUICKLIST_TAIL
+func quicklistPush(ql *quicklist, value []byte, where int) {
+	if where == QUICKLIST_HEAD {
+		quicklistPushHead(ql, value)
+	} else if where == QUICKLIST_TAIL {
+		quicklistPushTail(ql, value)
+	}
+}
+
+// 将整个压缩列表作为一个新节点添加到表尾，用于从 RDB 载入
+// 之后快速列表拥有 zl，调用者不能再使用它
+func quicklistAppendZiplist(ql *quicklist, zl []byte) {
+	node := quicklistCreateNode()
+	node.zl = zl
+	node.count = ziplistLen(node.zl)
+	node.sz = ziplistBlobLen(zl)
+
+	_quicklistInsertNodeAfter(ql, ql.tail, node)
+	ql.count += node.count
+}
+
+// 将压缩列表中的元素逐个添加到表尾，节点大小遵循快速列表的 fill
+func quicklistAppendValuesFromZiplist(ql *quicklist, zl []byte) *quicklist {
+	for p := ziplistIndex(zl, 0); p >= 0; p = ziplistNext(zl, p) {
+		value, longval, _ := ziplistGet(zl, p)
+		if value == nil {
+			s, _ := ll2string(longval)
+			value = []byte(s)
+		}
+		quicklistPushTail(ql, value)
+	}
+	return ql
+}
+
+// 使用压缩列表中的元素创建快速列表
+func quicklistCreateFromZiplist(fill int, compress int, zl []byte) *quicklist {
+	return quicklistAppendValuesFromZiplist(quicklistNew(fill, compress), zl)
+}
+
+// 节点为空时删除节点，返回删除后的节点(被删除时为nil)
+func quicklistDeleteIfEmpty(ql *quicklist, node *quicklistNode) *quicklistNode {
+	if node.count == 0 {
+		__quicklistDelNode(ql, node)
+		return nil
+	}
+	return node
+}
+
+// 从快速列表中删除节点
+func __quicklistDelNode(ql *quicklist, node *quicklistNode) {
+	// 指向该节点的书签移动到下一个节点，没有下一个节点时删除书签
+	if bm := _quicklistBookmarkFindByNode(ql, node); bm != nil {
+		bm.node = node.next
+		if bm.node == nil {
+			_quicklistBookmarkDelete(ql, bm)
+		}
+	}
+
+	if node.next != nil {
+		node.next.prev = node.prev
+	}
+	if node.prev != nil {
+		node.prev.next = node.next
+	}
+	if node == ql.tail {
+		ql.tail = node.prev
+	}
+	if node == ql.head {
+		ql.head = node.next
+	}
+
+	// 删除的节点在深度内时，原先被压缩的节点进入了深度内，需要解压
+	__quicklistCompress(ql, nil)
+
+	ql.count -= node.count
+	node.zl = nil
+	node.lzf = nil
+	ql.len--
+}
+
+// 删除节点中 p 处的元素，节点变为空时删除节点
+// 返回节点是否被删除，以及删除后 p 处的位置
+func quicklistDelIndex(ql *quicklist, node *quicklistNode, p int) (bool, int) {
+	gone := false
+	node.zl, p = ziplistDelete(node.zl, p)
+	node.count--
+	if node.count == 0 {
+		gone = true
+		__quicklistDelNode(ql, node)
+	} else {
+		quicklistNodeUpdateSz(node)
+	}
+	ql.count--
+	return gone, p
+}
+
+// 删除迭代器返回的元素，之后可以继续使用迭代器
+func quicklistDelEntry(iter *quicklistIter, entry *quicklistEntry) {
+	prev := entry.node.prev
+	next := entry.node.next
+	deletedNode, _ := quicklistDelIndex(entry.quicklist, entry.node, entry.zi)
+
+	// 删除后压缩列表中的位置失效，迭代器需要根据 offset 重新定位
+	iter.zi = -1
+
+	// 当前节点被删除时移动到下一个节点
+	if deletedNode {
+		if iter.direction == AL_START_HEAD {
+			iter.current = next
+			iter.offset = 0
+		} else if iter.direction == AL_START_TAIL {
+			iter.current = prev
+			iter.offset = -1
+		}
+	}
+	// 节点没有被删除时 offset 不需要改变：
+	//   - [1, 2, 3] 删除偏移量1后为 [1, 3]，下一个元素的偏移量仍然是1
+	//   - 从表尾迭代时 [1, 2, 3] 删除偏移量-1后为 [1, 2]，下一个元素的偏移量仍然是-1
+	// 删除的是节点的最后一个元素时，下一次调用 quicklistNext 会移动到下一个节点
+}
+
+// 将索引 index 处的元素替换为 data，index 超出范围时返回false
+func quicklistReplaceAtIndex(ql *quicklist, index int, data []byte) bool {
+	var entry quicklistEntry
+	if quicklistIndex(ql, index, &entry) {
+		// quicklistIndex 返回的节点已经解压
+		entry.node.zl, entry.zi = ziplistDelete(entry.node.zl, entry.zi)
+		entry.node.zl = ziplistInsert(entry.node.zl, entry.zi, data)
+		quicklistNodeUpdateSz(entry.node)
+		quicklistCompress(ql, entry.node)
+		return true
+	}
+	return false
+}
+
+// 将 b 的压缩列表合并到 a 中并删除 b，返回保留的节点
+func _quicklistZiplistMerge(ql *quicklist, a *quicklistNode, b *quicklistNode) *quicklistNode {
+	quicklistDecompressNode(a)
+	quicklistDecompressNode(b)
+
+	a.zl = ziplistMerge(a.zl, b.zl)
+	a.count = ziplistLen(a.zl)
+	quicklistNodeUpdateSz(a)
+
+	b.count = 0
+	__quicklistDelNode(ql, b)
+	quicklistCompress(ql, a)
+	return a
+}
+
+// 尝试合并 center 附近的节点：
+//   - (center.prev.prev, center.prev)
+//   - (center.next, center.next.next)
+//   - (center.prev, center)
+//   - (center, center.next)
+func _quicklistMergeNodes(ql *quicklist, center *quicklistNode) {
+	fill := ql.fill
+	var prev, prevPrev, next, nextNext, target *quicklistNode
+
+	if center.prev != nil {
+		prev = center.prev
+		if center.prev.prev != nil {
+			prevPrev = center.prev.prev
+		}
+	}
+	if center.next != nil {
+		next = center.next
+		if center.next.next != nil {
+			nextNext = center.next.next
+		}
+	}
+
+	// 尝试合并 prevPrev 和 prev
+	if _quicklistNodeAllowMerge(prev, prevPrev, fill) {
+		_quicklistZiplistMerge(ql, prevPrev, prev)
+	}
+
+	// 尝试合并 next 和 nextNext
+	if _quicklistNodeAllowMerge(next, nextNext, fill) {
+		_quicklistZiplistMerge(ql, next, nextNext)
+	}
+
+	// 尝试合并 center 和它的前一个节点
+	if _quicklistNodeAllowMerge(center, center.prev, fill) {
+		target = _quicklistZiplistMerge(ql, center.prev, center)
+	} else {
+		target = center
+	}
+
+	// 尝试合并上一步的结果和它的后一个节点
+	if _quicklistNodeAllowMerge(target, target.next, fill) {
+		_quicklistZiplistMerge(ql, target, target.next)
+	}
+}
+
+// 在 offset 处分裂节点，返回新的节点，新节点还没有加入快速列表
+// after 为true时，node 保留 [0, offset]，新节点保存 (offset, end]；
+// after 为false时，node 保留 [offset, end]，新节点保存 [0, offset)
+func _quicklistSplitNode(node *quicklistNode, offset int, after bool) *quicklistNode {
+	if offset < 0 {
+		offset += node.count
+	}
+
+	newNode := quicklistCreateNode()
+	// 复制原先的压缩列表，两个节点各自删除不需要的部分
+	newNode.zl = append([]byte(nil), node.zl[:node.sz]...)
+
+	var origStart, origExtent, newStart, newExtent int
+	if after {
+		origStart, origExtent = offset+1, node.count
+		newStart, newExtent = 0, offset+1
+	} else {
+		origStart, origExtent = 0, offset
+		newStart, newExtent = offset, node.count
+	}
+
+	node.zl = ziplistDeleteRange(node.zl, origStart, origExtent)
+	node.count = ziplistLen(node.zl)
+	quicklistNodeUpdateSz(node)
+
+	newNode.zl = ziplistDeleteRange(newNode.zl, newStart, newExtent)
+	newNode.count = ziplistLen(newNode.zl)
+	quicklistNodeUpdateSz(newNode)
+
+	return newNode
+}
+
+// 在 entry 之前或之后插入 value
+// 插入位置所在的节点已满时，可能将 value 插入相邻的节点、创建新的节点，或者分裂节点
+func _quicklistInsert(ql *quicklist, entry *quicklistEntry, value []byte, after bool) {
+	full, atTail, atHead, fullNext, fullPrev := false, false, false, false, false
+	fill := ql.fill
+	node := entry.node
+	sz := len(value)
+
+	if node == nil {
+		// 没有参照节点，创建唯一的节点
+		newNode := quicklistCreateNode()
+		newNode.zl = ziplistPush(ziplistNew(), value, ZIPLIST_HEAD)
+		quicklistNodeUpdateSz(newNode)
+		__quicklistInsertNode(ql, nil, newNode, after)
+		newNode.count++
+		ql.count++
+		return
+	}
+
+	offset := entry.offset
+	if offset < 0 {
+		offset += node.count
+	}
+
+	if !_quicklistNodeAllowInsert(node, fill, sz) {
+		full = true
+	}
+
+	if after && offset == node.count-1 {
+		atTail = true
+		if !_quicklistNodeAllowInsert(node.next, fill, sz) {
+			fullNext = true
+		}
+	}
+
+	if !after && offset == 0 {
+		atHead = true
+		if !_quicklistNodeAllowInsert(node.prev, fill, sz) {
+			fullPrev = true
+		}
+	}
+
+	if !full && after {
+		// 节点没有满，插入到 entry 之后
+		quicklistDecompressNodeForUse(node)
+		next := ziplistNext(node.zl, entry.zi)
+		if next < 0 {
+			node.zl = ziplistPush(node.zl, value, ZIPLIST_TAIL)
+		} else {
+			node.zl = ziplistInsert(node.zl, next, value)
+		}
+		node.count++
+		quicklistNodeUpdateSz(node)
+		quicklistRecompressOnly(ql, node)
+	} else if !full && !after {
+		// 节点没有满，插入到 entry 之前
+		quicklistDecompressNodeForUse(node)
+		node.zl = ziplistInsert(node.zl, entry.zi, value)
+		node.count++
+		quicklistNodeUpdateSz(node)
+		quicklistRecompressOnly(ql, node)
+	} else if full && atTail && node.next != nil && !fullNext && after {
+		// 节点已满，entry 是节点的最后一个元素并且后一个节点没有满，插入到后一个节点的表头
+		newNode := node.next
+		quicklistDecompressNodeForUse(newNode)
+		newNode.zl = ziplistPush(newNode.zl, value, ZIPLIST_HEAD)
+		newNode.count++
+		quicklistNodeUpdateSz(newNode)
+		quicklistRecompressOnly(ql, newNode)
+		// 调用者定位 entry 时临时解压的节点没有被修改，同样需要重新压缩
+		quicklistRecompressOnly(ql, node)
+	} else if full && atHead && node.prev != nil && !fullPrev && !after {
+		// 节点已满，entry 是节点的第一个元素并且前一个节点没有满，插入到前一个节点的表尾
+		newNode := node.prev
+		quicklistDecompressNodeForUse(newNode)
+		newNode.zl = ziplistPush(newNode.zl, value, ZIPLIST_TAIL)
+		newNode.count++
+		quicklistNodeUpdateSz(newNode)
+		quicklistRecompressOnly(ql, newNode)
+		// 调用者定位 entry 时临时解压的节点没有被修改，同样需要重新压缩
+		quicklistRecompressOnly(ql, node)
+	} else if full && ((atTail && node.next != nil && fullNext && after) ||
+		(atHead && node.prev != nil && fullPrev && !after)) {
+		// 节点和相邻的节点都已满，创建新的节点
+		newNode := quicklistCreateNode()
+		newNode.zl = ziplistPush(ziplistNew(), value, ZIPLIST_HEAD)
+		newNode.count++
+		quicklistNodeUpdateSz(newNode)
+		__quicklistInsertNode(ql, node, newNode, after)
+		// 新节点可能位于两端的深度之外
+		quicklistCompress(ql, newNode)
+	} else if full {
+		// 节点已满，分裂节点后插入，再尝试合并附近的节点
+		quicklistDecompressNodeForUse(node)
+		newNode := _quicklistSplitNode(node, offset, after)
+		if after {
+			newNode.zl = ziplistPush(newNode.zl, value, ZIPLIST_HEAD)
+		} else {
+			newNode.zl = ziplistPush(newNode.zl, value, ZIPLIST_TAIL)
+		}
+		newNode.count++
+		quicklistNodeUpdateSz(newNode)
+		__quicklistInsertNode(ql, node, newNode, after)
+		quicklistCompress(ql, newNode)
+		_quicklistMergeNodes(ql, node)
+	}
+
+	ql.count++
+}
+
+// 在 entry 之前插入 value
+func quicklistInsertBefore(ql *quicklist, entry *quicklistEntry, value []byte) {
+	_quicklistInsert(ql, entry, value, false)
+}
+
+// 在 entry 之后插入 value
+func quicklistInsertAfter(ql *quicklist, entry *quicklistEntry, value []byte) {
+	_quicklistInsert(ql, entry, value, true)
+}
+
+// 从索引 start 开始删除 count 个元素，start 可以为负数
+// 删除了元素时返回true
+func quicklistDelRange(ql *quicklist, start int, count int) bool {
+	if count <= 0 {
+		return false
+	}
+
+	extent := count
+	if start >= 0 && extent > ql.count-start {
+		// 删除的数量超出了元素数量，删除到表尾为止
+		extent = ql.count - start
+	} else if start < 0 && extent > -start {
+		// 负数索引时最多删除到表尾
+		extent = -start
+	}
+
+	var entry quicklistEntry
+	if !quicklistIndex(ql, start, &entry) {
+		return false
+	}
+
+	node := entry.node
+	for extent > 0 {
+		next := node.next
+
+		del := 0
+		deleteEntireNode := false
+		if entry.offset == 0 && extent >= node.count {
+			// 删除整个节点
+			deleteEntireNode = true
+			del = node.count
+		} else if entry.offset >= 0 && extent+entry.offset >= node.count {
+			// 删除 offset 之后的所有元素
+			del = node.count - entry.offset
+		} else if entry.offset < 0 {
+			// 负数的 offset 表示删除到节点末尾为止的元素数量
+			del = -entry.offset
+			if del > extent {
+				del = extent
+			}
+		} else {
+			// 删除节点中间的元素
+			del = extent
+		}
+
+		if deleteEntireNode {
+			__quicklistDelNode(ql, node)
+		} else {
+			quicklistDecompressNodeForUse(node)
+			node.zl = ziplistDeleteRange(node.zl, entry.offset, del)
+			quicklistNodeUpdateSz(node)
+			node.count -= del
+			ql.count -= del
+			if node = quicklistDeleteIfEmpty(ql, node); node != nil {
+				quicklistRecompressOnly(ql, node)
+			}
+		}
+
+		extent -= del
+		node = next
+		entry.offset = 0
+	}
+	return true
+}
+
+// 比较压缩列表 zl 中 p 处的元素与 s 是否相等
+func quicklistCompare(zl []byte, p int, s []byte) bool {
+	return ziplistCompare(zl, p, s)
+}
+
+// 返回一个迭代器，direction 与 adlist 相同，为 AL_START_HEAD 或 AL_START_TAIL
+func quicklistGetIterator(ql *quicklist, direction int) *quicklistIter {
+	iter := &quicklistIter{
+		quicklist: ql,
+		direction: direction,
+		zi:        -1,
+	}
+	if direction == AL_START_HEAD {
+		iter.current = ql.head
+		iter.offset = 0
+	} else if direction == AL_START_TAIL {
+		iter.current = ql.tail
+		iter.offset = -1
+	}
+	return iter
+}
+
+// 返回从索引 idx 开始迭代的迭代器，idx 超出范围时返回nil
+func quicklistGetIteratorAtIdx(ql *quicklist, direction int, idx int) *quicklistIter {
+	var entry quicklistEntry
+	if quicklistIndex(ql, idx, &entry) {
+		base := quicklistGetIterator(ql, direction)
+		base.zi = -1
+		base.current = entry.node
+		base.offset = entry.offset
+		return base
+	}
+	return nil
+}
+
+// 释放迭代器，重新压缩迭代器当前的节点
+func quicklistReleaseIterator(iter *quicklistIter) {
+	if iter.current != nil {
+		quicklistCompress(iter.quicklist, iter.current)
+	}
+}
+
+// 将迭代器的下一个元素保存到 entry 中，没有更多元素时返回false
+//
+// 迭代时只能使用 quicklistDelEntry 删除元素，其他修改快速列表的操作会使迭代器失效。
+// 迭代过程中节点会被临时解压，离开节点时重新压缩。
+func quicklistNext(iter *quicklistIter, entry *quicklistEntry) bool {
+	initEntry(entry)
+
+	if iter == nil {
+		return false
+	}
+
+	entry.quicklist = iter.quicklist
+	entry.node = iter.current
+
+	if iter.current == nil {
+		return false
+	}
+
+	if iter.zi < 0 {
+		// 根据 offset 定位
+		quicklistDecompressNodeForUse(iter.current)
+		iter.zi = ziplistIndex(iter.current.zl, iter.offset)
+	} else {
+		// 根据方向移动到前一个或后一个元素
+		if iter.direction == AL_START_HEAD {
+			iter.zi = ziplistNext(iter.current.zl, iter.zi)
+			iter.offset++
+		} else if iter.direction == AL_START_TAIL {
+			iter.zi = ziplistPrev(iter.current.zl, iter.zi)
+			iter.offset--
+		}
+	}
+
+	entry.zi = iter.zi
+	entry.offset = iter.offset
+
+	if iter.zi >= 0 {
+		entry.value, entry.longval, _ = ziplistGet(iter.current.zl, entry.zi)
+		entry.sz = len(entry.value)
+		return true
+	}
+
+	// 当前节点已经没有元素，移动到下一个节点后重新获取
+	quicklistCompress(iter.quicklist, iter.current)
+	if iter.direction == AL_START_HEAD {
+		iter.current = iter.current.next
+		iter.offset = 0
+	} else if iter.direction == AL_START_TAIL {
+		iter.current = iter.current.prev
+		iter.offset = -1
+	}
+	iter.zi = -1
+	return quicklistNext(iter, entry)
+}
+
+// 将索引 idx 处的元素保存到 entry 中，idx 为负数时从表尾开始计算
+// idx 超出范围时返回false
+// 返回的节点已经解压，调用者使用后负责重新压缩或者删除节点
+func quicklistIndex(ql *quicklist, idx int, entry *quicklistEntry) bool {
+	initEntry(entry)
+	entry.quicklist = ql
+
+	forward := idx >= 0
+	var index int
+	var n *quicklistNode
+	if !forward {
+		index = (-idx) - 1
+		n = ql.tail
+	} else {
+		index = idx
+		n = ql.head
+	}
+
+	if index >= ql.count {
+		return false
+	}
+
+	accum := 0
+	for n != nil {
+		if accum+n.count > index {
+			break
+		}
+		accum += n.count
+		if forward {
+			n = n.next
+		} else {
+			n = n.prev
+		}
+	}
+
+	if n == nil {
+		return false
+	}
+
+	entry.node = n
+	if forward {
+		entry.offset = index - accum
+	} else {
+		entry.offset = (-index) - 1 + accum
+	}
+
+	quicklistDecompressNodeForUse(entry.node)
+	entry.zi = ziplistIndex(entry.node.zl, entry.offset)
+	entry.value, entry.longval, _ = ziplistGet(entry.node.zl, entry.zi)
+	entry.sz = len(entry.value)
+	return true
+}
+
+// 复制快速列表
+func quicklistDup(orig *quicklist) *quicklist {
+	cp := quicklistNew(orig.fill, orig.compress)
+
+	for current := orig.head; current != nil; current = current.next {
+		node := quicklistCreateNode()
+
+		if current.encoding == QUICKLIST_NODE_ENCODING_LZF {
+			node.lzf = &quicklistLZF{
+				sz:         current.lzf.sz,
+				compressed: append([]byte(nil), current.lzf.compressed...),
+			}
+		} else if current.encoding == QUICKLIST_NODE_ENCODING_RAW {
+			node.zl = append([]byte(nil), current.zl...)
+		}
+
+		node.count = current.count
+		cp.count += node.count
+		node.sz = current.sz
+		node.encoding = current.encoding
+
+		_quicklistInsertNodeAfter(cp, cp.tail, node)
+	}
+	return cp
+}
+
+// 将表尾元素移动到表头
+func quicklistRotate(ql *quicklist) {
+	if ql.count <= 1 {
+		return
+	}
+
+	// 获取表尾元素，添加到表头后压缩列表可能被修改，所以需要复制
+	p := ziplistIndex(ql.tail.zl, -1)
+	value, longval, _ := ziplistGet(ql.tail.zl, p)
+	if value == nil {
+		s, _ := ll2string(longval)
+		value = []byte(s)
+	} else {
+		value = append([]byte(nil), value...)
+	}
+
+	// 先添加到表头再删除表尾
+	quicklistPushHead(ql, value)
+
+	// 只有一个节点时表头和表尾是同一个压缩列表，添加到表头后需要重新定位
+	if ql.len == 1 {
+		p = ziplistIndex(ql.tail.zl, -1)
+	}
+
+	quicklistDelIndex(ql, ql.tail, p)
+}
+
+// 弹出表头或表尾的元素，saver 用于复制字符串元素
+// 字符串元素返回 saver 的结果，整数元素返回 sval；列表为空时 ok 为false
+func quicklistPopCustom(ql *quicklist, where int, saver func([]byte) interface{}) (data interface{}, sval int64, ok bool) {
+	pos := 0
+	if where != QUICKLIST_HEAD {
+		pos = -1
+	}
+
+	if ql.count == 0 {
+		return nil, 0, false
+	}
+
+	var node *quicklistNode
+	if where == QUICKLIST_HEAD && ql.head != nil {
+		node = ql.head
+	} else if where == QUICKLIST_TAIL && ql.tail != nil {
+		node = ql.tail
+	} else {
+		return nil, 0, false
+	}
+
+	p := ziplistIndex(node.zl, pos)
+	vstr, vlong, found := ziplistGet(node.zl, p)
+	if !found {
+		return nil, 0, false
+	}
+	if vstr != nil {
+		data = saver(vstr)
+	} else {
+		sval = vlong
+	}
+	quicklistDelIndex(ql, node, p)
+	return data, sval, true
+}
+
+// 复制弹出的字符串元素
+func _quicklistSaver(data []byte) interface{} {
+	return append([]byte(nil), data...)
+}
+
+// 弹出表头或表尾的元素
+// 字符串元素保存在 data 中，整数元素 data 为nil，值保存在 sval 中；列表为空时 ok 为false
+func quicklistPop(ql *quicklist, where int) (data []byte, sval int64, ok bool) {
+	vstr, vlong, ok := quicklistPopCustom(ql, where, _quicklistSaver)
+	if vstr != nil {
+		data = vstr.([]byte)
+	}
+	return data, vlong, ok
+}
+
+// 创建或更新名为 name 的书签，书签数量达到上限时返回false
+func quicklistBookmarkCreate(ql *quicklist, name string, node *quicklistNode) bool {
+	if bm := _quicklistBookmarkFindByName(ql, name); bm != nil {
+		bm.node = node
+		return true
+	}
+	if len(ql.bookmarks) >= QL_MAX_BM {
+		return false
+	}
+	ql.bookmarks = append(ql.bookmarks, quicklistBookmark{node: node, name: name})
+	return true
+}
+
+// 返回书签指向的节点，书签不存在时返回nil
+func quicklistBookmarkFind(ql *quicklist, name string) *quicklistNode {
+	if bm := _quicklistBookmarkFindByName(ql, name); bm != nil {
+		return bm.node
+	}
+	return nil
+}
+
+// 删除书签，书签不存在时返回false
+func quicklistBookmarkDelete(ql *quicklist, name string) bool {
+	bm := _quicklistBookmarkFindByName(ql, name)
+	if bm == nil {
+		return false
+	}
+	_quicklistBookmarkDelete(ql, bm)
+	return true
+}
+
+func _quicklistBookmarkFindByName(ql *quicklist, name string) *quicklistBookmark {
+	for i := range ql.bookmarks {
+		if ql.bookmarks[i].name == name {
+			return &ql.bookmarks[i]
+		}
+	}
+	return nil
+}
+
+func _quicklistBookmarkFindByNode(ql *quicklist, node *quicklistNode) *quicklistBookmark {
+	for i := range ql.bookmarks {
+		if ql.bookmarks[i].node == node {
+			return &ql.bookmarks[i]
+		}
+	}
+	return nil
+}
+
+func _quicklistBookmarkDelete(ql *quicklist, bm *quicklistBookmark) {
+	for i := range ql.bookmarks {
+		if &ql.bookmarks[i] == bm {
+			ql.bookmarks = append(ql.bookmarks[:i], ql.bookmarks[i+1:]...)
+			return
+		}
+	}
+}
+
+// 删除所有书签
+func quicklistBookmarksClear(ql *quicklist) {
+	ql.bookmarks = nil
+}
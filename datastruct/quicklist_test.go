@@ -0,0 +1,612 @@
+package datastruct
+
+import (
+	"bytes"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+// 返回节点的压缩列表，节点被压缩时解压一份副本，不改变节点的状态
+func quicklistNodeZiplist(t *testing.T, node *quicklistNode) []byte {
+	t.Helper()
+	if node.encoding == QUICKLIST_NODE_ENCODING_RAW {
+		return node.zl
+	}
+	zl := make([]byte, node.sz)
+	if lzfDecompress(quicklistGetLzf(node), zl) != node.sz {
+		t.Fatalf("decompress node failed")
+	}
+	return zl
+}
+
+// 检查快速列表的结构、压缩状态以及其中的值
+func checkQuicklist(t *testing.T, ql *quicklist, want [][]byte) {
+	t.Helper()
+	if ql.count != len(want) {
+		t.Fatalf("count %d, want %d", ql.count, len(want))
+	}
+
+	var values [][]byte
+	var prev *quicklistNode
+	nodes := 0
+	for node := ql.head; node != nil; node = node.next {
+		if node.prev != prev {
+			t.Fatalf("node %d: bad prev pointer", nodes)
+		}
+		zl := quicklistNodeZiplist(t, node)
+		if node.count == 0 || node.count != ziplistLen(zl) || node.sz != ziplistBlobLen(zl) {
+			t.Fatalf("node %d: count %d sz %d, ziplist len %d bytes %d",
+				nodes, node.count, node.sz, ziplistLen(zl), ziplistBlobLen(zl))
+		}
+		values = append(values, checkZiplist(t, zl)...)
+
+		// 两端深度内的节点不压缩，其他节点被压缩或者尝试过压缩
+		if ql.compress > 0 && ql.len > ql.compress*2 {
+			inDepth := nodes < ql.compress || nodes >= ql.len-ql.compress
+			if inDepth && node.encoding != QUICKLIST_NODE_ENCODING_RAW {
+				t.Fatalf("node %d of %d is compressed within depth %d", nodes, ql.len, ql.compress)
+			}
+			if !inDepth && node.encoding != QUICKLIST_NODE_ENCODING_LZF && !node.attemptedCompress {
+				t.Fatalf("node %d of %d is not compressed beyond depth %d", nodes, ql.len, ql.compress)
+			}
+		}
+		prev = node
+		nodes++
+	}
+	if ql.tail != prev || ql.len != nodes {
+		t.Fatalf("len %d, counted %d nodes", ql.len, nodes)
+	}
+
+	if len(values) != len(want) {
+		t.Fatalf("got %d values, want %d", len(values), len(want))
+	}
+	for i := range want {
+		if !bytes.Equal(values[i], want[i]) {
+			t.Fatalf("value %d = %q, want %q", i, values[i], want[i])
+		}
+	}
+}
+
+// 以字符串形式返回元素的值
+func quicklistEntryValue(entry *quicklistEntry) []byte {
+	if entry.value != nil {
+		return append([]byte(nil), entry.value...)
+	}
+	return []byte(strconv.FormatInt(entry.longval, 10))
+}
+
+// 使用迭代器收集所有值
+func quicklistValues(ql *quicklist, direction int) [][]byte {
+	var values [][]byte
+	var entry quicklistEntry
+	iter := quicklistGetIterator(ql, direction)
+	for quicklistNext(iter, &entry) {
+		values = append(values, quicklistEntryValue(&entry))
+	}
+	quicklistReleaseIterator(iter)
+	return values
+}
+
+func genValues(prefix string, n int) [][]byte {
+	values := make([][]byte, n)
+	for i := range values {
+		values[i] = []byte(prefix + strconv.Itoa(i))
+	}
+	return values
+}
+
+func TestQuicklistPushPop(t *testing.T) {
+	ql := quicklistCreate()
+	var want [][]byte
+	for i := 0; i < 500; i++ {
+		v := []byte(strconv.Itoa(i))
+		if i%2 == 0 {
+			quicklistPushHead(ql, v)
+			want = append([][]byte{v}, want...)
+		} else {
+			quicklistPushTail(ql, v)
+			want = append(want, v)
+		}
+	}
+	checkQuicklist(t, ql, want)
+
+	quicklistPush(ql, []byte("hello"), QUICKLIST_HEAD)
+	data, _, ok := quicklistPop(ql, QUICKLIST_HEAD)
+	if !ok || string(data) != "hello" {
+		t.Fatalf("pop head %q %v", data, ok)
+	}
+	// 整数元素通过 sval 返回
+	data, sval, ok := quicklistPop(ql, QUICKLIST_TAIL)
+	if !ok || data != nil || sval != 499 {
+		t.Fatalf("pop tail %q %d %v", data, sval, ok)
+	}
+	want = want[:len(want)-1]
+	checkQuicklist(t, ql, want)
+
+	for len(want) > 0 {
+		if _, _, ok := quicklistPop(ql, QUICKLIST_HEAD); !ok {
+			t.Fatal("pop failed")
+		}
+		want = want[1:]
+	}
+	checkQuicklist(t, ql, nil)
+	if _, _, ok := quicklistPop(ql, QUICKLIST_TAIL); ok || ql.head != nil || ql.tail != nil {
+		t.Fatal("pop from empty list")
+	}
+}
+
+func TestQuicklistFill(t *testing.T) {
+	// 正数的 fill 限制每个节点的元素数量
+	ql := quicklistNew(4, 0)
+	for _, v := range genValues("v", 10) {
+		quicklistPushTail(ql, v)
+	}
+	if ql.len != 3 || ql.head.count != 4 || ql.head.next.count != 4 || ql.tail.count != 2 {
+		t.Fatalf("len %d", ql.len)
+	}
+
+	// 负数的 fill 限制每个节点的大小
+	for fill := -1; fill >= -5; fill-- {
+		ql := quicklistNew(fill, 0)
+		value := bytes.Repeat([]byte("x"), 100)
+		for i := 0; i < 2000; i++ {
+			quicklistPushTail(ql, value)
+		}
+		limit := optimization_level[-fill-1]
+		for node := ql.head; node != nil; node = node.next {
+			if node.sz > limit {
+				t.Fatalf("fill %d: node size %d exceeds %d", fill, node.sz, limit)
+			}
+		}
+		if ql.len < 2000*100/limit {
+			t.Fatalf("fill %d: too few nodes %d", fill, ql.len)
+		}
+	}
+
+	// 正数的 fill 仍然受 SIZE_SAFETY_LIMIT 限制
+	ql = quicklistNew(FILL_MAX, 0)
+	for i := 0; i < 100; i++ {
+		quicklistPushTail(ql, bytes.Repeat([]byte("y"), 1000))
+	}
+	for node := ql.head; node != nil; node = node.next {
+		if node.sz > SIZE_SAFETY_LIMIT {
+			t.Fatalf("node size %d exceeds safety limit", node.sz)
+		}
+	}
+
+	// 选项超出范围时被修正
+	ql = quicklistNew(-100, -1)
+	if ql.fill != -5 || ql.compress != 0 {
+		t.Fatalf("fill %d compress %d", ql.fill, ql.compress)
+	}
+	quicklistSetOptions(ql, 1<<20, 1<<20)
+	if ql.fill != FILL_MAX || ql.compress != COMPRESS_MAX {
+		t.Fatalf("fill %d compress %d", ql.fill, ql.compress)
+	}
+}
+
+func TestQuicklistIndex(t *testing.T) {
+	ql := quicklistNew(7, 0)
+	want := genValues("i", 100)
+	for _, v := range want {
+		quicklistPushTail(ql, v)
+	}
+
+	var entry quicklistEntry
+	for i := range want {
+		if !quicklistIndex(ql, i, &entry) || !bytes.Equal(entry.value, want[i]) {
+			t.Fatalf("index %d = %q", i, entry.value)
+		}
+		if !quicklistIndex(ql, -i-1, &entry) || !bytes.Equal(entry.value, want[len(want)-i-1]) {
+			t.Fatalf("index %d = %q", -i-1, entry.value)
+		}
+	}
+	if quicklistIndex(ql, 100, &entry) || quicklistIndex(ql, -101, &entry) {
+		t.Fatal("index out of range")
+	}
+	if quicklistIndex(quicklistCreate(), 0, &entry) {
+		t.Fatal("index empty list")
+	}
+}
+
+func TestQuicklistIterator(t *testing.T) {
+	ql := quicklistNew(3, 0)
+	want := genValues("", 20)
+	for _, v := range want {
+		quicklistPushTail(ql, v)
+	}
+
+	got := quicklistValues(ql, AL_START_TAIL)
+	for i := range want {
+		if !bytes.Equal(got[len(got)-i-1], want[i]) {
+			t.Fatalf("backward value %d = %q", i, got[len(got)-i-1])
+		}
+	}
+
+	// 从指定的索引开始迭代
+	var entry quicklistEntry
+	iter := quicklistGetIteratorAtIdx(ql, AL_START_HEAD, 5)
+	for i := 5; i < len(want); i++ {
+		if !quicklistNext(iter, &entry) || !bytes.Equal(quicklistEntryValue(&entry), want[i]) {
+			t.Fatalf("value %d = %q", i, quicklistEntryValue(&entry))
+		}
+	}
+	if quicklistNext(iter, &entry) {
+		t.Fatal("iterator not exhausted")
+	}
+	iter = quicklistGetIteratorAtIdx(ql, AL_START_TAIL, -3)
+	if !quicklistNext(iter, &entry) || !bytes.Equal(quicklistEntryValue(&entry), want[17]) {
+		t.Fatalf("value %q", quicklistEntryValue(&entry))
+	}
+	if quicklistGetIteratorAtIdx(ql, AL_START_HEAD, 20) != nil {
+		t.Fatal("iterator out of range")
+	}
+}
+
+func TestQuicklistDelEntry(t *testing.T) {
+	for _, direction := range []int{AL_START_HEAD, AL_START_TAIL} {
+		for _, fill := range []int{1, 2, 5, -2} {
+			ql := quicklistNew(fill, 0)
+			values := genValues("", 50)
+			for _, v := range values {
+				quicklistPushTail(ql, v)
+			}
+
+			// 迭代时删除所有偶数
+			var entry quicklistEntry
+			iter := quicklistGetIterator(ql, direction)
+			for quicklistNext(iter, &entry) {
+				n, _ := strconv.Atoi(string(quicklistEntryValue(&entry)))
+				if n%2 == 0 {
+					quicklistDelEntry(iter, &entry)
+				}
+			}
+			quicklistReleaseIterator(iter)
+
+			var want [][]byte
+			for i, v := range values {
+				if i%2 == 1 {
+					want = append(want, v)
+				}
+			}
+			checkQuicklist(t, ql, want)
+		}
+	}
+}
+
+func TestQuicklistInsert(t *testing.T) {
+	for _, fill := range []int{1, 2, 3, 4, 32, -1, -2} {
+		for _, after := range []bool{false, true} {
+			ql := quicklistNew(fill, 0)
+			var want [][]byte
+			var entry quicklistEntry
+
+			// 空列表
+			quicklistIndex(ql, 0, &entry)
+			quicklistInsertAfter(ql, &entry, []byte("first"))
+			want = append(want, []byte("first"))
+
+			r := rand.New(rand.NewSource(int64(fill)))
+			for i := 0; i < 300; i++ {
+				idx := r.Intn(len(want))
+				v := []byte("ins" + strconv.Itoa(i))
+				// 交替使用正数和负数索引定位
+				pos := idx
+				if i%2 == 1 {
+					pos = idx - len(want)
+				}
+				if !quicklistIndex(ql, pos, &entry) {
+					t.Fatalf("index %d", pos)
+				}
+				if after {
+					quicklistInsertAfter(ql, &entry, v)
+					idx++
+				} else {
+					quicklistInsertBefore(ql, &entry, v)
+				}
+				want = append(want[:idx], append([][]byte{v}, want[idx:]...)...)
+				checkQuicklist(t, ql, want)
+			}
+		}
+	}
+}
+
+func TestQuicklistReplaceAtIndex(t *testing.T) {
+	ql := quicklistNew(4, 0)
+	want := genValues("", 10)
+	for _, v := range want {
+		quicklistPushTail(ql, v)
+	}
+	if !quicklistReplaceAtIndex(ql, 1, []byte("one")) || !quicklistReplaceAtIndex(ql, -1, []byte("last")) {
+		t.Fatal("replace failed")
+	}
+	if quicklistReplaceAtIndex(ql, 10, []byte("x")) {
+		t.Fatal("replace out of range")
+	}
+	want[1], want[9] = []byte("one"), []byte("last")
+	checkQuicklist(t, ql, want)
+}
+
+func TestQuicklistDelRange(t *testing.T) {
+	for _, fill := range []int{1, 3, 4, -2} {
+		for start := -12; start < 12; start++ {
+			for count := 0; count < 14; count++ {
+				ql := quicklistNew(fill, 0)
+				values := genValues("", 10)
+				for _, v := range values {
+					quicklistPushTail(ql, v)
+				}
+
+				from := start
+				if from < 0 {
+					from += len(values)
+				}
+				deleted := quicklistDelRange(ql, start, count)
+				want := values
+				if from >= 0 && from < len(values) && count > 0 {
+					if !deleted {
+						t.Fatalf("fill %d: del range %d %d failed", fill, start, count)
+					}
+					want = append(append([][]byte{}, values[:from]...), values[min(from+count, len(values)):]...)
+				} else if deleted {
+					t.Fatalf("fill %d: del range %d %d should fail", fill, start, count)
+				}
+				checkQuicklist(t, ql, want)
+			}
+		}
+	}
+}
+
+func TestQuicklistRotate(t *testing.T) {
+	for _, fill := range []int{1, 4, -2} {
+		ql := quicklistNew(fill, 0)
+		want := genValues("r", 10)
+		want = append(want, []byte("12345"))
+		for _, v := range want {
+			quicklistPushTail(ql, v)
+		}
+		for i := 0; i < len(want)*2; i++ {
+			quicklistRotate(ql)
+			want = append([][]byte{want[len(want)-1]}, want[:len(want)-1]...)
+			checkQuicklist(t, ql, want)
+		}
+	}
+
+	// 只有一个节点时添加到表头可能移动表尾元素
+	ql := quicklistCreate()
+	quicklistPushTail(ql, []byte("a"))
+	quicklistPushTail(ql, bytes.Repeat([]byte("b"), 300))
+	quicklistRotate(ql)
+	checkQuicklist(t, ql, [][]byte{bytes.Repeat([]byte("b"), 300), []byte("a")})
+}
+
+func TestQuicklistDup(t *testing.T) {
+	ql := quicklistNew(5, 1)
+	var want [][]byte
+	for i := 0; i < 100; i++ {
+		v := bytes.Repeat([]byte(strconv.Itoa(i%10)), 64)
+		quicklistPushTail(ql, v)
+		want = append(want, v)
+	}
+	cp := quicklistDup(ql)
+	checkQuicklist(t, cp, want)
+
+	// 修改副本不影响原来的快速列表
+	quicklistDelRange(cp, 0, 50)
+	quicklistPushHead(cp, []byte("x"))
+	checkQuicklist(t, ql, want)
+}
+
+func TestQuicklistCompress(t *testing.T) {
+	for depth := 1; depth <= 4; depth++ {
+		ql := quicklistNew(4, depth)
+		var want [][]byte
+		for i := 0; i < 200; i++ {
+			// 可以压缩的值
+			v := bytes.Repeat([]byte{byte('a' + i%26)}, 50+i%30)
+			quicklistPushTail(ql, v)
+			want = append(want, v)
+			checkQuicklist(t, ql, want)
+		}
+
+		compressed := 0
+		for node := ql.head; node != nil; node = node.next {
+			if node.encoding == QUICKLIST_NODE_ENCODING_LZF {
+				compressed++
+			}
+		}
+		if compressed != ql.len-depth*2 {
+			t.Fatalf("depth %d: %d of %d nodes compressed", depth, compressed, ql.len)
+		}
+
+		// 访问压缩的节点后重新压缩
+		var entry quicklistEntry
+		if !quicklistIndex(ql, 100, &entry) || !bytes.Equal(entry.value, want[100]) {
+			t.Fatalf("index 100 = %q", entry.value)
+		}
+		quicklistCompress(ql, entry.node)
+		checkQuicklist(t, ql, want)
+
+		got := quicklistValues(ql, AL_START_HEAD)
+		for i := range want {
+			if !bytes.Equal(got[i], want[i]) {
+				t.Fatalf("value %d = %q", i, got[i])
+			}
+		}
+		checkQuicklist(t, ql, want)
+	}
+
+	// 太小的节点不压缩
+	ql := quicklistNew(1, 1)
+	for i := 0; i < 5; i++ {
+		quicklistPushTail(ql, []byte("small"))
+	}
+	for node := ql.head.next; node != ql.tail; node = node.next {
+		if node.encoding != QUICKLIST_NODE_ENCODING_RAW || !node.attemptedCompress {
+			t.Fatal("small node should not be compressed")
+		}
+	}
+}
+
+func TestQuicklistFromZiplist(t *testing.T) {
+	zl := ziplistNew()
+	want := [][]byte{[]byte("a"), []byte("1"), []byte("-20"), []byte("bcd")}
+	for _, v := range want {
+		zl = ziplistPush(zl, v, ZIPLIST_TAIL)
+	}
+	ql := quicklistCreateFromZiplist(2, 0, zl)
+	checkQuicklist(t, ql, want)
+	if ql.len != 2 {
+		t.Fatalf("len %d", ql.len)
+	}
+
+	quicklistAppendZiplist(ql, zl)
+	checkQuicklist(t, ql, append(append([][]byte{}, want...), want...))
+	if ql.len != 3 || ql.tail.count != 4 {
+		t.Fatalf("len %d", ql.len)
+	}
+}
+
+func TestQuicklistRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	randValue := func() []byte {
+		if r.Intn(3) == 0 {
+			return []byte(strconv.Itoa(r.Intn(1000) - 500))
+		}
+		return bytes.Repeat([]byte{byte('a' + r.Intn(3))}, r.Intn(120)+1)
+	}
+
+	for _, fill := range []int{-5, -2, -1, 1, 2, 8, 64} {
+		for _, depth := range []int{0, 1, 2, 4} {
+			ql := quicklistNew(fill, depth)
+			var want [][]byte
+			var entry quicklistEntry
+			for i := 0; i < 1000; i++ {
+				switch op := r.Intn(10); {
+				case op < 2:
+					v := randValue()
+					quicklistPushHead(ql, v)
+					want = append([][]byte{v}, want...)
+				case op < 4:
+					v := randValue()
+					quicklistPushTail(ql, v)
+					want = append(want, v)
+				case op < 5 && len(want) > 0:
+					v := randValue()
+					idx := r.Intn(len(want))
+					quicklistIndex(ql, idx, &entry)
+					if r.Intn(2) == 0 {
+						quicklistInsertBefore(ql, &entry, v)
+					} else {
+						quicklistInsertAfter(ql, &entry, v)
+						idx++
+					}
+					want = append(want[:idx], append([][]byte{v}, want[idx:]...)...)
+				case op < 6 && len(want) > 0:
+					v := randValue()
+					idx := r.Intn(len(want))
+					quicklistReplaceAtIndex(ql, idx, v)
+					want[idx] = v
+				case op < 7 && len(want) > 0:
+					idx, n := r.Intn(len(want)), r.Intn(10)+1
+					quicklistDelRange(ql, idx, n)
+					want = append(want[:idx], want[min(idx+n, len(want)):]...)
+				case op < 8 && len(want) > 0:
+					where := QUICKLIST_HEAD
+					if r.Intn(2) == 0 {
+						where = QUICKLIST_TAIL
+					}
+					quicklistPop(ql, where)
+					if where == QUICKLIST_HEAD {
+						want = want[1:]
+					} else {
+						want = want[:len(want)-1]
+					}
+				case op < 9:
+					quicklistRotate(ql)
+					if len(want) > 1 {
+						want = append([][]byte{want[len(want)-1]}, want[:len(want)-1]...)
+					}
+				case len(want) > 0:
+					idx := r.Intn(len(want))
+					if !quicklistIndex(ql, idx, &entry) || !bytes.Equal(quicklistEntryValue(&entry), want[idx]) {
+						t.Fatalf("fill %d depth %d: index %d = %q, want %q",
+							fill, depth, idx, quicklistEntryValue(&entry), want[idx])
+					}
+					quicklistRecompressOnly(ql, entry.node)
+				}
+				checkQuicklist(t, ql, want)
+			}
+		}
+	}
+}
+
+func TestQuicklistBookmark(t *testing.T) {
+	ql := quicklistNew(1, 0)
+	for _, v := range genValues("", 5) {
+		quicklistPushTail(ql, v)
+	}
+	if ql.len != 5 {
+		t.Fatalf("len %d", ql.len)
+	}
+	if !quicklistBookmarkCreate(ql, "_dummy", ql.head.next) || !quicklistBookmarkCreate(ql, "_test", ql.tail.prev) {
+		t.Fatal("create bookmark")
+	}
+	if quicklistBookmarkFind(ql, "_test") != ql.tail.prev {
+		t.Fatal("find bookmark")
+	}
+
+	// 删除书签指向的节点后，书签指向下一个节点
+	quicklistDelRange(ql, -2, 1)
+	if quicklistBookmarkFind(ql, "_test") != ql.tail {
+		t.Fatal("bookmark should move to the next node")
+	}
+	// 删除最后一个节点后，书签被删除
+	quicklistDelRange(ql, -1, 1)
+	if quicklistBookmarkFind(ql, "_test") != nil {
+		t.Fatal("bookmark should be deleted")
+	}
+	// 其他书签不受影响
+	if quicklistBookmarkFind(ql, "_dummy") != ql.head.next || quicklistBookmarkFind(ql, "_missing") != nil {
+		t.Fatal("other bookmarks")
+	}
+	if ql.len != 3 {
+		t.Fatalf("len %d", ql.len)
+	}
+	quicklistBookmarksClear(ql)
+	if quicklistBookmarkFind(ql, "_dummy") != nil {
+		t.Fatal("clear bookmarks")
+	}
+}
+
+func TestQuicklistBookmarkLimit(t *testing.T) {
+	ql := quicklistNew(1, 0)
+	quicklistPushHead(ql, []byte("1"))
+	for i := 0; i < QL_MAX_BM; i++ {
+		if !quicklistBookmarkCreate(ql, strconv.Itoa(i), ql.head) {
+			t.Fatalf("create bookmark %d", i)
+		}
+	}
+	// 书签已满时不能再创建，但可以更新已有的书签
+	if quicklistBookmarkCreate(ql, "_test", ql.head) {
+		t.Fatal("create bookmark beyond limit")
+	}
+	if !quicklistBookmarkCreate(ql, "3", ql.head) {
+		t.Fatal("update existing bookmark")
+	}
+	if !quicklistBookmarkDelete(ql, "0") || !quicklistBookmarkCreate(ql, "_test", ql.head) {
+		t.Fatal("create after delete")
+	}
+	if !quicklistBookmarkDelete(ql, "_test") || quicklistBookmarkDelete(ql, "_test") {
+		t.Fatal("delete bookmark")
+	}
+	for i := 1; i < QL_MAX_BM; i++ {
+		if quicklistBookmarkFind(ql, strconv.Itoa(i)) != ql.head {
+			t.Fatalf("bookmark %d", i)
+		}
+	}
+	if quicklistBookmarkFind(ql, "0") != nil || quicklistBookmarkFind(ql, "_test") != nil {
+		t.Fatal("deleted bookmarks")
+	}
+}
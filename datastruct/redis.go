@@ -26,7 +26,8 @@ const (
 	REDIS_ENCODING_ZIPLIST
 	REDIS_ENCODING_INTSET
 	REDIS_ENCODING_SKIPLIST
-	REDIS_ENCODING_EMBSTR // embeded string encoding
+	REDIS_ENCODING_EMBSTR    // embeded string encoding
+	REDIS_ENCODING_QUICKLIST // linked list of ziplists
 )
 
 // static server configuration
@@ -36,14 +37,24 @@ const (
 	REDIS_SHARED_BULKHDR_LEN = 32
 )
 
+// 数据结构编码转换的默认阈值
+const (
+	REDIS_SET_MAX_INTSET_ENTRIES   = 512
+	REDIS_LIST_MAX_ZIPLIST_SIZE    = -2
+	REDIS_LIST_COMPRESS_DEPTH      = 0
+	REDIS_ZSET_MAX_ZIPLIST_ENTRIES = 128
+	REDIS_ZSET_MAX_ZIPLIST_VALUE   = 64
+)
+
 // 表示开闭区间的范围结构
 type zrangespec struct {
 	// 最大值和最小值
 	min, max float64
-	// 表示是否包含最大、最小值  1:包含  0:不包含
+	// 表示是否排除最大、最小值  1:不包含  0:包含
 	minex, maxex int
 }
 
+// 表示字典序范围的结构，shared.minstring 和 shared.maxstring 表示负无穷和正无穷
 type zlexrangespec struct {
 	min, max     *redisObject
 	minex, maxex int
@@ -71,7 +82,7 @@ type redisObject struct {
 
 // 共享结构
 type SharedObjectsStruct struct {
-	crlf, ok, err, emptybulk, czero, cont, cegone, pong, space,
+	crlf, ok, err, emptybulk, czero, cone, cnegone, pong, space,
 	colon, nullbulk, nullmultibulk, queued, emptymultibulk, wrongtypeerr,
 	nokeyerr, syntaxerr, sameobjecterr, outofrangeerr, noscripterr, loadingerr,
 	slowscripterr, bgsaveerr, masterdownerr, roslaveerr, execaborterr,
@@ -85,6 +96,84 @@ type SharedObjectsStruct struct {
 	bulkhdr  [REDIS_SHARED_BULKHDR_LEN]*redisObject
 }
 
+// 全局共享对象，由 createSharedObjects 创建
+// minstring 和 maxstring 是字典序范围中 - 和 + 使用的哨兵对象，只比较指针，不比较内容
+var shared SharedObjectsStruct = createSharedObjects()
+
+// 创建共享对象，包括常用的协议回复、[0, REDIS_SHARED_INTEGERS) 范围内的整数和多条批量回复的头部
+// 所有对象的引用计数都为 OBJ_SHARED_REFCOUNT，decrRefCount 不会释放它们
+func createSharedObjects() SharedObjectsStruct {
+	var s SharedObjectsStruct
+	str := func(value string) *redisObject {
+		return makeObjectShared(createRawStringObject(sdsNew(value)))
+	}
+
+	s.crlf = str("\r\n")
+	s.ok = str("+OK\r\n")
+	s.err = str("-ERR\r\n")
+	s.emptybulk = str("$0\r\n\r\n")
+	s.czero = str(":0\r\n")
+	s.cone = str(":1\r\n")
+	s.cnegone = str(":-1\r\n")
+	s.nullbulk = str("$-1\r\n")
+	s.nullmultibulk = str("*-1\r\n")
+	s.emptymultibulk = str("*0\r\n")
+	s.pong = str("+PONG\r\n")
+	s.queued = str("+QUEUED\r\n")
+	s.emptyscan = str("*2\r\n$1\r\n0\r\n*0\r\n")
+	s.wrongtypeerr = str("-WRONGTYPE Operation against a key holding the wrong kind of value\r\n")
+	s.nokeyerr = str("-ERR no such key\r\n")
+	s.syntaxerr = str("-ERR syntax error\r\n")
+	s.sameobjecterr = str("-ERR source and destination objects are the same\r\n")
+	s.outofrangeerr = str("-ERR index out of range\r\n")
+	s.noscripterr = str("-NOSCRIPT No matching script. Please use EVAL.\r\n")
+	s.loadingerr = str("-LOADING Redis is loading the dataset in memory\r\n")
+	s.slowscripterr = str("-BUSY Redis is busy running a script. You can only call SCRIPT KILL or SHUTDOWN NOSAVE.\r\n")
+	s.masterdownerr = str("-MASTERDOWN Link with MASTER is down and slave-serve-stale-data is set to 'no'.\r\n")
+	s.bgsaveerr = str("-MISCONF Redis is configured to save RDB snapshots, but is currently not able to persist on disk. Commands that may modify the data set are disabled. Please check Redis logs for details about the error.\r\n")
+	s.roslaveerr = str("-READONLY You can't write against a read only slave.\r\n")
+	s.noautherr = str("-NOAUTH Authentication required.\r\n")
+	s.oomerr = str("-OOM command not allowed when used memory > 'maxmemory'.\r\n")
+	s.execaborterr = str("-EXECABORT Transaction discarded because of previous errors.\r\n")
+	s.noreplicaserr = str("-NOREPLICAS Not enough good slaves to write.\r\n")
+	s.busykeyerr = str("-BUSYKEY Target key name already exists.\r\n")
+	s.space = str(" ")
+	s.colon = str(":")
+	s.plus = str("+")
+
+	for j := range s.sel {
+		dictid, dictidLen := ll2string(int64(j))
+		s.sel[j] = makeObjectShared(createRawStringObject(
+			sdsCatPrintf(sdsEmpty(), "*2\r\n$6\r\nSELECT\r\n$%d\r\n%s\r\n", dictidLen, dictid)))
+	}
+
+	s.messagebulk = str("$7\r\nmessage\r\n")
+	s.pmessagebulk = str("$8\r\npmessage\r\n")
+	s.subscribebulk = str("$9\r\nsubscribe\r\n")
+	s.unsubscribebulk = str("$11\r\nunsubscribe\r\n")
+	s.psubscribebulk = str("$10\r\npsubscribe\r\n")
+	s.punsubscribebulk = str("$12\r\npunsubscribe\r\n")
+	s.del = str("DEL")
+	s.rpop = str("RPOP")
+	s.lpop = str("LPOP")
+	s.lpush = str("LPUSH")
+
+	for j := range s.integers {
+		value := int64(j)
+		o := createObject(REDIS_STRING, unsafe.Pointer(&value))
+		o.encoding = REDIS_ENCODING_INT
+		s.integers[j] = makeObjectShared(o)
+	}
+	for j := range s.mbulkhdr {
+		s.mbulkhdr[j] = makeObjectShared(createRawStringObject(sdsCatPrintf(sdsEmpty(), "*%d\r\n", j)))
+		s.bulkhdr[j] = makeObjectShared(createRawStringObject(sdsCatPrintf(sdsEmpty(), "$%d\r\n", j)))
+	}
+
+	s.minstring = str("minstring")
+	s.maxstring = str("maxstring")
+	return s
+}
+
 // 跳跃表节点
 type zskiplistNode struct {
 	// 成员对象-redisObject
@@ -117,6 +206,7 @@ type zskiplist struct {
 
 // zset结构
 type zset struct {
-	dict *dict
+	// 成员到分值的映射
+	dict *Dict[*redisObject, float64]
 	zsl  *zskiplist
 }
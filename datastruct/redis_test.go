@@ -0,0 +1,70 @@
+package datastruct
+
+import "testing"
+
+func TestCreateSharedObjects(t *testing.T) {
+	checkObjectLeaks(t)
+	replies := map[*redisObject]string{
+		shared.crlf:           "\r\n",
+		shared.ok:             "+OK\r\n",
+		shared.czero:          ":0\r\n",
+		shared.cone:           ":1\r\n",
+		shared.cnegone:        ":-1\r\n",
+		shared.nullbulk:       "$-1\r\n",
+		shared.emptymultibulk: "*0\r\n",
+		shared.wrongtypeerr:   "-" + errWrongType.Error() + "\r\n",
+		shared.syntaxerr:      "-" + errSyntax.Error() + "\r\n",
+		shared.sel[3]:         "*2\r\n$6\r\nSELECT\r\n$1\r\n3\r\n",
+		shared.mbulkhdr[5]:    "*5\r\n",
+		shared.bulkhdr[31]:    "$31\r\n",
+		shared.lpush:          "LPUSH",
+	}
+	for o, want := range replies {
+		if got := string(stringObjectBytes(o)); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+
+	for j, o := range shared.integers {
+		if o.encoding != REDIS_ENCODING_INT || *(*int64)(o.ptr) != int64(j) {
+			t.Fatalf("integers[%d]: encoding %d value %d", j, o.encoding, *(*int64)(o.ptr))
+		}
+	}
+
+	if shared.minstring == nil || shared.maxstring == nil || shared.minstring == shared.maxstring {
+		t.Errorf("minstring and maxstring must be distinct objects")
+	}
+}
+
+func TestSharedObjectRefCount(t *testing.T) {
+	checkObjectLeaks(t)
+	o := shared.ok
+	for i := 0; i < 3; i++ {
+		incrRefCount(o)
+		decrRefCount(o)
+		decrRefCount(o)
+	}
+	if o.refcount != OBJ_SHARED_REFCOUNT || string(stringObjectBytes(o)) != "+OK\r\n" {
+		t.Errorf("shared object changed: refcount %d value %q", o.refcount, stringObjectBytes(o))
+	}
+
+	// 共享对象不会被原地修改
+	x := createStringObject([]byte("x"))
+	n, _, err := appendGeneric(shared.integers[7], x)
+	if err != nil || n == shared.integers[7] || *(*int64)(shared.integers[7].ptr) != 7 {
+		t.Errorf("shared integer modified by append")
+	}
+	decrRefCount(n)
+	decrRefCount(x)
+
+	r := createStringObject([]byte("a"))
+	incrRefCount(r)
+	defer func() {
+		if recover() == nil {
+			t.Errorf("makeObjectShared on a referenced object should panic")
+		}
+		decrRefCount(r)
+		decrRefCount(r)
+	}()
+	makeObjectShared(r)
+}
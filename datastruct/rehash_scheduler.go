@@ -0,0 +1,178 @@
+/*
+字典的渐进式 rehash 调度器
+与 Redis serverCron 中的 incrementallyRehash 类似，周期性地在限定的时间内推进各个字典的 rehash
+*/
+package datastruct
+
+import (
+	"sync"
+	"time"
+)
+
+// 可以由调度器推进 rehash 的字典，*Dict 和 *ConcurrentDict 都实现了这个接口
+type DictRehasher interface {
+	// 查看是否正在 rehash
+	IsRehashing() bool
+	// 在给定的微秒内进行 rehash，返回执行的步数
+	RehashMicroseconds(us int64) int
+	// 填充率过低时缩小哈希表，开始了缩小的 rehash 时返回true
+	ResizeIfNeeded() bool
+}
+
+// 调度器一次执行的统计信息
+type DictRehashTickStats struct {
+	// rehash 的总步数
+	Rehashed int
+	// 执行了 rehash 的字典数量
+	Dicts int
+	// 本次执行中完成了 rehash 的字典数量
+	Completed int
+	// 本次执行中开始缩小哈希表的字典数量
+	Resized int
+	// 本次执行耗费的时间
+	Elapsed time.Duration
+	// 通过 dictDisableResize 关闭了 rehash(例如正在生成快照)，本次没有执行
+	Skipped bool
+}
+
+// rehash 调度器
+//
+// 每次执行(Tick)时，先缩小填充率过低的字典(tryResizeHashTables)，
+// 再在 budget 时间内依次对注册的字典进行 rehash，
+// 每次从不同的字典开始，避免排在后面的字典一直得不到处理。
+// 调度器本身是并发安全的，但 *Dict 不是：
+// 注册了 *Dict 时，应当在使用这些字典的协程中调用 Tick，
+// 只有注册的都是 *ConcurrentDict 这类并发安全的字典时，才可以使用 Start 在后台执行。
+type DictRehashScheduler struct {
+	mu sync.Mutex
+	// 注册的字典
+	dicts []DictRehasher
+	// 下次执行时开始处理的字典
+	next int
+	// 每次执行的时间预算
+	budget time.Duration
+
+	// 后台协程的停止信号
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// 创建一个 rehash 调度器，budget 为每次执行最多使用的时间
+func NewDictRehashScheduler(budget time.Duration) *DictRehashScheduler {
+	return &DictRehashScheduler{budget: budget}
+}
+
+// 注册一个需要调度 rehash 的字典
+func (s *DictRehashScheduler) Register(d DictRehasher) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dicts = append(s.dicts, d)
+}
+
+// 取消注册字典，字典未注册时返回false
+func (s *DictRehashScheduler) Unregister(d DictRehasher) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, item := range s.dicts {
+		if item == d {
+			s.dicts = append(s.dicts[:i], s.dicts[i+1:]...)
+			if s.next > i {
+				s.next--
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// 执行一次调度，在时间预算内推进各个字典的 rehash
+func (s *DictRehashScheduler) Tick() DictRehashTickStats {
+	var stats DictRehashTickStats
+	// 关闭 rehash 期间不做任何处理
+	if dict_can_resize.Load() != 1 {
+		stats.Skipped = true
+		return stats
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := len(s.dicts)
+	if n == 0 {
+		return stats
+	}
+	if s.next >= n {
+		s.next = 0
+	}
+
+	start := time.Now()
+	// 缩小填充率过低的字典，缩小同样通过 rehash 完成
+	for _, d := range s.dicts {
+		if d.ResizeIfNeeded() {
+			stats.Resized++
+		}
+	}
+	for i := 0; i < n; i++ {
+		d := s.dicts[(s.next+i)%n]
+		if !d.IsRehashing() {
+			continue
+		}
+		remaining := s.budget - time.Since(start)
+		if remaining <= 0 {
+			break
+		}
+		steps := d.RehashMicroseconds(remaining.Microseconds())
+		// 存在安全迭代器或者正在 Scan 时 rehash 暂停，没有执行任何一步的字典不计入统计
+		if steps == 0 {
+			continue
+		}
+		stats.Rehashed += steps
+		stats.Dicts++
+		if !d.IsRehashing() {
+			stats.Completed++
+		}
+	}
+	s.next = (s.next + 1) % n
+	stats.Elapsed = time.Since(start)
+	return stats
+}
+
+// 启动后台协程，每隔 interval 执行一次 Tick
+// onTick 不为nil时，每次执行后以统计信息调用 onTick，已经启动时不做任何操作
+func (s *DictRehashScheduler) Start(interval time.Duration, onTick func(stats DictRehashTickStats)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stop != nil {
+		return
+	}
+	s.stop = make(chan struct{})
+	s.wg.Add(1)
+	go func(stop chan struct{}) {
+		defer s.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				stats := s.Tick()
+				if onTick != nil {
+					onTick(stats)
+				}
+			}
+		}
+	}(s.stop)
+}
+
+// 停止后台协程，并等待其退出
+func (s *DictRehashScheduler) Stop() {
+	s.mu.Lock()
+	stop := s.stop
+	s.stop = nil
+	s.mu.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	s.wg.Wait()
+}
@@ -0,0 +1,118 @@
+package datastruct
+
+import (
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 创建一个正在 rehash 的字典
+func newTestRehashingDict(n int) *Dict[string, int] {
+	d := newTestStringDict()
+	for i := 0; i < n; i++ {
+		d.Add(strconv.Itoa(i), i)
+	}
+	for d.dictRehash(100) != 0 {
+	}
+	d.dictExpand(d.ht[0].size * 2)
+	return d
+}
+
+func TestDictRehashMilliseconds(t *testing.T) {
+	d := newTestRehashingDict(1 << 18)
+	start := time.Now()
+	rehashes := d.dictRehashMilliseconds(1)
+	elapsed := time.Since(start)
+	if rehashes == 0 || !dictIsRehashing(d) {
+		t.Errorf("rehash error, rehashes %d", rehashes)
+	}
+	// 时间精度为毫秒，不应远远超过给定的时间
+	if elapsed > 50*time.Millisecond {
+		t.Errorf("rehash took too long, %v", elapsed)
+	}
+
+	// 存在安全迭代器时不进行rehash
+	iter := dictGetSafeIterator(d)
+	dictNext(iter)
+	if d.dictRehashMicroseconds(1000) != 0 {
+		t.Error("should not rehash with safe iterator")
+	}
+	dictReleaseIterator(iter)
+}
+
+func TestDictRehashScheduler_Tick(t *testing.T) {
+	s := NewDictRehashScheduler(time.Millisecond)
+	if stats := s.Tick(); stats.Rehashed != 0 || stats.Dicts != 0 {
+		t.Errorf("empty scheduler error, %+v", stats)
+	}
+
+	dicts := []*Dict[string, int]{newTestRehashingDict(1000), newTestRehashingDict(2000), newTestStringDict()}
+	for _, d := range dicts {
+		s.Register(d)
+	}
+
+	dictDisableResize()
+	stats := s.Tick()
+	dictEnableResize()
+	if !stats.Skipped || stats.Rehashed != 0 || !dicts[0].IsRehashing() {
+		t.Errorf("should skip when resize disabled, %+v", stats)
+	}
+
+	completed := 0
+	for i := 0; i < 1000 && (dicts[0].IsRehashing() || dicts[1].IsRehashing()); i++ {
+		stats = s.Tick()
+		if stats.Skipped || stats.Dicts == 0 || stats.Rehashed == 0 {
+			t.Fatalf("tick error, %+v", stats)
+		}
+		completed += stats.Completed
+	}
+	if dicts[0].IsRehashing() || dicts[1].IsRehashing() || completed != 2 {
+		t.Errorf("scheduler did not finish rehash, completed %d", completed)
+	}
+
+	if !s.Unregister(dicts[2]) || s.Unregister(dicts[2]) {
+		t.Error("Unregister error")
+	}
+}
+
+// rehash 暂停的字典不计入统计
+func TestDictRehashScheduler_TickPaused(t *testing.T) {
+	s := NewDictRehashScheduler(time.Millisecond)
+	d := newTestRehashingDict(1000)
+	s.Register(d)
+
+	iter := dictGetSafeIterator(d)
+	dictNext(iter)
+	if stats := s.Tick(); stats.Dicts != 0 || stats.Rehashed != 0 || stats.Completed != 0 {
+		t.Errorf("paused dict counted, %+v", stats)
+	}
+	dictReleaseIterator(iter)
+
+	if stats := s.Tick(); stats.Dicts != 1 || stats.Rehashed == 0 {
+		t.Errorf("tick error after releasing iterator, %+v", stats)
+	}
+}
+
+func TestDictRehashScheduler_Start(t *testing.T) {
+	cd := NewConcurrentDict(StringDictType[int](), 4)
+	for i := 0; i < 10000; i++ {
+		cd.Add(strconv.Itoa(i), i)
+	}
+	s := NewDictRehashScheduler(time.Millisecond)
+	s.Register(cd)
+
+	var ticks atomic.Int32
+	s.Start(time.Millisecond, func(stats DictRehashTickStats) {
+		ticks.Add(1)
+	})
+	deadline := time.Now().Add(time.Second)
+	for (cd.IsRehashing() || ticks.Load() == 0) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	s.Stop()
+	s.Stop()
+	if cd.IsRehashing() || ticks.Load() == 0 {
+		t.Errorf("background rehash error, ticks %d", ticks.Load())
+	}
+}
@@ -1,6 +1,8 @@
 package datastruct
 
 import (
+	"bytes"
+	"fmt"
 	"strconv"
 	"strings"
 )
@@ -27,17 +29,20 @@ func sdsAvail(s sds) int {
 }
 
 // 创建一个新的sds
+// 空间由 zmalloc 分配，容量为 initlen 对应的大小级别，多出的部分作为剩余空间
 func sdsNewLen(init interface{}, initlen int) sds {
-	sds := make([]byte, initlen)
+	s := sds(zcalloc(initlen))
 	if init != nil && initlen > 0 {
-		switch init.(type) {
+		switch v := init.(type) {
 		case string:
-			copy(sds, init.(string))
+			copy(s, v)
 		case []byte:
-			copy(sds, init.([]byte))
+			copy(s, v)
+		case sds:
+			copy(s, v)
 		}
 	}
-	return sds
+	return s
 }
 
 // 创建一个空字符串
@@ -52,27 +57,29 @@ func sdsNew(init string) sds {
 
 // 创建sds副本
 func sdsDup(s sds) sds {
-	return sdsNewLen(string(s), len(s))
+	return sdsNewLen([]byte(s), len(s))
 }
 
-// 释放字符数组占用空间
+// 释放字符数组占用空间，释放后s不能再使用
 func sdsFree(s sds) sds {
-	s = nil
-	return s
+	zfree(s)
+	return nil
 }
 
-// 将字符数组置空
+// 将字符数组置空，保留已分配的空间供之后使用
 func sdsClear(s sds) sds {
-	return make([]byte, 0)
+	return s[:0]
 }
 
 /*
 重新为sds中数组分配长度，增加addlen个长度数组
-如果加上后总长度大于 SDS_MAX_PREALLOC，则新长度为 (oldlen+addlen)*2 ，否则为 (oldlen+addlen)+SDS_MAX_PREALLOC
+剩余空间足够时直接返回s，否则分配新的空间，之后只能使用返回的sds
+原有的空间可能仍然被其它 sds 引用，因此不放入缓冲池复用，只从内存统计中释放，由 GC 回收
+如果加上后总长度小于 SDS_MAX_PREALLOC，则新长度为 (oldlen+addlen)*2 ，否则为 (oldlen+addlen)+SDS_MAX_PREALLOC
 */
 func sdsMakeRoomFor(s sds, addlen int) sds {
 	free := sdsAvail(s)
-	if free > addlen {
+	if free >= addlen {
 		return s
 	}
 	newLen := sdsLen(s) + addlen
@@ -81,15 +88,21 @@ func sdsMakeRoomFor(s sds, addlen int) sds {
 	} else {
 		newLen += SDS_MAX_PREALLOC
 	}
-	newSds := make([]byte, len(s), newLen)
+	newSds := zmalloc(newLen)[:len(s)]
 	copy(newSds, s)
+	zfreeNoReuse(s)
 	return newSds
 }
 
-// 删除字符数组中的多余空间
+// 删除字符数组中的多余空间，原有的空间与 sdsMakeRoomFor 一样不会被复用
+// 容量会取整到大小级别，仍然可能留有少量剩余空间
 func sdsRemoveFreeSpace(s sds) sds {
-	newSds := make([]byte, len(s))
+	if zmallocSize(len(s)) == cap(s) {
+		return s
+	}
+	newSds := sds(zmalloc(len(s)))
 	copy(newSds, s)
+	zfreeNoReuse(s)
 	return newSds
 }
 
@@ -99,55 +112,62 @@ func sdsAllocSize(s sds) int {
 }
 
 // 扩大占用的空间，减少剩余空间（剩余空间足够的情况下）
+// 新增的部分为空闲空间中原有的内容，通常在直接向空闲空间写入数据后调用
 // incr如果为负数则进行右截断
 func sdsIncrLen(s sds, incr int) sds {
-	if incr < 0 {
-		newLen := sdsLen(s) + incr
-		return s[0 : newLen-1]
+	if incr >= 0 && incr > sdsAvail(s) {
+		panic("sdsIncrLen: incr exceeds available space")
 	}
-
-	availNum := sdsAvail(s)
-	if incr < availNum {
-		temp := make([]byte, incr)
-		return append(s, temp...)
+	if incr < 0 && -incr > sdsLen(s) {
+		panic("sdsIncrLen: incr exceeds length")
 	}
-	return s
+	return s[:sdsLen(s)+incr]
 }
 
-// 将sds扩充至指定长度
+// 将sds扩充至指定长度，新增的部分以0填充
 func sdsGrowZero(s sds, len int) sds {
 	curLen := sdsLen(s)
 	if len <= curLen {
 		return s
 	}
 	s = sdsMakeRoomFor(s, len-curLen)
+	s = s[:len]
+	// 空闲空间中可能有旧数据，需要清零
+	clear(s[curLen:])
 	return s
 }
 
-// 将长度为len的字符串t追加到sds字符串末尾
+// 将字符串t的前len个字节追加到sds字符串末尾
 func sdsCatLen(s sds, t string, len int) sds {
 	s = sdsMakeRoomFor(s, len)
-	s = append(s, []byte(t)...)
+	s = append(s, t[:len]...)
 	return s
 }
 
+// 将一个字节追加到sds字符串末尾
+func sdsCatByte(s sds, c byte) sds {
+	s = sdsMakeRoomFor(s, 1)
+	return append(s, c)
+}
+
 // 将指定字符串添加到sds末尾
 func sdsCat(s sds, t string) sds {
-	return sdsCatLen(s, t, len(s))
+	return sdsCatLen(s, t, len(t))
 }
 
 // 将t添加到sds末尾
-func sdsCatSds(s sds, t sds) {
-	sdsCatLen(s, string(t), sdsLen(t))
+func sdsCatSds(s sds, t sds) sds {
+	s = sdsMakeRoomFor(s, sdsLen(t))
+	return append(s, t...)
 }
 
 // 将字符串t的前length个字符复制到sds s中,覆盖原有字符串
 func sdsCpyLen(s sds, t string, length int) sds {
-	totlen := cap(s)
-	if totlen < length {
-		s = sdsMakeRoomFor(s, length-len(s))
+	if cap(s) < length {
+		s = sdsMakeRoomFor(s[:0], length)
 	}
-	copy(s, s[0:length])
+	s = s[:length]
+	copy(s, t[:length])
 	return s
 }
 
@@ -160,80 +180,131 @@ const SDS_LLSTR_SIZE = 21
 
 // 原 sdsull2str(char *s, u long long v)
 func sdsInt2Str(v uint) (string, int) {
-	str := strconv.Itoa(int(v))
+	str := strconv.FormatUint(uint64(v), 10)
+	return str, len(str)
+}
+
+// 原 sdsll2str(char *s, long long v)
+func sdsLl2Str(v int) (string, int) {
+	str := strconv.FormatInt(int64(v), 10)
 	return str, len(str)
 }
 
 // 根据输入的数字创建一个SDS, 原 sdsfromlonglong(long long value)
 func sdsFromInt(value int) sds {
-	str, length := sdsInt2Str(uint(value))
-	buf := make([]byte, SDS_LLSTR_SIZE)
-	copy(buf, str)
-	return sdsNewLen(buf, length)
+	str, length := sdsLl2Str(value)
+	return sdsNewLen(str, length)
 }
 
-// 打印函数
-func sdsCatVPrinf(s sds, fmt string) {
-	//todo
+// 打印函数，将按格式 format 格式化 args 的结果追加到 s 末尾
+// 格式使用 Go 的 fmt 格式
+func sdsCatVPrinf(s sds, format string, args []interface{}) sds {
+	str := fmt.Sprintf(format, args...)
+	return sdsCatLen(s, str, len(str))
 }
 
-// 打印函数
-func sdsCatPrintf(s sds, fmt string, s1 ...interface{}) {
-	//todo
+// 打印函数，将按格式 format 格式化 args 的结果追加到 s 末尾
+// s = sdsCatPrintf(sdsEmpty(), "%d+%d = %d", 1, 2, 3)
+func sdsCatPrintf(s sds, format string, args ...interface{}) sds {
+	return sdsCatVPrinf(s, format, args)
 }
 
 // 对sds左右两端进行裁剪，清楚两端的所有cset中出现的字符
+// 按字节进行比较，cset 中的每个字节都是一个要清除的字符
 // s = sdsnew("AA...AA.a.aa.aHelloWorld     :::");
 // s = sdstrim(s,"Aa. :");
 // printf("%s\n", s); = HelloWorld
+// 与 C 中一样直接在 s 原有的空间中修改，不分配新的空间
 func sdsTrim(s sds, cset string) sds {
-	newStr := strings.Trim(string(s), cset)
-	return sdsNew(newStr)
+	start, end := 0, len(s)
+	for start < end && strings.IndexByte(cset, s[start]) >= 0 {
+		start++
+	}
+	for end > start && strings.IndexByte(cset, s[end-1]) >= 0 {
+		end--
+	}
+	n := copy(s, s[start:end])
+	return s[:n]
 }
 
-// 裁剪sds, 索引可以为负数
+// 裁剪sds, 保留 [start, end] 之间的字符，两端都包含在内
+// 索引可以为负数，-1 表示最后一个字符，超出范围的索引会被修正
+// s = sdsnew("Hello World"); sdsrange(s,1,-1); => "ello World"
+// 直接在 s 原有的空间中修改，不分配新的空间
 func sdsRange(s sds, start int, end int) sds {
-	str := string(s)
+	length := len(s)
+	if length == 0 {
+		return s
+	}
 	if start < 0 {
-		start = len(str) + start
+		start = length + start
 		if start < 0 {
 			start = 0
 		}
 	}
 	if end < 0 {
-		end = len(str) + end
+		end = length + end
 		if end < 0 {
 			end = 0
 		}
 	}
-	newStr := str[start:end]
-	len := end - start + 1
-	newSds := make([]byte, len)
-	copy(newSds, newStr)
-	return newSds
+	newLen := 0
+	if start <= end {
+		newLen = end - start + 1
+	}
+	if newLen != 0 {
+		if start >= length {
+			newLen = 0
+		} else if end >= length {
+			end = length - 1
+			newLen = 0
+			if start <= end {
+				newLen = end - start + 1
+			}
+		}
+	}
+	if newLen == 0 {
+		return s[:0]
+	}
+	copy(s, s[start:start+newLen])
+	return s[:newLen]
 }
 
-// 将sds字符串中的所有字符转小写
+// 将sds字符串中的所有字符转小写，只转换 ASCII 字符，直接修改 s
 func sdsToLower(s sds) sds {
-	str := string(s)
-	newStr := strings.ToLower(str)
-	return sdsNew(newStr)
+	for i, c := range s {
+		if c >= 'A' && c <= 'Z' {
+			s[i] = c + ('a' - 'A')
+		}
+	}
+	return s
 }
 
-// 转大写
+// 转大写，只转换 ASCII 字符，直接修改 s
 func sdsToUpper(s sds) sds {
-	str := string(s)
-	newStr := strings.ToUpper(str)
-	return sdsNew(newStr)
+	for i, c := range s {
+		if c >= 'a' && c <= 'z' {
+			s[i] = c - ('a' - 'A')
+		}
+	}
+	return s
 }
 
-// 比较s1与s2
+// 按字节比较s1与s2
+// s1 > s2 返回正数，s1 == s2 返回0，s1 < s2 返回负数
 func sdsCmp(s1 sds, s2 sds) int {
-	return strings.Compare(string(s1), string(s2))
+	return bytes.Compare(s1, s2)
 }
 
 // 使用sep对s进行分割
+// s 为空时返回0个元素，sep 为空时返回 nil
 func sdsSplitLen(s string, sep string) ([]sds, int) {
+	if len(sep) == 0 {
+		return nil, 0
+	}
+	if len(s) == 0 {
+		return make([]sds, 0), 0
+	}
 	split := strings.Split(s, sep)
 	num := len(split)
 	sdss := make([]sds, 0)
@@ -243,8 +314,11 @@ func sdsSplitLen(s string, sep string) ([]sds, int) {
 	return sdss, num
 }
 
-// 释放count个sds
+// 释放前count个sds，返回剩余的sds
 func sdsFreeSplitRes(tokens []sds, count int) []sds {
+	for i := 0; i < count && i < len(tokens); i++ {
+		sdsFree(tokens[i])
+	}
 	if count > len(tokens) {
 		return make([]sds, 0)
 	}
@@ -255,9 +329,44 @@ func sdsFreeSplitRes(tokens []sds, count int) []sds {
 	return res
 }
 
-// todo
-func sdsCatRepr(s sds, p string) {
+// 将p转换为带引号的字符串，并追加到s末尾
+// 不可打印的字符会被转义为 "\n\r\a...." 或者 "\x<hex-number>" 的形式
+func sdsCatRepr(s sds, p string) sds {
+	s = sdsCatByte(s, '"')
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		switch c {
+		case '\\', '"':
+			s = sdsCatPrintf(s, "\\%c", c)
+		case '\n':
+			s = sdsCatLen(s, "\\n", 2)
+		case '\r':
+			s = sdsCatLen(s, "\\r", 2)
+		case '\t':
+			s = sdsCatLen(s, "\\t", 2)
+		case '\a':
+			s = sdsCatLen(s, "\\a", 2)
+		case '\b':
+			s = sdsCatLen(s, "\\b", 2)
+		default:
+			if isPrint(c) {
+				s = sdsCatByte(s, c)
+			} else {
+				s = sdsCatPrintf(s, "\\x%02x", c)
+			}
+		}
+	}
+	return sdsCatByte(s, '"')
+}
+
+// 是否是可打印的 ASCII 字符
+func isPrint(c byte) bool {
+	return c >= 0x20 && c <= 0x7e
+}
 
+// 是否是空白字符
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\v' || c == '\f' || c == '\r'
 }
 
 // 是否是16进制符号中的一个
@@ -274,19 +383,137 @@ func hexDigitToInt(c byte) int {
 	if c >= 'a' && c <= 'f' {
 		return int(c) - 97 + 10
 	}
+	if c >= 'A' && c <= 'F' {
+		return int(c) - 65 + 10
+	}
 	return 0
 }
 
-// todo
-func sdsSplitArgs(line string, argc int) {
+// 将一行文本按 redis-cli 的规则分割为参数
+//
+// 参数之间以空白分隔，参数可以使用引号：
+// 双引号中可以使用 \n \r \t \b \a 以及 \xHH 形式的转义，
+// 单引号中只能使用 \' 转义单引号。
+// 引号结束后必须是空白或者行尾，例如 "foo"bar 是不合法的。
+//
+// 成功时返回参数及其数量，输入为空时返回0个参数；
+// 引号不匹配或者格式错误时返回 nil, 0
+func sdsSplitArgs(line string) ([]sds, int) {
+	// 与 sds 的其它函数一样是二进制安全的，'\0' 是普通字符，只以 line 的长度判断行尾
+	n := len(line)
+	p := 0
+	vector := make([]sds, 0)
+	// 格式错误时释放已经分配的参数
+	fail := func(current sds) ([]sds, int) {
+		sdsFree(current)
+		for _, arg := range vector {
+			sdsFree(arg)
+		}
+		return nil, 0
+	}
+	for {
+		// 跳过空白
+		for p < n && isSpace(line[p]) {
+			p++
+		}
+		if p >= n {
+			return vector, len(vector)
+		}
 
+		// 读取一个参数
+		// inq: 在双引号中  insq: 在单引号中
+		inq, insq, done := false, false, false
+		current := sdsEmpty()
+		for !done {
+			if inq {
+				if p >= n {
+					// 引号没有结束
+					return fail(current)
+				}
+				c := line[p]
+				if c == '\\' && p+3 < n && line[p+1] == 'x' && isHexDigit(line[p+2]) && isHexDigit(line[p+3]) {
+					b := byte(hexDigitToInt(line[p+2])*16 + hexDigitToInt(line[p+3]))
+					current = sdsCatByte(current, b)
+					p += 3
+				} else if c == '\\' && p+1 < n {
+					p++
+					switch line[p] {
+					case 'n':
+						c = '\n'
+					case 'r':
+						c = '\r'
+					case 't':
+						c = '\t'
+					case 'b':
+						c = '\b'
+					case 'a':
+						c = '\a'
+					default:
+						c = line[p]
+					}
+					current = sdsCatByte(current, c)
+				} else if c == '"' {
+					// 结束的引号后面必须是空白或者行尾
+					if p+1 < n && !isSpace(line[p+1]) {
+						return fail(current)
+					}
+					done = true
+				} else {
+					current = sdsCatByte(current, c)
+				}
+			} else if insq {
+				if p >= n {
+					// 引号没有结束
+					return fail(current)
+				}
+				c := line[p]
+				if c == '\\' && p+1 < n && line[p+1] == '\'' {
+					p++
+					current = sdsCatByte(current, '\'')
+				} else if c == '\'' {
+					// 结束的引号后面必须是空白或者行尾
+					if p+1 < n && !isSpace(line[p+1]) {
+						return fail(current)
+					}
+					done = true
+				} else {
+					current = sdsCatByte(current, c)
+				}
+			} else if p >= n {
+				done = true
+			} else {
+				switch c := line[p]; c {
+				case ' ', '\n', '\r', '\t':
+					done = true
+				case '"':
+					inq = true
+				case '\'':
+					insq = true
+				default:
+					current = sdsCatByte(current, c)
+				}
+			}
+			if p < n {
+				p++
+			}
+		}
+		vector = append(vector, current)
+	}
 }
 
-// 将sds中 from中的字符串替换为to字符串
+// 将s中出现在from中的字符替换为to中相同位置的字符，类似 tr 命令
+// 例如 sdsMapChars(s, "ho", "01") 将 "hello" 转换为 "0ell1"，直接修改 s
 func sdsMapChars(s sds, from string, to string) sds {
-	str := string(s)
-	replaceRes := strings.Replace(str, from, to, -1)
-	return sdsNew(replaceRes)
+	setlen := len(from)
+	if len(to) < setlen {
+		setlen = len(to)
+	}
+	for j, c := range s {
+		if i := strings.IndexByte(from[:setlen], c); i >= 0 {
+			s[j] = to[i]
+		}
+	}
+	return s
 }
 
 // join
@@ -1,12 +1,14 @@
 package datastruct
 
 import (
+	"math"
 	"testing"
 )
 
 func TestSdsNew(t *testing.T) {
 	ori := sdsNew("abcdef")
-	if len(ori) != 6 || cap(ori) != 6 {
+	// 容量取整到大小级别
+	if len(ori) != 6 || cap(ori) != zmallocSize(6) {
 		t.Errorf("error, len %d, cap %d", len(ori), cap(ori))
 	}
 }
@@ -14,7 +16,7 @@ func TestSdsNew(t *testing.T) {
 func TestSdsMakeRoomFor(t *testing.T) {
 	ori := sdsNew("abcdefg")
 	newSds := sdsMakeRoomFor(ori, 10)
-	newLen := (len(ori) + 10) * 2
+	newLen := zmallocSize((len(ori) + 10) * 2)
 	if len(newSds) != 7 || cap(newSds) != newLen {
 		t.Errorf("error, len %d ,cap %d", len(newSds), cap(newSds))
 	}
@@ -29,4 +31,252 @@ func TestHexDigitToInt(t *testing.T) {
 	if toInt != 11 {
 		t.Error("err != 11")
 	}
+	if i := hexDigitToInt('F'); i != 15 {
+		t.Errorf("error, F = %d", i)
+	}
+}
+
+func TestSdsCat(t *testing.T) {
+	s := sdsNew("foo")
+	s = sdsCat(s, "bar")
+	s = sdsCatLen(s, "bazqux", 3)
+	s = sdsCatSds(s, sdsNew("\x00end"))
+	if string(s) != "foobarbaz\x00end" {
+		t.Errorf("error, got %q", s)
+	}
+}
+
+func TestSdsCpy(t *testing.T) {
+	s := sdsNew("a")
+	s = sdsCpy(s, "xyzxxxxxxxxxxyyyyyyyyyykkkkkkkkkk")
+	if string(s) != "xyzxxxxxxxxxxyyyyyyyyyykkkkkkkkkk" {
+		t.Errorf("error, got %q", s)
+	}
+	s = sdsCpy(s, "a")
+	if string(s) != "a" {
+		t.Errorf("error, got %q", s)
+	}
+}
+
+func TestSdsCatPrintf(t *testing.T) {
+	s := sdsCatPrintf(sdsEmpty(), "%d", 123)
+	if string(s) != "123" {
+		t.Errorf("error, got %q", s)
+	}
+	s = sdsCatPrintf(sdsNew("--"), "Hello %s World %d", "Hi!", 1)
+	if string(s) != "--Hello Hi! World 1" {
+		t.Errorf("error, got %q", s)
+	}
+}
+
+func TestSdsTrim(t *testing.T) {
+	tests := []struct {
+		s, cset, want string
+	}{
+		{"xxciaoyyy", "xy", "ciao"},
+		{"AA...AA.a.aa.aHelloWorld     :::", "Aa. :", "HelloWorld"},
+		{"xxxx", "x", ""},
+		{"\xffa\xff", "\xff", "a"},
+	}
+	for _, tt := range tests {
+		if got := sdsTrim(sdsNew(tt.s), tt.cset); string(got) != tt.want {
+			t.Errorf("sdsTrim(%q, %q) = %q, want %q", tt.s, tt.cset, got, tt.want)
+		}
+	}
+}
+
+func TestSdsRange(t *testing.T) {
+	tests := []struct {
+		start, end int
+		want       string
+	}{
+		{1, 1, "i"},
+		{1, -1, "iao"},
+		{-2, -1, "ao"},
+		{2, 1, ""},
+		{1, 100, "iao"},
+		{100, 100, ""},
+		{-100, 1, "ci"},
+	}
+	for _, tt := range tests {
+		if got := sdsRange(sdsNew("ciao"), tt.start, tt.end); string(got) != tt.want {
+			t.Errorf("sdsRange(ciao, %d, %d) = %q, want %q", tt.start, tt.end, got, tt.want)
+		}
+	}
+}
+
+func TestSdsCmp(t *testing.T) {
+	tests := []struct {
+		s1, s2 string
+		sign   int
+	}{
+		{"foo", "foa", 1},
+		{"bar", "bar", 0},
+		{"aar", "bar", -1},
+		{"bar", "barx", -1},
+		{"\xff", "a", 1},
+	}
+	for _, tt := range tests {
+		got := sdsCmp(sdsNew(tt.s1), sdsNew(tt.s2))
+		if (got > 0) != (tt.sign > 0) || (got < 0) != (tt.sign < 0) {
+			t.Errorf("sdsCmp(%q, %q) = %d", tt.s1, tt.s2, got)
+		}
+	}
+}
+
+func TestSdsCase(t *testing.T) {
+	if s := sdsToLower(sdsNew("HeLLo\xc4")); string(s) != "hello\xc4" {
+		t.Errorf("error, got %q", s)
+	}
+	if s := sdsToUpper(sdsNew("HeLLo\xe4")); string(s) != "HELLO\xe4" {
+		t.Errorf("error, got %q", s)
+	}
+}
+
+// 裁剪、截取和大小写转换直接修改原有的空间，不会泄漏内存
+func TestSdsInPlaceUsedMemory(t *testing.T) {
+	before := zmallocUsedMemory()
+	s := sdsNew("  Hello World, THIS is sds  ")
+	allocated := zmallocUsedMemory()
+	base := &s[0]
+
+	s = sdsTrim(s, " ")
+	s = sdsRange(s, 6, -2)
+	s = sdsToLower(s)
+	s = sdsToUpper(s)
+	s = sdsMapChars(s, "S", "5")
+	if string(s) != "WORLD, THI5 I5 5D" {
+		t.Errorf("error, got %q", s)
+	}
+	if &s[0] != base || zmallocUsedMemory() != allocated {
+		t.Errorf("error, used %d, want %d", zmallocUsedMemory()-before, allocated-before)
+	}
+	s = sdsRange(s, 100, 200)
+	if len(s) != 0 || zmallocUsedMemory() != allocated {
+		t.Errorf("error, empty range got %q", s)
+	}
+	sdsFree(s)
+	if got := zmallocUsedMemory() - before; got != 0 {
+		t.Errorf("error, used %d after sdsFree", got)
+	}
+}
+
+func TestSdsMapChars(t *testing.T) {
+	if s := sdsMapChars(sdsNew("hello"), "ho", "01"); string(s) != "0ell1" {
+		t.Errorf("error, got %q", s)
+	}
+}
+
+func TestSdsSplitLen(t *testing.T) {
+	res, count := sdsSplitLen("foo_-_bar", "_-_")
+	if count != 2 || string(res[0]) != "foo" || string(res[1]) != "bar" {
+		t.Errorf("error, got %q", res)
+	}
+	if _, count := sdsSplitLen("", "_"); count != 0 {
+		t.Errorf("error, empty string count %d", count)
+	}
+	if res, count := sdsSplitLen("foo", ""); res != nil || count != 0 {
+		t.Errorf("error, empty sep got %q", res)
+	}
+}
+
+func TestSdsIncrLen(t *testing.T) {
+	s := sdsMakeRoomFor(sdsNew("abc"), 10)
+	copy(s[len(s):cap(s)], "def")
+	s = sdsIncrLen(s, 3)
+	if string(s) != "abcdef" {
+		t.Errorf("error, got %q", s)
+	}
+	s = sdsIncrLen(s, -2)
+	if string(s) != "abcd" {
+		t.Errorf("error, got %q", s)
+	}
+}
+
+func TestSdsGrowZero(t *testing.T) {
+	s := sdsMakeRoomFor(sdsNew("ab"), 10)
+	copy(s[len(s):cap(s)], "junk")
+	s = sdsGrowZero(s, 5)
+	if string(s) != "ab\x00\x00\x00" {
+		t.Errorf("error, got %q", s)
+	}
+}
+
+func TestSdsCatRepr(t *testing.T) {
+	tests := []struct {
+		p, want string
+	}{
+		{"\a\n\x00foo\r", `"\a\n\x00foo\r"`},
+		{`say "hi" \ bye`, `"say \"hi\" \\ bye"`},
+		{"\t\b\xff", `"\t\b\xff"`},
+		{"", `""`},
+	}
+	for _, tt := range tests {
+		if got := sdsCatRepr(sdsEmpty(), tt.p); string(got) != tt.want {
+			t.Errorf("sdsCatRepr(%q) = %s, want %s", tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestSdsSplitArgs(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{`set "foo bar" 'baz'`, []string{"set", "foo bar", "baz"}},
+		{"  a  b\tc\n", []string{"a", "b", "c"}},
+		{`"\x41\x4a\x4B" "\xZZ"`, []string{"AJK", "xZZ"}},
+		{`"a\nb\r\t\b\a\"\\"`, []string{"a\nb\r\t\b\a\"\\"}},
+		{`'it\'s' 'a\nb'`, []string{"it's", `a\nb`}},
+		{`"" ''`, []string{"", ""}},
+		{"", []string{}},
+		{"   ", []string{}},
+		{`"unterminated`, nil},
+		{`'unterminated`, nil},
+		{`"foo"bar`, nil},
+		{`'foo'bar`, nil},
+		// '\0' 是普通字符，不表示行尾
+		{"set a\x00b c", []string{"set", "a\x00b", "c"}},
+		{"\x00 \"x\x00y\" 'z\x00'", []string{"\x00", "x\x00y", "z\x00"}},
+		{"\"a\x00", nil},
+	}
+	for _, tt := range tests {
+		got, argc := sdsSplitArgs(tt.line)
+		if tt.want == nil {
+			if got != nil || argc != 0 {
+				t.Errorf("sdsSplitArgs(%q) = %q, want error", tt.line, got)
+			}
+			continue
+		}
+		if got == nil || argc != len(tt.want) || len(got) != argc {
+			t.Errorf("sdsSplitArgs(%q) = %q (%d), want %q", tt.line, got, argc, tt.want)
+			continue
+		}
+		for i := range got {
+			if string(got[i]) != tt.want[i] {
+				t.Errorf("sdsSplitArgs(%q)[%d] = %q, want %q", tt.line, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
+
+func TestSdsFromInt(t *testing.T) {
+	tests := []struct {
+		v    int
+		want string
+	}{
+		{0, "0"},
+		{123, "123"},
+		{-123, "-123"},
+		{math.MinInt64, "-9223372036854775808"},
+		{math.MaxInt64, "9223372036854775807"},
+	}
+	for _, tt := range tests {
+		if got := sdsFromInt(tt.v); string(got) != tt.want {
+			t.Errorf("sdsFromInt(%d) = %q, want %q", tt.v, got, tt.want)
+		}
+	}
+	if str, _ := sdsInt2Str(math.MaxUint64); str != "18446744073709551615" {
+		t.Errorf("sdsInt2Str(MaxUint64) = %q", str)
+	}
 }
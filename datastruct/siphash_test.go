@@ -0,0 +1,73 @@
+package datastruct
+
+import (
+	"testing"
+)
+
+func testSipHashKey() [16]byte {
+	var k [16]byte
+	for i := range k {
+		k[i] = byte(i)
+	}
+	return k
+}
+
+// SipHash-2-4 论文中的测试向量，密钥为 00 01 02 ... 0f
+func TestSiphashRounds(t *testing.T) {
+	k := testSipHashKey()
+	if h := siphashRounds(nil, &k, 2, 4, false); h != 0x726fdb47dd0e0e31 {
+		t.Errorf("empty input error, %x", h)
+	}
+	in := make([]byte, 15)
+	for i := range in {
+		in[i] = byte(i)
+	}
+	if h := siphashRounds(in, &k, 2, 4, false); h != 0xa129ca6149be45e5 {
+		t.Errorf("15 bytes input error, %x", h)
+	}
+}
+
+// 字典使用的 SipHash-1-2，期望值由 Redis 的 siphash.c 计算得到，密钥为 00 01 02 ... 0f
+func TestSiphash12(t *testing.T) {
+	k := testSipHashKey()
+	in := make([]byte, 15)
+	for i := range in {
+		in[i] = byte(i)
+	}
+	if h := siphash(in, &k); h != 0xec8f61bc1c8966a6 {
+		t.Errorf("15 bytes input error, %x", h)
+	}
+
+	tests := []struct {
+		in           string
+		hash, nocase uint64
+	}{
+		{"", 0xcea28b51565c12e2, 0xcea28b51565c12e2},
+		{"a", 0x3e0a5fabc9a8b128, 0x3e0a5fabc9a8b128},
+		{"hello", 0xf5496b7e483cca31, 0xf5496b7e483cca31},
+		{"abcdefgh", 0xe9ab83e99527623c, 0xe9ab83e99527623c},
+		{"Hello World", 0xc3a1f541ad0d87e9, 0xb91b8e97a1658e27},
+		{"HELLO world, 123456789", 0xf844d2369c76f2c9, 0x2fa151af89dd507b},
+	}
+	for _, tt := range tests {
+		if h := siphash([]byte(tt.in), &k); h != tt.hash {
+			t.Errorf("siphash(%q) = %x, want %x", tt.in, h, tt.hash)
+		}
+		if h := siphashNocase([]byte(tt.in), &k); h != tt.nocase {
+			t.Errorf("siphashNocase(%q) = %x, want %x", tt.in, h, tt.nocase)
+		}
+	}
+}
+
+func TestSiphashNocase(t *testing.T) {
+	k := testSipHashKey()
+	for _, s := range []string{"", "a", "Hello", "HELLO world, 123456789"} {
+		lower := siphash([]byte(sdsToLower(sdsNew(s))), &k)
+		if h := siphashNocase([]byte(s), &k); h != lower {
+			t.Errorf("siphashNocase(%q) %x != %x", s, h, lower)
+		}
+	}
+	if siphash([]byte("Hello"), &k) == siphash([]byte("hello"), &k) {
+		t.Error("siphash should be case sensitive")
+	}
+}
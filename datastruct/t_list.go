@@ -0,0 +1,74 @@
+/*
+列表对象，与 Redis 的 t_list.c 对应
+
+列表对象使用快速列表编码(REDIS_ENCODING_QUICKLIST)，
+节点大小和压缩深度由 list_max_ziplist_size 和 list_compress_depth 决定。
+*/
+package datastruct
+
+import "errors"
+
+// 列表的表头和表尾
+const (
+	LIST_HEAD = 0
+	LIST_TAIL = 1
+)
+
+// 快速列表每个节点的大小限制，对应配置项 list-max-ziplist-size
+var list_max_ziplist_size = REDIS_LIST_MAX_ZIPLIST_SIZE
+
+// 快速列表两端不压缩的节点数量，对应配置项 list-compress-depth
+var list_compress_depth = REDIS_LIST_COMPRESS_DEPTH
+
+// 返回快速列表编码的列表对象中的快速列表
+func listTypeQuicklist(subject *redisObject) *quicklist {
+	return (*quicklist)(subject.ptr)
+}
+
+// 使用当前的配置创建一个空的列表对象
+func listTypeCreate() *redisObject {
+	o := createQuicklistObject()
+	quicklistSetOptions(listTypeQuicklist(o), list_max_ziplist_size, list_compress_depth)
+	return o
+}
+
+// 将 value 添加到列表的表头或表尾，where 为 LIST_HEAD 或 LIST_TAIL
+func listTypePush(subject *redisObject, value sds, where int) {
+	if subject.encoding != REDIS_ENCODING_QUICKLIST {
+		panic(errors.New("Unknown list encoding"))
+	}
+	pos := QUICKLIST_TAIL
+	if where == LIST_HEAD {
+		pos = QUICKLIST_HEAD
+	}
+	quicklistPush(listTypeQuicklist(subject), []byte(value), pos)
+}
+
+// 弹出列表表头或表尾的元素，列表为空时返回nil
+func listTypePop(subject *redisObject, where int) sds {
+	if subject.encoding != REDIS_ENCODING_QUICKLIST {
+		panic(errors.New("Unknown list encoding"))
+	}
+	pos := QUICKLIST_TAIL
+	if where == LIST_HEAD {
+		pos = QUICKLIST_HEAD
+	}
+	vstr, vlong, ok := quicklistPopCustom(listTypeQuicklist(subject), pos, func(data []byte) interface{} {
+		return sdsNewLen(data, len(data))
+	})
+	if !ok {
+		return nil
+	}
+	if vstr != nil {
+		return vstr.(sds)
+	}
+	return sdsFromInt(int(vlong))
+}
+
+// 返回列表的元素数量
+func listTypeLength(subject *redisObject) int {
+	if subject.encoding != REDIS_ENCODING_QUICKLIST {
+		panic(errors.New("Unknown list encoding"))
+	}
+	return quicklistCount(listTypeQuicklist(subject))
+}
@@ -0,0 +1,36 @@
+package datastruct
+
+import "testing"
+
+func TestListTypePushPop(t *testing.T) {
+	checkObjectLeaks(t)
+	list := listTypeCreate()
+	if list.rtype != REDIS_LIST || list.encoding != REDIS_ENCODING_QUICKLIST {
+		t.Fatalf("type %d, encoding %d", list.rtype, list.encoding)
+	}
+	ql := listTypeQuicklist(list)
+	if ql.fill != list_max_ziplist_size || ql.compress != list_compress_depth {
+		t.Fatalf("fill %d, compress %d", ql.fill, ql.compress)
+	}
+
+	listTypePush(list, sdsNew("b"), LIST_HEAD)
+	listTypePush(list, sdsNew("a"), LIST_HEAD)
+	listTypePush(list, sdsNew("100"), LIST_TAIL)
+	if listTypeLength(list) != 3 {
+		t.Fatalf("length %d", listTypeLength(list))
+	}
+
+	// 整数元素弹出时转换为 sds
+	for _, want := range []string{"100", "b"} {
+		if v := listTypePop(list, LIST_TAIL); string(v) != want {
+			t.Fatalf("pop tail %q, want %q", v, want)
+		}
+	}
+	if v := listTypePop(list, LIST_HEAD); string(v) != "a" {
+		t.Fatalf("pop head %q", v)
+	}
+	if v := listTypePop(list, LIST_HEAD); v != nil {
+		t.Fatalf("pop empty list %q", v)
+	}
+	decrRefCount(list)
+}
@@ -0,0 +1,166 @@
+/*
+集合对象，与 Redis 3.0 的 t_set.c 对应
+
+集合对象有两种编码：
+只包含整数并且元素数量不超过 set_max_intset_entries 时使用整数集合(REDIS_ENCODING_INTSET)，
+否则使用以 sds 为键、值为nil的哈希表(REDIS_ENCODING_HT)。
+整数集合编码的集合添加了非整数元素或者元素数量超出限制时，转换为哈希表编码，转换后不会再转换回来。
+*/
+package datastruct
+
+import (
+	"errors"
+	"unsafe"
+)
+
+// 整数集合编码的集合最多可以包含的元素数量，对应配置项 set-max-intset-entries
+var set_max_intset_entries = REDIS_SET_MAX_INTSET_ENTRIES
+
+// 集合使用的字典类型，键为 sds，值为nil
+func setDictType() DictType[interface{}, interface{}] {
+	return DictType[interface{}, interface{}]{
+		HashFunction: func(key interface{}) uint64 {
+			return dictSdsHash(key.(sds))
+		},
+		KeyCompare: func(privdata interface{}, key1 interface{}, key2 interface{}) bool {
+			return dictSdsKeyCompare(privdata, key1.(sds), key2.(sds))
+		},
+		KeyDestructor: func(privdata interface{}, key interface{}) {
+			sdsFree(key.(sds))
+		},
+	}
+}
+
+// 返回整数集合编码的集合对象中的整数集合
+func setTypeIntset(setobj *redisObject) *[]byte {
+	return (*[]byte)(setobj.ptr)
+}
+
+// 创建一个可以保存 value 的空集合对象
+// value 可以表示为整数时使用整数集合编码，否则使用哈希表编码
+func setTypeCreate(value sds) *redisObject {
+	if _, ok := string2ll(value); ok {
+		return createIntsetObject()
+	}
+	return createSetObject()
+}
+
+// 将 value 添加到集合中，value 已存在时返回false
+func setTypeAdd(subject *redisObject, value sds) bool {
+	switch subject.encoding {
+	case REDIS_ENCODING_HT:
+		// 字典只在添加成功时拥有复制的 value，元素已存在时需要释放
+		dup := sdsDup(value)
+		if (*dict)(subject.ptr).dictAdd(dup, nil) != DICT_OK {
+			sdsFree(dup)
+			return false
+		}
+		return true
+	case REDIS_ENCODING_INTSET:
+		if llval, ok := string2ll(value); ok {
+			isp := setTypeIntset(subject)
+			var added bool
+			*isp, added = intsetAdd(*isp, llval)
+			if added {
+				// 元素数量超出限制时转换为哈希表编码
+				if intsetLen(*isp) > set_max_intset_entries {
+					setTypeConvert(subject, REDIS_ENCODING_HT)
+				}
+				return true
+			}
+			return false
+		}
+		// 添加的元素不是整数，转换为哈希表编码
+		setTypeConvert(subject, REDIS_ENCODING_HT)
+		if (*dict)(subject.ptr).dictAdd(sdsDup(value), nil) != DICT_OK {
+			panic(errors.New("set add failed after conversion"))
+		}
+		return true
+	default:
+		panic(errors.New("Unknown set encoding"))
+	}
+}
+
+// 从集合中删除 value，value 不存在时返回false
+func setTypeRemove(setobj *redisObject, value sds) bool {
+	switch setobj.encoding {
+	case REDIS_ENCODING_HT:
+		return dictDelete((*dict)(setobj.ptr), interface{}(value)) == DICT_OK
+	case REDIS_ENCODING_INTSET:
+		if llval, ok := string2ll(value); ok {
+			isp := setTypeIntset(setobj)
+			var removed bool
+			*isp, removed = intsetRemove(*isp, llval)
+			return removed
+		}
+		return false
+	default:
+		panic(errors.New("Unknown set encoding"))
+	}
+}
+
+// 查看 value 是否在集合中
+func setTypeIsMember(set *redisObject, value sds) bool {
+	switch set.encoding {
+	case REDIS_ENCODING_HT:
+		return dictFind((*dict)(set.ptr), interface{}(value)) != nil
+	case REDIS_ENCODING_INTSET:
+		if llval, ok := string2ll(value); ok {
+			return intsetFind(*setTypeIntset(set), llval)
+		}
+		return false
+	default:
+		panic(errors.New("Unknown set encoding"))
+	}
+}
+
+// 随机返回集合中的一个元素，集合不能为空
+// 哈希表编码时元素以 sds 返回，整数集合编码时元素以整数返回，第三个返回值为集合的编码
+// 返回的 sds 与集合共享，不能修改
+func setTypeRandomElement(setobj *redisObject) (sds, int64, int) {
+	switch setobj.encoding {
+	case REDIS_ENCODING_HT:
+		de := dictGetFairRandomKey((*dict)(setobj.ptr))
+		return dictGetKey(de).(sds), 0, REDIS_ENCODING_HT
+	case REDIS_ENCODING_INTSET:
+		return nil, intsetRandom(*setTypeIntset(setobj)), REDIS_ENCODING_INTSET
+	default:
+		panic(errors.New("Unknown set encoding"))
+	}
+}
+
+// 返回集合的元素数量
+func setTypeSize(subject *redisObject) int {
+	switch subject.encoding {
+	case REDIS_ENCODING_HT:
+		return dictSize((*dict)(subject.ptr))
+	case REDIS_ENCODING_INTSET:
+		return intsetLen(*setTypeIntset(subject))
+	default:
+		panic(errors.New("Unknown set encoding"))
+	}
+}
+
+// 将整数集合编码的集合转换为 enc 编码，目前只支持转换为哈希表编码
+func setTypeConvert(setobj *redisObject, enc int) {
+	if setobj.rtype != REDIS_SET || setobj.encoding != REDIS_ENCODING_INTSET {
+		panic(errors.New("setTypeConvert against a non intset encoded set"))
+	}
+	if enc != REDIS_ENCODING_HT {
+		panic(errors.New("Unsupported set conversion"))
+	}
+
+	is := *setTypeIntset(setobj)
+	d := DictCreate(setDictType(), nil)
+	// 预先扩展哈希表，避免转换时 rehash
+	d.dictExpand(intsetLen(is))
+	for pos := 0; pos < intsetLen(is); pos++ {
+		llval, _ := intsetGet(is, pos)
+		if d.dictAdd(sdsFromInt(int(llval)), nil) != DICT_OK {
+			panic(errors.New("duplicate element in intset"))
+		}
+	}
+
+	setobj.encoding = REDIS_ENCODING_HT
+	setobj.ptr = unsafe.Pointer(d)
+}
@@ -0,0 +1,105 @@
+package datastruct
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestSetTypeIntset(t *testing.T) {
+	checkObjectLeaks(t)
+	set := setTypeCreate(sdsNew("1"))
+	if set.encoding != REDIS_ENCODING_INTSET {
+		t.Fatalf("encoding %d", set.encoding)
+	}
+	for _, v := range []string{"3", "1", "2", "-100000"} {
+		setTypeAdd(set, sdsNew(v))
+	}
+	if setTypeAdd(set, sdsNew("2")) {
+		t.Error("add existing member")
+	}
+	if setTypeSize(set) != 4 || set.encoding != REDIS_ENCODING_INTSET {
+		t.Fatalf("size %d, encoding %d", setTypeSize(set), set.encoding)
+	}
+	// 不能严格转换为整数的元素不可能在整数集合中
+	if !setTypeIsMember(set, sdsNew("-100000")) || setTypeIsMember(set, sdsNew("01")) {
+		t.Error("is member")
+	}
+	if !setTypeRemove(set, sdsNew("3")) || setTypeRemove(set, sdsNew("3")) || setTypeRemove(set, sdsNew("x")) {
+		t.Error("remove")
+	}
+	if _, v, enc := setTypeRandomElement(set); enc != REDIS_ENCODING_INTSET || !setTypeIsMember(set, sdsFromInt(int(v))) {
+		t.Errorf("random element %d", v)
+	}
+	decrRefCount(set)
+}
+
+func TestSetTypeConvertOnString(t *testing.T) {
+	checkObjectLeaks(t)
+	set := setTypeCreate(sdsNew("1"))
+	setTypeAdd(set, sdsNew("1"))
+	setTypeAdd(set, sdsNew("2"))
+	if !setTypeAdd(set, sdsNew("a")) {
+		t.Fatal("add a")
+	}
+	if set.encoding != REDIS_ENCODING_HT {
+		t.Fatalf("encoding %d", set.encoding)
+	}
+	for _, v := range []string{"1", "2", "a"} {
+		if !setTypeIsMember(set, sdsNew(v)) {
+			t.Errorf("%s should be member", v)
+		}
+	}
+	if setTypeSize(set) != 3 || setTypeAdd(set, sdsNew("2")) {
+		t.Error("size after conversion")
+	}
+	if !setTypeRemove(set, sdsNew("1")) || setTypeIsMember(set, sdsNew("1")) {
+		t.Error("remove after conversion")
+	}
+	if s, _, enc := setTypeRandomElement(set); enc != REDIS_ENCODING_HT || !setTypeIsMember(set, s) {
+		t.Errorf("random element %q", s)
+	}
+	decrRefCount(set)
+}
+
+func TestSetTypeConvertOnSize(t *testing.T) {
+	checkObjectLeaks(t)
+	old := set_max_intset_entries
+	set_max_intset_entries = 16
+	defer func() { set_max_intset_entries = old }()
+
+	set := setTypeCreate(sdsNew("0"))
+	for i := 0; i < 16; i++ {
+		setTypeAdd(set, sdsFromInt(i))
+	}
+	if set.encoding != REDIS_ENCODING_INTSET {
+		t.Fatalf("encoding %d with 16 entries", set.encoding)
+	}
+	setTypeAdd(set, sdsFromInt(16))
+	if set.encoding != REDIS_ENCODING_HT || setTypeSize(set) != 17 {
+		t.Fatalf("encoding %d, size %d", set.encoding, setTypeSize(set))
+	}
+	for i := 0; i < 17; i++ {
+		if !setTypeIsMember(set, sdsNew(strconv.Itoa(i))) {
+			t.Errorf("%d should be member", i)
+		}
+	}
+	decrRefCount(set)
+}
+
+func TestSetTypeAddDuplicateUsedMemory(t *testing.T) {
+	checkObjectLeaks(t)
+	set := setTypeCreate(sdsNew("a"))
+	member := sdsNew("a")
+	setTypeAdd(set, member)
+	before := zmallocUsedMemory()
+	for i := 0; i < 1000; i++ {
+		if setTypeAdd(set, member) {
+			t.Fatal("duplicate add")
+		}
+	}
+	if got := zmallocUsedMemory() - before; got != 0 || setTypeSize(set) != 1 {
+		t.Errorf("used %d after duplicate adds, size %d", got, setTypeSize(set))
+	}
+	sdsFree(member)
+	decrRefCount(set)
+}
@@ -0,0 +1,142 @@
+/*
+字符串对象，与 Redis 3.0 的 t_string.c 对应
+
+字符串对象有三种编码：
+可以表示为 int64 的值使用 REDIS_ENCODING_INT 编码，[0, REDIS_SHARED_INTEGERS) 范围内的值直接使用共享的整数对象；
+长度不超过 REDIS_ENCODING_EMBSTR_SIZE_LIMIT 的字符串使用 REDIS_ENCODING_EMBSTR 编码，只读；
+其余字符串使用 REDIS_ENCODING_RAW 编码。
+APPEND、SETRANGE 修改字符串前将对象转换为非共享的 REDIS_ENCODING_RAW 编码，INCR、DECR 的结果总是整数编码。
+
+这里的函数接管调用者对 o 的引用，返回应该保存在键中的对象，返回的对象可能不是 o；
+返回错误时 o 不会被修改，调用者仍然持有它的引用。
+*/
+package datastruct
+
+import (
+	"errors"
+	"math"
+	"unsafe"
+)
+
+// 字符串的最大长度，512MB
+const REDIS_STRING_MAX_LENGTH = 512 * 1024 * 1024
+
+var (
+	errStringTooLong = errors.New("ERR string exceeds maximum allowed size (512MB)")
+	errOffsetRange   = errors.New("ERR offset is out of range")
+	errIncrOverflow  = errors.New("ERR increment or decrement would overflow")
+)
+
+// 检查字符串的长度是否超过 REDIS_STRING_MAX_LENGTH
+func checkStringLength(size int64) error {
+	if size > REDIS_STRING_MAX_LENGTH {
+		return errStringTooLong
+	}
+	return nil
+}
+
+// 返回一个可以直接修改的字符串对象，与 Redis 的 dbUnshareStringValue 对应
+// o 被共享或者不是 REDIS_ENCODING_RAW 编码时，创建一个值相同的 REDIS_ENCODING_RAW 编码的对象替代它，并释放调用者对 o 的引用
+func unshareStringValue(o *redisObject) *redisObject {
+	if o.refcount == 1 && o.encoding == REDIS_ENCODING_RAW {
+		return o
+	}
+	decoded := getDecodedObject(o)
+	s := *(*sds)(decoded.ptr)
+	n := createRawStringObject(sdsNewLen(s, sdsLen(s)))
+	decrRefCount(decoded)
+	decrRefCount(o)
+	return n
+}
+
+// 将 val 追加到字符串对象 o 的末尾，o 为nil时表示键不存在
+// 返回追加后的对象和字符串的长度
+func appendGeneric(o *redisObject, val *redisObject) (*redisObject, int, error) {
+	if o == nil {
+		// 键不存在时直接以 val 的值创建新的对象
+		o = tryObjectEncoding(createStringObject(stringObjectBytes(val)))
+		return o, stringObjectLen(o), nil
+	}
+	if o.rtype != REDIS_STRING {
+		return nil, 0, errWrongType
+	}
+
+	appendBytes := stringObjectBytes(val)
+	if err := checkStringLength(int64(stringObjectLen(o)) + int64(len(appendBytes))); err != nil {
+		return nil, 0, err
+	}
+
+	o = unshareStringValue(o)
+	s := sdsCatLen(*(*sds)(o.ptr), string(appendBytes), len(appendBytes))
+	o.ptr = unsafe.Pointer(&s)
+	return o, sdsLen(s), nil
+}
+
+// 从 offset 开始用 val 覆盖字符串对象 o 的值，o 为nil时表示键不存在
+// 原字符串长度不足 offset 时以0填充，返回修改后的对象和字符串的长度
+// 键不存在并且 val 为空时不会创建对象，返回nil
+func setrangeGeneric(o *redisObject, offset int64, val *redisObject) (*redisObject, int, error) {
+	if offset < 0 {
+		return nil, 0, errOffsetRange
+	}
+
+	valBytes := stringObjectBytes(val)
+	if o == nil {
+		// 键不存在并且 val 为空时什么都不做
+		if len(valBytes) == 0 {
+			return nil, 0, nil
+		}
+		if err := checkStringLength(offset + int64(len(valBytes))); err != nil {
+			return nil, 0, err
+		}
+		o = createRawStringObject(sdsNewLen(nil, int(offset)+len(valBytes)))
+	} else {
+		if o.rtype != REDIS_STRING {
+			return nil, 0, errWrongType
+		}
+		// val 为空时返回原字符串的长度，不修改对象
+		olen := stringObjectLen(o)
+		if len(valBytes) == 0 {
+			return o, olen, nil
+		}
+		if err := checkStringLength(offset + int64(len(valBytes))); err != nil {
+			return nil, 0, err
+		}
+		o = unshareStringValue(o)
+	}
+
+	s := sdsGrowZero(*(*sds)(o.ptr), int(offset)+len(valBytes))
+	copy(s[offset:], valBytes)
+	o.ptr = unsafe.Pointer(&s)
+	return o, sdsLen(s), nil
+}
+
+// 将字符串对象 o 的值加上 incr，o 为nil时表示键不存在，值为0
+// 返回保存结果的对象和结果的值
+func incrDecrGeneric(o *redisObject, incr int64) (*redisObject, int64, error) {
+	if o != nil && o.rtype != REDIS_STRING {
+		return nil, 0, errWrongType
+	}
+	value, ok := getLongLongFromObject(o)
+	if !ok {
+		return nil, 0, errNotInteger
+	}
+	if (incr < 0 && value < 0 && incr < math.MinInt64-value) ||
+		(incr > 0 && value > 0 && incr > math.MaxInt64-value) {
+		return nil, 0, errIncrOverflow
+	}
+	value += incr
+
+	// 对象没有被共享、已经是整数编码并且结果不在共享整数的范围内时，直接修改对象的值
+	if o != nil && o.refcount == 1 && o.encoding == REDIS_ENCODING_INT &&
+		(value < 0 || value >= REDIS_SHARED_INTEGERS) {
+		*(*int64)(o.ptr) = value
+		return o, value, nil
+	}
+
+	n := createStringObjectFromLongLong(value)
+	if o != nil {
+		decrRefCount(o)
+	}
+	return n, value, nil
+}
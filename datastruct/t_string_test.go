@@ -0,0 +1,155 @@
+package datastruct
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestAppendGeneric(t *testing.T) {
+	checkObjectLeaks(t)
+	val := createStringObject([]byte("12"))
+	// 键不存在时创建新的对象，可以表示为整数时使用整数编码
+	o, n, err := appendGeneric(nil, val)
+	if err != nil || n != 2 || o.encoding != REDIS_ENCODING_INT {
+		t.Fatalf("append to missing key: %v %d %d", err, n, o.encoding)
+	}
+	// 追加后转换为 RAW 编码
+	o, n, err = appendGeneric(o, val)
+	if err != nil || n != 4 || o.encoding != REDIS_ENCODING_RAW || string(stringObjectBytes(o)) != "1212" {
+		t.Fatalf("append to int: %v %d %d %q", err, n, o.encoding, stringObjectBytes(o))
+	}
+	raw := o
+	neg := createStringObjectFromLongLong(-3)
+	o, n, err = appendGeneric(o, neg)
+	if err != nil || n != 6 || o != raw || string(stringObjectBytes(o)) != "1212-3" {
+		t.Fatalf("append to raw: %v %d %q", err, n, stringObjectBytes(o))
+	}
+	decrRefCount(o)
+	decrRefCount(neg)
+
+	// EMBSTR 编码的对象修改前转换为 RAW 编码
+	emb := createStringObject([]byte("foo"))
+	bar := createStringObject([]byte("bar"))
+	o, n, err = appendGeneric(emb, bar)
+	if err != nil || n != 6 || o == emb || o.encoding != REDIS_ENCODING_RAW || string(stringObjectBytes(o)) != "foobar" {
+		t.Fatalf("append to embstr: %v %d %d %q", err, n, o.encoding, stringObjectBytes(o))
+	}
+	decrRefCount(o)
+
+	// 被共享的对象不会被修改
+	sh := createRawStringObject(sdsNew("foo"))
+	incrRefCount(sh)
+	o, _, _ = appendGeneric(sh, bar)
+	if o == sh || string(stringObjectBytes(sh)) != "foo" || sh.refcount != 1 {
+		t.Errorf("shared object modified: %q refcount %d", stringObjectBytes(sh), sh.refcount)
+	}
+	decrRefCount(o)
+	decrRefCount(sh)
+	decrRefCount(bar)
+
+	zobj := createZsetObject()
+	if _, _, err := appendGeneric(zobj, val); err != errWrongType {
+		t.Errorf("expected wrong type, got %v", err)
+	}
+	decrRefCount(zobj)
+	decrRefCount(val)
+}
+
+func TestSetrangeGeneric(t *testing.T) {
+	checkObjectLeaks(t)
+	val := createStringObject([]byte("abc"))
+	o, n, err := setrangeGeneric(nil, 2, val)
+	if err != nil || n != 5 || string(stringObjectBytes(o)) != "\x00\x00abc" {
+		t.Fatalf("setrange missing key: %v %d %q", err, n, stringObjectBytes(o))
+	}
+	decrRefCount(o)
+
+	// 键不存在并且值为空时不创建对象
+	empty := createStringObject(nil)
+	if o, n, err := setrangeGeneric(nil, 10, empty); o != nil || n != 0 || err != nil {
+		t.Errorf("empty setrange on missing key created %v %d %v", o, n, err)
+	}
+
+	// 整数编码的对象转换为 RAW 编码
+	o = createStringObjectFromLongLong(123456)
+	if o2, n, err := setrangeGeneric(o, 10, empty); o2 != o || n != 6 || err != nil {
+		t.Errorf("empty setrange: %d %v", n, err)
+	}
+	o, n, err = setrangeGeneric(o, 1, val)
+	if err != nil || n != 6 || o.encoding != REDIS_ENCODING_RAW || string(stringObjectBytes(o)) != "1abc56" {
+		t.Fatalf("setrange int: %v %d %d %q", err, n, o.encoding, stringObjectBytes(o))
+	}
+	o, n, err = setrangeGeneric(o, 8, val)
+	if err != nil || n != 11 || string(stringObjectBytes(o)) != "1abc56\x00\x00abc" {
+		t.Fatalf("setrange grow: %v %d %q", err, n, stringObjectBytes(o))
+	}
+
+	if _, _, err := setrangeGeneric(o, -1, val); err != errOffsetRange {
+		t.Errorf("expected offset error, got %v", err)
+	}
+	if _, _, err := setrangeGeneric(o, REDIS_STRING_MAX_LENGTH, val); err != errStringTooLong {
+		t.Errorf("expected length error, got %v", err)
+	}
+	decrRefCount(o)
+	decrRefCount(val)
+	decrRefCount(empty)
+}
+
+func TestIncrDecrGeneric(t *testing.T) {
+	checkObjectLeaks(t)
+	o, v, err := incrDecrGeneric(nil, 1)
+	if err != nil || v != 1 || o != shared.integers[1] {
+		t.Fatalf("incr missing key: %v %d", err, v)
+	}
+	// 超出共享整数的范围后使用独立的整数编码对象
+	o, v, err = incrDecrGeneric(o, REDIS_SHARED_INTEGERS)
+	if err != nil || v != REDIS_SHARED_INTEGERS+1 || o.encoding != REDIS_ENCODING_INT || o.refcount != 1 {
+		t.Fatalf("incr out of shared range: %v %d", err, v)
+	}
+	// 之后直接修改对象的值
+	prev := o
+	o, v, err = incrDecrGeneric(o, 2)
+	if err != nil || v != REDIS_SHARED_INTEGERS+3 || o != prev {
+		t.Fatalf("incr in place: %v %d", err, v)
+	}
+	// 回到共享范围时使用共享对象
+	o, v, err = incrDecrGeneric(o, -(REDIS_SHARED_INTEGERS + 3))
+	if err != nil || v != 0 || o != shared.integers[0] {
+		t.Fatalf("decr to shared: %v %d", err, v)
+	}
+	decrRefCount(o)
+
+	// 字符串编码的整数
+	o = createStringObject([]byte("-20"))
+	o, v, err = incrDecrGeneric(o, 5)
+	if err != nil || v != -15 || o.encoding != REDIS_ENCODING_INT {
+		t.Fatalf("incr string: %v %d", err, v)
+	}
+	decrRefCount(o)
+
+	for _, s := range []string{"abc", "1.5", " 1", "", strings.Repeat("9", 30)} {
+		o := createStringObject([]byte(s))
+		if _, _, err := incrDecrGeneric(o, 1); err != errNotInteger {
+			t.Errorf("%q: expected not integer, got %v", s, err)
+		}
+		decrRefCount(o)
+	}
+
+	o = createStringObjectFromLongLong(math.MaxInt64)
+	if _, _, err := incrDecrGeneric(o, 1); err != errIncrOverflow {
+		t.Errorf("expected overflow, got %v", err)
+	}
+	decrRefCount(o)
+	o = createStringObjectFromLongLong(math.MinInt64)
+	if _, _, err := incrDecrGeneric(o, -1); err != errIncrOverflow {
+		t.Errorf("expected overflow, got %v", err)
+	}
+	decrRefCount(o)
+
+	zobj := createZsetObject()
+	if _, _, err := incrDecrGeneric(zobj, 1); err != errWrongType {
+		t.Errorf("expected wrong type, got %v", err)
+	}
+	decrRefCount(zobj)
+}
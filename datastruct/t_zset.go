@@ -1,9 +1,81 @@
+/*
+有序集合对象，与 Redis 的 t_zset.c 对应
+
+有序集合对象有两种编码：
+元素数量不超过 zset_max_ziplist_entries 并且所有成员的长度都不超过 zset_max_ziplist_value 时
+使用压缩列表编码(REDIS_ENCODING_ZIPLIST)，成员和分值依次保存在相邻的两个节点中，按分值从小到大排列，
+分值相同时按成员的字典序排列；
+否则使用跳跃表编码(REDIS_ENCODING_SKIPLIST)，由一个成员到分值的字典和一个跳跃表组成，
+字典用于 O(1) 复杂度查找成员的分值，跳跃表用于按分值或排位进行范围操作。
+跳跃表节点拥有成员对象，字典与跳跃表共享同一个成员对象，不会单独释放它。
+*/
 package datastruct
 
-import "math/rand"
+import (
+	"bytes"
+	"errors"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+// 压缩列表编码的有序集合最多可以包含的元素数量，对应配置项 zset-max-ziplist-entries
+var zset_max_ziplist_entries = REDIS_ZSET_MAX_ZIPLIST_ENTRIES
+
+// 压缩列表编码的有序集合中成员的最大长度，对应配置项 zset-max-ziplist-value
+var zset_max_ziplist_value = REDIS_ZSET_MAX_ZIPLIST_VALUE
+
+// zsetAdd 的输入标志
+const (
+	ZADD_IN_NONE = 0
+	// 将分值加到成员原有的分值上
+	ZADD_IN_INCR = 1 << 0
+	// 只添加新成员，不更新已有的成员
+	ZADD_IN_NX = 1 << 1
+	// 只更新已有的成员，不添加新成员
+	ZADD_IN_XX = 1 << 2
+	// 只在新分值大于原有分值时更新
+	ZADD_IN_GT = 1 << 3
+	// 只在新分值小于原有分值时更新
+	ZADD_IN_LT = 1 << 4
+	// 返回添加和更新的成员数量之和，只在 zaddGeneric 中使用，zsetAdd 会忽略它
+	ZADD_IN_CH = 1 << 5
+)
+
+// zsetAdd 的输出标志
+const (
+	// 因为 NX、XX、GT、LT 的限制没有执行操作
+	ZADD_OUT_NOP = 1 << 0
+	// 分值为 NaN，没有执行操作
+	ZADD_OUT_NAN = 1 << 1
+	// 添加了新成员
+	ZADD_OUT_ADDED = 1 << 2
+	// 更新了已有成员的分值
+	ZADD_OUT_UPDATED = 1 << 3
+)
+
+var (
+	errZaddNXXX       = errors.New("ERR XX and NX options at the same time are not compatible")
+	errZaddGTLTNX     = errors.New("ERR GT, LT, and/or NX options at the same time are not compatible")
+	errZaddIncrPairs  = errors.New("ERR INCR option supports a single increment-element pair")
+	errZaddScoreIsNaN = errors.New("ERR resulting score is not a number (NaN)")
+	errNotFloat       = errors.New("ERR value is not a valid float")
+
+	errWrongType       = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+	errZinterCardLimit = errors.New("ERR LIMIT can't be negative")
+	errZsetLexRange    = errors.New("ERR min or max not valid string range item")
+
+	errZsetMinMaxNotFloat = errors.New("ERR min or max is not a float")
+	errSyntax             = errors.New("ERR syntax error")
+	errNotInteger         = errors.New("ERR value is not an integer or out of range")
+)
 
-// 全局共享变量
-var shared SharedObjectsStruct = SharedObjectsStruct{}
+/*-----------------------------------------------------------------------------
+ * 跳跃表
+ *----------------------------------------------------------------------------*/
 
 // 创建一个层数为level的跳跃表节点
 // 成员对象为 obj, 分值为 score
@@ -11,6 +83,7 @@ func zslCreateNode(level int, score float64, obj *redisObject) *zskiplistNode {
 	znode := &zskiplistNode{}
 	znode.score = score
 	znode.obj = obj
+	znode.level = make([]zskiplistLevel, level)
 	return znode
 }
 
@@ -66,6 +139,7 @@ func zslRandomLevel() int {
 }
 
 // 创建一个新节点，并插入跳跃表中
+// 调用者需要保证跳跃表中没有相同的成员
 func zslInsert(zsl *zskiplist, score float64, robj *redisObject) *zskiplistNode {
 	// 记录每层 开头到目标节点（要插入其后的节点）之间的距离（节点数）+ 上层的rank
 	var rank [ZSKPLIST_MAXLEVEL]int
@@ -79,21 +153,17 @@ func zslInsert(zsl *zskiplist, score float64, robj *redisObject) *zskiplistNode
 			rank[i] = rank[i+1]
 		}
 
-		node := x.level[i].forward
-		for node != nil {
-			if node.score < score ||
-				(node.score == score &&
-					compareStringObjects(x.level[i].forward.obj, robj) < 0) {
-				// 记录跨越过了多少节点
-				rank[i] += x.level[i].span
-				// 移动至下一个指针
-				node = x.level[i].forward
-			} else {
-				break
-			}
+		for x.level[i].forward != nil &&
+			(x.level[i].forward.score < score ||
+				(x.level[i].forward.score == score &&
+					compareStringObjects(x.level[i].forward.obj, robj) < 0)) {
+			// 记录跨越过了多少节点
+			rank[i] += x.level[i].span
+			// 移动至下一个指针
+			x = x.level[i].forward
 		}
 		// 第i层要插入到此节点后
-		update[i] = node
+		update[i] = x
 	}
 
 	level := zslRandomLevel()
@@ -136,6 +206,7 @@ func zslInsert(zsl *zskiplist, score float64, robj *redisObject) *zskiplistNode
 }
 
 // 内部删除函数
+// update 为每一层中位于 node 之前的节点
 func zslDeleteNode(zsl *zskiplist, node *zskiplistNode, update []*zskiplistNode) {
 	for i := 0; i < zsl.level; i++ {
 		if update[i].level[i].forward == node {
@@ -155,14 +226,15 @@ func zslDeleteNode(zsl *zskiplist, node *zskiplistNode, update []*zskiplistNode)
 	for zsl.level > 1 && zsl.header.level[zsl.level-1].forward == nil {
 		zsl.level--
 	}
-	zsl.level--
+	zsl.length--
 }
 
 // 删除包含score并带有指定obj的对象节点
-func zslDelet(zsl *zskiplist, score float64, obj *redisObject) int {
+// 找到并删除节点时返回1，否则返回0
+func zslDelete(zsl *zskiplist, score float64, obj *redisObject) int {
 	update := make([]*zskiplistNode, ZSKPLIST_MAXLEVEL)
 	x := zsl.header
-	for i := zsl.level - 1; i > 0; i++ {
+	for i := zsl.level - 1; i >= 0; i-- {
 		for x.level[i].forward != nil &&
 			(x.level[i].forward.score < score ||
 				(x.level[i].forward.score == score &&
@@ -180,11 +252,45 @@ func zslDelet(zsl *zskiplist, score float64, obj *redisObject) int {
 	} else {
 		return 0
 	}
-	return 0
+}
+
+// 将成员 obj 的分值从 curscore 更新为 newscore，返回更新后成员所在的节点
+// 成员必须存在于跳跃表中并且分值为 curscore
+// 更新后节点的位置不变时直接修改分值，否则删除原节点并以同一个成员对象插入新节点
+func zslUpdateScore(zsl *zskiplist, curscore float64, obj *redisObject, newscore float64) *zskiplistNode {
+	update := make([]*zskiplistNode, ZSKPLIST_MAXLEVEL)
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil &&
+			(x.level[i].forward.score < curscore ||
+				(x.level[i].forward.score == curscore &&
+					compareStringObjects(x.level[i].forward.obj, obj) < 0)) {
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	x = x.level[0].forward
+	if x == nil || x.score != curscore || equalStringObjects(x.obj, obj) != 1 {
+		panic(errors.New("zslUpdateScore against a missing element"))
+	}
+
+	// 新分值仍然位于前后两个节点之间
+	if (x.backward == nil || x.backward.score < newscore) &&
+		(x.level[0].forward == nil || x.level[0].forward.score > newscore) {
+		x.score = newscore
+		return x
+	}
+
+	// 成员对象转移到新节点，旧节点不释放成员对象
+	zslDeleteNode(zsl, x, update)
+	newnode := zslInsert(zsl, newscore, x.obj)
+	x.obj = nil
+	return newnode
 }
 
 // 检测value是否大于(或大于等于) spec中的min
-// 返回 1 表示 value 小于等于 max 项，否则返回 0
+// 返回 1 表示 value 大于等于 min 项，否则返回 0
 func zslValueGteMin(value float64, spec *zrangespec) int {
 	if spec.minex == 1 {
 		if spec.min < value {
@@ -201,22 +307,23 @@ func zslValueGteMin(value float64, spec *zrangespec) int {
 // 检测给定值 value 是否小于（或小于等于）范围 spec 中的 max 项
 // 返回 1 表示 value 小于等于 max 项，否则返回 0
 func zslValueLteMax(value float64, spec *zrangespec) int {
-	if spec.minex == 1 {
-		if spec.min > value {
+	if spec.maxex == 1 {
+		if value < spec.max {
 			return 1
 		}
 	} else {
-		if spec.min >= value {
+		if value <= spec.max {
 			return 1
 		}
 	}
 	return 0
 }
 
-// 判断给定的值是否在范围内
+// 判断跳跃表中是否有节点的分值在范围内
 func zslIsInRange(zsl *zskiplist, rge *zrangespec) int {
+	// 排除空的范围
 	if rge.min > rge.max ||
-		(rge.min == rge.max && (rge.minex == 0 || rge.maxex == 0)) {
+		(rge.min == rge.max && (rge.minex == 1 || rge.maxex == 1)) {
 		return 0
 	}
 	x := zsl.tail
@@ -272,8 +379,8 @@ func zslLastInRange(zsl *zskiplist, rge *zrangespec) *zskiplistNode {
 	return x
 }
 
-// 删除所有分值在给定范围内的节点
-func zslDeleteRangeByScore(zsl *zskiplist, rge *zrangespec, d *dict) int {
+// 删除所有分值在给定范围内的节点，同时从字典 d 中删除，返回删除的节点数量
+func zslDeleteRangeByScore(zsl *zskiplist, rge *zrangespec, d *Dict[*redisObject, float64]) int {
 	update := make([]*zskiplistNode, ZSKPLIST_MAXLEVEL)
 	removed := 0
 	x := zsl.header
@@ -317,7 +424,8 @@ func zslDeleteRangeByScore(zsl *zskiplist, rge *zrangespec, d *dict) int {
 	return removed
 }
 
-func zslDeleteRangeByLex(zsl *zskiplist, rge *zlexrangespec, d *dict) int {
+// 删除所有成员在字典序范围内的节点，同时从字典 d 中删除，返回删除的节点数量
+func zslDeleteRangeByLex(zsl *zskiplist, rge *zlexrangespec, d *Dict[*redisObject, float64]) int {
 	update := make([]*zskiplistNode, ZSKPLIST_MAXLEVEL)
 	var removed = 0
 	x := zsl.header
@@ -331,7 +439,7 @@ func zslDeleteRangeByLex(zsl *zskiplist, rge *zlexrangespec, d *dict) int {
 	}
 
 	x = x.level[0].forward
-	for x != nil && zslLexValueGteMax(x.obj, rge) {
+	for x != nil && zslLexValueLteMax(x.obj, rge) {
 		next := x.level[0].forward
 
 		zslDeleteNode(zsl, x, update)
@@ -344,7 +452,7 @@ func zslDeleteRangeByLex(zsl *zskiplist, rge *zlexrangespec, d *dict) int {
 }
 
 // 删除start-end之间的所有节点（从1开始）
-func zslDeleteRangeByRank(zsl *zskiplist, start int, end int, d *dict) int {
+func zslDeleteRangeByRank(zsl *zskiplist, start int, end int, d *Dict[*redisObject, float64]) int {
 	update := make([]*zskiplistNode, ZSKPLIST_MAXLEVEL)
 	traversed, removed := 0, 0
 
@@ -376,20 +484,22 @@ func zslDeleteRangeByRank(zsl *zskiplist, start int, end int, d *dict) int {
 }
 
 // 查找包含执行值和对象的排位, 索引从1开始，未找到返回0
-func zslGetRand(zsl *zskiplist, score float64, o *redisObject) int {
+func zslGetRank(zsl *zskiplist, score float64, o *redisObject) int {
 	rank := 0
 	x := zsl.header
-	var i int
-	for x.level[i].forward != nil &&
-		(x.level[i].forward.score < score ||
-			(x.level[i].forward.score == score &&
-				compareStringObjects(x.level[i].forward.obj, o) <= 0)) {
-		rank += x.level[i].span
-		x = x.level[i].forward
-	}
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil &&
+			(x.level[i].forward.score < score ||
+				(x.level[i].forward.score == score &&
+					compareStringObjects(x.level[i].forward.obj, o) <= 0)) {
+			rank += x.level[i].span
+			x = x.level[i].forward
+		}
 
-	if x.obj != nil && equalStringObjects(x.obj, o) == 1 {
-		return rank
+		// x 可能是表头，此时 obj 为nil
+		if x.obj != nil && equalStringObjects(x.obj, o) == 1 {
+			return rank
+		}
 	}
 	return 0
 }
@@ -413,11 +523,46 @@ func zslGetElementByRank(zsl *zskiplist, rank int) *zskiplistNode {
 	return nil
 }
 
-func zslParseRange(min *redisObject, max *redisObject, spec *zrangespec) int {
-	// todo this
-	return 1
+// 解析分值范围的一端，返回这一端的值以及是否排除这一端
+// "(" 开头表示不包含这一端，数值的格式与 strtod 相同，可以为 "-inf" 和 "+inf"，不能为 NaN
+func zslParseRangeItem(item *redisObject) (float64, int, bool) {
+	if item.encoding == REDIS_ENCODING_INT {
+		return float64(*(*int64)(item.ptr)), 0, true
+	}
+	s := *(*sds)(item.ptr)
+	ex := 0
+	if len(s) > 0 && s[0] == '(' {
+		s = s[1:]
+		ex = 1
+	}
+	// 与 C 字符串相同，只解析到第一个 '\0' 为止
+	if i := bytes.IndexByte(s, 0); i >= 0 {
+		s = s[:i]
+	}
+	value, n := strtod(s)
+	if n != len(s) || math.IsNaN(value) {
+		return 0, 0, false
+	}
+	return value, ex, true
+}
+
+// 解析 ZRANGEBYSCORE 等命令的 min 和 max 参数，结果保存到 spec 中
+func zslParseRange(min *redisObject, max *redisObject, spec *zrangespec) error {
+	var ok bool
+	if spec.min, spec.minex, ok = zslParseRangeItem(min); !ok {
+		return errZsetMinMaxNotFloat
+	}
+	if spec.max, spec.maxex, ok = zslParseRangeItem(max); !ok {
+		return errZsetMinMaxNotFloat
+	}
+	return nil
 }
 
+/*-----------------------------------------------------------------------------
+ * 字典序范围
+ *----------------------------------------------------------------------------*/
+
+// 比较字典序范围中的两个值，shared.minstring 和 shared.maxstring 分别表示负无穷和正无穷
 func compareStringObjectsForLexRange(a *redisObject, b *redisObject) int {
 	if a == b {
 		return 0
@@ -431,6 +576,64 @@ func compareStringObjectsForLexRange(a *redisObject, b *redisObject) int {
 	return compareStringObjects(a, b)
 }
 
+// 解析字典序范围的一端，返回表示这一端的对象以及是否排除这一端
+// "[a" 表示包含 a，"(a" 表示不包含 a，"-" 和 "+" 分别表示负无穷和正无穷
+func zslParseLexRangeItem(item *redisObject) (*redisObject, int, error) {
+	c := *(*sds)(item.ptr)
+	if len(c) == 0 {
+		return nil, 0, errZsetLexRange
+	}
+	switch c[0] {
+	case '+':
+		if len(c) != 1 {
+			return nil, 0, errZsetLexRange
+		}
+		return shared.maxstring, 0, nil
+	case '-':
+		if len(c) != 1 {
+			return nil, 0, errZsetLexRange
+		}
+		return shared.minstring, 0, nil
+	case '(':
+		return createRawStringObject(sdsNewLen(c[1:], len(c)-1)), 1, nil
+	case '[':
+		return createRawStringObject(sdsNewLen(c[1:], len(c)-1)), 0, nil
+	default:
+		return nil, 0, errZsetLexRange
+	}
+}
+
+// 解析 ZRANGEBYLEX 等命令的 min 和 max 参数，结果保存到 spec 中
+// 解析成功后需要使用 zslFreeLexRange 释放 spec
+func zslParseLexRange(min *redisObject, max *redisObject, spec *zlexrangespec) error {
+	// 整数编码的对象不可能以 '(' 或 '[' 开头
+	if min.encoding == REDIS_ENCODING_INT || max.encoding == REDIS_ENCODING_INT {
+		return errZsetLexRange
+	}
+
+	var err error
+	spec.min, spec.max = nil, nil
+	if spec.min, spec.minex, err = zslParseLexRangeItem(min); err == nil {
+		spec.max, spec.maxex, err = zslParseLexRangeItem(max)
+	}
+	if err != nil {
+		zslFreeLexRange(spec)
+		return err
+	}
+	return nil
+}
+
+// 释放 zslParseLexRange 创建的对象，哨兵对象不会被释放
+func zslFreeLexRange(spec *zlexrangespec) {
+	for _, o := range []*redisObject{spec.min, spec.max} {
+		if o != nil && o != shared.minstring && o != shared.maxstring {
+			decrRefCount(o)
+		}
+	}
+	spec.min, spec.max = nil, nil
+}
+
+// 检测 value 是否大于（或大于等于）spec 中的 min
 func zslLexValueGteMin(value *redisObject, spec *zlexrangespec) bool {
 	if spec.minex == 1 {
 		return compareStringObjectsForLexRange(value, spec.min) > 0
@@ -439,23 +642,1697 @@ func zslLexValueGteMin(value *redisObject, spec *zlexrangespec) bool {
 	}
 }
 
-func zslLexValueGteMax(value *redisObject, spec *zlexrangespec) bool {
-	if spec.minex == 1 {
-		return compareStringObjectsForLexRange(value, spec.max) > 0
+// 检测 value 是否小于（或小于等于）spec 中的 max
+func zslLexValueLteMax(value *redisObject, spec *zlexrangespec) bool {
+	if spec.maxex == 1 {
+		return compareStringObjectsForLexRange(value, spec.max) < 0
 	} else {
-		return compareStringObjectsForLexRange(value, spec.max) >= 0
+		return compareStringObjectsForLexRange(value, spec.max) <= 0
 	}
 }
 
-// 相等返回1 否则返回0
-func equalStringObjects(a *redisObject, b *redisObject) int {
-	if a.encoding == REDIS_ENCODING_INT &&
-		b.encoding == REDIS_ENCODING_INT {
-		if a == b {
-			return 1
+// 判断跳跃表中是否有成员在字典序范围内
+func zslIsInLexRange(zsl *zskiplist, rge *zlexrangespec) bool {
+	// 排除空的范围
+	cmp := compareStringObjectsForLexRange(rge.min, rge.max)
+	if cmp > 0 || (cmp == 0 && (rge.minex == 1 || rge.maxex == 1)) {
+		return false
+	}
+	x := zsl.tail
+	if x == nil || !zslLexValueGteMin(x.obj, rge) {
+		return false
+	}
+	x = zsl.header.level[0].forward
+	if x == nil || !zslLexValueLteMax(x.obj, rge) {
+		return false
+	}
+	return true
+}
+
+// 返回第一个成员在字典序范围内的节点，没有时返回nil
+func zslFirstInLexRange(zsl *zskiplist, rge *zlexrangespec) *zskiplistNode {
+	if !zslIsInLexRange(zsl, rge) {
+		return nil
+	}
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && !zslLexValueGteMin(x.level[i].forward.obj, rge) {
+			x = x.level[i].forward
+		}
+	}
+
+	x = x.level[0].forward
+	if !zslLexValueLteMax(x.obj, rge) {
+		return nil
+	}
+	return x
+}
+
+// 返回最后一个成员在字典序范围内的节点，没有时返回nil
+func zslLastInLexRange(zsl *zskiplist, rge *zlexrangespec) *zskiplistNode {
+	if !zslIsInLexRange(zsl, rge) {
+		return nil
+	}
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && zslLexValueLteMax(x.level[i].forward.obj, rge) {
+			x = x.level[i].forward
 		}
+	}
+
+	if !zslLexValueGteMin(x.obj, rge) {
+		return nil
+	}
+	return x
+}
+
+/*-----------------------------------------------------------------------------
+ * 压缩列表编码的有序集合
+ *----------------------------------------------------------------------------*/
+
+// 将压缩列表中以字符串保存的分值转换为 double，无法转换时返回0
+func zzlStrtod(vstr []byte) float64 {
+	score, err := strconv.ParseFloat(string(vstr), 64)
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
 		return 0
+	}
+	return score
+}
+
+// 返回 sptr 处节点保存的分值
+func zzlGetScore(zl []byte, sptr int) float64 {
+	vstr, vlong, ok := ziplistGet(zl, sptr)
+	if !ok {
+		panic(errors.New("zzlGetScore against an invalid entry"))
+	}
+	if vstr != nil {
+		return zzlStrtod(vstr)
+	}
+	return float64(vlong)
+}
+
+// 返回 eptr 处节点保存的成员，返回的 sds 为副本
+func zzlGetElement(zl []byte, eptr int) sds {
+	vstr, vlong, ok := ziplistGet(zl, eptr)
+	if !ok {
+		panic(errors.New("zzlGetElement against an invalid entry"))
+	}
+	if vstr != nil {
+		return sdsNewLen(vstr, len(vstr))
+	}
+	return sdsFromInt(int(vlong))
+}
+
+// 按字典序比较 eptr 处的成员与 cstr
+func zzlCompareElements(zl []byte, eptr int, cstr []byte) int {
+	vstr, vlong, ok := ziplistGet(zl, eptr)
+	if !ok {
+		panic(errors.New("zzlCompareElements against an invalid entry"))
+	}
+	if vstr == nil {
+		str, _ := ll2string(vlong)
+		vstr = []byte(str)
+	}
+	return bytes.Compare(vstr, cstr)
+}
+
+// 返回压缩列表编码的有序集合的元素数量
+func zzlLength(zl []byte) int {
+	return ziplistLen(zl) / 2
+}
+
+// 移动到下一个元素，返回下一个元素的成员和分值所在的节点，没有下一个元素时都为 -1
+func zzlNext(zl []byte, eptr int, sptr int) (int, int) {
+	eptr = ziplistNext(zl, sptr)
+	if eptr != -1 {
+		sptr = ziplistNext(zl, eptr)
+	} else {
+		sptr = -1
+	}
+	return eptr, sptr
+}
+
+// 移动到上一个元素，返回上一个元素的成员和分值所在的节点，没有上一个元素时都为 -1
+func zzlPrev(zl []byte, eptr int, sptr int) (int, int) {
+	sptr = ziplistPrev(zl, eptr)
+	if sptr != -1 {
+		eptr = ziplistPrev(zl, sptr)
+	} else {
+		eptr = -1
+	}
+	return eptr, sptr
+}
+
+// 判断压缩列表中是否有元素的分值在范围内
+func zzlIsInRange(zl []byte, rge *zrangespec) bool {
+	if rge.min > rge.max ||
+		(rge.min == rge.max && (rge.minex == 1 || rge.maxex == 1)) {
+		return false
+	}
+
+	// 最后一个元素的分值
+	p := ziplistIndex(zl, -1)
+	if p == -1 || zslValueGteMin(zzlGetScore(zl, p), rge) == 0 {
+		return false
+	}
+	// 第一个元素的分值
+	p = ziplistIndex(zl, 1)
+	if zslValueLteMax(zzlGetScore(zl, p), rge) == 0 {
+		return false
+	}
+	return true
+}
+
+// 返回第一个分值在范围内的元素的成员节点，没有时返回 -1
+func zzlFirstInRange(zl []byte, rge *zrangespec) int {
+	if !zzlIsInRange(zl, rge) {
+		return -1
+	}
+	eptr := ziplistIndex(zl, 0)
+	for eptr != -1 {
+		sptr := ziplistNext(zl, eptr)
+		score := zzlGetScore(zl, sptr)
+		if zslValueGteMin(score, rge) == 1 {
+			if zslValueLteMax(score, rge) == 1 {
+				return eptr
+			}
+			return -1
+		}
+		eptr = ziplistNext(zl, sptr)
+	}
+	return -1
+}
+
+// 返回最后一个分值在范围内的元素的成员节点，没有时返回 -1
+func zzlLastInRange(zl []byte, rge *zrangespec) int {
+	if !zzlIsInRange(zl, rge) {
+		return -1
+	}
+	eptr := ziplistIndex(zl, -2)
+	for eptr != -1 {
+		sptr := ziplistNext(zl, eptr)
+		score := zzlGetScore(zl, sptr)
+		if zslValueLteMax(score, rge) == 1 {
+			if zslValueGteMin(score, rge) == 1 {
+				return eptr
+			}
+			return -1
+		}
+		eptr, _ = zzlPrev(zl, eptr, sptr)
+	}
+	return -1
+}
+
+// 检测 p 处的成员是否大于（或大于等于）spec 中的 min
+func zzlLexValueGteMin(zl []byte, p int, spec *zlexrangespec) bool {
+	ele := zzlGetElement(zl, p)
+	value := initStaticStringObject(ele)
+	res := zslLexValueGteMin(&value, spec)
+	sdsFree(ele)
+	return res
+}
+
+// 检测 p 处的成员是否小于（或小于等于）spec 中的 max
+func zzlLexValueLteMax(zl []byte, p int, spec *zlexrangespec) bool {
+	ele := zzlGetElement(zl, p)
+	value := initStaticStringObject(ele)
+	res := zslLexValueLteMax(&value, spec)
+	sdsFree(ele)
+	return res
+}
+
+// 判断压缩列表中是否有成员在字典序范围内
+func zzlIsInLexRange(zl []byte, rge *zlexrangespec) bool {
+	cmp := compareStringObjectsForLexRange(rge.min, rge.max)
+	if cmp > 0 || (cmp == 0 && (rge.minex == 1 || rge.maxex == 1)) {
+		return false
+	}
+
+	// 最后一个成员
+	p := ziplistIndex(zl, -2)
+	if p == -1 || !zzlLexValueGteMin(zl, p, rge) {
+		return false
+	}
+	// 第一个成员
+	p = ziplistIndex(zl, 0)
+	return zzlLexValueLteMax(zl, p, rge)
+}
+
+// 返回第一个成员在字典序范围内的元素的成员节点，没有时返回 -1
+func zzlFirstInLexRange(zl []byte, rge *zlexrangespec) int {
+	if !zzlIsInLexRange(zl, rge) {
+		return -1
+	}
+	eptr := ziplistIndex(zl, 0)
+	for eptr != -1 {
+		if zzlLexValueGteMin(zl, eptr, rge) {
+			if zzlLexValueLteMax(zl, eptr, rge) {
+				return eptr
+			}
+			return -1
+		}
+		sptr := ziplistNext(zl, eptr)
+		eptr = ziplistNext(zl, sptr)
+	}
+	return -1
+}
+
+// 返回最后一个成员在字典序范围内的元素的成员节点，没有时返回 -1
+func zzlLastInLexRange(zl []byte, rge *zlexrangespec) int {
+	if !zzlIsInLexRange(zl, rge) {
+		return -1
+	}
+	eptr := ziplistIndex(zl, -2)
+	for eptr != -1 {
+		if zzlLexValueLteMax(zl, eptr, rge) {
+			if zzlLexValueGteMin(zl, eptr, rge) {
+				return eptr
+			}
+			return -1
+		}
+		eptr, _ = zzlPrev(zl, eptr, ziplistNext(zl, eptr))
+	}
+	return -1
+}
+
+// 删除分值在范围内的所有元素，返回新的压缩列表和删除的元素数量
+func zzlDeleteRangeByScore(zl []byte, rge *zrangespec) ([]byte, int) {
+	deleted := 0
+	eptr := zzlFirstInRange(zl, rge)
+	if eptr == -1 {
+		return zl, 0
+	}
+	// 删除一个元素后 eptr 指向下一个元素
+	for sptr := ziplistNext(zl, eptr); sptr != -1; sptr = ziplistNext(zl, eptr) {
+		if zslValueLteMax(zzlGetScore(zl, sptr), rge) == 0 {
+			break
+		}
+		zl = zzlDelete(zl, eptr)
+		deleted++
+	}
+	return zl, deleted
+}
+
+// 删除成员在字典序范围内的所有元素，返回新的压缩列表和删除的元素数量
+func zzlDeleteRangeByLex(zl []byte, rge *zlexrangespec) ([]byte, int) {
+	deleted := 0
+	eptr := zzlFirstInLexRange(zl, rge)
+	if eptr == -1 {
+		return zl, 0
+	}
+	// 删除一个元素后 eptr 指向下一个元素
+	for ziplistNext(zl, eptr) != -1 {
+		if !zzlLexValueLteMax(zl, eptr, rge) {
+			break
+		}
+		zl = zzlDelete(zl, eptr)
+		deleted++
+	}
+	return zl, deleted
+}
+
+// 查找成员 ele，返回成员所在的节点及其分值，找不到时返回 -1
+func zzlFind(zl []byte, ele sds) (int, float64) {
+	eptr := ziplistIndex(zl, 0)
+	for eptr != -1 {
+		sptr := ziplistNext(zl, eptr)
+		if ziplistCompare(zl, eptr, ele) {
+			return eptr, zzlGetScore(zl, sptr)
+		}
+		eptr = ziplistNext(zl, sptr)
+	}
+	return -1, 0
+}
+
+// 删除 eptr 处的元素，包括成员和分值两个节点
+func zzlDelete(zl []byte, eptr int) []byte {
+	zl, p := ziplistDelete(zl, eptr)
+	zl, _ = ziplistDelete(zl, p)
+	return zl
+}
+
+// 在 eptr 处插入元素，eptr 为 -1 时添加到末尾
+func zzlInsertAt(zl []byte, eptr int, ele sds, score float64) []byte {
+	scorebuf, _ := d2string(score)
+	if eptr == -1 {
+		zl = ziplistPush(zl, ele, ZIPLIST_TAIL)
+		zl = ziplistPush(zl, []byte(scorebuf), ZIPLIST_TAIL)
 	} else {
-		return compareStringObjects(a, b)
+		// 插入成员后，分值插入到成员之后
+		zl = ziplistInsert(zl, eptr, ele)
+		sptr := ziplistNext(zl, eptr)
+		zl = ziplistInsert(zl, sptr, []byte(scorebuf))
+	}
+	return zl
+}
+
+// 按分值和成员的顺序插入元素，调用者需要保证成员不存在
+func zzlInsert(zl []byte, ele sds, score float64) []byte {
+	eptr := ziplistIndex(zl, 0)
+	for eptr != -1 {
+		sptr := ziplistNext(zl, eptr)
+		s := zzlGetScore(zl, sptr)
+		if s > score {
+			// 插入到第一个分值更大的元素之前
+			return zzlInsertAt(zl, eptr, ele, score)
+		} else if s == score {
+			// 分值相同时按成员排序
+			if zzlCompareElements(zl, eptr, ele) > 0 {
+				return zzlInsertAt(zl, eptr, ele, score)
+			}
+		}
+		eptr = ziplistNext(zl, sptr)
+	}
+	return zzlInsertAt(zl, -1, ele, score)
+}
+
+/*-----------------------------------------------------------------------------
+ * 有序集合对象
+ *----------------------------------------------------------------------------*/
+
+// 跳跃表编码的有序集合使用的字典类型，键为成员对象，值为分值
+// 成员对象由跳跃表释放，字典不释放键
+// 与 equalStringObjects 一样按字符串的值计算哈希值，整数编码的成员与值相同的字符串成员哈希值相同
+func zsetDictType() DictType[*redisObject, float64] {
+	return DictType[*redisObject, float64]{
+		HashFunction: func(key *redisObject) uint64 {
+			return dictSdsHash(stringObjectBytes(key))
+		},
+		KeyCompare: func(privdata interface{}, key1 *redisObject, key2 *redisObject) bool {
+			return equalStringObjects(key1, key2) == 1
+		},
+	}
+}
+
+// 返回压缩列表编码的有序集合对象中的压缩列表
+func zsetTypeZiplist(zobj *redisObject) *[]byte {
+	return (*[]byte)(zobj.ptr)
+}
+
+// 返回跳跃表编码的有序集合对象中的 zset
+func zsetTypeZset(zobj *redisObject) *zset {
+	return (*zset)(zobj.ptr)
+}
+
+// 创建一个空的有序集合对象，sizeHint 和 valueLenHint 分别为预计的元素数量和成员长度，
+// 两者都不超过压缩列表编码的限制时使用压缩列表编码
+func zsetTypeCreate(sizeHint int, valueLenHint int) *redisObject {
+	if sizeHint <= zset_max_ziplist_entries && valueLenHint <= zset_max_ziplist_value {
+		return createZsetZiplistObject()
+	}
+	zobj := createZsetObject()
+	zsetTypeZset(zobj).dict.dictExpand(sizeHint)
+	return zobj
+}
+
+// 返回有序集合的元素数量，对应 ZCARD 命令
+func zsetLength(zobj *redisObject) int {
+	switch zobj.encoding {
+	case REDIS_ENCODING_ZIPLIST:
+		return zzlLength(*zsetTypeZiplist(zobj))
+	case REDIS_ENCODING_SKIPLIST:
+		return zsetTypeZset(zobj).zsl.length
+	default:
+		panic(errors.New("Unknown sorted set encoding"))
+	}
+}
+
+// 转换有序集合的编码，encoding 为 REDIS_ENCODING_ZIPLIST 或 REDIS_ENCODING_SKIPLIST
+func zsetConvert(zobj *redisObject, encoding int) {
+	if int(zobj.encoding) == encoding {
+		return
+	}
+	switch zobj.encoding {
+	case REDIS_ENCODING_ZIPLIST:
+		if encoding != REDIS_ENCODING_SKIPLIST {
+			panic(errors.New("Unknown target encoding"))
+		}
+		zl := *zsetTypeZiplist(zobj)
+		zs := &zset{dict: DictCreate(zsetDictType(), nil), zsl: zslCreate()}
+		zs.dict.dictExpand(zzlLength(zl))
+
+		eptr := ziplistIndex(zl, 0)
+		sptr := -1
+		if eptr != -1 {
+			sptr = ziplistNext(zl, eptr)
+		}
+		for eptr != -1 {
+			score := zzlGetScore(zl, sptr)
+			ele := createRawStringObject(zzlGetElement(zl, eptr))
+			// 压缩列表中的元素已经有序，跳跃表只需依次插入
+			node := zslInsert(zs.zsl, score, ele)
+			if zs.dict.dictAdd(node.obj, score) != DICT_OK {
+				panic(errors.New("duplicate element in ziplist"))
+			}
+			eptr, sptr = zzlNext(zl, eptr, sptr)
+		}
+
+		zobj.ptr = unsafe.Pointer(zs)
+		zobj.encoding = REDIS_ENCODING_SKIPLIST
+	case REDIS_ENCODING_SKIPLIST:
+		if encoding != REDIS_ENCODING_ZIPLIST {
+			panic(errors.New("Unknown target encoding"))
+		}
+		zl := ziplistNew()
+		zs := zsetTypeZset(zobj)
+		for node := zs.zsl.header.level[0].forward; node != nil; node = node.level[0].forward {
+			zl = zzlInsertAt(zl, -1, *(*sds)(node.obj.ptr), node.score)
+		}
+		dictRelease(zs.dict)
+		zslFree(zs.zsl)
+
+		zobj.ptr = unsafe.Pointer(&zl)
+		zobj.encoding = REDIS_ENCODING_ZIPLIST
+	default:
+		panic(errors.New("Unknown sorted set encoding"))
+	}
+}
+
+// 跳跃表编码的有序集合元素数量和成员长度都在压缩列表编码的限制内时，转换为压缩列表编码
+// maxelelen 为最长成员的长度，totelelen 为所有成员的长度之和
+func zsetConvertToZiplistIfNeeded(zobj *redisObject, maxelelen int, totelelen int) {
+	if zobj.encoding == REDIS_ENCODING_ZIPLIST {
+		return
+	}
+	zs := zsetTypeZset(zobj)
+	// 压缩列表的大小需要保持在安全范围内
+	if zs.zsl.length <= zset_max_ziplist_entries &&
+		maxelelen <= zset_max_ziplist_value &&
+		totelelen < math.MaxUint32/2 {
+		zsetConvert(zobj, REDIS_ENCODING_ZIPLIST)
+	}
+}
+
+// 返回成员 member 的分值，成员不存在时 ok 为false
+func zsetScore(zobj *redisObject, member sds) (score float64, ok bool) {
+	switch zobj.encoding {
+	case REDIS_ENCODING_ZIPLIST:
+		eptr, score := zzlFind(*zsetTypeZiplist(zobj), member)
+		return score, eptr != -1
+	case REDIS_ENCODING_SKIPLIST:
+		obj := initStaticStringObject(member)
+		de := dictFind(zsetTypeZset(zobj).dict, &obj)
+		if de == nil {
+			return 0, false
+		}
+		return dictGetVal(de), true
+	default:
+		panic(errors.New("Unknown sorted set encoding"))
+	}
+}
+
+// 添加成员或者更新成员的分值
+//
+// inFlags 为 ZADD_IN_* 标志的组合：
+//   - ZADD_IN_INCR：将 score 加到成员原有的分值上，成员不存在时视为原有分值为0
+//   - ZADD_IN_NX：成员已存在时不执行操作
+//   - ZADD_IN_XX：成员不存在时不执行操作
+//   - ZADD_IN_GT、ZADD_IN_LT：新分值不大于（不小于）原有分值时不执行操作，不影响新成员的添加
+//
+// outFlags 为 ZADD_OUT_* 标志的组合，表示执行的结果；
+// 添加或更新成功时 newscore 为成员的新分值。
+// 分值为 NaN（或者增加后的分值为 NaN）时 ok 为false，此时不会执行任何操作，其他情况 ok 都为true
+func zsetAdd(zobj *redisObject, score float64, ele sds, inFlags int) (outFlags int, newscore float64, ok bool) {
+	incr := inFlags&ZADD_IN_INCR != 0
+	nx := inFlags&ZADD_IN_NX != 0
+	xx := inFlags&ZADD_IN_XX != 0
+	gt := inFlags&ZADD_IN_GT != 0
+	lt := inFlags&ZADD_IN_LT != 0
+
+	if math.IsNaN(score) {
+		return ZADD_OUT_NAN, 0, false
+	}
+
+	if zobj.encoding == REDIS_ENCODING_ZIPLIST {
+		zlp := zsetTypeZiplist(zobj)
+		if eptr, curscore := zzlFind(*zlp, ele); eptr != -1 {
+			// 成员已存在
+			if nx {
+				return ZADD_OUT_NOP, 0, true
+			}
+			if incr {
+				score += curscore
+				if math.IsNaN(score) {
+					return ZADD_OUT_NAN, 0, false
+				}
+			}
+			if (lt && score >= curscore) || (gt && score <= curscore) {
+				return ZADD_OUT_NOP, 0, true
+			}
+			// 分值改变时删除后重新插入，保持有序
+			if score != curscore {
+				*zlp = zzlDelete(*zlp, eptr)
+				*zlp = zzlInsert(*zlp, ele, score)
+				outFlags |= ZADD_OUT_UPDATED
+			}
+			return outFlags, score, true
+		} else if !xx {
+			// 添加后超出压缩列表编码的限制时，先转换为跳跃表编码再添加
+			if zzlLength(*zlp)+1 > zset_max_ziplist_entries || sdsLen(ele) > zset_max_ziplist_value {
+				zsetConvert(zobj, REDIS_ENCODING_SKIPLIST)
+			} else {
+				*zlp = zzlInsert(*zlp, ele, score)
+				return ZADD_OUT_ADDED, score, true
+			}
+		} else {
+			return ZADD_OUT_NOP, 0, true
+		}
+	}
+
+	if zobj.encoding != REDIS_ENCODING_SKIPLIST {
+		panic(errors.New("Unknown sorted set encoding"))
+	}
+	zs := zsetTypeZset(zobj)
+	obj := initStaticStringObject(ele)
+	if de := dictFind(zs.dict, &obj); de != nil {
+		// 成员已存在
+		if nx {
+			return ZADD_OUT_NOP, 0, true
+		}
+		curscore := dictGetVal(de)
+		if incr {
+			score += curscore
+			if math.IsNaN(score) {
+				return ZADD_OUT_NAN, 0, false
+			}
+		}
+		if (lt && score >= curscore) || (gt && score <= curscore) {
+			return ZADD_OUT_NOP, 0, true
+		}
+		if score != curscore {
+			zslUpdateScore(zs.zsl, curscore, dictGetKey(de), score)
+			zs.dict.dictSetVal(de, score)
+			outFlags |= ZADD_OUT_UPDATED
+		}
+		return outFlags, score, true
+	} else if !xx {
+		node := zslInsert(zs.zsl, score, createRawStringObject(sdsDup(ele)))
+		if zs.dict.dictAdd(node.obj, score) != DICT_OK {
+			panic(errors.New("zsetAdd failed to add element to dict"))
+		}
+		return ZADD_OUT_ADDED, score, true
+	}
+	return ZADD_OUT_NOP, 0, true
+}
+
+// ZADD 命令的实现，将 scores 和 eles 中对应的元素依次添加到有序集合中
+//
+// flags 为 ZADD_IN_* 标志的组合，选项不兼容时返回错误并且不执行任何操作。
+// 没有 ZADD_IN_INCR 时 reply 为添加的成员数量，带有 ZADD_IN_CH 时还包括分值被更新的成员数量；
+// 带有 ZADD_IN_INCR 时只能有一个元素，执行了增加时 reply 为1并返回成员的新分值，
+// 因为 NX、XX、GT、LT 没有执行时 reply 为0，对应 ZADD 返回的空回复。
+// 与 Redis 解析参数时相同，任何一个分值为 NaN 时返回错误，不修改有序集合；
+// 带有 ZADD_IN_INCR 时相加的结果为 NaN 同样返回错误，不修改成员的分值
+func zaddGeneric(zobj *redisObject, flags int, scores []float64, eles []sds) (reply int, score float64, err error) {
+	incr := flags&ZADD_IN_INCR != 0
+	nx := flags&ZADD_IN_NX != 0
+	xx := flags&ZADD_IN_XX != 0
+	gt := flags&ZADD_IN_GT != 0
+	lt := flags&ZADD_IN_LT != 0
+	ch := flags&ZADD_IN_CH != 0
+
+	if len(scores) != len(eles) {
+		panic(errors.New("zaddGeneric scores and elements mismatch"))
+	}
+	if nx && xx {
+		return 0, 0, errZaddNXXX
+	}
+	if (gt && nx) || (lt && nx) || (gt && lt) {
+		return 0, 0, errZaddGTLTNX
+	}
+	if incr && len(eles) > 1 {
+		return 0, 0, errZaddIncrPairs
+	}
+	// 修改有序集合之前检查所有的分值
+	for _, s := range scores {
+		if math.IsNaN(s) {
+			return 0, 0, errNotFloat
+		}
+	}
+
+	added, updated, processed := 0, 0, 0
+	for j := range eles {
+		outFlags, newscore, ok := zsetAdd(zobj, scores[j], eles[j], flags&^ZADD_IN_CH)
+		if !ok {
+			// 只有 INCR 的结果可能为 NaN，此时只有一个元素
+			return 0, 0, errZaddScoreIsNaN
+		}
+		if outFlags&ZADD_OUT_ADDED != 0 {
+			added++
+		}
+		if outFlags&ZADD_OUT_UPDATED != 0 {
+			updated++
+		}
+		if outFlags&ZADD_OUT_NOP == 0 {
+			processed++
+		}
+		score = newscore
+	}
+
+	if incr {
+		return processed, score, nil
+	}
+	if ch {
+		return added + updated, 0, nil
+	}
+	return added, 0, nil
+}
+
+// 从有序集合中删除成员 ele，成员不存在时返回false
+func zsetDel(zobj *redisObject, ele sds) bool {
+	switch zobj.encoding {
+	case REDIS_ENCODING_ZIPLIST:
+		zlp := zsetTypeZiplist(zobj)
+		if eptr, _ := zzlFind(*zlp, ele); eptr != -1 {
+			*zlp = zzlDelete(*zlp, eptr)
+			return true
+		}
+		return false
+	case REDIS_ENCODING_SKIPLIST:
+		zs := zsetTypeZset(zobj)
+		obj := initStaticStringObject(ele)
+		de := dictFind(zs.dict, &obj)
+		if de == nil {
+			return false
+		}
+		score := dictGetVal(de)
+		// 先从字典中删除，成员对象由跳跃表释放
+		dictDelete(zs.dict, &obj)
+		if zslDelete(zs.zsl, score, &obj) == 0 {
+			panic(errors.New("zsetDel element missing in skiplist"))
+		}
+		return true
+	default:
+		panic(errors.New("Unknown sorted set encoding"))
+	}
+}
+
+// 返回成员 ele 的排位（从0开始），reverse 为true时按分值从大到小排位，成员不存在时返回 -1
+// 对应 ZRANK 和 ZREVRANK 命令
+func zsetRank(zobj *redisObject, ele sds, reverse bool) int {
+	llen := zsetLength(zobj)
+	switch zobj.encoding {
+	case REDIS_ENCODING_ZIPLIST:
+		zl := *zsetTypeZiplist(zobj)
+		eptr := ziplistIndex(zl, 0)
+		sptr := -1
+		if eptr != -1 {
+			sptr = ziplistNext(zl, eptr)
+		}
+		rank := 1
+		for eptr != -1 {
+			if ziplistCompare(zl, eptr, ele) {
+				break
+			}
+			rank++
+			eptr, sptr = zzlNext(zl, eptr, sptr)
+		}
+		if eptr == -1 {
+			return -1
+		}
+		if reverse {
+			return llen - rank
+		}
+		return rank - 1
+	case REDIS_ENCODING_SKIPLIST:
+		zs := zsetTypeZset(zobj)
+		obj := initStaticStringObject(ele)
+		de := dictFind(zs.dict, &obj)
+		if de == nil {
+			return -1
+		}
+		rank := zslGetRank(zs.zsl, dictGetVal(de), &obj)
+		if rank == 0 {
+			panic(errors.New("zsetRank element missing in skiplist"))
+		}
+		if reverse {
+			return llen - rank
+		}
+		return rank - 1
+	default:
+		panic(errors.New("Unknown sorted set encoding"))
+	}
+}
+
+// 范围查询返回的元素，ele 为成员的副本
+type zsetRangeEntry struct {
+	ele   sds
+	score float64
+}
+
+// 返回排位在 [start, end] 之间的元素，对应 ZRANGE 和 ZREVRANGE 命令
+// 索引从0开始，可以为负数，-1 表示最后一个元素；reverse 为true时按分值从大到小排位
+func zsetRangeByRank(zobj *redisObject, start int, end int, reverse bool) []zsetRangeEntry {
+	llen := zsetLength(zobj)
+	if start < 0 {
+		start = llen + start
+	}
+	if end < 0 {
+		end = llen + end
+	}
+	if start < 0 {
+		start = 0
+	}
+	if start > end || start >= llen {
+		return nil
+	}
+	if end >= llen {
+		end = llen - 1
+	}
+	rangelen := end - start + 1
+	result := make([]zsetRangeEntry, 0, rangelen)
+
+	switch zobj.encoding {
+	case REDIS_ENCODING_ZIPLIST:
+		zl := *zsetTypeZiplist(zobj)
+		var eptr int
+		if reverse {
+			eptr = ziplistIndex(zl, -2-2*start)
+		} else {
+			eptr = ziplistIndex(zl, 2*start)
+		}
+		sptr := ziplistNext(zl, eptr)
+		for ; rangelen > 0; rangelen-- {
+			result = append(result, zsetRangeEntry{zzlGetElement(zl, eptr), zzlGetScore(zl, sptr)})
+			if reverse {
+				eptr, sptr = zzlPrev(zl, eptr, sptr)
+			} else {
+				eptr, sptr = zzlNext(zl, eptr, sptr)
+			}
+		}
+	case REDIS_ENCODING_SKIPLIST:
+		zsl := zsetTypeZset(zobj).zsl
+		var ln *zskiplistNode
+		// 通过排位直接定位到第一个元素
+		if reverse {
+			ln = zsl.tail
+			if start > 0 {
+				ln = zslGetElementByRank(zsl, llen-start)
+			}
+		} else {
+			ln = zsl.header.level[0].forward
+			if start > 0 {
+				ln = zslGetElementByRank(zsl, start+1)
+			}
+		}
+		for ; rangelen > 0; rangelen-- {
+			result = append(result, zsetRangeEntry{sdsDup(*(*sds)(ln.obj.ptr)), ln.score})
+			if reverse {
+				ln = ln.backward
+			} else {
+				ln = ln.level[0].forward
+			}
+		}
+	default:
+		panic(errors.New("Unknown sorted set encoding"))
+	}
+	return result
+}
+
+// 返回分值在范围 rge 内的元素，对应 ZRANGEBYSCORE 和 ZREVRANGEBYSCORE 命令
+// reverse 为true时按分值从大到小返回；跳过前 offset 个元素，最多返回 limit 个元素，limit 为负数时不限制，
+// 与 Redis 相同，offset 为负数时结果为空
+func zsetRangeByScore(zobj *redisObject, rge *zrangespec, reverse bool, offset int, limit int) []zsetRangeEntry {
+	var result []zsetRangeEntry
+	if offset < 0 {
+		return nil
+	}
+	switch zobj.encoding {
+	case REDIS_ENCODING_ZIPLIST:
+		zl := *zsetTypeZiplist(zobj)
+		var eptr, sptr int
+		if reverse {
+			eptr = zzlLastInRange(zl, rge)
+		} else {
+			eptr = zzlFirstInRange(zl, rge)
+		}
+		if eptr == -1 {
+			return nil
+		}
+		sptr = ziplistNext(zl, eptr)
+
+		next := func() {
+			if reverse {
+				eptr, sptr = zzlPrev(zl, eptr, sptr)
+			} else {
+				eptr, sptr = zzlNext(zl, eptr, sptr)
+			}
+		}
+		for ; eptr != -1 && offset > 0; offset-- {
+			next()
+		}
+		for ; eptr != -1 && limit != 0; limit-- {
+			score := zzlGetScore(zl, sptr)
+			// 超出范围的另一端时结束
+			if reverse {
+				if zslValueGteMin(score, rge) == 0 {
+					break
+				}
+			} else {
+				if zslValueLteMax(score, rge) == 0 {
+					break
+				}
+			}
+			result = append(result, zsetRangeEntry{zzlGetElement(zl, eptr), score})
+			next()
+		}
+	case REDIS_ENCODING_SKIPLIST:
+		zsl := zsetTypeZset(zobj).zsl
+		var ln *zskiplistNode
+		if reverse {
+			ln = zslLastInRange(zsl, rge)
+		} else {
+			ln = zslFirstInRange(zsl, rge)
+		}
+
+		next := func() {
+			if reverse {
+				ln = ln.backward
+			} else {
+				ln = ln.level[0].forward
+			}
+		}
+		for ; ln != nil && offset > 0; offset-- {
+			next()
+		}
+		for ; ln != nil && limit != 0; limit-- {
+			if reverse {
+				if zslValueGteMin(ln.score, rge) == 0 {
+					break
+				}
+			} else {
+				if zslValueLteMax(ln.score, rge) == 0 {
+					break
+				}
+			}
+			result = append(result, zsetRangeEntry{sdsDup(*(*sds)(ln.obj.ptr)), ln.score})
+			next()
+		}
+	default:
+		panic(errors.New("Unknown sorted set encoding"))
+	}
+	return result
+}
+
+// 返回成员在字典序范围 rge 内的元素，对应 ZRANGEBYLEX 和 ZREVRANGEBYLEX 命令
+// 只有所有元素的分值都相同时结果才有意义；offset 和 limit 与 zsetRangeByScore 相同
+func zsetRangeByLex(zobj *redisObject, rge *zlexrangespec, reverse bool, offset int, limit int) []zsetRangeEntry {
+	var result []zsetRangeEntry
+	if offset < 0 {
+		return nil
+	}
+	switch zobj.encoding {
+	case REDIS_ENCODING_ZIPLIST:
+		zl := *zsetTypeZiplist(zobj)
+		var eptr, sptr int
+		if reverse {
+			eptr = zzlLastInLexRange(zl, rge)
+		} else {
+			eptr = zzlFirstInLexRange(zl, rge)
+		}
+		if eptr == -1 {
+			return nil
+		}
+		sptr = ziplistNext(zl, eptr)
+
+		next := func() {
+			if reverse {
+				eptr, sptr = zzlPrev(zl, eptr, sptr)
+			} else {
+				eptr, sptr = zzlNext(zl, eptr, sptr)
+			}
+		}
+		for ; eptr != -1 && offset > 0; offset-- {
+			next()
+		}
+		for ; eptr != -1 && limit != 0; limit-- {
+			if reverse {
+				if !zzlLexValueGteMin(zl, eptr, rge) {
+					break
+				}
+			} else {
+				if !zzlLexValueLteMax(zl, eptr, rge) {
+					break
+				}
+			}
+			result = append(result, zsetRangeEntry{zzlGetElement(zl, eptr), zzlGetScore(zl, sptr)})
+			next()
+		}
+	case REDIS_ENCODING_SKIPLIST:
+		zsl := zsetTypeZset(zobj).zsl
+		var ln *zskiplistNode
+		if reverse {
+			ln = zslLastInLexRange(zsl, rge)
+		} else {
+			ln = zslFirstInLexRange(zsl, rge)
+		}
+
+		next := func() {
+			if reverse {
+				ln = ln.backward
+			} else {
+				ln = ln.level[0].forward
+			}
+		}
+		for ; ln != nil && offset > 0; offset-- {
+			next()
+		}
+		for ; ln != nil && limit != 0; limit-- {
+			if reverse {
+				if !zslLexValueGteMin(ln.obj, rge) {
+					break
+				}
+			} else {
+				if !zslLexValueLteMax(ln.obj, rge) {
+					break
+				}
+			}
+			result = append(result, zsetRangeEntry{sdsDup(*(*sds)(ln.obj.ptr)), ln.score})
+			next()
+		}
+	default:
+		panic(errors.New("Unknown sorted set encoding"))
+	}
+	return result
+}
+
+// 返回分值在范围 rge 内的元素数量，对应 ZCOUNT 命令
+func zsetCount(zobj *redisObject, rge *zrangespec) int {
+	count := 0
+	switch zobj.encoding {
+	case REDIS_ENCODING_ZIPLIST:
+		zl := *zsetTypeZiplist(zobj)
+		eptr := zzlFirstInRange(zl, rge)
+		if eptr == -1 {
+			return 0
+		}
+		sptr := ziplistNext(zl, eptr)
+		for eptr != -1 {
+			if zslValueLteMax(zzlGetScore(zl, sptr), rge) == 0 {
+				break
+			}
+			count++
+			eptr, sptr = zzlNext(zl, eptr, sptr)
+		}
+	case REDIS_ENCODING_SKIPLIST:
+		zsl := zsetTypeZset(zobj).zsl
+		// 通过第一个和最后一个节点的排位计算数量
+		zn := zslFirstInRange(zsl, rge)
+		if zn != nil {
+			rank := zslGetRank(zsl, zn.score, zn.obj)
+			count = zsl.length - (rank - 1)
+			zn = zslLastInRange(zsl, rge)
+			if zn != nil {
+				rank = zslGetRank(zsl, zn.score, zn.obj)
+				count -= zsl.length - rank
+			}
+		}
+	default:
+		panic(errors.New("Unknown sorted set encoding"))
+	}
+	return count
+}
+
+// 返回成员在字典序范围 rge 内的元素数量，对应 ZLEXCOUNT 命令
+func zsetLexCount(zobj *redisObject, rge *zlexrangespec) int {
+	count := 0
+	switch zobj.encoding {
+	case REDIS_ENCODING_ZIPLIST:
+		zl := *zsetTypeZiplist(zobj)
+		eptr := zzlFirstInLexRange(zl, rge)
+		if eptr == -1 {
+			return 0
+		}
+		sptr := ziplistNext(zl, eptr)
+		for eptr != -1 {
+			if !zzlLexValueLteMax(zl, eptr, rge) {
+				break
+			}
+			count++
+			eptr, sptr = zzlNext(zl, eptr, sptr)
+		}
+	case REDIS_ENCODING_SKIPLIST:
+		zsl := zsetTypeZset(zobj).zsl
+		zn := zslFirstInLexRange(zsl, rge)
+		if zn != nil {
+			rank := zslGetRank(zsl, zn.score, zn.obj)
+			count = zsl.length - (rank - 1)
+			zn = zslLastInLexRange(zsl, rge)
+			if zn != nil {
+				rank = zslGetRank(zsl, zn.score, zn.obj)
+				count -= zsl.length - rank
+			}
+		}
+	default:
+		panic(errors.New("Unknown sorted set encoding"))
+	}
+	return count
+}
+
+// 删除分值在范围内的所有元素，返回删除的元素数量
+// 有序集合变为空时，调用者应当删除对应的键
+func zsetDeleteRangeByScore(zobj *redisObject, rge *zrangespec) int {
+	switch zobj.encoding {
+	case REDIS_ENCODING_ZIPLIST:
+		zlp := zsetTypeZiplist(zobj)
+		var deleted int
+		*zlp, deleted = zzlDeleteRangeByScore(*zlp, rge)
+		return deleted
+	case REDIS_ENCODING_SKIPLIST:
+		zs := zsetTypeZset(zobj)
+		return zslDeleteRangeByScore(zs.zsl, rge, zs.dict)
+	default:
+		panic(errors.New("Unknown sorted set encoding"))
+	}
+}
+
+// ZRANGEBYSCORE 和 ZREVRANGEBYSCORE 命令
+//
+// zobj 为键对应的对象，键不存在时为nil；argv 为键之后的参数：min max [WITHSCORES] [LIMIT offset count]，
+// reverse 为true时前两个参数的顺序为 max min。
+// 返回范围内的元素以及是否带有 WITHSCORES 选项
+func genericZrangebyscore(zobj *redisObject, argv []*redisObject, reverse bool) ([]zsetRangeEntry, bool, error) {
+	if len(argv) < 2 {
+		return nil, false, errSyntax
+	}
+	minidx, maxidx := 0, 1
+	if reverse {
+		minidx, maxidx = 1, 0
+	}
+
+	var rge zrangespec
+	if err := zslParseRange(argv[minidx], argv[maxidx], &rge); err != nil {
+		return nil, false, err
+	}
+
+	// 解析可选参数
+	withscores := false
+	offset, limit := 0, -1
+	isOption := func(o *redisObject, name string) bool {
+		return sdsEncodedObject(o) && strings.EqualFold(string(*(*sds)(o.ptr)), name)
+	}
+	for pos := 2; pos < len(argv); {
+		remaining := len(argv) - pos
+		if isOption(argv[pos], "withscores") {
+			withscores = true
+			pos++
+		} else if remaining >= 3 && isOption(argv[pos], "limit") {
+			o, ok1 := getLongLongFromObject(argv[pos+1])
+			l, ok2 := getLongLongFromObject(argv[pos+2])
+			if !ok1 || !ok2 {
+				return nil, false, errNotInteger
+			}
+			offset, limit = int(o), int(l)
+			pos += 3
+		} else {
+			return nil, false, errSyntax
+		}
+	}
+
+	if zobj == nil {
+		return nil, withscores, nil
+	}
+	if zobj.rtype != REDIS_ZSET {
+		return nil, false, errWrongType
+	}
+	return zsetRangeByScore(zobj, &rge, reverse, offset, limit), withscores, nil
+}
+
+// ZCOUNT 命令，返回分值在 min 和 max 之间的元素数量，键不存在时 zobj 为nil
+func zcount(zobj *redisObject, min *redisObject, max *redisObject) (int, error) {
+	var rge zrangespec
+	if err := zslParseRange(min, max, &rge); err != nil {
+		return 0, err
+	}
+	if zobj == nil {
+		return 0, nil
+	}
+	if zobj.rtype != REDIS_ZSET {
+		return 0, errWrongType
+	}
+	return zsetCount(zobj, &rge), nil
+}
+
+// ZREMRANGEBYSCORE 命令，删除分值在 min 和 max 之间的元素，返回删除的数量，键不存在时 zobj 为nil
+// 有序集合变为空时，调用者应当删除对应的键
+func zremrangebyscore(zobj *redisObject, min *redisObject, max *redisObject) (int, error) {
+	var rge zrangespec
+	if err := zslParseRange(min, max, &rge); err != nil {
+		return 0, err
+	}
+	if zobj == nil {
+		return 0, nil
+	}
+	if zobj.rtype != REDIS_ZSET {
+		return 0, errWrongType
+	}
+	return zsetDeleteRangeByScore(zobj, &rge), nil
+}
+
+// 删除成员在字典序范围内的所有元素，返回删除的元素数量，对应 ZREMRANGEBYLEX 命令
+// 有序集合变为空时，调用者应当删除对应的键
+func zsetDeleteRangeByLex(zobj *redisObject, rge *zlexrangespec) int {
+	switch zobj.encoding {
+	case REDIS_ENCODING_ZIPLIST:
+		zlp := zsetTypeZiplist(zobj)
+		var deleted int
+		*zlp, deleted = zzlDeleteRangeByLex(*zlp, rge)
+		return deleted
+	case REDIS_ENCODING_SKIPLIST:
+		zs := zsetTypeZset(zobj)
+		return zslDeleteRangeByLex(zs.zsl, rge, zs.dict)
+	default:
+		panic(errors.New("Unknown sorted set encoding"))
+	}
+}
+
+// 相等返回1 否则返回0
+func equalStringObjects(a *redisObject, b *redisObject) int {
+	if a.encoding == REDIS_ENCODING_INT &&
+		b.encoding == REDIS_ENCODING_INT {
+		// 两个整数编码的对象直接比较整数值
+		if *(*int64)(a.ptr) == *(*int64)(b.ptr) {
+			return 1
+		}
+		return 0
+	} else {
+		if compareStringObjects(a, b) == 0 {
+			return 1
+		}
+		return 0
+	}
+}
+
+/*-----------------------------------------------------------------------------
+ * 有序集合运算：ZUNIONSTORE、ZINTERSTORE、ZDIFFSTORE 等
+ *----------------------------------------------------------------------------*/
+
+// 集合运算的类型
+const (
+	SET_OP_UNION = iota
+	SET_OP_DIFF
+	SET_OP_INTER
+)
+
+// 同一个成员在多个输入中出现时分值的聚合方式
+const (
+	REDIS_AGGR_SUM = iota + 1
+	REDIS_AGGR_MIN
+	REDIS_AGGR_MAX
+)
+
+// zsetopval 中的 ele 由迭代器分配，需要在之后释放
+const OPVAL_DIRTY_SDS = 1 << 0
+
+// 参与运算的一个输入，可以是集合对象或者有序集合对象
+// subject 为nil表示键不存在，视为空集合
+type zsetopsrc struct {
+	subject *redisObject
+	weight  float64
+
+	// 整数集合编码的集合的迭代位置
+	ii int
+	// 哈希表编码的集合的迭代器
+	di *dictIterator[interface{}, interface{}]
+	// 压缩列表编码的有序集合的迭代位置
+	eptr, sptr int
+	// 跳跃表编码的有序集合的迭代位置
+	node *zskiplistNode
+}
+
+// 迭代输入时得到的元素，集合中元素的分值为1
+type zsetopval struct {
+	flags int
+	ele   sds
+	score float64
+}
+
+// 释放 val 中由迭代器分配的成员
+func zuiClearValue(val *zsetopval) {
+	if val.flags&OPVAL_DIRTY_SDS != 0 {
+		sdsFree(val.ele)
+	}
+	*val = zsetopval{}
+}
+
+// 初始化输入的迭代器
+func zuiInitIterator(op *zsetopsrc) {
+	if op.subject == nil {
+		return
+	}
+	switch op.subject.rtype {
+	case REDIS_SET:
+		switch op.subject.encoding {
+		case REDIS_ENCODING_INTSET:
+			op.ii = 0
+		case REDIS_ENCODING_HT:
+			// 迭代期间可能会查找同一个集合，使用安全迭代器避免 rehash
+			op.di = dictGetSafeIterator((*dict)(op.subject.ptr))
+		default:
+			panic(errors.New("Unknown set encoding"))
+		}
+	case REDIS_ZSET:
+		switch op.subject.encoding {
+		case REDIS_ENCODING_ZIPLIST:
+			zl := *zsetTypeZiplist(op.subject)
+			op.eptr = ziplistIndex(zl, 0)
+			op.sptr = -1
+			if op.eptr != -1 {
+				op.sptr = ziplistNext(zl, op.eptr)
+			}
+		case REDIS_ENCODING_SKIPLIST:
+			op.node = zsetTypeZset(op.subject).zsl.header.level[0].forward
+		default:
+			panic(errors.New("Unknown sorted set encoding"))
+		}
+	default:
+		panic(errors.New("Unsupported type"))
+	}
+}
+
+// 结束输入的迭代
+func zuiClearIterator(op *zsetopsrc) {
+	if op.di != nil {
+		dictReleaseIterator(op.di)
+		op.di = nil
+	}
+	op.node = nil
+}
+
+// 返回输入的元素数量
+func zuiLength(op *zsetopsrc) int {
+	if op.subject == nil {
+		return 0
+	}
+	switch op.subject.rtype {
+	case REDIS_SET:
+		return setTypeSize(op.subject)
+	case REDIS_ZSET:
+		return zsetLength(op.subject)
+	default:
+		panic(errors.New("Unsupported type"))
+	}
+}
+
+// 将输入的下一个元素保存到 val 中，没有更多元素时返回false
+// 上一次得到的元素会被释放
+func zuiNext(op *zsetopsrc, val *zsetopval) bool {
+	if op.subject == nil {
+		return false
+	}
+	zuiClearValue(val)
+
+	switch op.subject.rtype {
+	case REDIS_SET:
+		val.score = 1.0
+		switch op.subject.encoding {
+		case REDIS_ENCODING_INTSET:
+			llval, ok := intsetGet(*setTypeIntset(op.subject), op.ii)
+			if !ok {
+				return false
+			}
+			val.ele = sdsFromInt(int(llval))
+			val.flags |= OPVAL_DIRTY_SDS
+			op.ii++
+		case REDIS_ENCODING_HT:
+			de := dictNext(op.di)
+			if de == nil {
+				return false
+			}
+			val.ele = dictGetKey(de).(sds)
+		default:
+			panic(errors.New("Unknown set encoding"))
+		}
+	case REDIS_ZSET:
+		switch op.subject.encoding {
+		case REDIS_ENCODING_ZIPLIST:
+			if op.eptr == -1 {
+				return false
+			}
+			zl := *zsetTypeZiplist(op.subject)
+			val.ele = zzlGetElement(zl, op.eptr)
+			val.flags |= OPVAL_DIRTY_SDS
+			val.score = zzlGetScore(zl, op.sptr)
+			op.eptr, op.sptr = zzlNext(zl, op.eptr, op.sptr)
+		case REDIS_ENCODING_SKIPLIST:
+			if op.node == nil {
+				return false
+			}
+			val.ele = *(*sds)(op.node.obj.ptr)
+			val.score = op.node.score
+			op.node = op.node.level[0].forward
+		default:
+			panic(errors.New("Unknown sorted set encoding"))
+		}
+	default:
+		panic(errors.New("Unsupported type"))
+	}
+	return true
+}
+
+// 返回一个保存 val 中成员的 sds，由迭代器分配的成员直接转移给调用者
+func zuiNewSdsFromValue(val *zsetopval) sds {
+	if val.flags&OPVAL_DIRTY_SDS != 0 {
+		val.flags &^= OPVAL_DIRTY_SDS
+		return val.ele
+	}
+	return sdsDup(val.ele)
+}
+
+// 在输入中查找 val 中的成员，返回成员的分值（集合中的成员分值为1）
+func zuiFind(op *zsetopsrc, val *zsetopval) (float64, bool) {
+	if op.subject == nil {
+		return 0, false
+	}
+	switch op.subject.rtype {
+	case REDIS_SET:
+		if setTypeIsMember(op.subject, val.ele) {
+			return 1.0, true
+		}
+		return 0, false
+	case REDIS_ZSET:
+		return zsetScore(op.subject, val.ele)
+	default:
+		panic(errors.New("Unsupported type"))
+	}
+}
+
+// 按 aggregate 指定的方式将 val 聚合到 target 中
+func zunionInterAggregate(target *float64, val float64, aggregate int) {
+	switch aggregate {
+	case REDIS_AGGR_SUM:
+		*target = *target + val
+		// inf + -inf 的结果为 NaN，此时使用0
+		if math.IsNaN(*target) {
+			*target = 0.0
+		}
+	case REDIS_AGGR_MIN:
+		if val < *target {
+			*target = val
+		}
+	case REDIS_AGGR_MAX:
+		if val > *target {
+			*target = val
+		}
+	default:
+		panic(errors.New("Unknown ZUNION/INTER aggregate type"))
+	}
+}
+
+// 将成员 ele 和分值插入跳跃表编码的有序集合，zs 拥有 ele
+func zsetopInsert(zs *zset, ele sds, score float64) {
+	node := zslInsert(zs.zsl, score, createRawStringObject(ele))
+	if zs.dict.dictAdd(node.obj, score) != DICT_OK {
+		panic(errors.New("duplicate element in set operation result"))
+	}
+}
+
+// 选择 ZDIFF 使用的算法，返回0表示结果一定为空
+//
+// 算法1遍历第一个输入，在其余的每个输入中查找成员，复杂度为 O(N*K)，N 为第一个输入的大小，K 为输入的数量；
+// 算法2将第一个输入加入结果，再从结果中删除其余输入中的每个成员，复杂度为 O(M)，M 为所有输入的大小之和。
+// 算法1在找到成员后可以提前结束查找，按平均情况将它的工作量减半后比较
+func zsetChooseDiffAlgorithm(src []zsetopsrc) int {
+	algoOneWork, algoTwoWork := 0, 0
+	for j := range src {
+		// 其余的输入与第一个输入相同时，结果为空
+		if j > 0 && src[0].subject == src[j].subject {
+			return 0
+		}
+		algoOneWork += zuiLength(&src[0])
+		algoTwoWork += zuiLength(&src[j])
+	}
+	algoOneWork /= 2
+	if algoOneWork <= algoTwoWork {
+		return 1
+	}
+	return 2
+}
+
+// ZDIFF 算法1，见 zsetChooseDiffAlgorithm
+func zdiffAlgorithm1(src []zsetopsrc, dstzset *zset) {
+	// 先查找元素较多的输入，更可能提前找到成员
+	rest := src[1:]
+	sort.SliceStable(rest, func(a, b int) bool {
+		return zuiLength(&rest[a]) > zuiLength(&rest[b])
+	})
+
+	var zval zsetopval
+	zuiInitIterator(&src[0])
+	for zuiNext(&src[0], &zval) {
+		exists := false
+		for j := 1; j < len(src); j++ {
+			if _, ok := zuiFind(&src[j], &zval); ok {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			zsetopInsert(dstzset, zuiNewSdsFromValue(&zval), zval.score)
+		}
+	}
+	zuiClearValue(&zval)
+	zuiClearIterator(&src[0])
+}
+
+// ZDIFF 算法2，见 zsetChooseDiffAlgorithm
+func zdiffAlgorithm2(src []zsetopsrc, dstzset *zset) {
+	cardinality := 0
+	var zval zsetopval
+	for j := range src {
+		if zuiLength(&src[j]) == 0 {
+			continue
+		}
+
+		zuiInitIterator(&src[j])
+		for zuiNext(&src[j], &zval) {
+			if j == 0 {
+				zsetopInsert(dstzset, zuiNewSdsFromValue(&zval), zval.score)
+				cardinality++
+			} else {
+				obj := initStaticStringObject(zval.ele)
+				if de := dictFind(dstzset.dict, &obj); de != nil {
+					score := dictGetVal(de)
+					dictDelete(dstzset.dict, &obj)
+					zslDelete(dstzset.zsl, score, &obj)
+					cardinality--
+				}
+			}
+			// 结果已经为空，不需要再处理其余的输入
+			if cardinality == 0 {
+				break
+			}
+		}
+		zuiClearValue(&zval)
+		zuiClearIterator(&src[j])
+
+		if cardinality == 0 {
+			break
+		}
+	}
+}
+
+// 计算第一个输入与其余输入的差集，结果保存到 dstzset 中
+func zdiff(src []zsetopsrc, dstzset *zset) {
+	if zuiLength(&src[0]) == 0 {
+		return
+	}
+	switch zsetChooseDiffAlgorithm(src) {
+	case 1:
+		zdiffAlgorithm1(src, dstzset)
+	case 2:
+		zdiffAlgorithm2(src, dstzset)
+	}
+}
+
+// ZUNION、ZINTER、ZDIFF 系列命令的通用实现
+//
+// inputs 为参与运算的集合或有序集合对象，nil 表示键不存在；
+// weights 为每个输入的权重，为nil时权重都为1，只用于并集和交集；
+// 集合中的成员分值视为1，乘以权重后按 aggregate 聚合。
+// cardinalityOnly 为true时只计算交集的大小，不生成结果，limit 大于0时数量达到 limit 后停止计算。
+// 返回跳跃表编码的结果、结果的大小，以及最长成员的长度和所有成员的长度之和
+func zunionInterDiffGeneric(inputs []*redisObject, weights []float64, aggregate int, op int,
+	cardinalityOnly bool, limit int) (dstobj *redisObject, cardinality int, maxelelen int, totelelen int, err error) {
+	if weights != nil && len(weights) != len(inputs) {
+		panic(errors.New("weights and inputs mismatch"))
+	}
+
+	src := make([]zsetopsrc, len(inputs))
+	for i, obj := range inputs {
+		if obj != nil && obj.rtype != REDIS_ZSET && obj.rtype != REDIS_SET {
+			return nil, 0, 0, 0, errWrongType
+		}
+		src[i].subject = obj
+		src[i].weight = 1.0
+		if weights != nil {
+			src[i].weight = weights[i]
+		}
+	}
+
+	// 交集从元素最少的输入开始遍历，可以尽快排除不在交集中的成员
+	if op == SET_OP_INTER {
+		sort.SliceStable(src, func(a, b int) bool {
+			return zuiLength(&src[a]) < zuiLength(&src[b])
+		})
+	}
+
+	if !cardinalityOnly {
+		dstobj = createZsetObject()
+	}
+	var dstzset *zset
+	if dstobj != nil {
+		dstzset = zsetTypeZset(dstobj)
+	}
+
+	var zval zsetopval
+	switch op {
+	case SET_OP_INTER:
+		if zuiLength(&src[0]) == 0 {
+			break
+		}
+		zuiInitIterator(&src[0])
+		for zuiNext(&src[0], &zval) {
+			score := src[0].weight * zval.score
+			if math.IsNaN(score) {
+				score = 0
+			}
+
+			j := 1
+			for ; j < len(src); j++ {
+				// 与上一个输入相同时不需要查找
+				if src[j].subject == src[j-1].subject {
+					zunionInterAggregate(&score, zval.score*src[j].weight, aggregate)
+				} else if value, ok := zuiFind(&src[j], &zval); ok {
+					zunionInterAggregate(&score, value*src[j].weight, aggregate)
+				} else {
+					break
+				}
+			}
+
+			// 成员在所有输入中都存在
+			if j == len(src) {
+				if cardinalityOnly {
+					cardinality++
+					if limit > 0 && cardinality >= limit {
+						break
+					}
+				} else {
+					tmp := zuiNewSdsFromValue(&zval)
+					totelelen += sdsLen(tmp)
+					if sdsLen(tmp) > maxelelen {
+						maxelelen = sdsLen(tmp)
+					}
+					zsetopInsert(dstzset, tmp, score)
+				}
+			}
+		}
+		zuiClearValue(&zval)
+		zuiClearIterator(&src[0])
+	case SET_OP_UNION:
+		// 先在字典中聚合所有成员的分值，再一次性插入跳跃表
+		accumulator := DictCreate(sdsDictType[float64](), nil)
+		for i := range src {
+			if zuiLength(&src[i]) == 0 {
+				continue
+			}
+			zuiInitIterator(&src[i])
+			for zuiNext(&src[i], &zval) {
+				score := src[i].weight * zval.score
+				if math.IsNaN(score) {
+					score = 0
+				}
+
+				if de := dictFind(accumulator, zval.ele); de == nil {
+					tmp := zuiNewSdsFromValue(&zval)
+					totelelen += sdsLen(tmp)
+					if sdsLen(tmp) > maxelelen {
+						maxelelen = sdsLen(tmp)
+					}
+					accumulator.dictAdd(tmp, score)
+				} else {
+					existing := dictGetVal(de)
+					zunionInterAggregate(&existing, score, aggregate)
+					accumulator.dictSetVal(de, existing)
+				}
+			}
+			zuiClearValue(&zval)
+			zuiClearIterator(&src[i])
+		}
+
+		// 字典中的成员转移给结果
+		dstzset.dict.dictExpand(dictSize(accumulator))
+		di := dictGetIterator(accumulator)
+		for de := dictNext(di); de != nil; de = dictNext(di) {
+			zsetopInsert(dstzset, dictGetKey(de), dictGetVal(de))
+		}
+		dictReleaseIterator(di)
+		dictRelease(accumulator)
+	case SET_OP_DIFF:
+		zdiff(src, dstzset)
+		for node := dstzset.zsl.header.level[0].forward; node != nil; node = node.level[0].forward {
+			elelen := sdsLen(*(*sds)(node.obj.ptr))
+			totelelen += elelen
+			if elelen > maxelelen {
+				maxelelen = elelen
+			}
+		}
+	default:
+		panic(errors.New("Unknown operator"))
+	}
+
+	if dstobj != nil {
+		cardinality = zsetLength(dstobj)
+	}
+	return dstobj, cardinality, maxelelen, totelelen, nil
+}
+
+// ZUNIONSTORE、ZINTERSTORE 和 ZDIFFSTORE 命令，返回要保存到目标键的有序集合
+// 结果为空时返回nil，表示删除目标键；结果较小时转换为压缩列表编码
+func zunionInterDiffStore(inputs []*redisObject, weights []float64, aggregate int, op int) (*redisObject, error) {
+	dstobj, cardinality, maxelelen, totelelen, err := zunionInterDiffGeneric(inputs, weights, aggregate, op, false, 0)
+	if err != nil {
+		return nil, err
+	}
+	if cardinality == 0 {
+		decrRefCount(dstobj)
+		return nil, nil
+	}
+	zsetConvertToZiplistIfNeeded(dstobj, maxelelen, totelelen)
+	return dstobj, nil
+}
+
+// ZUNION、ZINTER 和 ZDIFF 命令，按分值从小到大返回运算结果
+func zunionInterDiff(inputs []*redisObject, weights []float64, aggregate int, op int) ([]zsetRangeEntry, error) {
+	dstobj, _, _, _, err := zunionInterDiffGeneric(inputs, weights, aggregate, op, false, 0)
+	if err != nil {
+		return nil, err
+	}
+	result := zsetRangeByRank(dstobj, 0, -1, false)
+	decrRefCount(dstobj)
+	return result, nil
+}
+
+// ZINTERCARD 命令，返回交集的大小，limit 大于0时最多计算到 limit
+func zinterCard(inputs []*redisObject, limit int) (int, error) {
+	if limit < 0 {
+		return 0, errZinterCardLimit
+	}
+	_, cardinality, _, _, err := zunionInterDiffGeneric(inputs, nil, REDIS_AGGR_SUM, SET_OP_INTER, true, limit)
+	return cardinality, err
+}
+
+// ZRANGESTORE 命令，将范围查询的结果保存为新的有序集合
+// 结果为空时返回nil，表示删除目标键
+// entries 中的成员由这里释放，zsetAdd 会复制需要保存的成员
+func zrangeStore(entries []zsetRangeEntry) *redisObject {
+	if len(entries) == 0 {
+		return nil
+	}
+	dstobj := zsetTypeCreate(len(entries), 0)
+	for _, e := range entries {
+		zsetAdd(dstobj, e.score, e.ele, ZADD_IN_NONE)
+		sdsFree(e.ele)
 	}
+	return dstobj
 }
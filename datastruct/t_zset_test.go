@@ -0,0 +1,887 @@
+package datastruct
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+// 检查跳跃表的结构：有序、backward 指针、span 和 length 都正确
+func checkSkiplist(t *testing.T, zsl *zskiplist) {
+	t.Helper()
+	n := 0
+	var prev *zskiplistNode
+	for x := zsl.header.level[0].forward; x != nil; x = x.level[0].forward {
+		n++
+		if x.backward != prev {
+			t.Fatalf("node %d backward mismatch", n)
+		}
+		if prev != nil && (prev.score > x.score ||
+			(prev.score == x.score && compareStringObjects(prev.obj, x.obj) >= 0)) {
+			t.Fatalf("node %d out of order", n)
+		}
+		prev = x
+	}
+	if n != zsl.length || zsl.tail != prev {
+		t.Fatalf("length %d, counted %d", zsl.length, n)
+	}
+	for i := 0; i < zsl.level; i++ {
+		rank := 0
+		for x := zsl.header; x.level[i].forward != nil; x = x.level[i].forward {
+			rank += x.level[i].span
+			if zslGetElementByRank(zsl, rank) != x.level[i].forward {
+				t.Fatalf("level %d span mismatch at rank %d", i, rank)
+			}
+		}
+	}
+}
+
+func zsetEntries(entries []zsetRangeEntry) []string {
+	res := make([]string, 0, len(entries))
+	for _, e := range entries {
+		s, _ := d2string(e.score)
+		res = append(res, string(e.ele)+":"+s)
+	}
+	return res
+}
+
+func assertEntries(t *testing.T, what string, got []zsetRangeEntry, want ...string) {
+	t.Helper()
+	g := zsetEntries(got)
+	if len(g) != len(want) {
+		t.Fatalf("%s: got %v, want %v", what, g, want)
+	}
+	for i := range g {
+		if g[i] != want[i] {
+			t.Fatalf("%s: got %v, want %v", what, g, want)
+		}
+	}
+}
+
+func TestZslInsertDelete(t *testing.T) {
+	checkObjectLeaks(t)
+	zsl := zslCreate()
+	for i := 0; i < 500; i++ {
+		zslInsert(zsl, float64(i%50), createRawStringObject(sdsFromInt(i)))
+	}
+	checkSkiplist(t, zsl)
+
+	for i := 0; i < 500; i += 2 {
+		obj := initStaticStringObject(sdsFromInt(i))
+		if zslDelete(zsl, float64(i%50), &obj) != 1 {
+			t.Fatalf("delete %d", i)
+		}
+		if zslDelete(zsl, float64(i%50), &obj) != 0 {
+			t.Fatalf("delete %d twice", i)
+		}
+	}
+	checkSkiplist(t, zsl)
+	if zsl.length != 250 {
+		t.Fatalf("length %d", zsl.length)
+	}
+
+	obj := initStaticStringObject(sdsNew("1"))
+	if rank := zslGetRank(zsl, 1, &obj); rank != 1 {
+		t.Fatalf("rank %d", rank)
+	}
+	node := zslUpdateScore(zsl, 1, &obj, 100)
+	if node.score != 100 || zsl.tail != node || zslGetRank(zsl, 100, &obj) != 250 {
+		t.Fatal("update score")
+	}
+	checkSkiplist(t, zsl)
+	zslFree(zsl)
+}
+
+func testZsetBasic(t *testing.T, zobj *redisObject) {
+	add := func(score float64, ele string) {
+		t.Helper()
+		if out, _, ok := zsetAdd(zobj, score, sdsNew(ele), ZADD_IN_NONE); !ok || out != ZADD_OUT_ADDED {
+			t.Fatalf("add %s: %d", ele, out)
+		}
+	}
+	add(3, "c")
+	add(1, "a")
+	add(2, "b")
+	add(2, "bb")
+	add(-1.5, "z")
+
+	if zsetLength(zobj) != 5 {
+		t.Fatalf("length %d", zsetLength(zobj))
+	}
+	if s, ok := zsetScore(zobj, sdsNew("bb")); !ok || s != 2 {
+		t.Fatalf("score %v %v", s, ok)
+	}
+	if _, ok := zsetScore(zobj, sdsNew("x")); ok {
+		t.Fatal("score of missing member")
+	}
+	if r := zsetRank(zobj, sdsNew("b"), false); r != 2 {
+		t.Fatalf("rank %d", r)
+	}
+	if r := zsetRank(zobj, sdsNew("b"), true); r != 2 {
+		t.Fatalf("rev rank %d", r)
+	}
+	if r := zsetRank(zobj, sdsNew("z"), true); r != 4 {
+		t.Fatalf("rev rank %d", r)
+	}
+	if r := zsetRank(zobj, sdsNew("x"), false); r != -1 {
+		t.Fatalf("rank of missing member %d", r)
+	}
+
+	assertEntries(t, "range", zsetRangeByRank(zobj, 0, -1, false), "z:-1.5", "a:1", "b:2", "bb:2", "c:3")
+	assertEntries(t, "revrange", zsetRangeByRank(zobj, 1, 2, true), "bb:2", "b:2")
+	assertEntries(t, "range clamp", zsetRangeByRank(zobj, -100, 1, false), "z:-1.5", "a:1")
+	assertEntries(t, "range empty", zsetRangeByRank(zobj, 3, 1, false))
+	assertEntries(t, "range out", zsetRangeByRank(zobj, 5, 10, false))
+
+	rge := &zrangespec{min: 1, max: 3, maxex: 1}
+	assertEntries(t, "rangebyscore", zsetRangeByScore(zobj, rge, false, 0, -1), "a:1", "b:2", "bb:2")
+	assertEntries(t, "revrangebyscore", zsetRangeByScore(zobj, rge, true, 0, -1), "bb:2", "b:2", "a:1")
+	assertEntries(t, "rangebyscore limit", zsetRangeByScore(zobj, rge, false, 1, 1), "b:2")
+	assertEntries(t, "revrangebyscore limit", zsetRangeByScore(zobj, rge, true, 2, 5), "a:1")
+	assertEntries(t, "rangebyscore offset", zsetRangeByScore(zobj, rge, false, 10, -1))
+	all := &zrangespec{min: math.Inf(-1), max: math.Inf(1)}
+	assertEntries(t, "rangebyscore inf", zsetRangeByScore(zobj, all, true, 0, 2), "c:3", "bb:2")
+	if n := zsetCount(zobj, rge); n != 3 {
+		t.Fatalf("count %d", n)
+	}
+	if n := zsetCount(zobj, &zrangespec{min: 2, max: 2}); n != 2 {
+		t.Fatalf("count %d", n)
+	}
+	if n := zsetCount(zobj, &zrangespec{min: 2, max: 2, minex: 1}); n != 0 {
+		t.Fatalf("count empty range %d", n)
+	}
+	if n := zsetCount(zobj, &zrangespec{min: 4, max: 10}); n != 0 {
+		t.Fatalf("count %d", n)
+	}
+
+	if !zsetDel(zobj, sdsNew("a")) || zsetDel(zobj, sdsNew("a")) {
+		t.Fatal("del")
+	}
+	assertEntries(t, "range after del", zsetRangeByRank(zobj, 0, -1, false), "z:-1.5", "b:2", "bb:2", "c:3")
+}
+
+func TestZsetBasicZiplist(t *testing.T) {
+	checkObjectLeaks(t)
+	zobj := zsetTypeCreate(0, 0)
+	if zobj.encoding != REDIS_ENCODING_ZIPLIST {
+		t.Fatalf("encoding %d", zobj.encoding)
+	}
+	testZsetBasic(t, zobj)
+	if zobj.encoding != REDIS_ENCODING_ZIPLIST {
+		t.Fatalf("encoding %d", zobj.encoding)
+	}
+	decrRefCount(zobj)
+}
+
+func TestZsetBasicSkiplist(t *testing.T) {
+	checkObjectLeaks(t)
+	zobj := zsetTypeCreate(zset_max_ziplist_entries+1, 0)
+	if zobj.encoding != REDIS_ENCODING_SKIPLIST {
+		t.Fatalf("encoding %d", zobj.encoding)
+	}
+	testZsetBasic(t, zobj)
+	checkSkiplist(t, zsetTypeZset(zobj).zsl)
+	decrRefCount(zobj)
+}
+
+// 整数编码的成员与值相同的字符串成员哈希值相同，能在字典中找到同一个节点
+func TestZsetDictTypeIntEncoding(t *testing.T) {
+	checkObjectLeaks(t)
+	d := DictCreate(zsetDictType(), nil)
+	raw := createStringObject([]byte("12345"))
+	d.Add(raw, 1)
+	num := createStringObjectFromLongLong(12345)
+	if num.encoding != REDIS_ENCODING_INT {
+		t.Fatalf("encoding %d", num.encoding)
+	}
+	if score, ok := d.Find(num); !ok || score != 1 {
+		t.Errorf("int encoded member not found, %v %v", score, ok)
+	}
+	decrRefCount(num)
+	decrRefCount(raw)
+}
+
+func testZsetAddFlags(t *testing.T, zobj *redisObject) {
+	ele := sdsNew("m")
+	if out, _, _ := zsetAdd(zobj, 1, ele, ZADD_IN_XX); out != ZADD_OUT_NOP || zsetLength(zobj) != 0 {
+		t.Fatalf("xx on missing member: %d", out)
+	}
+	if out, s, _ := zsetAdd(zobj, 5, ele, ZADD_IN_INCR); out != ZADD_OUT_ADDED || s != 5 {
+		t.Fatalf("incr missing member: %d %v", out, s)
+	}
+	if out, _, _ := zsetAdd(zobj, 1, ele, ZADD_IN_NX); out != ZADD_OUT_NOP {
+		t.Fatalf("nx on existing member: %d", out)
+	}
+	if out, _, _ := zsetAdd(zobj, 4, ele, ZADD_IN_GT); out != ZADD_OUT_NOP {
+		t.Fatalf("gt with smaller score: %d", out)
+	}
+	if out, s, _ := zsetAdd(zobj, 6, ele, ZADD_IN_GT); out != ZADD_OUT_UPDATED || s != 6 {
+		t.Fatalf("gt with larger score: %d %v", out, s)
+	}
+	if out, _, _ := zsetAdd(zobj, 7, ele, ZADD_IN_LT); out != ZADD_OUT_NOP {
+		t.Fatalf("lt with larger score: %d", out)
+	}
+	if out, s, _ := zsetAdd(zobj, -1, ele, ZADD_IN_LT|ZADD_IN_INCR); out != ZADD_OUT_UPDATED || s != 5 {
+		t.Fatalf("lt incr: %d %v", out, s)
+	}
+	// 分值不变时不算更新
+	if out, s, ok := zsetAdd(zobj, 5, ele, ZADD_IN_XX); out != 0 || s != 5 || !ok {
+		t.Fatalf("same score: %d %v", out, s)
+	}
+	// GT、LT 不影响新成员的添加
+	if out, _, _ := zsetAdd(zobj, 1, sdsNew("n"), ZADD_IN_GT); out != ZADD_OUT_ADDED {
+		t.Fatalf("gt on new member: %d", out)
+	}
+	if out, _, ok := zsetAdd(zobj, math.NaN(), ele, ZADD_IN_NONE); ok || out != ZADD_OUT_NAN {
+		t.Fatalf("nan: %d", out)
+	}
+	zsetAdd(zobj, math.Inf(1), ele, ZADD_IN_NONE)
+	if out, _, ok := zsetAdd(zobj, math.Inf(-1), ele, ZADD_IN_INCR); ok || out != ZADD_OUT_NAN {
+		t.Fatalf("inf - inf: %d", out)
+	}
+	if s, _ := zsetScore(zobj, ele); !math.IsInf(s, 1) {
+		t.Fatalf("score after nan %v", s)
+	}
+}
+
+func TestZsetAddFlags(t *testing.T) {
+	checkObjectLeaks(t)
+	zl := zsetTypeCreate(0, 0)
+	testZsetAddFlags(t, zl)
+	decrRefCount(zl)
+
+	zs := zsetTypeCreate(zset_max_ziplist_entries+1, 0)
+	testZsetAddFlags(t, zs)
+	checkSkiplist(t, zsetTypeZset(zs).zsl)
+	decrRefCount(zs)
+}
+
+func TestZaddGeneric(t *testing.T) {
+	checkObjectLeaks(t)
+	zobj := zsetTypeCreate(0, 0)
+	eles := []sds{sdsNew("a"), sdsNew("b"), sdsNew("c")}
+
+	if n, _, err := zaddGeneric(zobj, ZADD_IN_NONE, []float64{1, 2, 3}, eles); err != nil || n != 3 {
+		t.Fatalf("add %d %v", n, err)
+	}
+	if n, _, _ := zaddGeneric(zobj, ZADD_IN_NONE, []float64{1, 5, 3}, eles); n != 0 {
+		t.Fatalf("update without ch %d", n)
+	}
+	if n, _, _ := zaddGeneric(zobj, ZADD_IN_CH, []float64{1, 6, 4}, eles); n != 2 {
+		t.Fatalf("update with ch %d", n)
+	}
+	if n, s, err := zaddGeneric(zobj, ZADD_IN_INCR, []float64{2.5}, eles[:1]); err != nil || n != 1 || s != 3.5 {
+		t.Fatalf("incr %d %v %v", n, s, err)
+	}
+	// INCR 没有执行时对应空回复
+	if n, _, err := zaddGeneric(zobj, ZADD_IN_INCR|ZADD_IN_NX, []float64{1}, eles[:1]); err != nil || n != 0 {
+		t.Fatalf("incr nx %d %v", n, err)
+	}
+
+	for _, flags := range []int{ZADD_IN_NX | ZADD_IN_XX, ZADD_IN_GT | ZADD_IN_LT, ZADD_IN_NX | ZADD_IN_GT, ZADD_IN_NX | ZADD_IN_LT} {
+		if _, _, err := zaddGeneric(zobj, flags, []float64{1}, eles[:1]); err == nil {
+			t.Errorf("flags %d should be rejected", flags)
+		}
+	}
+	if _, _, err := zaddGeneric(zobj, ZADD_IN_INCR, []float64{1, 2}, eles[:2]); err != errZaddIncrPairs {
+		t.Errorf("incr with two pairs: %v", err)
+	}
+	if _, _, err := zaddGeneric(zobj, ZADD_IN_NONE, []float64{10, math.NaN()}, []sds{sdsNew("d"), sdsNew("e")}); err != errNotFloat {
+		t.Errorf("nan: %v", err)
+	}
+	// 有分值为 NaN 时不添加任何元素
+	if zsetLength(zobj) != 3 {
+		t.Errorf("length %d", zsetLength(zobj))
+	}
+	if _, ok := zsetScore(zobj, sdsNew("d")); ok {
+		t.Errorf("d should not be added")
+	}
+	// INCR 的结果为 NaN
+	inf := []sds{sdsNew("inf")}
+	zaddGeneric(zobj, ZADD_IN_NONE, []float64{math.Inf(1)}, inf)
+	if _, _, err := zaddGeneric(zobj, ZADD_IN_INCR, []float64{math.Inf(-1)}, inf); err != errZaddScoreIsNaN {
+		t.Errorf("incr nan: %v", err)
+	}
+	if s, _ := zsetScore(zobj, inf[0]); !math.IsInf(s, 1) {
+		t.Errorf("score after incr nan %v", s)
+	}
+	decrRefCount(zobj)
+}
+
+func TestZsetRangeByLex(t *testing.T) {
+	checkObjectLeaks(t)
+	for _, enc := range []int{REDIS_ENCODING_ZIPLIST, REDIS_ENCODING_SKIPLIST} {
+		zobj := zsetTypeCreate(0, 0)
+		for _, ele := range []string{"a", "b", "c", "d", "e", "f"} {
+			zsetAdd(zobj, 0, sdsNew(ele), ZADD_IN_NONE)
+		}
+		zsetConvert(zobj, enc)
+
+		min := createRawStringObject(sdsNew("b"))
+		max := createRawStringObject(sdsNew("e"))
+		rge := &zlexrangespec{min: min, max: max, maxex: 1}
+		assertEntries(t, "rangebylex", zsetRangeByLex(zobj, rge, false, 0, -1), "b:0", "c:0", "d:0")
+		assertEntries(t, "revrangebylex", zsetRangeByLex(zobj, rge, true, 0, -1), "d:0", "c:0", "b:0")
+		assertEntries(t, "rangebylex limit", zsetRangeByLex(zobj, rge, false, 1, 1), "c:0")
+		assertEntries(t, "revrangebylex limit", zsetRangeByLex(zobj, rge, true, 1, 10), "c:0", "b:0")
+		if n := zsetLexCount(zobj, rge); n != 3 {
+			t.Fatalf("lexcount %d", n)
+		}
+
+		rge = &zlexrangespec{min: min, max: max, minex: 1}
+		assertEntries(t, "rangebylex (b [e", zsetRangeByLex(zobj, rge, false, 0, -1), "c:0", "d:0", "e:0")
+		rge = &zlexrangespec{min: max, max: min}
+		assertEntries(t, "rangebylex empty", zsetRangeByLex(zobj, rge, false, 0, -1))
+		if n := zsetLexCount(zobj, rge); n != 0 {
+			t.Fatalf("lexcount of empty range %d", n)
+		}
+		decrRefCount(min)
+		decrRefCount(max)
+		decrRefCount(zobj)
+	}
+}
+
+func TestZsetConvert(t *testing.T) {
+	checkObjectLeaks(t)
+	oldEntries, oldValue := zset_max_ziplist_entries, zset_max_ziplist_value
+	zset_max_ziplist_entries, zset_max_ziplist_value = 16, 8
+	defer func() { zset_max_ziplist_entries, zset_max_ziplist_value = oldEntries, oldValue }()
+
+	zobj := zsetTypeCreate(0, 0)
+	for i := 0; i < 16; i++ {
+		zsetAdd(zobj, float64(i), sdsFromInt(i), ZADD_IN_NONE)
+	}
+	if zobj.encoding != REDIS_ENCODING_ZIPLIST {
+		t.Fatalf("encoding %d with 16 entries", zobj.encoding)
+	}
+	zsetAdd(zobj, 16, sdsFromInt(16), ZADD_IN_NONE)
+	if zobj.encoding != REDIS_ENCODING_SKIPLIST || zsetLength(zobj) != 17 {
+		t.Fatalf("encoding %d, length %d", zobj.encoding, zsetLength(zobj))
+	}
+	checkSkiplist(t, zsetTypeZset(zobj).zsl)
+	for i := 0; i <= 16; i++ {
+		if s, ok := zsetScore(zobj, sdsFromInt(i)); !ok || s != float64(i) {
+			t.Fatalf("score of %d: %v", i, s)
+		}
+	}
+
+	// 元素数量回到限制内时可以转换回压缩列表编码
+	zsetDel(zobj, sdsFromInt(0))
+	zsetConvertToZiplistIfNeeded(zobj, 2, 32)
+	if zobj.encoding != REDIS_ENCODING_ZIPLIST || zsetLength(zobj) != 16 {
+		t.Fatalf("encoding %d, length %d", zobj.encoding, zsetLength(zobj))
+	}
+	assertEntries(t, "range after convert", zsetRangeByRank(zobj, 0, 1, false), "1:1", "2:2")
+	decrRefCount(zobj)
+
+	// 成员过长时转换
+	zobj = zsetTypeCreate(0, 0)
+	zsetAdd(zobj, 1, sdsNew("123456789"), ZADD_IN_NONE)
+	if zobj.encoding != REDIS_ENCODING_SKIPLIST {
+		t.Fatalf("encoding %d with long member", zobj.encoding)
+	}
+	decrRefCount(zobj)
+}
+
+// 与一个简单的模型对比随机操作的结果
+func TestZsetRandom(t *testing.T) {
+	checkObjectLeaks(t)
+	oldEntries := zset_max_ziplist_entries
+	zset_max_ziplist_entries = 32
+	defer func() { zset_max_ziplist_entries = oldEntries }()
+
+	r := rand.New(rand.NewSource(1))
+	zobj := zsetTypeCreate(0, 0)
+	model := map[string]float64{}
+	for i := 0; i < 3000; i++ {
+		ele := "e" + strconv.Itoa(r.Intn(64))
+		switch r.Intn(4) {
+		case 0:
+			zsetDel(zobj, sdsNew(ele))
+			delete(model, ele)
+		case 1:
+			incr := float64(r.Intn(10) - 5)
+			_, s, _ := zsetAdd(zobj, incr, sdsNew(ele), ZADD_IN_INCR)
+			model[ele] += incr
+			if s != model[ele] {
+				t.Fatalf("incr %s: %v, want %v", ele, s, model[ele])
+			}
+		default:
+			score := float64(r.Intn(20))
+			zsetAdd(zobj, score, sdsNew(ele), ZADD_IN_NONE)
+			model[ele] = score
+		}
+
+		if zsetLength(zobj) != len(model) {
+			t.Fatalf("length %d, want %d", zsetLength(zobj), len(model))
+		}
+		if i%100 != 0 {
+			continue
+		}
+
+		keys := make([]string, 0, len(model))
+		for k := range model {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(a, b int) bool {
+			if model[keys[a]] != model[keys[b]] {
+				return model[keys[a]] < model[keys[b]]
+			}
+			return keys[a] < keys[b]
+		})
+		got := zsetRangeByRank(zobj, 0, -1, false)
+		for j, k := range keys {
+			if string(got[j].ele) != k || got[j].score != model[k] {
+				t.Fatalf("entry %d: %s %v, want %s %v", j, got[j].ele, got[j].score, k, model[k])
+			}
+			if rank := zsetRank(zobj, sdsNew(k), false); rank != j {
+				t.Fatalf("rank of %s: %d, want %d", k, rank, j)
+			}
+		}
+		if zobj.encoding == REDIS_ENCODING_SKIPLIST {
+			checkSkiplist(t, zsetTypeZset(zobj).zsl)
+		}
+	}
+	decrRefCount(zobj)
+}
+
+func createTestZset(encoding int, pairs ...interface{}) *redisObject {
+	zobj := zsetTypeCreate(0, 0)
+	for i := 0; i < len(pairs); i += 2 {
+		zsetAdd(zobj, pairs[i+1].(float64), sdsNew(pairs[i].(string)), ZADD_IN_NONE)
+	}
+	zsetConvert(zobj, encoding)
+	return zobj
+}
+
+func createTestSet(members ...string) *redisObject {
+	set := setTypeCreate(sdsNew(members[0]))
+	for _, m := range members {
+		setTypeAdd(set, sdsNew(m))
+	}
+	return set
+}
+
+func TestZunionInterStore(t *testing.T) {
+	checkObjectLeaks(t)
+	for _, enc := range []int{REDIS_ENCODING_ZIPLIST, REDIS_ENCODING_SKIPLIST} {
+		daily := createTestZset(enc, "a", 1.0, "b", 2.0, "c", 3.0)
+		weekly := createTestZset(enc, "b", 10.0, "c", 20.0, "d", 30.0)
+		inputs := []*redisObject{daily, weekly}
+
+		res, err := zunionInterDiff(inputs, nil, REDIS_AGGR_SUM, SET_OP_UNION)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertEntries(t, "union", res, "a:1", "b:12", "c:23", "d:30")
+
+		res, _ = zunionInterDiff(inputs, []float64{2, 0.5}, REDIS_AGGR_SUM, SET_OP_UNION)
+		assertEntries(t, "union weights", res, "a:2", "b:9", "d:15", "c:16")
+		res, _ = zunionInterDiff(inputs, nil, REDIS_AGGR_MIN, SET_OP_UNION)
+		assertEntries(t, "union min", res, "a:1", "b:2", "c:3", "d:30")
+
+		res, _ = zunionInterDiff(inputs, nil, REDIS_AGGR_SUM, SET_OP_INTER)
+		assertEntries(t, "inter", res, "b:12", "c:23")
+		res, _ = zunionInterDiff(inputs, []float64{1, -1}, REDIS_AGGR_MAX, SET_OP_INTER)
+		assertEntries(t, "inter max", res, "b:2", "c:3")
+
+		// 不存在的键视为空集合
+		res, _ = zunionInterDiff([]*redisObject{daily, nil}, nil, REDIS_AGGR_SUM, SET_OP_INTER)
+		assertEntries(t, "inter with missing key", res)
+		res, _ = zunionInterDiff([]*redisObject{nil, daily}, nil, REDIS_AGGR_SUM, SET_OP_UNION)
+		assertEntries(t, "union with missing key", res, "a:1", "b:2", "c:3")
+
+		// 同一个输入出现多次
+		res, _ = zunionInterDiff([]*redisObject{daily, daily}, []float64{1, 2}, REDIS_AGGR_SUM, SET_OP_INTER)
+		assertEntries(t, "inter with itself", res, "a:3", "b:6", "c:9")
+
+		dst, err := zunionInterDiffStore(inputs, nil, REDIS_AGGR_SUM, SET_OP_UNION)
+		if err != nil || dst.encoding != REDIS_ENCODING_ZIPLIST || zsetLength(dst) != 4 {
+			t.Fatalf("union store %v", err)
+		}
+		decrRefCount(dst)
+		if dst, _ := zunionInterDiffStore([]*redisObject{daily, nil}, nil, REDIS_AGGR_SUM, SET_OP_INTER); dst != nil {
+			t.Fatal("empty result should delete the key")
+		}
+
+		decrRefCount(daily)
+		decrRefCount(weekly)
+	}
+}
+
+func TestZunionInterWithSets(t *testing.T) {
+	checkObjectLeaks(t)
+	zobj := createTestZset(REDIS_ENCODING_ZIPLIST, "1", 5.0, "2", 6.0, "x", 7.0)
+	intset := createTestSet("1", "2", "3")
+	htset := createTestSet("2", "x", "y")
+
+	res, err := zunionInterDiff([]*redisObject{zobj, intset, htset}, []float64{1, 10, 100}, REDIS_AGGR_SUM, SET_OP_INTER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEntries(t, "inter sets", res, "2:116")
+
+	res, _ = zunionInterDiff([]*redisObject{intset, htset}, nil, REDIS_AGGR_SUM, SET_OP_UNION)
+	assertEntries(t, "union sets", res, "1:1", "3:1", "x:1", "y:1", "2:2")
+
+	lobj := listTypeCreate()
+	if _, err := zunionInterDiff([]*redisObject{zobj, lobj}, nil, REDIS_AGGR_SUM, SET_OP_UNION); err != errWrongType {
+		t.Fatalf("wrong type: %v", err)
+	}
+	decrRefCount(lobj)
+	decrRefCount(zobj)
+	decrRefCount(intset)
+	decrRefCount(htset)
+}
+
+func TestZunionInterInf(t *testing.T) {
+	checkObjectLeaks(t)
+	a := createTestZset(REDIS_ENCODING_SKIPLIST, "m", math.Inf(1))
+	b := createTestZset(REDIS_ENCODING_ZIPLIST, "m", math.Inf(-1))
+	// inf + -inf 的结果为0，inf * 0 的结果也为0
+	res, _ := zunionInterDiff([]*redisObject{a, b}, nil, REDIS_AGGR_SUM, SET_OP_UNION)
+	assertEntries(t, "inf sum", res, "m:0")
+	res, _ = zunionInterDiff([]*redisObject{a, b}, []float64{0, 1}, REDIS_AGGR_MIN, SET_OP_INTER)
+	assertEntries(t, "inf weight 0", res, "m:-inf")
+	decrRefCount(a)
+	decrRefCount(b)
+}
+
+func TestZdiff(t *testing.T) {
+	checkObjectLeaks(t)
+	big := createTestZset(REDIS_ENCODING_SKIPLIST, "a", 1.0, "b", 2.0, "c", 3.0, "d", 4.0, "e", 5.0)
+	small := createTestZset(REDIS_ENCODING_ZIPLIST, "b", 20.0, "z", 1.0)
+	set := createTestSet("d")
+
+	// 其余输入很小时使用算法2，很大时使用算法1
+	for _, extra := range []int{0, 100} {
+		other := createTestZset(REDIS_ENCODING_SKIPLIST, "e", 1.0)
+		for i := 0; i < extra; i++ {
+			zsetAdd(other, float64(i), sdsNew("n"+strconv.Itoa(i)), ZADD_IN_NONE)
+		}
+		inputs := []*redisObject{big, small, set, other}
+		want := 2
+		if extra > 0 {
+			want = 1
+		}
+		src := []zsetopsrc{{subject: big}, {subject: small}, {subject: set}, {subject: other}}
+		if algo := zsetChooseDiffAlgorithm(src); algo != want {
+			t.Fatalf("algorithm %d, want %d", algo, want)
+		}
+
+		res, err := zunionInterDiff(inputs, nil, REDIS_AGGR_SUM, SET_OP_DIFF)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertEntries(t, "diff", res, "a:1", "c:3")
+		decrRefCount(other)
+	}
+
+	res, _ := zunionInterDiff([]*redisObject{big, big}, nil, REDIS_AGGR_SUM, SET_OP_DIFF)
+	assertEntries(t, "diff with itself", res)
+	res, _ = zunionInterDiff([]*redisObject{nil, big}, nil, REDIS_AGGR_SUM, SET_OP_DIFF)
+	assertEntries(t, "diff of missing key", res)
+	res, _ = zunionInterDiff([]*redisObject{small, big}, nil, REDIS_AGGR_SUM, SET_OP_DIFF)
+	assertEntries(t, "diff small", res, "z:1")
+
+	dst, _ := zunionInterDiffStore([]*redisObject{big, small}, nil, REDIS_AGGR_SUM, SET_OP_DIFF)
+	if dst == nil || dst.encoding != REDIS_ENCODING_ZIPLIST || zsetLength(dst) != 4 {
+		t.Fatal("diff store")
+	}
+	decrRefCount(dst)
+	decrRefCount(big)
+	decrRefCount(small)
+	decrRefCount(set)
+}
+
+func TestZinterCard(t *testing.T) {
+	checkObjectLeaks(t)
+	a := createTestZset(REDIS_ENCODING_SKIPLIST, "a", 1.0, "b", 2.0, "c", 3.0, "d", 4.0)
+	b := createTestSet("a", "b", "c", "x")
+	for _, c := range []struct{ limit, want int }{{0, 3}, {2, 2}, {3, 3}, {10, 3}} {
+		if n, err := zinterCard([]*redisObject{a, b}, c.limit); err != nil || n != c.want {
+			t.Errorf("limit %d: %d %v", c.limit, n, err)
+		}
+	}
+	if _, err := zinterCard([]*redisObject{a, b}, -1); err != errZinterCardLimit {
+		t.Errorf("negative limit: %v", err)
+	}
+	decrRefCount(a)
+	decrRefCount(b)
+}
+
+func TestZrangeStore(t *testing.T) {
+	checkObjectLeaks(t)
+	src := createTestZset(REDIS_ENCODING_SKIPLIST, "a", 1.0, "b", 2.0, "c", 3.0)
+	before := zmallocUsedMemory()
+	dst := zrangeStore(zsetRangeByScore(src, &zrangespec{min: 2, max: math.Inf(1)}, true, 0, -1))
+	if dst == nil || dst.encoding != REDIS_ENCODING_ZIPLIST {
+		t.Fatal("range store")
+	}
+	// 范围查询返回的成员由 zrangeStore 释放
+	if got := zmallocUsedMemory() - before; got != 0 {
+		t.Errorf("range store leaked %d bytes", got)
+	}
+	assertEntries(t, "range store", zsetRangeByRank(dst, 0, -1, false), "b:2", "c:3")
+	if zrangeStore(zsetRangeByRank(src, 5, 10, false)) != nil {
+		t.Fatal("empty range store")
+	}
+	decrRefCount(src)
+	decrRefCount(dst)
+}
+
+func parseTestLexRange(t *testing.T, min string, max string) (*zlexrangespec, error) {
+	t.Helper()
+	minobj := createRawStringObject(sdsNew(min))
+	maxobj := createRawStringObject(sdsNew(max))
+	defer decrRefCount(minobj)
+	defer decrRefCount(maxobj)
+	spec := &zlexrangespec{}
+	return spec, zslParseLexRange(minobj, maxobj, spec)
+}
+
+func TestZslParseLexRange(t *testing.T) {
+	checkObjectLeaks(t)
+	spec, err := parseTestLexRange(t, "-", "+")
+	if err != nil || spec.min != shared.minstring || spec.max != shared.maxstring || spec.minex != 0 || spec.maxex != 0 {
+		t.Fatalf("- +: %v", err)
+	}
+	zslFreeLexRange(spec)
+	if shared.minstring.refcount != OBJ_SHARED_REFCOUNT || shared.maxstring.refcount != OBJ_SHARED_REFCOUNT {
+		t.Fatal("sentinels must not be freed")
+	}
+
+	spec, err = parseTestLexRange(t, "(a", "[")
+	if err != nil || string(*(*sds)(spec.min.ptr)) != "a" || spec.minex != 1 ||
+		string(*(*sds)(spec.max.ptr)) != "" || spec.maxex != 0 {
+		t.Fatalf("(a [: %v", err)
+	}
+	zslFreeLexRange(spec)
+
+	for _, c := range [][2]string{{"a", "+"}, {"-", "b"}, {"", "+"}, {"-x", "+"}, {"[a", "++"}} {
+		if _, err := parseTestLexRange(t, c[0], c[1]); err != errZsetLexRange {
+			t.Errorf("%q %q: %v", c[0], c[1], err)
+		}
+	}
+}
+
+func TestZsetLexRangeSentinels(t *testing.T) {
+	checkObjectLeaks(t)
+	words := []string{"alpha", "bar", "foo", "foobar", "fooz", "zap"}
+	for _, enc := range []int{REDIS_ENCODING_ZIPLIST, REDIS_ENCODING_SKIPLIST} {
+		zobj := zsetTypeCreate(0, 0)
+		for _, w := range words {
+			zsetAdd(zobj, 0, sdsNew(w), ZADD_IN_NONE)
+		}
+		zsetConvert(zobj, enc)
+
+		spec, _ := parseTestLexRange(t, "-", "+")
+		if n := zsetLexCount(zobj, spec); n != len(words) {
+			t.Fatalf("lexcount - +: %d", n)
+		}
+		assertEntries(t, "revrangebylex + -", zsetRangeByLex(zobj, &zlexrangespec{min: spec.max, max: spec.min}, true, 0, -1))
+		assertEntries(t, "revrangebylex limit", zsetRangeByLex(zobj, spec, true, 0, 2), "zap:0", "fooz:0")
+		zslFreeLexRange(spec)
+
+		// 自动补全：查找以 foo 开头的成员
+		spec, _ = parseTestLexRange(t, "[foo", "(fop")
+		assertEntries(t, "prefix", zsetRangeByLex(zobj, spec, false, 0, -1), "foo:0", "foobar:0", "fooz:0")
+		zslFreeLexRange(spec)
+
+		spec, _ = parseTestLexRange(t, "(bar", "+")
+		assertEntries(t, "(bar +", zsetRangeByLex(zobj, spec, false, 0, 2), "foo:0", "foobar:0")
+		zslFreeLexRange(spec)
+
+		spec, _ = parseTestLexRange(t, "-", "[bar")
+		assertEntries(t, "- [bar", zsetRangeByLex(zobj, spec, true, 0, -1), "bar:0", "alpha:0")
+		zslFreeLexRange(spec)
+
+		decrRefCount(zobj)
+	}
+}
+
+func TestZsetDeleteRangeByLex(t *testing.T) {
+	checkObjectLeaks(t)
+	for _, enc := range []int{REDIS_ENCODING_ZIPLIST, REDIS_ENCODING_SKIPLIST} {
+		zobj := zsetTypeCreate(0, 0)
+		for _, w := range []string{"a", "b", "c", "d", "e"} {
+			zsetAdd(zobj, 0, sdsNew(w), ZADD_IN_NONE)
+		}
+		zsetConvert(zobj, enc)
+
+		spec, _ := parseTestLexRange(t, "(b", "[d")
+		if n := zsetDeleteRangeByLex(zobj, spec); n != 2 {
+			t.Fatalf("removed %d", n)
+		}
+		if n := zsetDeleteRangeByLex(zobj, spec); n != 0 {
+			t.Fatalf("removed %d again", n)
+		}
+		zslFreeLexRange(spec)
+		assertEntries(t, "after remove", zsetRangeByRank(zobj, 0, -1, false), "a:0", "b:0", "e:0")
+
+		spec, _ = parseTestLexRange(t, "[e", "-")
+		if n := zsetDeleteRangeByLex(zobj, spec); n != 0 {
+			t.Fatalf("removed %d with inverted range", n)
+		}
+		zslFreeLexRange(spec)
+
+		spec, _ = parseTestLexRange(t, "-", "+")
+		if n := zsetDeleteRangeByLex(zobj, spec); n != 3 || zsetLength(zobj) != 0 {
+			t.Fatalf("removed %d, length %d", n, zsetLength(zobj))
+		}
+		zslFreeLexRange(spec)
+		if enc == REDIS_ENCODING_SKIPLIST {
+			checkSkiplist(t, zsetTypeZset(zobj).zsl)
+		}
+		decrRefCount(zobj)
+	}
+}
+
+// 创建参数对应的字符串对象，测试结束时释放
+func testStringObjects(t *testing.T, args ...string) []*redisObject {
+	objs := make([]*redisObject, len(args))
+	for i, a := range args {
+		objs[i] = createRawStringObject(sdsNew(a))
+	}
+	t.Cleanup(func() {
+		for _, o := range objs {
+			decrRefCount(o)
+		}
+	})
+	return objs
+}
+
+func TestZslParseRange(t *testing.T) {
+	checkObjectLeaks(t)
+	tests := []struct {
+		min, max string
+		spec     zrangespec
+	}{
+		{"1", "2", zrangespec{min: 1, max: 2}},
+		{"(1.5", "(2.5", zrangespec{min: 1.5, max: 2.5, minex: 1, maxex: 1}},
+		{"-inf", "+inf", zrangespec{min: math.Inf(-1), max: math.Inf(1)}},
+		{"(-inf", "inf", zrangespec{min: math.Inf(-1), max: math.Inf(1), minex: 1}},
+		{"1e2", "0x10", zrangespec{min: 100, max: 16}},
+		// 与 strtod 相同，空字符串解析为0
+		{"", "(", zrangespec{min: 0, max: 0, maxex: 1}},
+	}
+	for _, tt := range tests {
+		args := testStringObjects(t, tt.min, tt.max)
+		var spec zrangespec
+		if err := zslParseRange(args[0], args[1], &spec); err != nil || spec != tt.spec {
+			t.Errorf("parse %q %q: %+v %v", tt.min, tt.max, spec, err)
+		}
+	}
+
+	for _, bad := range []string{"nan", "(nan", "-nan", "NaN(1)", "abc", "1.5x", "((1", " 1 ", "[1", "1e"} {
+		args := testStringObjects(t, bad, "1")
+		var spec zrangespec
+		if err := zslParseRange(args[0], args[1], &spec); err != errZsetMinMaxNotFloat {
+			t.Errorf("parse min %q: %v", bad, err)
+		}
+		if err := zslParseRange(args[1], args[0], &spec); err != errZsetMinMaxNotFloat {
+			t.Errorf("parse max %q: %v", bad, err)
+		}
+	}
+}
+
+func TestGenericZrangebyscore(t *testing.T) {
+	checkObjectLeaks(t)
+	for _, enc := range []int{REDIS_ENCODING_ZIPLIST, REDIS_ENCODING_SKIPLIST} {
+		zobj := createTestZset(enc, "a", 1.0, "b", 2.0, "c", 3.0, "d", 4.0, "inf", math.Inf(1))
+
+		res, withscores, err := genericZrangebyscore(zobj, testStringObjects(t, "(1", "3"), false)
+		if err != nil || withscores {
+			t.Fatalf("rangebyscore: %v", err)
+		}
+		assertEntries(t, "(1 3", res, "b:2", "c:3")
+
+		res, withscores, _ = genericZrangebyscore(zobj, testStringObjects(t, "+inf", "(1", "WITHSCORES", "limit", "1", "2"), true)
+		if !withscores {
+			t.Fatal("withscores")
+		}
+		assertEntries(t, "rev +inf (1 limit 1 2", res, "d:4", "c:3")
+
+		res, _, _ = genericZrangebyscore(zobj, testStringObjects(t, "-inf", "inf", "LIMIT", "0", "-1"), false)
+		assertEntries(t, "limit 0 -1", res, "a:1", "b:2", "c:3", "d:4", "inf:inf")
+		res, _, _ = genericZrangebyscore(zobj, testStringObjects(t, "-inf", "inf", "LIMIT", "-1", "2"), false)
+		assertEntries(t, "negative offset", res)
+		res, _, _ = genericZrangebyscore(zobj, testStringObjects(t, "(4", "+inf"), false)
+		assertEntries(t, "(4 +inf", res, "inf:inf")
+		res, _, _ = genericZrangebyscore(zobj, testStringObjects(t, "3", "2"), false)
+		assertEntries(t, "min > max", res)
+
+		for _, args := range [][]string{
+			{"1", "2", "withscore"},
+			{"1", "2", "limit", "1"},
+			{"1"},
+		} {
+			if _, _, err := genericZrangebyscore(zobj, testStringObjects(t, args...), false); err != errSyntax {
+				t.Errorf("%q: %v", args, err)
+			}
+		}
+		if _, _, err := genericZrangebyscore(zobj, testStringObjects(t, "1", "2", "limit", "a", "1"), false); err != errNotInteger {
+			t.Errorf("limit a: %v", err)
+		}
+		if _, _, err := genericZrangebyscore(zobj, testStringObjects(t, "1", "nan"), false); err != errZsetMinMaxNotFloat {
+			t.Errorf("nan: %v", err)
+		}
+		decrRefCount(zobj)
+	}
+
+	if res, _, err := genericZrangebyscore(nil, testStringObjects(t, "1", "2"), false); err != nil || len(res) != 0 {
+		t.Errorf("missing key: %v", err)
+	}
+	lobj := listTypeCreate()
+	if _, _, err := genericZrangebyscore(lobj, testStringObjects(t, "1", "2"), false); err != errWrongType {
+		t.Errorf("wrong type: %v", err)
+	}
+	decrRefCount(lobj)
+}
+
+func TestZcountZremrangebyscore(t *testing.T) {
+	checkObjectLeaks(t)
+	for _, enc := range []int{REDIS_ENCODING_ZIPLIST, REDIS_ENCODING_SKIPLIST} {
+		zobj := createTestZset(enc, "a", 1.0, "b", 2.0, "c", 3.0, "d", 4.0, "e", 5.0)
+
+		for _, c := range []struct {
+			min, max string
+			want     int
+		}{
+			{"-inf", "+inf", 5}, {"(1", "(5", 3}, {"2", "2", 1}, {"(2", "2", 0}, {"6", "+inf", 0}, {"5", "1", 0},
+		} {
+			args := testStringObjects(t, c.min, c.max)
+			if n, err := zcount(zobj, args[0], args[1]); err != nil || n != c.want {
+				t.Errorf("zcount %s %s: %d %v", c.min, c.max, n, err)
+			}
+		}
+		args := testStringObjects(t, "nan", "1")
+		if _, err := zcount(zobj, args[0], args[1]); err != errZsetMinMaxNotFloat {
+			t.Errorf("zcount nan: %v", err)
+		}
+		if _, err := zremrangebyscore(zobj, args[1], args[0]); err != errZsetMinMaxNotFloat {
+			t.Errorf("zremrangebyscore nan: %v", err)
+		}
+
+		args = testStringObjects(t, "(1", "3")
+		if n, err := zremrangebyscore(zobj, args[0], args[1]); err != nil || n != 2 {
+			t.Fatalf("zremrangebyscore: %d %v", n, err)
+		}
+		if n, _ := zremrangebyscore(zobj, args[0], args[1]); n != 0 {
+			t.Fatalf("zremrangebyscore again: %d", n)
+		}
+		assertEntries(t, "after zremrangebyscore", zsetRangeByRank(zobj, 0, -1, false), "a:1", "d:4", "e:5")
+
+		args = testStringObjects(t, "4", "+inf")
+		if n, _ := zremrangebyscore(zobj, args[0], args[1]); n != 2 {
+			t.Fatalf("zremrangebyscore tail: %d", n)
+		}
+		assertEntries(t, "after removing tail", zsetRangeByRank(zobj, 0, -1, false), "a:1")
+		if enc == REDIS_ENCODING_SKIPLIST {
+			checkSkiplist(t, zsetTypeZset(zobj).zsl)
+		}
+		decrRefCount(zobj)
+	}
+}
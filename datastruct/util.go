@@ -0,0 +1,259 @@
+/*
+数字与字符串之间的转换，与 Redis 的 util.c 对应
+*/
+package datastruct
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+)
+
+// 将字符串严格地转换为 int64，转换成功时第二个返回值为true
+//
+// 只接受与 ll2string 的输出完全相同的字符串，以下情况都会失败：
+// 空字符串、前后有空白、带有 "+" 号、有多余的前导0(例如 "01"、"-0")、
+// 非数字字符以及超出 int64 范围的数字
+func string2ll(s []byte) (int64, bool) {
+	slen := len(s)
+	if slen == 0 {
+		return 0, false
+	}
+
+	// 只有一个0的特殊情况
+	if slen == 1 && s[0] == '0' {
+		return 0, true
+	}
+
+	p := 0
+	negative := false
+	if s[0] == '-' {
+		negative = true
+		p++
+		// 只有一个负号
+		if p == slen {
+			return 0, false
+		}
+	}
+
+	// 第一个数字必须是1-9，否则字符串不合法
+	var v uint64
+	if s[p] >= '1' && s[p] <= '9' {
+		v = uint64(s[p] - '0')
+		p++
+	} else {
+		return 0, false
+	}
+
+	for p < slen && s[p] >= '0' && s[p] <= '9' {
+		// 检查溢出
+		if v > math.MaxUint64/10 {
+			return 0, false
+		}
+		v *= 10
+		if v > math.MaxUint64-uint64(s[p]-'0') {
+			return 0, false
+		}
+		v += uint64(s[p] - '0')
+		p++
+	}
+
+	// 没有使用完所有的字符，说明有非数字的字符
+	if p < slen {
+		return 0, false
+	}
+
+	if negative {
+		// -math.MinInt64 超出了 int64 的范围，需要用无符号数比较
+		if v > uint64(-(math.MinInt64+1))+1 {
+			return 0, false
+		}
+		return -int64(v), true
+	}
+	if v > math.MaxInt64 {
+		return 0, false
+	}
+	return int64(v), true
+}
+
+// 将字符串严格地转换为 int，规则与 string2ll 相同
+func string2l(s []byte) (int, bool) {
+	v, ok := string2ll(s)
+	if !ok || v < math.MinInt || v > math.MaxInt {
+		return 0, false
+	}
+	return int(v), true
+}
+
+// 将 int64 转换为字符串，返回字符串及其长度
+func ll2string(value int64) (string, int) {
+	str := strconv.FormatInt(value, 10)
+	return str, len(str)
+}
+
+// 将 double 转换为字符串，返回字符串及其长度
+//
+// 与 Redis 相同：nan、inf 和 -inf 转换为对应的字符串，-0 转换为 "-0"，
+// 可以用整数精确表示的值按整数输出，其余的值使用 "%.17g" 格式，保证可以无损地转换回 double
+func d2string(value float64) (string, int) {
+	var str string
+	switch {
+	case math.IsNaN(value):
+		str = "nan"
+	case math.IsInf(value, 1):
+		str = "inf"
+	case math.IsInf(value, -1):
+		str = "-inf"
+	case value == 0:
+		if math.Signbit(value) {
+			str = "-0"
+		} else {
+			str = "0"
+		}
+	default:
+		// 在 (-(2^52-1), 2^52) 范围内的整数值按整数输出
+		const min = -4503599627370495
+		const max = 4503599627370496
+		if value > min && value < max && value == float64(int64(value)) {
+			str, _ = ll2string(int64(value))
+		} else {
+			str = strconv.FormatFloat(value, 'g', 17, 64)
+		}
+	}
+	return str, len(str)
+}
+
+// 将 long double 转换为字符串，返回字符串及其长度，用于 INCRBYFLOAT 等命令
+//
+// Go 中没有 long double，使用 float64 代替。
+// humanfriendly 为true时输出不使用指数的形式并且去掉小数部分末尾的0，例如 "10.5"、"3"；
+// C 中使用 "%.17Lf" 依靠 long double 的精度来消除误差，float64 只有约17位有效数字，
+// 这里改为使用可以精确转换回原值的最短小数，对于用户输入的小数可以得到相同的结果。
+// humanfriendly 为false时使用 "%.17g" 格式。
+func ld2string(value float64, humanfriendly bool) (string, int) {
+	var str string
+	switch {
+	case math.IsInf(value, 1):
+		str = "inf"
+	case math.IsInf(value, -1):
+		str = "-inf"
+	case math.IsNaN(value):
+		str = "nan"
+	case humanfriendly:
+		str = strconv.FormatFloat(value, 'f', -1, 64)
+	default:
+		str = strconv.FormatFloat(value, 'g', 17, 64)
+	}
+	return str, len(str)
+}
+
+// 与 C 的 strtod 相同地解析 s 开头的浮点数，返回解析得到的值以及使用的字节数
+//
+// 跳过前导空白后，接受可选的正负号，以及十进制数（可以带小数点和指数）、以 "0x" 开头的十六进制数
+// （可以带小数点和 "p" 指数）、"inf"、"infinity" 和 "nan"（大小写不敏感）。
+// 没有可以解析的数字时返回 0 和 0；超出范围时与 strtod 相同，返回 ±inf 或者接近0的值
+func strtod(s []byte) (float64, int) {
+	i := 0
+	for i < len(s) && isSpace(s[i]) {
+		i++
+	}
+	start := i
+	neg := false
+	if i < len(s) && (s[i] == '+' || s[i] == '-') {
+		neg = s[i] == '-'
+		i++
+	}
+
+	hasPrefixFold := func(prefix string) bool {
+		return len(s)-i >= len(prefix) && bytes.EqualFold(s[i:i+len(prefix)], []byte(prefix))
+	}
+	isDigit := func(c byte) bool {
+		return c >= '0' && c <= '9'
+	}
+	// 从 i 开始跳过满足 f 的字符，返回跳过的数量
+	skip := func(f func(c byte) bool) int {
+		n := 0
+		for i < len(s) && f(s[i]) {
+			i++
+			n++
+		}
+		return n
+	}
+
+	switch {
+	case hasPrefixFold("infinity"), hasPrefixFold("inf"):
+		if hasPrefixFold("infinity") {
+			i += 8
+		} else {
+			i += 3
+		}
+		if neg {
+			return math.Inf(-1), i
+		}
+		return math.Inf(1), i
+	case hasPrefixFold("nan"):
+		i += 3
+		// 可以带有 "(n-char-sequence)"
+		if i < len(s) && s[i] == '(' {
+			j := i + 1
+			for j < len(s) && (isDigit(s[j]) || s[j] == '_' ||
+				(s[j]|0x20 >= 'a' && s[j]|0x20 <= 'z')) {
+				j++
+			}
+			if j < len(s) && s[j] == ')' {
+				i = j + 1
+			}
+		}
+		return math.NaN(), i
+	}
+
+	// 十六进制数，"0x" 之后没有数字时只解析 "0"
+	if hasPrefixFold("0x") && i+2 < len(s) &&
+		(isHexDigit(s[i+2]) || (s[i+2] == '.' && i+3 < len(s) && isHexDigit(s[i+3]))) {
+		i += 2
+		skip(isHexDigit)
+		if i < len(s) && s[i] == '.' {
+			i++
+			skip(isHexDigit)
+		}
+		numEnd := i
+		if i < len(s) && (s[i] == 'p' || s[i] == 'P') {
+			i++
+			if i < len(s) && (s[i] == '+' || s[i] == '-') {
+				i++
+			}
+			if skip(isDigit) == 0 {
+				i = numEnd
+			}
+		}
+		num := string(s[start:i])
+		if i == numEnd {
+			num += "p0"
+		}
+		v, _ := strconv.ParseFloat(num, 64)
+		return v, i
+	}
+
+	// 十进制数，整数部分和小数部分至少要有一个数字
+	digits := skip(isDigit)
+	if i < len(s) && s[i] == '.' {
+		i++
+		digits += skip(isDigit)
+	}
+	if digits == 0 {
+		return 0, 0
+	}
+	numEnd := i
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		i++
+		if i < len(s) && (s[i] == '+' || s[i] == '-') {
+			i++
+		}
+		if skip(isDigit) == 0 {
+			i = numEnd
+		}
+	}
+	// 语法已经检查过，超出范围时 ParseFloat 返回 ±inf 或0
+	v, _ := strconv.ParseFloat(string(s[start:i]), 64)
+	return v, i
+}
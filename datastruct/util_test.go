@@ -0,0 +1,151 @@
+package datastruct
+
+import (
+	"math"
+	"testing"
+)
+
+func TestString2ll(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int64
+		ok   bool
+	}{
+		{"", 0, false},
+		{" 1", 0, false},
+		{"1 ", 0, false},
+		{"+1", 0, false},
+		{"01", 0, false},
+		{"-0", 0, false},
+		{"-", 0, false},
+		{"1a", 0, false},
+		{"0", 0, true},
+		{"1", 1, true},
+		{"99", 99, true},
+		{"-99", -99, true},
+		{"-9223372036854775808", math.MinInt64, true},
+		{"-9223372036854775809", 0, false},
+		{"9223372036854775807", math.MaxInt64, true},
+		{"9223372036854775808", 0, false},
+		{"18446744073709551616", 0, false},
+		{"99999999999999999999", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := string2ll([]byte(tt.s))
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("string2ll(%q) = %d, %v, want %d, %v", tt.s, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestLl2string(t *testing.T) {
+	for _, v := range []int64{0, 1, -1, 123456, math.MaxInt64, math.MinInt64} {
+		str, length := ll2string(v)
+		if length != len(str) {
+			t.Errorf("ll2string(%d) length %d", v, length)
+		}
+		// 转换结果可以被 string2ll 转换回原值
+		if got, ok := string2ll([]byte(str)); !ok || got != v {
+			t.Errorf("ll2string(%d) = %q", v, str)
+		}
+	}
+}
+
+func TestD2string(t *testing.T) {
+	tests := []struct {
+		v    float64
+		want string
+	}{
+		{math.NaN(), "nan"},
+		{math.Inf(1), "inf"},
+		{math.Inf(-1), "-inf"},
+		{0, "0"},
+		{math.Copysign(0, -1), "-0"},
+		{3, "3"},
+		{-42, "-42"},
+		{1.5, "1.5"},
+		{0.1, "0.10000000000000001"},
+		{4503599627370496, "4503599627370496"},
+		{1e20, "1e+20"},
+		{1e-5, "1.0000000000000001e-05"},
+	}
+	for _, tt := range tests {
+		str, length := d2string(tt.v)
+		if str != tt.want || length != len(tt.want) {
+			t.Errorf("d2string(%v) = %q, %d, want %q", tt.v, str, length, tt.want)
+		}
+	}
+}
+
+func TestLd2string(t *testing.T) {
+	tests := []struct {
+		v             float64
+		humanfriendly bool
+		want          string
+	}{
+		{math.Inf(1), true, "inf"},
+		{math.Inf(-1), false, "-inf"},
+		{10.5 + 0.1, true, "10.6"},
+		{3, true, "3"},
+		{5e20, true, "500000000000000000000"},
+		{1e-5, true, "0.00001"},
+		{0.1, false, "0.10000000000000001"},
+		{5e20, false, "5e+20"},
+	}
+	for _, tt := range tests {
+		str, length := ld2string(tt.v, tt.humanfriendly)
+		if str != tt.want || length != len(tt.want) {
+			t.Errorf("ld2string(%v, %v) = %q, %d, want %q", tt.v, tt.humanfriendly, str, length, tt.want)
+		}
+	}
+}
+
+func TestStrtod(t *testing.T) {
+	tests := []struct {
+		s    string
+		want float64
+		n    int
+	}{
+		{"", 0, 0},
+		{"abc", 0, 0},
+		{"-", 0, 0},
+		{".", 0, 0},
+		{"1", 1, 1},
+		{"1.5", 1.5, 3},
+		{"-1.5", -1.5, 4},
+		{"+.5", 0.5, 3},
+		{"1.", 1, 2},
+		{"  \t12abc", 12, 5},
+		{"1e3", 1000, 3},
+		{"1E-2x", 0.01, 4},
+		{"1e", 1, 1},
+		{"1e+", 1, 1},
+		{"1e400", math.Inf(1), 5},
+		{"-1e400", math.Inf(-1), 6},
+		{"inf", math.Inf(1), 3},
+		{"-Inf", math.Inf(-1), 4},
+		{"+infinity", math.Inf(1), 9},
+		{"infinit", math.Inf(1), 3},
+		{"0x10", 16, 4},
+		{"0x1.8p1", 3, 7},
+		{"-0x.8", -0.5, 5},
+		{"0x1p", 1, 3},
+		{"0x", 0, 1},
+		{"0xg", 0, 1},
+	}
+	for _, tt := range tests {
+		got, n := strtod([]byte(tt.s))
+		if got != tt.want || n != tt.n {
+			t.Errorf("strtod(%q) = %v, %d, want %v, %d", tt.s, got, n, tt.want, tt.n)
+		}
+	}
+
+	for _, s := range []string{"nan", "-NaN", "nan(123)"} {
+		if got, n := strtod([]byte(s)); !math.IsNaN(got) || n != len(s) {
+			t.Errorf("strtod(%q) = %v, %d", s, got, n)
+		}
+	}
+	if _, n := strtod([]byte("nan(")); n != 3 {
+		t.Errorf("strtod(\"nan(\") used %d bytes", n)
+	}
+}
@@ -0,0 +1,783 @@
+/*
+压缩列表(ziplist)实现，与 Redis 3.0 的 ziplist.c 对应，字节格式完全相同
+
+压缩列表是一块连续的内存，布局如下：
+
+	<zlbytes><zltail><zllen><entry><entry>...<entry><zlend>
+
+zlbytes: uint32，整个压缩列表占用的字节数
+zltail:  uint32，最后一个节点相对于压缩列表起始位置的偏移量
+zllen:   uint16，节点数量，等于 UINT16_MAX 时需要遍历整个列表才能得到节点数量
+zlend:   1字节，固定为 0xFF，表示列表结束
+
+每个节点由以下部分组成：
+
+	<prevlen><encoding><content>
+
+prevlen: 前一个节点的长度，小于254时占用1字节，否则占用5字节，第一个字节为 0xFE，之后4字节为长度
+encoding: 内容的编码以及长度
+  - 00pppppp: 长度不超过63字节的字符串
+  - 01pppppp|qqqqqqqq: 长度不超过16383字节的字符串，长度为14位大端序
+  - 10______|4字节: 长度更大的字符串，长度为32位大端序
+  - 11000000: int16
+  - 11010000: int32
+  - 11100000: int64
+  - 11110000: 24位有符号整数
+  - 11111110: int8
+  - 1111xxxx: xxxx 在 0001 到 1101 之间，表示 0 到 12 的整数，没有 content
+
+所有的整数都以小端序保存
+
+Go 中以 []byte 表示压缩列表，以节点相对于压缩列表起始位置的偏移量代替 C 中的指针，
+-1 表示 C 中的 NULL。与 C 中一样，修改压缩列表的函数会返回新的压缩列表，之后只能使用返回值。
+*/
+package datastruct
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+// 压缩列表结束标志
+const ZIP_END = 255
+
+// prevlen 使用1字节保存时的最大值(不包含)
+const ZIP_BIGLEN = 254
+
+// 字符串编码
+const (
+	ZIP_STR_MASK = 0xc0
+	ZIP_INT_MASK = 0x30
+	ZIP_STR_06B  = 0 << 6
+	ZIP_STR_14B  = 1 << 6
+	ZIP_STR_32B  = 2 << 6
+)
+
+// 整数编码
+const (
+	ZIP_INT_16B = 0xc0 | 0<<4
+	ZIP_INT_32B = 0xc0 | 1<<4
+	ZIP_INT_64B = 0xc0 | 2<<4
+	ZIP_INT_24B = 0xc0 | 3<<4
+	ZIP_INT_8B  = 0xfe
+)
+
+// 4位立即数编码: 1111xxxx，xxxx 在 0001 到 1101 之间
+const (
+	ZIP_INT_IMM_MASK = 0x0f
+	ZIP_INT_IMM_MIN  = 0xf1
+	ZIP_INT_IMM_MAX  = 0xfd
+)
+
+// 24位整数的范围
+const (
+	INT24_MAX = 0x7fffff
+	INT24_MIN = -INT24_MAX - 1
+)
+
+// 插入节点的位置
+const (
+	ZIPLIST_HEAD = 0
+	ZIPLIST_TAIL = 1
+)
+
+// 压缩列表头部的大小: zlbytes + zltail + zllen
+const ZIPLIST_HEADER_SIZE = 4 + 4 + 2
+
+// 编码是否是字符串编码
+func zipIsStr(encoding byte) bool {
+	return encoding&ZIP_STR_MASK < ZIP_STR_MASK
+}
+
+// 压缩列表占用的字节数
+func ziplistBytes(zl []byte) int {
+	return int(binary.LittleEndian.Uint32(zl[0:]))
+}
+
+func ziplistSetBytes(zl []byte, n int) {
+	binary.LittleEndian.PutUint32(zl[0:], uint32(n))
+}
+
+// 最后一个节点的偏移量
+func ziplistTailOffset(zl []byte) int {
+	return int(binary.LittleEndian.Uint32(zl[4:]))
+}
+
+func ziplistSetTailOffset(zl []byte, offset int) {
+	binary.LittleEndian.PutUint32(zl[4:], uint32(offset))
+}
+
+// 头部保存的节点数量
+func ziplistLength(zl []byte) int {
+	return int(binary.LittleEndian.Uint16(zl[8:]))
+}
+
+func ziplistSetLength(zl []byte, n int) {
+	binary.LittleEndian.PutUint16(zl[8:], uint16(n))
+}
+
+// 第一个节点的偏移量
+func ziplistEntryHead(zl []byte) int {
+	return ZIPLIST_HEADER_SIZE
+}
+
+// 最后一个节点的偏移量
+func ziplistEntryTail(zl []byte) int {
+	return ziplistTailOffset(zl)
+}
+
+// 结束标志的偏移量
+func ziplistEntryEnd(zl []byte) int {
+	return ziplistBytes(zl) - 1
+}
+
+// 增加节点数量，节点数量达到 UINT16_MAX 后不再更新
+func ziplistIncrLength(zl []byte, incr int) {
+	if ziplistLength(zl) < math.MaxUint16 {
+		ziplistSetLength(zl, ziplistLength(zl)+incr)
+	}
+}
+
+// 解码后的节点信息
+type zlentry struct {
+	// 保存前一个节点长度所用的字节数，以及前一个节点的长度
+	prevrawlensize, prevrawlen int
+	// 保存内容长度所用的字节数，以及内容的长度
+	lensize, len int
+	// 节点头部的长度: prevrawlensize + lensize
+	headersize int
+	// 内容的编码
+	encoding byte
+	// 节点的偏移量
+	p int
+}
+
+// 返回节点的编码，字符串编码只保留高2位
+func zipEntryEncoding(b byte) byte {
+	if b < ZIP_STR_MASK {
+		return b & ZIP_STR_MASK
+	}
+	return b
+}
+
+// 返回整数编码的内容所占的字节数
+func zipIntSize(encoding byte) int {
+	switch encoding {
+	case ZIP_INT_8B:
+		return 1
+	case ZIP_INT_16B:
+		return 2
+	case ZIP_INT_24B:
+		return 3
+	case ZIP_INT_32B:
+		return 4
+	case ZIP_INT_64B:
+		return 8
+	default:
+		// 4位立即数没有内容
+		return 0
+	}
+}
+
+// 将编码和字符串长度写入 buf，返回写入的字节数
+// buf 为nil时只返回需要的字节数
+func zipEncodeLength(buf []byte, encoding byte, rawlen int) int {
+	length := 1
+	var tmp [5]byte
+	if zipIsStr(encoding) {
+		if rawlen <= 0x3f {
+			tmp[0] = ZIP_STR_06B | byte(rawlen)
+		} else if rawlen <= 0x3fff {
+			length += 1
+			tmp[0] = ZIP_STR_14B | byte((rawlen>>8)&0x3f)
+			tmp[1] = byte(rawlen & 0xff)
+		} else {
+			length += 4
+			tmp[0] = ZIP_STR_32B
+			binary.BigEndian.PutUint32(tmp[1:], uint32(rawlen))
+		}
+	} else {
+		// 整数编码只需要1字节
+		tmp[0] = encoding
+	}
+	if buf != nil {
+		copy(buf, tmp[:length])
+	}
+	return length
+}
+
+// 解码 p 处的编码，返回编码、编码所占的字节数以及内容的长度
+func zipDecodeLength(zl []byte, p int) (encoding byte, lensize int, length int) {
+	encoding = zipEntryEncoding(zl[p])
+	if encoding < ZIP_STR_MASK {
+		switch encoding {
+		case ZIP_STR_06B:
+			return encoding, 1, int(zl[p] & 0x3f)
+		case ZIP_STR_14B:
+			return encoding, 2, int(zl[p]&0x3f)<<8 | int(zl[p+1])
+		default:
+			return encoding, 5, int(binary.BigEndian.Uint32(zl[p+1:]))
+		}
+	}
+	return encoding, 1, zipIntSize(encoding)
+}
+
+// 将前一个节点的长度 length 写入 buf，返回写入的字节数
+// buf 为nil时只返回需要的字节数
+func zipPrevEncodeLength(buf []byte, length int) int {
+	if buf == nil {
+		if length < ZIP_BIGLEN {
+			return 1
+		}
+		return 5
+	}
+	if length < ZIP_BIGLEN {
+		buf[0] = byte(length)
+		return 1
+	}
+	buf[0] = ZIP_BIGLEN
+	binary.LittleEndian.PutUint32(buf[1:], uint32(length))
+	return 5
+}
+
+// 使用5字节保存前一个节点的长度，即使长度可以用1字节保存
+// 用于避免级联更新时缩小节点
+func zipPrevEncodeLengthForceLarge(buf []byte, length int) {
+	buf[0] = ZIP_BIGLEN
+	binary.LittleEndian.PutUint32(buf[1:], uint32(length))
+}
+
+// 返回 p 处保存前一个节点长度所用的字节数
+func zipDecodePrevLenSize(zl []byte, p int) int {
+	if zl[p] < ZIP_BIGLEN {
+		return 1
+	}
+	return 5
+}
+
+// 返回 p 处保存前一个节点长度所用的字节数，以及前一个节点的长度
+func zipDecodePrevLen(zl []byte, p int) (prevlensize int, prevlen int) {
+	prevlensize = zipDecodePrevLenSize(zl, p)
+	if prevlensize == 1 {
+		return 1, int(zl[p])
+	}
+	return 5, int(binary.LittleEndian.Uint32(zl[p+1:]))
+}
+
+// 返回将 p 处前一个节点的长度改为 length 时，所需字节数的变化
+func zipPrevLenByteDiff(zl []byte, p int, length int) int {
+	prevlensize := zipDecodePrevLenSize(zl, p)
+	return zipPrevEncodeLength(nil, length) - prevlensize
+}
+
+// 返回 p 处节点占用的总字节数
+func zipRawEntryLength(zl []byte, p int) int {
+	prevlensize := zipDecodePrevLenSize(zl, p)
+	_, lensize, length := zipDecodeLength(zl, p+prevlensize)
+	return prevlensize + lensize + length
+}
+
+// 检查字符串能否编码为整数，可以时返回整数值及其编码
+func zipTryEncoding(entry []byte) (int64, byte, bool) {
+	if len(entry) >= 32 || len(entry) == 0 {
+		return 0, 0, false
+	}
+	value, ok := string2ll(entry)
+	if !ok {
+		return 0, 0, false
+	}
+	// 选择能保存该整数的最小编码
+	var encoding byte
+	switch {
+	case value >= 0 && value <= 12:
+		encoding = ZIP_INT_IMM_MIN + byte(value)
+	case value >= math.MinInt8 && value <= math.MaxInt8:
+		encoding = ZIP_INT_8B
+	case value >= math.MinInt16 && value <= math.MaxInt16:
+		encoding = ZIP_INT_16B
+	case value >= INT24_MIN && value <= INT24_MAX:
+		encoding = ZIP_INT_24B
+	case value >= math.MinInt32 && value <= math.MaxInt32:
+		encoding = ZIP_INT_32B
+	default:
+		encoding = ZIP_INT_64B
+	}
+	return value, encoding, true
+}
+
+// 按编码将整数写入 p 处
+func zipSaveInteger(zl []byte, p int, value int64, encoding byte) {
+	switch {
+	case encoding == ZIP_INT_8B:
+		zl[p] = byte(int8(value))
+	case encoding == ZIP_INT_16B:
+		binary.LittleEndian.PutUint16(zl[p:], uint16(int16(value)))
+	case encoding == ZIP_INT_24B:
+		// 保存 int32 小端序的低3字节
+		v := uint32(int32(value))
+		zl[p], zl[p+1], zl[p+2] = byte(v), byte(v>>8), byte(v>>16)
+	case encoding == ZIP_INT_32B:
+		binary.LittleEndian.PutUint32(zl[p:], uint32(int32(value)))
+	case encoding == ZIP_INT_64B:
+		binary.LittleEndian.PutUint64(zl[p:], uint64(value))
+	case encoding >= ZIP_INT_IMM_MIN && encoding <= ZIP_INT_IMM_MAX:
+		// 值保存在编码中，不需要写入
+	default:
+		panic("ziplist: invalid integer encoding")
+	}
+}
+
+// 按编码读取 p 处的整数
+func zipLoadInteger(zl []byte, p int, encoding byte) int64 {
+	switch {
+	case encoding == ZIP_INT_8B:
+		return int64(int8(zl[p]))
+	case encoding == ZIP_INT_16B:
+		return int64(int16(binary.LittleEndian.Uint16(zl[p:])))
+	case encoding == ZIP_INT_24B:
+		// 放到 int32 的高3字节，再算术右移进行符号扩展
+		v := uint32(zl[p])<<8 | uint32(zl[p+1])<<16 | uint32(zl[p+2])<<24
+		return int64(int32(v) >> 8)
+	case encoding == ZIP_INT_32B:
+		return int64(int32(binary.LittleEndian.Uint32(zl[p:])))
+	case encoding == ZIP_INT_64B:
+		return int64(binary.LittleEndian.Uint64(zl[p:]))
+	case encoding >= ZIP_INT_IMM_MIN && encoding <= ZIP_INT_IMM_MAX:
+		return int64(encoding&ZIP_INT_IMM_MASK) - 1
+	default:
+		panic("ziplist: invalid integer encoding")
+	}
+}
+
+// 解码 p 处的节点
+func zipEntry(zl []byte, p int) zlentry {
+	var e zlentry
+	e.prevrawlensize, e.prevrawlen = zipDecodePrevLen(zl, p)
+	e.encoding, e.lensize, e.len = zipDecodeLength(zl, p+e.prevrawlensize)
+	e.headersize = e.prevrawlensize + e.lensize
+	e.p = p
+	return e
+}
+
+// 创建一个空的压缩列表
+func ziplistNew() []byte {
+	n := ZIPLIST_HEADER_SIZE + 1
+	zl := make([]byte, n)
+	ziplistSetBytes(zl, n)
+	ziplistSetTailOffset(zl, ZIPLIST_HEADER_SIZE)
+	ziplistSetLength(zl, 0)
+	zl[n-1] = ZIP_END
+	return zl
+}
+
+// 调整压缩列表的大小为 n 字节，并写入新的结束标志
+func ziplistResize(zl []byte, n int) []byte {
+	if n <= cap(zl) {
+		zl = zl[:n]
+	} else {
+		newZl := make([]byte, n, n+n/2)
+		copy(newZl, zl)
+		zl = newZl
+	}
+	ziplistSetBytes(zl, n)
+	zl[n-1] = ZIP_END
+	return zl
+}
+
+// 级联更新
+//
+// 插入或删除节点后，后一个节点的 prevlen 可能需要从1字节扩展为5字节，
+// 这会使该节点的长度变化，进而需要更新它后面的节点，直到某个节点的 prevlen 不需要改变为止。
+// 为了避免节点反复扩展和缩小，prevlen 只会扩展，不会缩小。
+func ziplistCascadeUpdate(zl []byte, p int) []byte {
+	curlen := ziplistBytes(zl)
+	for zl[p] != ZIP_END {
+		cur := zipEntry(zl, p)
+		rawlen := cur.headersize + cur.len
+		rawlensize := zipPrevEncodeLength(nil, rawlen)
+
+		// 已经是最后一个节点
+		if zl[p+rawlen] == ZIP_END {
+			break
+		}
+		next := zipEntry(zl, p+rawlen)
+
+		// 后一个节点保存的长度没有变化，停止更新
+		if next.prevrawlen == rawlen {
+			break
+		}
+
+		if next.prevrawlensize < rawlensize {
+			// 后一个节点的 prevlen 需要扩展
+			extra := rawlensize - next.prevrawlensize
+			zl = ziplistResize(zl, curlen+extra)
+			np := p + rawlen
+
+			// 后一个节点不是最后一个节点时，需要更新表尾的偏移量
+			if ziplistTailOffset(zl) != np {
+				ziplistSetTailOffset(zl, ziplistTailOffset(zl)+extra)
+			}
+
+			// 移动后一个节点 prevlen 之后的数据
+			copy(zl[np+rawlensize:], zl[np+next.prevrawlensize:curlen-1])
+			zipPrevEncodeLength(zl[np:], rawlen)
+
+			// 继续检查再后一个节点
+			p += rawlen
+			curlen += extra
+		} else {
+			if next.prevrawlensize > rawlensize {
+				// 不缩小 prevlen，使用5字节保存较小的长度
+				zipPrevEncodeLengthForceLarge(zl[p+rawlen:], rawlen)
+			} else {
+				zipPrevEncodeLength(zl[p+rawlen:], rawlen)
+			}
+			// 后一个节点的长度没有变化，停止更新
+			break
+		}
+	}
+	return zl
+}
+
+// 从 p 开始删除 num 个节点
+func ziplistDeleteEntries(zl []byte, p int, num int) []byte {
+	first := zipEntry(zl, p)
+	deleted := 0
+	for i := 0; zl[p] != ZIP_END && i < num; i++ {
+		p += zipRawEntryLength(zl, p)
+		deleted++
+	}
+
+	totlen := p - first.p
+	if totlen <= 0 {
+		return zl
+	}
+
+	nextdiff := 0
+	bytesLen := ziplistBytes(zl)
+	if zl[p] != ZIP_END {
+		// 被删除节点之后的节点的 prevlen 需要改为第一个被删除节点的 prevlen，
+		// 所需的字节数可能变化，这部分空间从被删除的节点中借用或归还
+		nextdiff = zipPrevLenByteDiff(zl, p, first.prevrawlen)
+		p -= nextdiff
+		zipPrevEncodeLength(zl[p:], first.prevrawlen)
+
+		// 更新表尾的偏移量
+		ziplistSetTailOffset(zl, ziplistTailOffset(zl)-totlen)
+
+		// 之后的节点不是最后一个节点时，表尾的偏移量还需要加上 nextdiff
+		tail := zipEntry(zl, p)
+		if zl[p+tail.headersize+tail.len] != ZIP_END {
+			ziplistSetTailOffset(zl, ziplistTailOffset(zl)+nextdiff)
+		}
+
+		// 将之后的节点移动到被删除的位置
+		copy(zl[first.p:], zl[p:bytesLen-1])
+	} else {
+		// 删除到了表尾，第一个被删除节点的前一个节点成为新的表尾
+		ziplistSetTailOffset(zl, first.p-first.prevrawlen)
+	}
+
+	zl = ziplistResize(zl, bytesLen-totlen+nextdiff)
+	ziplistIncrLength(zl, -deleted)
+
+	// prevlen 的长度发生变化时，之后的节点可能需要级联更新
+	if nextdiff != 0 {
+		zl = ziplistCascadeUpdate(zl, first.p)
+	}
+	return zl
+}
+
+// 在 p 处插入节点 s
+func ziplistInsertAt(zl []byte, p int, s []byte) []byte {
+	curlen := ziplistBytes(zl)
+
+	// 找出新节点的前一个节点的长度
+	prevlen := 0
+	if zl[p] != ZIP_END {
+		_, prevlen = zipDecodePrevLen(zl, p)
+	} else {
+		ptail := ziplistEntryTail(zl)
+		if zl[ptail] != ZIP_END {
+			prevlen = zipRawEntryLength(zl, ptail)
+		}
+	}
+
+	// 计算新节点的长度
+	value, encoding, isInt := zipTryEncoding(s)
+	var reqlen int
+	if isInt {
+		reqlen = zipIntSize(encoding)
+	} else {
+		// 字符串编码，zipEncodeLength 只使用编码的高2位
+		encoding = ZIP_STR_06B
+		reqlen = len(s)
+	}
+	reqlen += zipPrevEncodeLength(nil, prevlen)
+	reqlen += zipEncodeLength(nil, encoding, len(s))
+
+	// 插入位置之后的节点的 prevlen 所需字节数的变化
+	nextdiff := 0
+	forcelarge := false
+	if zl[p] != ZIP_END {
+		nextdiff = zipPrevLenByteDiff(zl, p, reqlen)
+	}
+	// 新节点比较小，而后一个节点原先使用5字节保存 prevlen 时，
+	// 依然使用5字节保存，避免后一个节点缩小后空间不足
+	if nextdiff == -4 && reqlen < 4 {
+		nextdiff = 0
+		forcelarge = true
+	}
+
+	zl = ziplistResize(zl, curlen+reqlen+nextdiff)
+
+	if zl[p] != ZIP_END {
+		// 移动之后的节点，并更新后一个节点的 prevlen
+		copy(zl[p+reqlen:], zl[p-nextdiff:curlen-1])
+		if forcelarge {
+			zipPrevEncodeLengthForceLarge(zl[p+reqlen:], reqlen)
+		} else {
+			zipPrevEncodeLength(zl[p+reqlen:], reqlen)
+		}
+
+		// 更新表尾的偏移量
+		ziplistSetTailOffset(zl, ziplistTailOffset(zl)+reqlen)
+
+		// 后一个节点不是最后一个节点时，表尾的偏移量还需要加上 nextdiff
+		tail := zipEntry(zl, p+reqlen)
+		if zl[p+reqlen+tail.headersize+tail.len] != ZIP_END {
+			ziplistSetTailOffset(zl, ziplistTailOffset(zl)+nextdiff)
+		}
+	} else {
+		// 新节点成为表尾
+		ziplistSetTailOffset(zl, p)
+	}
+
+	// prevlen 的长度发生变化时，之后的节点可能需要级联更新
+	if nextdiff != 0 {
+		zl = ziplistCascadeUpdate(zl, p+reqlen)
+	}
+
+	// 写入新节点
+	q := p
+	q += zipPrevEncodeLength(zl[q:], prevlen)
+	q += zipEncodeLength(zl[q:], encoding, len(s))
+	if zipIsStr(encoding) {
+		copy(zl[q:], s)
+	} else {
+		zipSaveInteger(zl, q, value, encoding)
+	}
+	ziplistIncrLength(zl, 1)
+	return zl
+}
+
+// 将 s 添加到压缩列表的表头或表尾
+// where 为 ZIPLIST_HEAD 或 ZIPLIST_TAIL
+func ziplistPush(zl []byte, s []byte, where int) []byte {
+	var p int
+	if where == ZIPLIST_HEAD {
+		p = ziplistEntryHead(zl)
+	} else {
+		p = ziplistEntryEnd(zl)
+	}
+	return ziplistInsertAt(zl, p, s)
+}
+
+// 返回给定索引上的节点，索引可以为负数，-1 表示最后一个节点
+// 索引超出范围时返回 -1
+func ziplistIndex(zl []byte, index int) int {
+	var p int
+	if index < 0 {
+		index = (-index) - 1
+		p = ziplistEntryTail(zl)
+		if zl[p] != ZIP_END {
+			_, prevlen := zipDecodePrevLen(zl, p)
+			for prevlen > 0 && index > 0 {
+				index--
+				p -= prevlen
+				_, prevlen = zipDecodePrevLen(zl, p)
+			}
+		}
+	} else {
+		p = ziplistEntryHead(zl)
+		for zl[p] != ZIP_END && index > 0 {
+			index--
+			p += zipRawEntryLength(zl, p)
+		}
+	}
+	if zl[p] == ZIP_END || index > 0 {
+		return -1
+	}
+	return p
+}
+
+// 返回 p 的后一个节点，没有后一个节点时返回 -1
+func ziplistNext(zl []byte, p int) int {
+	if zl[p] == ZIP_END {
+		return -1
+	}
+	p += zipRawEntryLength(zl, p)
+	if zl[p] == ZIP_END {
+		return -1
+	}
+	return p
+}
+
+// 返回 p 的前一个节点，没有前一个节点时返回 -1
+// p 为结束标志时返回最后一个节点
+func ziplistPrev(zl []byte, p int) int {
+	if zl[p] == ZIP_END {
+		p = ziplistEntryTail(zl)
+		if zl[p] == ZIP_END {
+			return -1
+		}
+		return p
+	}
+	if p == ziplistEntryHead(zl) {
+		return -1
+	}
+	_, prevlen := zipDecodePrevLen(zl, p)
+	return p - prevlen
+}
+
+// 读取 p 处节点的值
+// 字符串编码时返回的 sval 不为nil，它与压缩列表共享内存，修改压缩列表后不能再使用；
+// 整数编码时 sval 为nil，值保存在 lval 中。
+// p 为 -1 或者结束标志时 ok 为false
+func ziplistGet(zl []byte, p int) (sval []byte, lval int64, ok bool) {
+	if p < 0 || zl[p] == ZIP_END {
+		return nil, 0, false
+	}
+	entry := zipEntry(zl, p)
+	q := p + entry.headersize
+	if zipIsStr(entry.encoding) {
+		return zl[q : q+entry.len : q+entry.len], 0, true
+	}
+	return nil, zipLoadInteger(zl, q, entry.encoding), true
+}
+
+// 在 p 处插入节点 s，原先 p 处及其之后的节点后移
+func ziplistInsert(zl []byte, p int, s []byte) []byte {
+	return ziplistInsertAt(zl, p, s)
+}
+
+// 删除 p 处的节点，返回新的压缩列表以及删除后 p 处的节点，
+// 可以在遍历时删除节点后继续从返回的位置遍历
+func ziplistDelete(zl []byte, p int) ([]byte, int) {
+	zl = ziplistDeleteEntries(zl, p, 1)
+	return zl, p
+}
+
+// 从索引 index 开始删除 num 个节点
+func ziplistDeleteRange(zl []byte, index int, num int) []byte {
+	p := ziplistIndex(zl, index)
+	if p < 0 {
+		return zl
+	}
+	return ziplistDeleteEntries(zl, p, num)
+}
+
+// 将 second 的所有节点追加到 first 之后，返回合并后的压缩列表
+// second 不会被修改，合并后 first 只能使用返回值
+func ziplistMerge(first []byte, second []byte) []byte {
+	if ziplistLength(second) == 0 {
+		return first
+	}
+	if ziplistLength(first) == 0 {
+		return append([]byte(nil), second...)
+	}
+
+	firstBytes, secondBytes := ziplistBytes(first), ziplistBytes(second)
+	firstTail, secondTail := ziplistTailOffset(first), ziplistTailOffset(second)
+	length := ziplistLength(first) + ziplistLength(second)
+	if length > math.MaxUint16 {
+		length = math.MaxUint16
+	}
+
+	// 去掉 first 的结束标志以及 second 的头部
+	zl := ziplistResize(first, firstBytes+secondBytes-ZIPLIST_HEADER_SIZE-1)
+	copy(zl[firstBytes-1:], second[ZIPLIST_HEADER_SIZE:secondBytes])
+	ziplistSetLength(zl, length)
+	ziplistSetTailOffset(zl, firstBytes-1-ZIPLIST_HEADER_SIZE+secondTail)
+
+	// second 原先的第一个节点的 prevlen 为0，需要更新为 first 最后一个节点的长度
+	return ziplistCascadeUpdate(zl, firstTail)
+}
+
+// 比较 p 处节点的值与 s 是否相等
+func ziplistCompare(zl []byte, p int, s []byte) bool {
+	if zl[p] == ZIP_END {
+		return false
+	}
+	entry := zipEntry(zl, p)
+	q := p + entry.headersize
+	if zipIsStr(entry.encoding) {
+		return entry.len == len(s) && bytes.Equal(zl[q:q+entry.len], s)
+	}
+	// 整数编码时，s 同样可以编码为整数才可能相等
+	if sval, _, ok := zipTryEncoding(s); ok {
+		return zipLoadInteger(zl, q, entry.encoding) == sval
+	}
+	return false
+}
+
+// 从 p 开始查找值为 vstr 的节点，每比较一个节点后跳过 skip 个节点
+// 例如哈希对象中键和值交替保存，查找键时 skip 为1
+// 找不到时返回 -1
+func ziplistFind(zl []byte, p int, vstr []byte, skip int) int {
+	skipcnt := 0
+	// vstr 转换为整数的结果，只在需要时转换一次
+	var vll int64
+	vconverted, vIsInt := false, false
+
+	for zl[p] != ZIP_END {
+		prevlensize := zipDecodePrevLenSize(zl, p)
+		encoding, lensize, length := zipDecodeLength(zl, p+prevlensize)
+		q := p + prevlensize + lensize
+
+		if skipcnt == 0 {
+			if zipIsStr(encoding) {
+				if length == len(vstr) && bytes.Equal(zl[q:q+length], vstr) {
+					return p
+				}
+			} else {
+				if !vconverted {
+					vll, _, vIsInt = zipTryEncoding(vstr)
+					vconverted = true
+				}
+				if vIsInt && zipLoadInteger(zl, q, encoding) == vll {
+					return p
+				}
+			}
+			// 重置跳过的节点数
+			skipcnt = skip
+		} else {
+			skipcnt--
+		}
+		p = q + length
+	}
+	return -1
+}
+
+// 返回压缩列表的节点数量
+func ziplistLen(zl []byte) int {
+	if n := ziplistLength(zl); n < math.MaxUint16 {
+		return n
+	}
+	// 节点数量超出了 zllen 的范围，需要遍历统计
+	n := 0
+	for p := ziplistEntryHead(zl); zl[p] != ZIP_END; p += zipRawEntryLength(zl, p) {
+		n++
+	}
+	// 数量恢复到可以保存的范围时写回头部
+	if n < math.MaxUint16 {
+		ziplistSetLength(zl, n)
+	}
+	return n
+}
+
+// 返回压缩列表占用的字节数
+func ziplistBlobLen(zl []byte) int {
+	return ziplistBytes(zl)
+}
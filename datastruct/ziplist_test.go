@@ -0,0 +1,389 @@
+package datastruct
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+// 检查压缩列表的结构是否正确，并返回其中的所有值
+func checkZiplist(t *testing.T, zl []byte) [][]byte {
+	t.Helper()
+	if ziplistBytes(zl) != len(zl) || zl[len(zl)-1] != ZIP_END {
+		t.Fatalf("zlbytes %d, len %d", ziplistBytes(zl), len(zl))
+	}
+	var values [][]byte
+	prevlen, tail := 0, ZIPLIST_HEADER_SIZE
+	for p := ziplistEntryHead(zl); zl[p] != ZIP_END; p += zipRawEntryLength(zl, p) {
+		entry := zipEntry(zl, p)
+		if entry.prevrawlen != prevlen {
+			t.Fatalf("entry at %d: prevlen %d, want %d", p, entry.prevrawlen, prevlen)
+		}
+		prevlen, tail = entry.headersize+entry.len, p
+		values = append(values, ziplistValue(zl, p))
+	}
+	if ziplistTailOffset(zl) != tail {
+		t.Fatalf("zltail %d, want %d", ziplistTailOffset(zl), tail)
+	}
+	if ziplistLen(zl) != len(values) {
+		t.Fatalf("zllen %d, want %d", ziplistLen(zl), len(values))
+	}
+	return values
+}
+
+// 以字符串形式返回 p 处节点的值
+func ziplistValue(zl []byte, p int) []byte {
+	sval, lval, _ := ziplistGet(zl, p)
+	if sval != nil {
+		return sval
+	}
+	return []byte(strconv.FormatInt(lval, 10))
+}
+
+func checkZiplistValues(t *testing.T, zl []byte, want [][]byte) {
+	t.Helper()
+	got := checkZiplist(t, zl)
+	if len(got) != len(want) {
+		t.Fatalf("got %d entries, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !bytes.Equal(got[i], want[i]) {
+			t.Fatalf("entry %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+	// 反向遍历
+	i := len(want) - 1
+	for p := ziplistIndex(zl, -1); p >= 0; p = ziplistPrev(zl, p) {
+		if !bytes.Equal(ziplistValue(zl, p), want[i]) {
+			t.Fatalf("backward entry %d = %q, want %q", i, ziplistValue(zl, p), want[i])
+		}
+		i--
+	}
+	if i != -1 {
+		t.Fatalf("backward stopped at %d", i)
+	}
+}
+
+func TestZiplistLayout(t *testing.T) {
+	zl := ziplistNew()
+	if !bytes.Equal(zl, []byte{0x0b, 0, 0, 0, 0x0a, 0, 0, 0, 0, 0, 0xff}) {
+		t.Fatalf("empty ziplist % x", zl)
+	}
+
+	// 与 Redis ziplist.c 中的示例相同
+	zl = ziplistPush(zl, []byte("2"), ZIPLIST_TAIL)
+	zl = ziplistPush(zl, []byte("5"), ZIPLIST_TAIL)
+	want := []byte{0x0f, 0, 0, 0, 0x0c, 0, 0, 0, 0x02, 0, 0x00, 0xf3, 0x02, 0xf6, 0xff}
+	if !bytes.Equal(zl, want) {
+		t.Fatalf("got % x, want % x", zl, want)
+	}
+
+	zl = ziplistPush(zl, []byte("Hello World"), ZIPLIST_TAIL)
+	want = append([]byte{0x1c, 0, 0, 0, 0x0e, 0, 0, 0, 0x03, 0, 0x00, 0xf3, 0x02, 0xf6, 0x02, 0x0b},
+		append([]byte("Hello World"), 0xff)...)
+	if !bytes.Equal(zl, want) {
+		t.Fatalf("got % x, want % x", zl, want)
+	}
+}
+
+func TestZiplistIntegerEncoding(t *testing.T) {
+	tests := []struct {
+		value   int64
+		content []byte
+	}{
+		{0, []byte{0xf1}},
+		{12, []byte{0xfd}},
+		{13, []byte{0xfe, 13}},
+		{-1, []byte{0xfe, 0xff}},
+		{math.MaxInt8 + 1, []byte{0xc0, 0x80, 0x00}},
+		{math.MinInt16, []byte{0xc0, 0x00, 0x80}},
+		{0x123456, []byte{0xf0, 0x56, 0x34, 0x12}},
+		{INT24_MIN, []byte{0xf0, 0x00, 0x00, 0x80}},
+		{INT24_MAX + 1, []byte{0xd0, 0x00, 0x00, 0x80, 0x00}},
+		{math.MinInt32, []byte{0xd0, 0x00, 0x00, 0x00, 0x80}},
+		{math.MaxInt64, []byte{0xe0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f}},
+		{math.MinInt64, []byte{0xe0, 0, 0, 0, 0, 0, 0, 0, 0x80}},
+	}
+	for _, tt := range tests {
+		zl := ziplistPush(ziplistNew(), []byte(strconv.FormatInt(tt.value, 10)), ZIPLIST_TAIL)
+		p := ziplistIndex(zl, 0)
+		if got := zl[p+1 : len(zl)-1]; !bytes.Equal(got, tt.content) {
+			t.Errorf("%d encoded as % x, want % x", tt.value, got, tt.content)
+		}
+		if sval, lval, ok := ziplistGet(zl, p); !ok || sval != nil || lval != tt.value {
+			t.Errorf("%d loaded as %q, %d", tt.value, sval, lval)
+		}
+	}
+
+	// 不能严格转换为整数的字符串按字符串保存
+	for _, s := range []string{"+1", "01", " 1", "-0", "9223372036854775808", ""} {
+		zl := ziplistPush(ziplistNew(), []byte(s), ZIPLIST_TAIL)
+		if sval, _, ok := ziplistGet(zl, ziplistIndex(zl, 0)); !ok || sval == nil || string(sval) != s {
+			t.Errorf("%q loaded as %q", s, sval)
+		}
+	}
+}
+
+func TestZiplistStringEncoding(t *testing.T) {
+	for _, n := range []int{0, 63, 64, 16383, 16384, 70000} {
+		s := bytes.Repeat([]byte{'x'}, n)
+		zl := ziplistPush(ziplistNew(), s, ZIPLIST_TAIL)
+		zl = ziplistPush(zl, []byte("tail"), ZIPLIST_TAIL)
+		checkZiplistValues(t, zl, [][]byte{s, []byte("tail")})
+	}
+}
+
+func TestZiplistIndexNextPrev(t *testing.T) {
+	zl := ziplistNew()
+	if ziplistIndex(zl, 0) != -1 || ziplistIndex(zl, -1) != -1 {
+		t.Fatal("index on empty ziplist")
+	}
+	if ziplistPrev(zl, ziplistEntryEnd(zl)) != -1 {
+		t.Fatal("prev on empty ziplist")
+	}
+	for _, s := range []string{"hello", "foo", "quux", "1024"} {
+		zl = ziplistPush(zl, []byte(s), ZIPLIST_TAIL)
+	}
+
+	tests := []struct {
+		index int
+		want  string
+	}{
+		{0, "hello"}, {3, "1024"}, {-1, "1024"}, {-4, "hello"}, {4, ""}, {-5, ""},
+	}
+	for _, tt := range tests {
+		p := ziplistIndex(zl, tt.index)
+		if tt.want == "" {
+			if p != -1 {
+				t.Errorf("index %d = %d, want -1", tt.index, p)
+			}
+			continue
+		}
+		if got := string(ziplistValue(zl, p)); got != tt.want {
+			t.Errorf("index %d = %q, want %q", tt.index, got, tt.want)
+		}
+	}
+
+	if ziplistNext(zl, ziplistIndex(zl, -1)) != -1 {
+		t.Error("next of tail")
+	}
+	if ziplistPrev(zl, ziplistIndex(zl, 0)) != -1 {
+		t.Error("prev of head")
+	}
+	if p := ziplistPrev(zl, ziplistEntryEnd(zl)); p != ziplistIndex(zl, -1) {
+		t.Error("prev of end")
+	}
+	if _, _, ok := ziplistGet(zl, -1); ok {
+		t.Error("get on -1")
+	}
+}
+
+func TestZiplistDelete(t *testing.T) {
+	values := [][]byte{[]byte("hello"), []byte("foo"), []byte("quux"), []byte("1024")}
+	newZl := func() []byte {
+		zl := ziplistNew()
+		for _, v := range values {
+			zl = ziplistPush(zl, v, ZIPLIST_TAIL)
+		}
+		return zl
+	}
+
+	// 遍历时删除
+	zl := newZl()
+	p := ziplistIndex(zl, 0)
+	for p >= 0 {
+		if ziplistCompare(zl, p, []byte("foo")) || ziplistCompare(zl, p, []byte("1024")) {
+			zl, p = ziplistDelete(zl, p)
+			if zl[p] == ZIP_END {
+				p = -1
+			}
+			continue
+		}
+		p = ziplistNext(zl, p)
+	}
+	checkZiplistValues(t, zl, [][]byte{values[0], values[2]})
+
+	tests := []struct {
+		index, num int
+		want       [][]byte
+	}{
+		{0, 1, values[1:]},
+		{1, 2, [][]byte{values[0], values[3]}},
+		{-2, 5, values[:2]},
+		{0, 4, nil},
+		{5, 1, values},
+	}
+	for _, tt := range tests {
+		checkZiplistValues(t, ziplistDeleteRange(newZl(), tt.index, tt.num), tt.want)
+	}
+}
+
+func TestZiplistFindCompare(t *testing.T) {
+	// 与哈希对象一样，键和值交替保存
+	zl := ziplistNew()
+	for _, s := range []string{"name", "redis", "10", "name", "version", "10"} {
+		zl = ziplistPush(zl, []byte(s), ZIPLIST_TAIL)
+	}
+	head := ziplistIndex(zl, 0)
+
+	if p := ziplistFind(zl, head, []byte("10"), 1); p != ziplistIndex(zl, 2) {
+		t.Errorf("find key 10 = %d", p)
+	}
+	if p := ziplistFind(zl, ziplistIndex(zl, 3), []byte("10"), 1); p != ziplistIndex(zl, 5) {
+		t.Errorf("find key 10 from 3 = %d", p)
+	}
+	if p := ziplistFind(zl, ziplistIndex(zl, 3), []byte("version"), 1); p != -1 {
+		t.Errorf("find value version as key = %d", p)
+	}
+	if p := ziplistFind(zl, head, []byte("name"), 1); p != head {
+		t.Errorf("find key name = %d", p)
+	}
+	if p := ziplistFind(zl, head, []byte("name"), 0); p != head {
+		t.Errorf("find name = %d", p)
+	}
+	if p := ziplistFind(zl, head, []byte("redis"), 1); p != -1 {
+		t.Errorf("find value as key = %d", p)
+	}
+	if p := ziplistFind(zl, head, []byte("010"), 0); p != -1 {
+		t.Errorf("find 010 = %d", p)
+	}
+
+	p := ziplistIndex(zl, 2)
+	if !ziplistCompare(zl, p, []byte("10")) || ziplistCompare(zl, p, []byte("010")) || ziplistCompare(zl, p, []byte("11")) {
+		t.Error("compare integer entry")
+	}
+	if !ziplistCompare(zl, head, []byte("name")) || ziplistCompare(zl, head, []byte("nam")) {
+		t.Error("compare string entry")
+	}
+	if ziplistCompare(zl, ziplistEntryEnd(zl), []byte("")) {
+		t.Error("compare end")
+	}
+}
+
+func TestZiplistCascadeUpdate(t *testing.T) {
+	// 每个节点长度为253字节(1字节 prevlen + 2字节编码 + 250字节内容)，
+	// 在表头插入一个长节点后，之后的每个节点的 prevlen 都需要扩展为5字节
+	var want [][]byte
+	zl := ziplistNew()
+	for i := 0; i < 10; i++ {
+		v := bytes.Repeat([]byte{byte('a' + i)}, 250)
+		zl = ziplistPush(zl, v, ZIPLIST_TAIL)
+		want = append(want, v)
+	}
+	checkZiplistValues(t, zl, want)
+
+	big := bytes.Repeat([]byte{'z'}, 300)
+	zl = ziplistPush(zl, big, ZIPLIST_HEAD)
+	want = append([][]byte{big}, want...)
+	checkZiplistValues(t, zl, want)
+
+	// 删除长节点后 prevlen 不会缩小
+	zl = ziplistDeleteRange(zl, 0, 1)
+	want = want[1:]
+	checkZiplistValues(t, zl, want)
+	if zipDecodePrevLenSize(zl, ziplistIndex(zl, 1)) != 5 {
+		t.Error("prevlen should not shrink")
+	}
+
+	// 在5字节 prevlen 的节点前插入小节点
+	zl = ziplistInsert(zl, ziplistIndex(zl, 1), []byte("1"))
+	want = append([][]byte{want[0], []byte("1")}, want[1:]...)
+	checkZiplistValues(t, zl, want)
+}
+
+func TestZiplistRandom(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	randValue := func() []byte {
+		switch r.Intn(4) {
+		case 0:
+			return []byte(strconv.FormatInt(r.Int63n(1<<40)-1<<39, 10))
+		case 1:
+			return []byte(strconv.Itoa(r.Intn(30) - 10))
+		default:
+			// 包含 prevlen 在 254 附近的长度
+			n := r.Intn(300)
+			b := make([]byte, n)
+			for i := range b {
+				b[i] = byte('a' + r.Intn(26))
+			}
+			return b
+		}
+	}
+
+	zl := ziplistNew()
+	var want [][]byte
+	for i := 0; i < 3000; i++ {
+		switch op := r.Intn(10); {
+		case op < 3:
+			v := randValue()
+			zl = ziplistPush(zl, v, ZIPLIST_HEAD)
+			want = append([][]byte{v}, want...)
+		case op < 6:
+			v := randValue()
+			zl = ziplistPush(zl, v, ZIPLIST_TAIL)
+			want = append(want, v)
+		case op < 8 && len(want) > 0:
+			v := randValue()
+			i := r.Intn(len(want))
+			zl = ziplistInsert(zl, ziplistIndex(zl, i), v)
+			want = append(want[:i], append([][]byte{v}, want[i:]...)...)
+		case len(want) > 0:
+			i, n := r.Intn(len(want)), r.Intn(3)+1
+			zl = ziplistDeleteRange(zl, i, n)
+			want = append(want[:i], want[min(i+n, len(want)):]...)
+		}
+		if i%50 == 0 {
+			checkZiplistValues(t, zl, want)
+		}
+	}
+	checkZiplistValues(t, zl, want)
+}
+
+func TestZiplistLenOverflow(t *testing.T) {
+	zl := ziplistNew()
+	n := math.MaxUint16 + 10
+	for i := 0; i < n; i++ {
+		zl = ziplistPush(zl, []byte("1"), ZIPLIST_TAIL)
+	}
+	if ziplistLength(zl) != math.MaxUint16 || ziplistLen(zl) != n {
+		t.Fatalf("zllen %d, len %d", ziplistLength(zl), ziplistLen(zl))
+	}
+	zl = ziplistDeleteRange(zl, 0, 20)
+	if ziplistLen(zl) != n-20 || ziplistLength(zl) != n-20 {
+		t.Fatalf("zllen %d, len %d", ziplistLength(zl), ziplistLen(zl))
+	}
+	if ziplistBlobLen(zl) != len(zl) {
+		t.Fatalf("blob len %d, len %d", ziplistBlobLen(zl), len(zl))
+	}
+}
+
+func TestZiplistMerge(t *testing.T) {
+	build := func(values ...[]byte) []byte {
+		zl := ziplistNew()
+		for _, v := range values {
+			zl = ziplistPush(zl, v, ZIPLIST_TAIL)
+		}
+		return zl
+	}
+	long := bytes.Repeat([]byte("x"), 300)
+	first := [][]byte{[]byte("a"), []byte("123"), long}
+	second := [][]byte{[]byte("b"), []byte("-5"), []byte("c")}
+
+	// first 的最后一个节点超过 254 字节，second 的第一个节点的 prevlen 需要扩展为5字节
+	zl := ziplistMerge(build(first...), build(second...))
+	checkZiplistValues(t, zl, append(append([][]byte{}, first...), second...))
+
+	zl = ziplistMerge(build(second...), build(first...))
+	checkZiplistValues(t, zl, append(append([][]byte{}, second...), first...))
+
+	// 与空的压缩列表合并
+	checkZiplistValues(t, ziplistMerge(ziplistNew(), build(first...)), first)
+	checkZiplistValues(t, ziplistMerge(build(first...), ziplistNew()), first)
+
+	// second 不会被修改
+	s := build(second...)
+	ziplistMerge(build(first...), s)
+	checkZiplistValues(t, s, second)
+}
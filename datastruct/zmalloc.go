@@ -0,0 +1,187 @@
+/*
+字节缓冲区分配器
+与 Redis 的 zmalloc 类似，负责 sds 的内存分配，并统计已分配的内存大小(used_memory)
+
+请求的大小会向上取整到与 jemalloc 相近的大小级别(size class)，
+不超过 ZMALLOC_POOL_MAX_SIZE 的缓冲区在释放后会放入对应级别的缓冲池中，供之后的分配复用，
+以减少频繁写入时的内存分配和 GC 压力。
+
+分配的大小级别记录在缓冲区的容量中，zmalloc 返回的缓冲区容量总是等于它的大小级别，
+zfree 根据容量更新 used_memory 并放入对应的缓冲池，不需要额外记录每个缓冲区。
+与 C 的 free 一样，只能释放由 zmalloc 返回的完整缓冲区，并且只能释放一次；
+容量不是大小级别的切片一定不是由 zmalloc 分配的，会被忽略。
+没有被释放的缓冲区由 GC 回收，但仍然计入 used_memory，与 C 中的内存泄漏相同。
+*/
+package datastruct
+
+import (
+	"fmt"
+	"math/bits"
+	"sync"
+	"sync/atomic"
+)
+
+// 最小的大小级别
+const ZMALLOC_MIN_SIZE = 8
+
+// 按 16 字节对齐的最大大小，之后每翻一倍划分 4 个级别
+const ZMALLOC_QUANTUM_MAX = 128
+
+// 使用缓冲池复用的最大大小，超过的缓冲区释放后交给 GC 回收
+const ZMALLOC_POOL_MAX_SIZE = 64 * 1024
+
+// 超过缓冲池大小的分配按页大小对齐
+const ZMALLOC_PAGE_SIZE = 4096
+
+// 已分配的内存总量
+var used_memory atomic.Int64
+
+// 分配和释放的次数，以及从缓冲池中复用的次数
+var zmalloc_allocs atomic.Int64
+var zmalloc_frees atomic.Int64
+var zmalloc_pool_hits atomic.Int64
+
+// 各个大小级别的缓冲池，以 zmallocPoolIndex 的结果为索引
+var zmalloc_pools = newZmallocPools()
+
+func newZmallocPools() []sync.Pool {
+	return make([]sync.Pool, zmallocPoolIndex(ZMALLOC_POOL_MAX_SIZE)+1)
+}
+
+// 返回分配 size 个字节时实际分配的大小
+//
+// 8 字节以下为 8，128 字节以下按 16 字节对齐，
+// 之后每个 2 的 N 次方区间 (2^n, 2^(n+1)] 等分为 4 个级别，例如 160、192、224、256，
+// 超过 ZMALLOC_POOL_MAX_SIZE 时按页大小对齐
+func zmallocSize(size int) int {
+	if size <= ZMALLOC_MIN_SIZE {
+		return ZMALLOC_MIN_SIZE
+	}
+	if size <= ZMALLOC_QUANTUM_MAX {
+		return (size + 15) &^ 15
+	}
+	if size > ZMALLOC_POOL_MAX_SIZE {
+		return (size + ZMALLOC_PAGE_SIZE - 1) &^ (ZMALLOC_PAGE_SIZE - 1)
+	}
+	// size 所在区间的下界 2^n，级别间隔为 2^n / 4
+	group := 1 << (bits.Len(uint(size-1)) - 1)
+	step := group / 4
+	return (size + step - 1) &^ (step - 1)
+}
+
+// 返回大小级别对应的缓冲池索引，size 必须是 zmallocSize 返回的值
+func zmallocPoolIndex(size int) int {
+	if size <= ZMALLOC_QUANTUM_MAX {
+		// 8, 16, 32, ..., 128 依次为 0 ~ 8
+		return size / 16
+	}
+	// 128 之后每个区间 4 个级别
+	n := bits.Len(uint(size-1)) - 1
+	step := (1 << n) / 4
+	return ZMALLOC_QUANTUM_MAX/16 + (n-7)*4 + (size-(1<<n))/step
+}
+
+// 分配一个长度为 size 的缓冲区，容量为 size 对应的大小级别
+// 缓冲区的内容是未定义的，可能是之前使用时留下的数据
+func zmalloc(size int) []byte {
+	alloc := zmallocSize(size)
+	used_memory.Add(int64(alloc))
+	zmalloc_allocs.Add(1)
+	if alloc <= ZMALLOC_POOL_MAX_SIZE {
+		if p, ok := zmalloc_pools[zmallocPoolIndex(alloc)].Get().(*[]byte); ok {
+			zmalloc_pool_hits.Add(1)
+			return (*p)[:size]
+		}
+	}
+	return make([]byte, size, alloc)
+}
+
+// 分配一个长度为 size 并且内容全部为0的缓冲区
+func zcalloc(size int) []byte {
+	buf := zmalloc(size)
+	clear(buf)
+	return buf
+}
+
+// 释放由 zmalloc 分配的缓冲区，放入缓冲池供之后的分配复用
+// 与 C 中一样，缓冲区释放后不能再使用，buf 必须是 zmalloc 返回的完整缓冲区，不能是子切片，也不能重复释放
+func zfree(buf []byte) {
+	zfreeGeneric(buf, true)
+}
+
+// 释放由 zmalloc 分配的缓冲区，但不放入缓冲池，缓冲区由 GC 回收
+// 用于其它切片可能仍然引用着的缓冲区，例如 sdsMakeRoomFor 中扩容前的 sds
+func zfreeNoReuse(buf []byte) {
+	zfreeGeneric(buf, false)
+}
+
+func zfreeGeneric(buf []byte, reuse bool) {
+	alloc := cap(buf)
+	// 容量不是大小级别的切片不是由 zmalloc 分配的
+	if buf == nil || zmallocSize(alloc) != alloc {
+		return
+	}
+	used_memory.Add(-int64(alloc))
+	zmalloc_frees.Add(1)
+	if reuse && alloc <= ZMALLOC_POOL_MAX_SIZE {
+		buf = buf[:0]
+		zmalloc_pools[zmallocPoolIndex(alloc)].Put(&buf)
+	}
+}
+
+// 返回已分配的内存总量
+func zmallocUsedMemory() int64 {
+	return used_memory.Load()
+}
+
+// 分配器的统计信息
+type ZmallocStats struct {
+	// 已分配的内存总量
+	UsedMemory int64
+	// 分配次数
+	Allocs int64
+	// 释放次数
+	Frees int64
+	// 从缓冲池中复用缓冲区的次数
+	PoolHits int64
+}
+
+// 返回分配器的统计信息
+func zmallocGetStats() ZmallocStats {
+	return ZmallocStats{
+		UsedMemory: used_memory.Load(),
+		Allocs:     zmalloc_allocs.Load(),
+		Frees:      zmalloc_frees.Load(),
+		PoolHits:   zmalloc_pool_hits.Load(),
+	}
+}
+
+// 以 INFO memory 的格式输出统计信息
+func (stats ZmallocStats) String() string {
+	return fmt.Sprintf("used_memory:%d\r\n"+
+		"used_memory_human:%s\r\n"+
+		"mem_allocs:%d\r\n"+
+		"mem_frees:%d\r\n"+
+		"mem_pool_hits:%d\r\n",
+		stats.UsedMemory, bytesToHuman(stats.UsedMemory),
+		stats.Allocs, stats.Frees, stats.PoolHits)
+}
+
+// 将字节数转换为便于阅读的形式，例如 1.50K、2.00M，与 Redis 的 bytesToHuman 相同
+func bytesToHuman(n int64) string {
+	d := float64(n)
+	switch {
+	case n < 1024:
+		return fmt.Sprintf("%dB", n)
+	case n < 1024*1024:
+		return fmt.Sprintf("%.2fK", d/1024)
+	case n < 1024*1024*1024:
+		return fmt.Sprintf("%.2fM", d/(1024*1024))
+	case n < 1024*1024*1024*1024:
+		return fmt.Sprintf("%.2fG", d/(1024*1024*1024))
+	case n < 1024*1024*1024*1024*1024:
+		return fmt.Sprintf("%.2fT", d/(1024*1024*1024*1024))
+	default:
+		return fmt.Sprintf("%.2fP", d/(1024*1024*1024*1024*1024))
+	}
+}
@@ -0,0 +1,142 @@
+package datastruct
+
+import (
+	"testing"
+)
+
+func TestZmallocSize(t *testing.T) {
+	tests := []struct {
+		size, want int
+	}{
+		{0, 8},
+		{8, 8},
+		{9, 16},
+		{100, 112},
+		{128, 128},
+		{129, 160},
+		{257, 320},
+		{1000, 1024},
+		{1025, 1280},
+		{ZMALLOC_POOL_MAX_SIZE, ZMALLOC_POOL_MAX_SIZE},
+		{ZMALLOC_POOL_MAX_SIZE + 1, ZMALLOC_POOL_MAX_SIZE + ZMALLOC_PAGE_SIZE},
+	}
+	for _, tt := range tests {
+		if got := zmallocSize(tt.size); got != tt.want {
+			t.Errorf("zmallocSize(%d) = %d, want %d", tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestZmallocPoolIndex(t *testing.T) {
+	// 各个大小级别的索引应当是连续的
+	want := 0
+	for size := 1; size <= ZMALLOC_POOL_MAX_SIZE; size++ {
+		class := zmallocSize(size)
+		if class != size {
+			continue
+		}
+		if got := zmallocPoolIndex(class); got != want {
+			t.Fatalf("zmallocPoolIndex(%d) = %d, want %d", class, got, want)
+		}
+		want++
+	}
+	if want != len(zmalloc_pools) {
+		t.Errorf("error, %d size classes, %d pools", want, len(zmalloc_pools))
+	}
+}
+
+func TestZmallocUsedMemory(t *testing.T) {
+	before := zmallocUsedMemory()
+	s := sdsNew("hello")
+	if got := zmallocUsedMemory() - before; got != 8 {
+		t.Errorf("error, used %d after sdsNew", got)
+	}
+	s = sdsCat(s, " world, this string needs more room")
+	if got := zmallocUsedMemory() - before; got != int64(sdsAllocSize(s)) {
+		t.Errorf("error, used %d, alloc size %d", got, sdsAllocSize(s))
+	}
+	s = sdsRemoveFreeSpace(s)
+	if got := zmallocUsedMemory() - before; got != int64(sdsAllocSize(s)) {
+		t.Errorf("error, used %d, alloc size %d", got, sdsAllocSize(s))
+	}
+	sdsFree(s)
+	if got := zmallocUsedMemory() - before; got != 0 {
+		t.Errorf("error, used %d after sdsFree", got)
+	}
+}
+
+func TestZmallocReuse(t *testing.T) {
+	buf := zmalloc(100)
+	copy(buf, "junk")
+	zfree(buf)
+	// 复用的缓冲区应当清零
+	s := sdsNewLen(nil, 100)
+	for i, c := range s {
+		if c != 0 {
+			t.Fatalf("error, s[%d] = %d", i, c)
+		}
+	}
+	if cap(s) != 112 {
+		t.Errorf("error, cap %d", cap(s))
+	}
+	sdsFree(s)
+}
+
+func TestZfreeSizeClass(t *testing.T) {
+	before := zmallocGetStats()
+
+	// 容量不是大小级别的切片不是由 zmalloc 分配的，会被忽略
+	zfree(make([]byte, 0, 100))
+	zfree(nil)
+	if got := zmallocGetStats(); got.UsedMemory != before.UsedMemory || got.Frees != before.Frees {
+		t.Errorf("error, used %d frees %d", got.UsedMemory-before.UsedMemory, got.Frees-before.Frees)
+	}
+
+	// 释放时按容量记录的大小级别更新 used_memory
+	bufs := [][]byte{zmalloc(5), zmalloc(200), zmalloc(ZMALLOC_POOL_MAX_SIZE + 1)}
+	for _, buf := range bufs {
+		if cap(buf) != zmallocSize(len(buf)) {
+			t.Errorf("error, len %d cap %d", len(buf), cap(buf))
+		}
+	}
+	for _, buf := range bufs {
+		zfree(buf)
+	}
+	if got := zmallocGetStats(); got.UsedMemory != before.UsedMemory || got.Frees-before.Frees != 3 {
+		t.Errorf("error, used %d frees %d", got.UsedMemory-before.UsedMemory, got.Frees-before.Frees)
+	}
+}
+
+func TestSdsMakeRoomForAlias(t *testing.T) {
+	before := zmallocUsedMemory()
+	s := sdsNew("alias")
+	alias := s
+	s = sdsMakeRoomFor(s, 100)
+	// 扩容前的空间不会被复用
+	other := sdsNew("other")
+	if string(alias) != "alias" {
+		t.Errorf("error, alias overwritten: %q", alias)
+	}
+	sdsFree(s)
+	sdsFree(other)
+	if got := zmallocUsedMemory() - before; got != 0 {
+		t.Errorf("error, used %d", got)
+	}
+}
+
+func TestBytesToHuman(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{100, "100B"},
+		{1536, "1.50K"},
+		{2 * 1024 * 1024, "2.00M"},
+		{3 * 1024 * 1024 * 1024, "3.00G"},
+	}
+	for _, tt := range tests {
+		if got := bytesToHuman(tt.n); got != tt.want {
+			t.Errorf("bytesToHuman(%d) = %s, want %s", tt.n, got, tt.want)
+		}
+	}
+}